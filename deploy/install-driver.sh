@@ -14,7 +14,7 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-# using example: ./install-driver.sh [local|master|any remote branch] [snapshot,hostprocess]
+# using example: ./install-driver.sh [local|master|any remote branch] [snapshot,hostprocess,lvmthin]
 
 set -euo pipefail
 
@@ -53,6 +53,14 @@ if [[ "$#" -gt 1 ]]; then
     kubectl apply -f $repo/csi-snapshot-controller.yaml
   fi
 
+  if [[ "$2" == *"lvmthin"* ]]; then
+    echo "install LVM thin pool volume driver ..."
+    kubectl apply -f $repo/csi-azuredisk-lvmthin-driver.yaml
+    kubectl apply -f $repo/rbac-csi-azuredisk-lvmthin.yaml
+    kubectl apply -f $repo/csi-azuredisk-lvmthin-node.yaml
+    kubectl apply -f $repo/csi-azuredisk-lvmthin-controller.yaml
+  fi
+
   if [[ "$2" == *"csi-proxy"* ]]; then
     windowsMode="csi-proxy"
   fi
@@ -36,6 +36,10 @@ fi
 echo "Uninstalling Azure Disk CSI driver, version: $ver ..."
 
 kubectl delete -f $repo/csi-snapshot-controller.yaml --ignore-not-found
+kubectl delete -f $repo/csi-azuredisk-lvmthin-controller.yaml --ignore-not-found
+kubectl delete -f $repo/csi-azuredisk-lvmthin-node.yaml --ignore-not-found
+kubectl delete -f $repo/csi-azuredisk-lvmthin-driver.yaml --ignore-not-found
+kubectl delete -f $repo/rbac-csi-azuredisk-lvmthin.yaml --ignore-not-found
 kubectl delete -f $repo/csi-azuredisk-controller.yaml --ignore-not-found
 kubectl delete -f $repo/csi-azuredisk-node.yaml --ignore-not-found
 if [[ "${WINDOWS_USE_HOST_PROCESS_CONTAINERS:=false}" == "true" ]]; then
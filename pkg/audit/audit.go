@@ -0,0 +1,307 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes an HMAC chained JSON lines record of the mutating cloud operations of the driver.
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+const (
+	// Stdout is the path which makes the audit log write to stdout
+	Stdout = "-"
+	// RedactedValue replaces the values of redacted parameters
+	RedactedValue = "***redacted***"
+)
+
+// outcomes of an operation
+const (
+	OutcomeSucceeded  = "succeeded"
+	OutcomeFailed     = "failed"
+	OutcomeInProgress = "inProgress"
+)
+
+// defaultRedactedKeys are redacted in addition to the configured keys, a parameter is
+// redacted if its lower cased key contains one of them
+var defaultRedactedKeys = []string{"secret", "password", "token"}
+
+// Record is one line of the audit log
+type Record struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Outcome   string    `json:"outcome"`
+	// DurationSeconds is the time from the start of the operation to its end
+	DurationSeconds float64 `json:"durationSeconds"`
+	// ResourceIDs are the ARM resource IDs the operation worked on
+	ResourceIDs           []string          `json:"resourceIDs,omitempty"`
+	Node                  string            `json:"node,omitempty"`
+	PVC                   string            `json:"pvc,omitempty"`
+	PV                    string            `json:"pv,omitempty"`
+	VolumeSnapshot        string            `json:"volumeSnapshot,omitempty"`
+	VolumeSnapshotContent string            `json:"volumeSnapshotContent,omitempty"`
+	Parameters            map[string]string `json:"parameters,omitempty"`
+	// PreviousHash is the Hash of the previous record, so that removing or changing a record breaks the chain
+	PreviousHash string `json:"previousHash"`
+	// Hash is the hex encoded HMAC-SHA256 of PreviousHash and the JSON encoding of the record without Hash,
+	// keyed so that a record can not be rewritten with a matching chain without the key
+	Hash string `json:"hash"`
+}
+
+// Logger writes audit records, a nil *Logger discards them
+type Logger struct {
+	mu         sync.Mutex
+	out        io.Writer
+	closer     io.Closer
+	redactKeys []string
+	key        []byte
+	lastHash   string
+	clock      clock.Clock
+}
+
+// errEmptyKey is returned for an empty HMAC key
+var errEmptyKey = errors.New("the HMAC key of the audit log is empty")
+
+// NewLogger returns a Logger which appends to the file at path, or writes to stdout if path is Stdout.
+// The records are chained with an HMAC keyed by key. Parameters whose key contains one of redactKeys,
+// "secret", "password" or "token" are redacted.
+func NewLogger(path string, key []byte, redactKeys []string) (*Logger, error) {
+	if len(key) == 0 {
+		return nil, errEmptyKey
+	}
+	if path == Stdout {
+		return newLogger(os.Stdout, nil, key, "", redactKeys), nil
+	}
+	lastHash, err := readLastHash(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return newLogger(f, f, key, lastHash, redactKeys), nil
+}
+
+func newLogger(out io.Writer, closer io.Closer, key []byte, lastHash string, redactKeys []string) *Logger {
+	keys := append([]string{}, defaultRedactedKeys...)
+	for _, key := range redactKeys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return &Logger{out: out, closer: closer, redactKeys: keys, key: key, lastHash: lastHash, clock: clock.RealClock{}}
+}
+
+// readLastHash returns the hash of the last record of an existing audit log, so that the chain continues across restarts
+func readLastHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var last string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	if last == "" {
+		return "", nil
+	}
+	var record Record
+	if err := json.Unmarshal([]byte(last), &record); err != nil {
+		return "", fmt.Errorf("failed to parse the last record of audit log %s: %w", path, err)
+	}
+	return record.Hash, nil
+}
+
+// Close closes the audit log file
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Operation is a mutating operation in progress
+type Operation struct {
+	logger *Logger
+	start  time.Time
+	record Record
+}
+
+// Start starts recording an operation, parameters are the CSI parameters or volume context of the request,
+// the identities of the PVC, PV and VolumeSnapshot are read from them
+func (l *Logger) Start(operation string, parameters map[string]string) *Operation {
+	if l == nil {
+		return nil
+	}
+	o := &Operation{
+		logger: l,
+		start:  l.clock.Now(),
+		record: Record{
+			Operation:             operation,
+			PV:                    parameters[consts.PvNameKey],
+			VolumeSnapshotContent: parameters[consts.VolumeSnapshotContentNameKey],
+			Parameters:            l.redact(parameters),
+		},
+	}
+	if name := parameters[consts.PvcNameKey]; name != "" {
+		o.record.PVC = parameters[consts.PvcNamespaceKey] + "/" + name
+	}
+	if name := parameters[consts.VolumeSnapshotNameKey]; name != "" {
+		o.record.VolumeSnapshot = parameters[consts.VolumeSnapshotNamespaceKey] + "/" + name
+	}
+	return o
+}
+
+// SetNode sets the node of an attach or detach
+func (o *Operation) SetNode(node string) {
+	if o != nil {
+		o.record.Node = node
+	}
+}
+
+// End writes the record of the operation with its outcome and the ARM resource IDs it worked on
+func (o *Operation) End(outcome string, resourceIDs ...string) {
+	if o == nil {
+		return
+	}
+	for _, id := range resourceIDs {
+		if id != "" {
+			o.record.ResourceIDs = append(o.record.ResourceIDs, id)
+		}
+	}
+	o.record.Outcome = outcome
+	o.logger.write(&o.record, o.start)
+}
+
+// Outcome returns OutcomeSucceeded or OutcomeFailed
+func Outcome(succeeded bool) string {
+	if succeeded {
+		return OutcomeSucceeded
+	}
+	return OutcomeFailed
+}
+
+func (l *Logger) redact(parameters map[string]string) map[string]string {
+	if len(parameters) == 0 {
+		return nil
+	}
+	redacted := make(map[string]string, len(parameters))
+	for k, v := range parameters {
+		redacted[k] = v
+		lower := strings.ToLower(k)
+		for _, key := range l.redactKeys {
+			if strings.Contains(lower, key) {
+				redacted[k] = RedactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+func (l *Logger) write(record *Record, start time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	record.Time = now.UTC()
+	record.DurationSeconds = now.Sub(start).Seconds()
+	record.PreviousHash = l.lastHash
+	record.Hash = ""
+	record.Hash = hashRecord(l.key, record)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		klog.Errorf("failed to marshal audit record of %s: %v", record.Operation, err)
+		return
+	}
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		klog.Errorf("failed to write audit record of %s: %v", record.Operation, err)
+		return
+	}
+	l.lastHash = record.Hash
+}
+
+// hashRecord returns the HMAC of record keyed by key, the Hash of record must be empty
+func hashRecord(key []byte, record *Record) string {
+	data, _ := json.Marshal(record)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(record.PreviousHash))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the HMAC chain of the audit log read from r with key and returns the number of records,
+// or an error naming the first record which was changed, removed or reordered
+func Verify(r io.Reader, key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, errEmptyKey
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	count := 0
+	previous := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		count++
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return count, fmt.Errorf("record %d is not valid: %w", count, err)
+		}
+		if count > 1 && record.PreviousHash != previous {
+			return count, fmt.Errorf("record %d does not follow the previous record", count)
+		}
+		hash := record.Hash
+		record.Hash = ""
+		if !hmac.Equal([]byte(hashRecord(key, &record)), []byte(hash)) {
+			return count, fmt.Errorf("record %d was modified", count)
+		}
+		previous = hash
+	}
+	return count, scanner.Err()
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+var testKey = []byte("audit-key")
+
+func readRecords(t *testing.T, data []byte) []Record {
+	var records []Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record Record
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestOperation(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := newLogger(buf, nil, testKey, "", []string{" diskEncryptionSetID ", ""})
+	fakeClock := clocktesting.NewFakeClock(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	logger.clock = fakeClock
+
+	op := logger.Start("controller_create_volume", map[string]string{
+		consts.PvcNameKey:      "pvc",
+		consts.PvcNamespaceKey: "default",
+		consts.PvNameKey:       "pv",
+		"skuName":              "Premium_LRS",
+		"diskEncryptionSetID":  "des",
+		"storageAccountToken":  "token",
+	})
+	fakeClock.Step(2 * time.Second)
+	op.End(Outcome(true), "diskURI", "")
+
+	op = logger.Start("controller_publish_volume", nil)
+	op.SetNode("node")
+	op.End(Outcome(false), "diskURI")
+
+	records := readRecords(t, buf.Bytes())
+	require.Len(t, records, 2)
+	assert.Equal(t, "controller_create_volume", records[0].Operation)
+	assert.Equal(t, OutcomeSucceeded, records[0].Outcome)
+	assert.Equal(t, 2.0, records[0].DurationSeconds)
+	assert.Equal(t, []string{"diskURI"}, records[0].ResourceIDs)
+	assert.Equal(t, "default/pvc", records[0].PVC)
+	assert.Equal(t, "pv", records[0].PV)
+	assert.Equal(t, "Premium_LRS", records[0].Parameters["skuName"])
+	assert.Equal(t, RedactedValue, records[0].Parameters["diskEncryptionSetID"])
+	assert.Equal(t, RedactedValue, records[0].Parameters["storageAccountToken"])
+	assert.Equal(t, "", records[0].PreviousHash)
+
+	assert.Equal(t, OutcomeFailed, records[1].Outcome)
+	assert.Equal(t, "node", records[1].Node)
+	assert.Nil(t, records[1].Parameters)
+	assert.Equal(t, records[0].Hash, records[1].PreviousHash)
+
+	count, err := Verify(bytes.NewReader(buf.Bytes()), testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestVerify(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := newLogger(buf, nil, testKey, "", nil)
+	for _, operation := range []string{"controller_create_volume", "controller_expand_volume", "controller_delete_volume"} {
+		logger.Start(operation, nil).End(OutcomeSucceeded, "diskURI")
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+
+	tests := []struct {
+		desc          string
+		lines         []string
+		expectedCount int
+		expectedErr   string
+	}{
+		{
+			desc:          "intact log",
+			lines:         lines,
+			expectedCount: 3,
+		},
+		{
+			desc:          "modified record",
+			lines:         []string{lines[0], strings.Replace(lines[1], "controller_expand_volume", "controller_modify_volume", 1), lines[2]},
+			expectedCount: 2,
+			expectedErr:   "record 2 was modified",
+		},
+		{
+			desc:          "removed record",
+			lines:         []string{lines[0], lines[2]},
+			expectedCount: 2,
+			expectedErr:   "record 2 does not follow the previous record",
+		},
+		{
+			desc:          "record rewritten without the key",
+			lines:         []string{lines[0], rehash(t, lines[1], []byte("another-key"))},
+			expectedCount: 2,
+			expectedErr:   "record 2 was modified",
+		},
+		{
+			desc:          "invalid record",
+			lines:         []string{lines[0], "{"},
+			expectedCount: 2,
+			expectedErr:   "record 2 is not valid",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			count, err := Verify(strings.NewReader(strings.Join(test.lines, "\n")), testKey)
+			assert.Equal(t, test.expectedCount, count)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+// rehash recomputes the hash of the record line with key
+func rehash(t *testing.T, line string, key []byte) string {
+	var record Record
+	require.NoError(t, json.Unmarshal([]byte(line), &record))
+	record.Hash = ""
+	record.Hash = hashRecord(key, &record)
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestNewLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	logger, err := NewLogger(path, testKey, nil)
+	require.NoError(t, err)
+	logger.Start("controller_create_snapshot", map[string]string{
+		consts.VolumeSnapshotNameKey:        "snapshot",
+		consts.VolumeSnapshotNamespaceKey:   "default",
+		consts.VolumeSnapshotContentNameKey: "content",
+	}).End(OutcomeInProgress, "diskURI", "snapshotURI")
+	assert.NoError(t, logger.Close())
+
+	// the hash chain continues after the log is reopened
+	logger, err = NewLogger(path, testKey, nil)
+	require.NoError(t, err)
+	logger.Start("controller_delete_snapshot", nil).End(OutcomeSucceeded, "snapshotURI")
+	assert.NoError(t, logger.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	records := readRecords(t, data)
+	require.Len(t, records, 2)
+	assert.Equal(t, "default/snapshot", records[0].VolumeSnapshot)
+	assert.Equal(t, "content", records[0].VolumeSnapshotContent)
+	assert.Equal(t, OutcomeInProgress, records[0].Outcome)
+	assert.Equal(t, []string{"diskURI", "snapshotURI"}, records[0].ResourceIDs)
+	assert.Equal(t, records[0].Hash, records[1].PreviousHash)
+
+	count, err := Verify(bytes.NewReader(data), testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = Verify(bytes.NewReader(data), []byte("another-key"))
+	assert.EqualError(t, err, "record 1 was modified")
+	_, err = NewLogger(path, nil, nil)
+	assert.Equal(t, errEmptyKey, err)
+
+	// an existing log which is not an audit log is refused
+	assert.NoError(t, os.WriteFile(path, []byte("not json\n"), 0600))
+	_, err = NewLogger(path, testKey, nil)
+	assert.Error(t, err)
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	op := logger.Start("controller_delete_volume", map[string]string{"key": "value"})
+	assert.Nil(t, op)
+	op.SetNode("node")
+	op.End(OutcomeSucceeded, "diskURI")
+	assert.NoError(t, logger.Close())
+}
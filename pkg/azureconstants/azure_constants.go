@@ -21,6 +21,7 @@ import (
 )
 
 const (
+	AllowFormatWithExistingDataField  = "allowformatwithexistingdata"
 	AzureDiskCSIDriverName            = "azuredisk_csi_driver"
 	CachingModeField                  = "cachingmode"
 	DefaultAzureCredentialFileEnv     = "AZURE_CREDENTIAL_FILE"
@@ -33,14 +34,28 @@ const (
 	DiskIOPSReadWriteField            = "diskiopsreadwrite"
 	DiskMBPSReadWriteField            = "diskmbpsreadwrite"
 	DiskNameField                     = "diskname"
+	DiskSizeBytesField                = "disksizebytes"
+	DiskUniqueIDField                 = "diskuniqueid"
 	EnableBurstingField               = "enablebursting"
 	ErrDiskNotFound                   = "not found"
+	FormatOptionsField                = "formatoptions"
+	FsckPolicyField                   = "fsckpolicy"
+	FsckPolicyNone                    = "none"
+	FsckPolicyCheck                   = "check"
+	FsckPolicyRepair                  = "repair"
 	FsTypeField                       = "fstype"
+	HostEncryptionField               = "hostencryption"
+	HostEncryptionNone                = "none"
+	HostEncryptionLUKS                = "luks"
 	IncrementalField                  = "incremental"
 	KindField                         = "kind"
 	LocationField                     = "location"
 	LogicalSectorSizeField            = "logicalsectorsize"
 	LUN                               = "LUN"
+	LUKSPassphraseKey                 = "luksPassphrase"
+	LVMThinPoolField                  = "lvmthinpool"
+	LVMThinPoolPool                   = "pool"
+	LVMThinPoolVolume                 = "volume"
 	MaxSharesField                    = "maxshares"
 	MinimumDiskSizeGiB                = 1
 	NetworkAccessPolicyField          = "networkaccesspolicy"
@@ -56,6 +71,7 @@ const (
 	PvcNamespaceTag                   = "kubernetes.io-created-for-pvc-namespace"
 	PvcNameTag                        = "kubernetes.io-created-for-pvc-name"
 	PvNameTag                         = "kubernetes.io-created-for-pv-name"
+	ReadOnlyRemountRecoveryField      = "readonlyremountrecovery"
 	SnapshotNamespaceTag              = "kubernetes.io-created-for-snapshot-namespace"
 	SnapshotNameTag                   = "kubernetes.io-created-for-snapshot-name"
 	PvNameKey                         = "csi.storage.k8s.io/pv/name"
@@ -75,6 +91,11 @@ const (
 	SourceVolume                      = "volume"
 	StandardSsdAccountPrefix          = "standardssd"
 	StorageAccountTypeField           = "storageaccounttype"
+	StripeCountField                  = "stripecount"
+	StripeLUNs                        = "stripeLUNs"
+	StripeDiskSizeBytes               = "stripeDiskSizeBytes"
+	StripeDiskUniqueIDs               = "stripeDiskUniqueIDs"
+	MaxStripeCount                    = 16
 	TagsField                         = "tags"
 	GetDiskThrottlingKey              = "getdiskthrottlingKey"
 	CheckDiskLunThrottlingKey         = "checkdisklunthrottlingKey"
@@ -82,6 +103,7 @@ const (
 	FalseValue                        = "false"
 	UserAgentField                    = "useragent"
 	VolumeAttributePartition          = "partition"
+	VolumeAttributePartitionAuto      = "auto"
 	WellKnownTopologyKey              = "topology.kubernetes.io/zone"
 	InstanceTypeKey                   = "node.kubernetes.io/instance-type"
 	WriteAcceleratorEnabled           = "writeacceleratorenabled"
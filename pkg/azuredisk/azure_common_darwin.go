@@ -38,7 +38,7 @@ const sysClassBlockPath = "/sys/class/block/"
 func scsiHostRescan(io azureutils.IOHandler, m *mount.SafeFormatAndMount) {
 }
 
-func formatAndMount(source, target, fstype string, options []string, m *mount.SafeFormatAndMount) error {
+func formatAndMount(source, target, fstype string, options, _ []string, m *mount.SafeFormatAndMount) error {
 	return nil
 }
 
@@ -69,6 +69,31 @@ func getDevicePathWithMountPath(mountPath string, m *mount.SafeFormatAndMount) (
 	return devicePath, nil
 }
 
+// getDeviceWWID is not supported, the device is only verified by its size
+func getDeviceWWID(_ azureutils.IOHandler, _ string) string {
+	return ""
+}
+
+// getDiskSignatures is not supported
+func getDiskSignatures(_ string, _ *mount.SafeFormatAndMount) ([]string, error) {
+	return nil, nil
+}
+
+// isFilesystemDirty is not supported
+func isFilesystemDirty(_, _ string, _ *mount.SafeFormatAndMount) (bool, error) {
+	return false, nil
+}
+
+// deviceInUse is not supported, the device is reported in use
+func deviceInUse(_ string) (bool, error) {
+	return true, nil
+}
+
+// checkFilesystem is not supported
+func checkFilesystem(_ context.Context, _, fstype string, _ bool, _ *mount.SafeFormatAndMount) (fsckResult, string, error) {
+	return "", "", fmt.Errorf("checking %s filesystems is not supported", fstype)
+}
+
 func getBlockSizeBytes(devicePath string, m *mount.SafeFormatAndMount) (int64, error) {
 	output, err := m.Exec.Command("blockdev", "--getsize64", devicePath).Output()
 	if err != nil {
@@ -122,3 +147,7 @@ func rescanAllVolumes(io azureutils.IOHandler) error {
 func (d *Driver) GetVolumeStats(ctx context.Context, m *mount.SafeFormatAndMount, volumeID, target string, hostutil hostUtil) ([]*csi.VolumeUsage, error) {
 	return []*csi.VolumeUsage{}, nil
 }
+
+func getPartitionDisk(_ azureutils.IOHandler, _ string) (string, string, bool, error) {
+	return "", "", false, nil
+}
@@ -21,11 +21,15 @@ package azuredisk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
@@ -33,10 +37,33 @@ import (
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/volume"
 	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
 )
 
-const sysClassBlockPath = "/sys/class/block/"
+const (
+	sysClassBlockPath = "/sys/class/block/"
+	sysClassNVMePath  = "/sys/class/nvme/"
+	// azureNVMeRemoteDiskModel is the model of the NVMe controller exposing the remote disks,
+	// local NVMe disks are exposed by "Microsoft NVMe Direct Disk" controllers
+	azureNVMeRemoteDiskModel = "MSFT NVMe Accelerator"
+	// nvmeDataDiskNamespaceOffset maps a data disk LUN to its NVMe namespace ID, namespace 1 is the OS disk
+	nvmeDataDiskNamespaceOffset = 2
+	// exit codes of e2fsck and xfs_repair
+	e2fsckErrorsCorrected       = 1
+	e2fsckErrorsCorrectedReboot = 2
+	e2fsckErrorsUncorrected     = 4
+	xfsRepairErrors             = 1
+	// xfs_repair exits with 2 if the log has to be replayed by mounting the filesystem first
+	xfsRepairDirtyLog = 2
+)
+
+// nvmeNamespaceRegex matches NVMe namespaces and their partitions, e.g. nvme0n3 and nvme0n3p1
+var nvmeNamespaceRegex = regexp.MustCompile(`^(nvme[0-9]+)n[0-9]+(p[0-9]+)?$`)
+
+// nvmeNamespacePathRegex matches the path of a controller to a namespace with native NVMe multipath, e.g. nvme0c1n3,
+// capturing the subsystem and namespace instances of the block device of the namespace, e.g. nvme0n3
+var nvmeNamespacePathRegex = regexp.MustCompile(`^nvme([0-9]+)c[0-9]+n([0-9]+)$`)
 
 // exclude those used by azure as resource and OS root in /dev/disk/azure, /dev/disk/azure/scsi0
 // "/dev/disk/azure/scsi0" dir is populated in Standard_DC4s/DC2s on Ubuntu 18.04
@@ -94,6 +121,80 @@ func scsiHostRescan(io azureutils.IOHandler, _ *mount.SafeFormatAndMount) {
 	} else {
 		klog.Warningf("failed to read %s, err %v", scsiPath, err)
 	}
+	rescanNVMeControllers(io)
+}
+
+// listAzureNVMeControllers lists the NVMe controllers of the remote disks under /sys/class/nvme
+func listAzureNVMeControllers(io azureutils.IOHandler) []string {
+	var controllers []string
+	dirs, err := io.ReadDir(sysClassNVMePath)
+	if err != nil {
+		klog.V(6).Infof("failed to read %s, err %v", sysClassNVMePath, err)
+		return nil
+	}
+	for _, f := range dirs {
+		name := f.Name()
+		modelBytes, err := io.ReadFile(filepath.Join(sysClassNVMePath, name, "model"))
+		if err != nil {
+			klog.V(4).Infof("failed to read model of NVMe controller %s, err: %v", name, err)
+			continue
+		}
+		if model := strings.TrimSpace(string(modelBytes)); !strings.HasPrefix(model, azureNVMeRemoteDiskModel) {
+			klog.V(6).Infof("NVMe controller %s is not a remote disk controller, got model %s", name, model)
+			continue
+		}
+		controllers = append(controllers, name)
+	}
+	return controllers
+}
+
+// findNVMeDiskByLun finds the NVMe namespace of the data disk on lun, e.g. /dev/nvme0n3 for lun 1,
+// a controller lists either its namespaces or, with native NVMe multipath, its paths to them
+func findNVMeDiskByLun(lun int, io azureutils.IOHandler) (string, error) {
+	nsid := lun + nvmeDataDiskNamespaceOffset
+	for _, controller := range listAzureNVMeControllers(io) {
+		controllerPath := filepath.Join(sysClassNVMePath, controller)
+		dirs, err := io.ReadDir(controllerPath)
+		if err != nil {
+			klog.Warningf("failed to read %s, err %v", controllerPath, err)
+			continue
+		}
+		for _, f := range dirs {
+			name := f.Name()
+			device := name
+			if match := nvmeNamespacePathRegex.FindStringSubmatch(name); match != nil {
+				// the path has no block device, the namespace is accessed through the one of the subsystem
+				device = fmt.Sprintf("nvme%sn%s", match[1], match[2])
+			} else if match := nvmeNamespaceRegex.FindStringSubmatch(name); match == nil || match[2] != "" {
+				continue
+			}
+			nsidBytes, err := io.ReadFile(filepath.Join(controllerPath, name, "nsid"))
+			if err != nil {
+				klog.Errorf("failed to read namespace ID of %s, err: %v", name, err)
+				continue
+			}
+			id, err := strconv.Atoi(strings.TrimSpace(string(nsidBytes)))
+			if err != nil {
+				klog.Errorf("failed to parse namespace ID of %s, err: %v", name, err)
+				continue
+			}
+			if id == nsid {
+				klog.V(4).Infof("azureDisk - found NVMe namespace %s with ID %d by lun %d", device, nsid, lun)
+				return "/dev/" + device, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no NVMe namespace with ID %d found", nsid)
+}
+
+// rescanNVMeControllers rescans the namespaces of the NVMe controllers of the remote disks
+func rescanNVMeControllers(io azureutils.IOHandler) {
+	for _, controller := range listAzureNVMeControllers(io) {
+		name := filepath.Join(sysClassNVMePath, controller, "rescan_controller")
+		if err := io.WriteFile(name, []byte("1"), 0666); err != nil {
+			klog.Warningf("failed to rescan NVMe controller %s", name)
+		}
+	}
 }
 
 func findDiskByLun(lun int, io azureutils.IOHandler, _ *mount.SafeFormatAndMount) (string, error) {
@@ -103,28 +204,33 @@ func findDiskByLun(lun int, io azureutils.IOHandler, _ *mount.SafeFormatAndMount
 		return device, nil
 	}
 
+	// data disks of newer VM sizes are NVMe namespaces instead of SCSI devices
+	if device, nvmeErr := findNVMeDiskByLun(lun, io); nvmeErr == nil {
+		return device, nil
+	} else if err == nil {
+		err = nvmeErr
+	}
+
 	devPaths := []string{
 		fmt.Sprintf("/dev/disk/azure/scsi1/lun%d", lun),
 		fmt.Sprintf("/dev/disk/azure/data/by-lun/%d", lun),
 	}
 	klog.Warningf("failed to find disk by lun %d, err %v, fall back to search in following device path: %s", lun, err, devPaths)
 	for _, devPath := range devPaths {
-		if _, err := os.Stat(devPath); err == nil {
-			if device, err := io.Readlink(devPath); err == nil {
-				klog.V(2).Infof("found device path %s linked to %s by lun %d", devPath, device, lun)
-				return devPath, nil
-			}
+		if device, err := io.Readlink(devPath); err == nil {
+			klog.V(2).Infof("found device path %s linked to %s by lun %d", devPath, device, lun)
+			return devPath, nil
 		}
 	}
 	return "", fmt.Errorf("failed to find disk by lun %d", lun)
 }
 
-func formatAndMount(source, target, fstype string, options []string, m *mount.SafeFormatAndMount) error {
+func formatAndMount(source, target, fstype string, options, formatOptions []string, m *mount.SafeFormatAndMount) error {
 	if newOptions, exists := azureutils.RemoveOptionIfExists(options, "directmount"); exists {
 		klog.V(2).Infof("formatAndMount - skip format for %s, old options: %v, new options: %v", target, options, newOptions)
 		return m.Mount(source, target, fstype, newOptions)
 	}
-	return m.FormatAndMount(source, target, fstype, options)
+	return m.FormatAndMountSensitiveWithFormatOptions(source, target, fstype, options, nil, formatOptions)
 }
 
 // finds a device mounted to "current" node
@@ -241,6 +347,141 @@ func getDevicePathWithMountPath(mountPath string, m *mount.SafeFormatAndMount) (
 	return devicePath, nil
 }
 
+// getDiskSignatures probes the filesystem, partition table, RAID and other data signatures on a device,
+// blkid reports a single signature and wipefs lists all of them if blkid finds several
+func getDiskSignatures(devicePath string, m *mount.SafeFormatAndMount) ([]string, error) {
+	output, err := m.Exec.Command("blkid", "-p", "-o", "export", devicePath).CombinedOutput()
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) {
+			switch exitErr.ExitStatus() {
+			case blkidExitNothingFound:
+				return nil, nil
+			case blkidExitAmbivalent:
+				return getAllDiskSignatures(devicePath, m)
+			}
+		}
+		return nil, fmt.Errorf("failed to probe signatures of %s: output: %s, err: %v", devicePath, string(output), err)
+	}
+
+	var signatures []string
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found || value == "" {
+			continue
+		}
+		switch key {
+		case "TYPE":
+			signatures = append(signatures, value)
+		case "PTTYPE":
+			signatures = append(signatures, value+" partition table")
+		}
+	}
+	return signatures, nil
+}
+
+// getAllDiskSignatures lists every signature wipefs finds on a device without erasing any
+func getAllDiskSignatures(devicePath string, m *mount.SafeFormatAndMount) ([]string, error) {
+	output, err := m.Exec.Command("wipefs", "--no-act", "--noheadings", "--output", "TYPE", devicePath).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signatures of %s: output: %s, err: %v", devicePath, string(output), err)
+	}
+	var signatures []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if signature := strings.TrimSpace(line); signature != "" && !slices.Contains(signatures, signature) {
+			signatures = append(signatures, signature)
+		}
+	}
+	return signatures, nil
+}
+
+// isFilesystemDirty returns whether the filesystem on devicePath was not unmounted cleanly or has recorded errors,
+// only ext filesystems keep the state in their superblock
+func isFilesystemDirty(devicePath, fstype string, m *mount.SafeFormatAndMount) (bool, error) {
+	if !strings.HasPrefix(fstype, "ext") {
+		return false, nil
+	}
+	output, err := m.Exec.Command("dumpe2fs", "-h", devicePath).CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to read the superblock of %s: output: %s, err: %v", devicePath, string(output), err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Filesystem state":
+			if value != "clean" {
+				return true, nil
+			}
+		case "Filesystem features":
+			// the journal was not replayed since the filesystem was last mounted
+			if slices.Contains(strings.Fields(value), "needs_recovery") {
+				return true, nil
+			}
+		case "FS Error count":
+			if count, err := strconv.Atoi(value); err == nil && count > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// deviceInUse returns whether a mount or another process holds devicePath, which fails an exclusive open of a block device
+func deviceInUse(devicePath string) (bool, error) {
+	fd, err := syscall.Open(devicePath, syscall.O_RDONLY|syscall.O_EXCL|syscall.O_CLOEXEC, 0)
+	if errors.Is(err, syscall.EBUSY) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s exclusively: %w", devicePath, err)
+	}
+	return false, syscall.Close(fd)
+}
+
+// checkFilesystem runs e2fsck or xfs_repair on devicePath, read-only unless repair is set
+func checkFilesystem(ctx context.Context, devicePath, fstype string, repair bool, m *mount.SafeFormatAndMount) (fsckResult, string, error) {
+	var cmd string
+	var args []string
+	switch {
+	case strings.HasPrefix(fstype, "ext"):
+		cmd, args = "e2fsck", []string{"-f", "-n", devicePath}
+		if repair {
+			args[1] = "-y"
+		}
+	case fstype == "xfs":
+		cmd, args = "xfs_repair", []string{"-n", devicePath}
+		if repair {
+			args = args[1:]
+		}
+	default:
+		return "", "", fmt.Errorf("checking %s filesystems is not supported", fstype)
+	}
+
+	output, err := m.Exec.CommandContext(ctx, cmd, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return fsckResultTimeout, string(output), ctx.Err()
+	}
+	if err == nil {
+		return fsckResultClean, string(output), nil
+	}
+	var exitErr utilexec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fsckResultFailed, string(output), err
+	}
+	switch status := exitErr.ExitStatus(); {
+	case cmd == "e2fsck" && repair && (status == e2fsckErrorsCorrected || status == e2fsckErrorsCorrectedReboot):
+		return fsckResultRepaired, string(output), nil
+	case cmd == "e2fsck" && status == e2fsckErrorsUncorrected,
+		cmd == "xfs_repair" && (status == xfsRepairErrors || status == xfsRepairDirtyLog):
+		return fsckResultErrors, string(output), nil
+	}
+	return fsckResultFailed, string(output), err
+}
+
 func getBlockSizeBytes(devicePath string, m *mount.SafeFormatAndMount) (int64, error) {
 	output, err := m.Exec.Command("blockdev", "--getsize64", devicePath).Output()
 	if err != nil {
@@ -265,16 +506,38 @@ func needResizeVolume(devicePath, volumePath string, m *mount.SafeFormatAndMount
 }
 
 // rescanVolume rescan device for detecting device size expansion
-// devicePath e.g. `/dev/sdc`
+// devicePath e.g. `/dev/sdc`, or `/dev/nvme0n3` whose controller is rescanned
 func rescanVolume(io azureutils.IOHandler, devicePath string) error {
 	klog.V(6).Infof("rescanVolume - begin to rescan %s", devicePath)
 	deviceName := filepath.Base(devicePath)
+	if match := nvmeNamespaceRegex.FindStringSubmatch(deviceName); match != nil {
+		rescanPath := filepath.Join(sysClassNVMePath, match[1], "rescan_controller")
+		return io.WriteFile(rescanPath, []byte("1"), 0666)
+	}
 	rescanPath := filepath.Join(sysClassBlockPath, deviceName, "device/rescan")
 	return io.WriteFile(rescanPath, []byte("1"), 0666)
 }
 
+// getPartitionDisk returns the disk and the number of the partition devicePath, isPartition is false if it is not a partition
+func getPartitionDisk(io azureutils.IOHandler, devicePath string) (disk, number string, isPartition bool, err error) {
+	name := filepath.Base(devicePath)
+	data, err := io.ReadFile(filepath.Join(sysClassBlockPath, name, "partition"))
+	if err != nil {
+		// only partitions have a partition attribute
+		return "", "", false, nil
+	}
+	// e.g. ../../devices/.../block/sdc/sdc1
+	link, err := io.Readlink(filepath.Join(sysClassBlockPath, name))
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to find disk of partition %s: %v", devicePath, err)
+	}
+	return filepath.Join("/dev", filepath.Base(filepath.Dir(link))), strings.TrimSpace(string(data)), true, nil
+}
+
 // rescanAllVolumes rescan all sd* devices under /sys/class/block/sd* starting from sdc
+// and the NVMe controllers of the remote disks
 func rescanAllVolumes(io azureutils.IOHandler) error {
+	rescanNVMeControllers(io)
 	dirs, err := io.ReadDir(sysClassBlockPath)
 	if err != nil {
 		return err
@@ -291,6 +554,23 @@ func rescanAllVolumes(io azureutils.IOHandler) error {
 	return nil
 }
 
+// getDeviceWWID reads the WWID of a SCSI device or NVMe namespace, it is empty if the device does not report one
+func getDeviceWWID(io azureutils.IOHandler, devicePath string) string {
+	deviceName := filepath.Base(devicePath)
+	if link, err := io.Readlink(devicePath); err == nil {
+		deviceName = filepath.Base(link)
+	}
+	for _, wwidPath := range []string{
+		filepath.Join(sysClassBlockPath, deviceName, "device/wwid"),
+		filepath.Join(sysClassBlockPath, deviceName, "wwid"),
+	} {
+		if wwid, err := io.ReadFile(wwidPath); err == nil {
+			return strings.TrimSpace(string(wwid))
+		}
+	}
+	return ""
+}
+
 func (d *Driver) GetVolumeStats(_ context.Context, m *mount.SafeFormatAndMount, _, target string, hostutil hostUtil) ([]*csi.VolumeUsage, error) {
 	var volUsages []*csi.VolumeUsage
 	_, err := os.Stat(target)
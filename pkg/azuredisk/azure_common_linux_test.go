@@ -17,12 +17,26 @@ limitations under the License.
 package azuredisk
 
 import (
+	"os"
 	"runtime"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
 )
 
+// recordingIOHandler records the files written through the fake IO handler
+type recordingIOHandler struct {
+	azureutils.IOHandler
+	written []string
+}
+
+func (handler *recordingIOHandler) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	handler.written = append(handler.written, filename)
+	return handler.IOHandler.WriteFile(filename, data, perm)
+}
+
 func TestRescanAllVolumes(t *testing.T) {
 	if runtime.GOOS == "darwin" {
 		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
@@ -32,3 +46,64 @@ func TestRescanAllVolumes(t *testing.T) {
 		t.Errorf("rescanAllVolumes failed with error: %v", err)
 	}
 }
+
+func TestFindNVMeDiskByLun(t *testing.T) {
+	ioHandler := azureutils.NewFakeIOHandler()
+	assert.Equal(t, []string{"nvme0", "nvme2"}, listAzureNVMeControllers(ioHandler))
+
+	disk, err := findNVMeDiskByLun(3, ioHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/nvme0n5", disk)
+	// nvme2 lists its path nvme2c2n7 to the namespace with native NVMe multipath
+	disk, err = findNVMeDiskByLun(5, ioHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/nvme2n7", disk)
+	_, err = findNVMeDiskByLun(7, ioHandler)
+	assert.Error(t, err)
+
+	// SCSI devices are found first, then NVMe namespaces, then udev links
+	disk, err = findDiskByLun(1, ioHandler, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/sdd", disk)
+	disk, err = findDiskByLun(3, ioHandler, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/nvme0n5", disk)
+	disk, err = findDiskByLun(4, ioHandler, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/disk/azure/data/by-lun/4", disk)
+	_, err = findDiskByLun(7, ioHandler, nil)
+	assert.Error(t, err)
+}
+
+func TestRescanVolume(t *testing.T) {
+	tests := []struct {
+		devicePath string
+		rescanPath string
+	}{
+		{devicePath: "/dev/sdc", rescanPath: "/sys/class/block/sdc/device/rescan"},
+		{devicePath: "/dev/nvme0n5", rescanPath: "/sys/class/nvme/nvme0/rescan_controller"},
+		{devicePath: "/dev/nvme1n12p1", rescanPath: "/sys/class/nvme/nvme1/rescan_controller"},
+	}
+	for _, test := range tests {
+		ioHandler := &recordingIOHandler{IOHandler: azureutils.NewFakeIOHandler()}
+		assert.NoError(t, rescanVolume(ioHandler, test.devicePath))
+		assert.Equal(t, []string{test.rescanPath}, ioHandler.written, test.devicePath)
+	}
+
+	ioHandler := &recordingIOHandler{IOHandler: azureutils.NewFakeIOHandler()}
+	scsiHostRescan(ioHandler, nil)
+	assert.Equal(t, []string{"/sys/class/scsi_host/host0/scan", "/sys/class/nvme/nvme0/rescan_controller", "/sys/class/nvme/nvme2/rescan_controller"}, ioHandler.written)
+}
+
+func TestGetPartitionDisk(t *testing.T) {
+	ioHandler := azureutils.NewFakeIOHandler()
+	disk, number, isPartition, err := getPartitionDisk(ioHandler, "/dev/sdd1")
+	assert.NoError(t, err)
+	assert.True(t, isPartition)
+	assert.Equal(t, "/dev/sdd", disk)
+	assert.Equal(t, "1", number)
+
+	_, _, isPartition, err = getPartitionDisk(ioHandler, "/dev/sdd")
+	assert.NoError(t, err)
+	assert.False(t, isPartition)
+}
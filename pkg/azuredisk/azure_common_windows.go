@@ -35,7 +35,7 @@ import (
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 )
 
-func formatAndMount(source, target, fstype string, options []string, m *mount.SafeFormatAndMount) error {
+func formatAndMount(source, target, fstype string, options, _ []string, m *mount.SafeFormatAndMount) error {
 	if proxy, ok := m.Interface.(mounter.CSIProxyMounter); ok {
 		return proxy.FormatAndMount(source, target, fstype, options)
 	}
@@ -101,6 +101,31 @@ func getDevicePathWithMountPath(mountPath string, m *mount.SafeFormatAndMount) (
 	return "", fmt.Errorf("could not cast to csi proxy class")
 }
 
+// getDeviceWWID is not supported, the device is only verified by its size
+func getDeviceWWID(_ azureutils.IOHandler, _ string) string {
+	return ""
+}
+
+// getDiskSignatures is not supported, csi-proxy only partitions and formats disks which are not initialized
+func getDiskSignatures(_ string, _ *mount.SafeFormatAndMount) ([]string, error) {
+	return nil, nil
+}
+
+// isFilesystemDirty is not supported
+func isFilesystemDirty(_, _ string, _ *mount.SafeFormatAndMount) (bool, error) {
+	return false, nil
+}
+
+// deviceInUse is not supported, the device is reported in use
+func deviceInUse(_ string) (bool, error) {
+	return true, nil
+}
+
+// checkFilesystem is not supported
+func checkFilesystem(_ context.Context, _, fstype string, _ bool, _ *mount.SafeFormatAndMount) (fsckResult, string, error) {
+	return "", "", fmt.Errorf("checking %s filesystems is not supported", fstype)
+}
+
 func getBlockSizeBytes(devicePath string, m *mount.SafeFormatAndMount) (int64, error) {
 	if proxy, ok := m.Interface.(mounter.CSIProxyMounter); ok {
 		return proxy.GetVolumeSizeInBytes(devicePath)
@@ -152,3 +177,7 @@ func (d *Driver) GetVolumeStats(ctx context.Context, m *mount.SafeFormatAndMount
 	}
 	return []*csi.VolumeUsage{}, fmt.Errorf("could not cast to csi proxy class")
 }
+
+func getPartitionDisk(_ azureutils.IOHandler, _ string) (string, string, bool, error) {
+	return "", "", false, nil
+}
@@ -18,6 +18,8 @@ package azuredisk
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
@@ -27,6 +29,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"go.opentelemetry.io/otel/attribute"
 
 	"k8s.io/apimachinery/pkg/types"
 	kwait "k8s.io/apimachinery/pkg/util/wait"
@@ -37,6 +40,7 @@ import (
 
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/util"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
@@ -80,7 +84,9 @@ var defaultBackOff = kwait.Backoff{
 }
 
 type controllerCommon struct {
-	diskStateMap  sync.Map // <diskURI, attaching/detaching state>
+	diskStateMap sync.Map // <diskURI, attaching/detaching state>
+	// batch ID of the last attach/detach batch of a disk, <diskURI, batchID>
+	diskBatchIDs  sync.Map
 	lockMap       *lockMap
 	cloud         *provider.Cloud
 	clientFactory azclient.ClientFactory
@@ -97,6 +103,8 @@ type controllerCommon struct {
 	CheckDiskCountForBatching    bool
 	// a timed cache for disk attach hitting max data disk count, <nodeName, "">
 	hitMaxDataDiskCountCache azcache.Resource
+	// dryRun answers attach, detach and VM updates with a synthesized success, nil if not in dry-run mode
+	dryRun *dryRun
 }
 
 // ExtendedLocation contains additional info about the location of resources.
@@ -107,29 +115,49 @@ type ExtendedLocation struct {
 	Type string `json:"type,omitempty"`
 }
 
+// getAttachCachingMode returns the caching mode disk is attached with and, if it differs from
+// the requested cachingMode, the reason of the change
+func getAttachCachingMode(disk *armcompute.Disk, cachingMode armcompute.CachingTypes) (armcompute.CachingTypes, string) {
+	if disk == nil || cachingMode == armcompute.CachingTypesNone {
+		return cachingMode, ""
+	}
+	if disk.Properties != nil && disk.Properties.DiskSizeGB != nil && *disk.Properties.DiskSizeGB >= diskCachingLimit {
+		// Disk Caching is not supported for disks 4 TiB and larger
+		// https://docs.microsoft.com/en-us/azure/virtual-machines/premium-storage-performance#disk-caching
+		return armcompute.CachingTypesNone, fmt.Sprintf("size of disk is %dGB which is bigger than limit(%dGB), set cacheMode as None instead of %s",
+			*disk.Properties.DiskSizeGB, diskCachingLimit, cachingMode)
+	}
+	if disk.SKU != nil && disk.SKU.Name != nil && *disk.SKU.Name == armcompute.DiskStorageAccountTypesPremiumV2LRS {
+		return armcompute.CachingTypesNone, fmt.Sprintf("disk is PremiumV2LRS and only supports None caching mode, set cacheMode as None instead of %s", cachingMode)
+	}
+	return cachingMode, ""
+}
+
 // AttachDisk attaches a disk to vm
 // occupiedLuns is used to avoid conflict with other disk attach in k8s VolumeAttachments
 // return (lun, error)
 func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI string, nodeName types.NodeName,
 	cachingMode armcompute.CachingTypes, disk *armcompute.Disk, occupiedLuns []int) (int32, error) {
+	logger := klog.FromContext(ctx)
 	diskEncryptionSetID := ""
+	skuName := ""
 	writeAcceleratorEnabled := false
 
 	// there is possibility that disk is nil when GetDisk is throttled
 	// don't check disk state when GetDisk is throttled
 	if disk != nil {
 		if disk.ManagedBy != nil && (disk.Properties == nil || disk.Properties.MaxShares == nil || *disk.Properties.MaxShares <= 1) {
-			vmset, err := c.cloud.GetNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
+			vmset, err := c.getNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
 			if err != nil {
 				return -1, err
 			}
-			klog.V(4).Infof("found disk(%s) is already attached to node %s", diskURI, *disk.ManagedBy)
+			logger.V(4).Info("found disk is already attached", "managedBy", *disk.ManagedBy)
 			attachedNode, err := vmset.GetNodeNameByProviderID(ctx, *disk.ManagedBy)
 			if err != nil {
 				return -1, err
 			}
 			if strings.EqualFold(string(nodeName), string(attachedNode)) {
-				klog.Warningf("volume %s is actually attached to current node %s, invalidate vm cache and return error", diskURI, nodeName)
+				csicommon.LogWarning(ctx, "volume is actually attached to current node, invalidate vm cache and return error")
 				// update VM(invalidate vm cache)
 				if errUpdate := c.UpdateVM(ctx, nodeName); errUpdate != nil {
 					return -1, errUpdate
@@ -141,19 +169,16 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 			attachErr := fmt.Sprintf(
 				"disk(%s) already attached to node(%s), could not be attached to node(%s)",
 				diskURI, *disk.ManagedBy, nodeName)
-			klog.V(2).Infof("found dangling volume %s attached to node %s, could not be attached to node(%s)", diskURI, attachedNode, nodeName)
+			logger.V(2).Info("found dangling volume attached to another node", "attachedNode", attachedNode)
 			return -1, volerr.NewDanglingError(attachErr, attachedNode, "")
 		}
 
-		if disk.Properties != nil {
-			if disk.Properties.DiskSizeGB != nil && *disk.Properties.DiskSizeGB >= diskCachingLimit && cachingMode != armcompute.CachingTypesNone {
-				// Disk Caching is not supported for disks 4 TiB and larger
-				// https://docs.microsoft.com/en-us/azure/virtual-machines/premium-storage-performance#disk-caching
-				cachingMode = armcompute.CachingTypesNone
-				klog.Warningf("size of disk(%s) is %dGB which is bigger than limit(%dGB), set cacheMode as None",
-					diskURI, *disk.Properties.DiskSizeGB, diskCachingLimit)
-			}
+		if adjusted, reason := getAttachCachingMode(disk, cachingMode); reason != "" {
+			csicommon.LogWarning(ctx, "caching mode adjusted", "reason", reason)
+			cachingMode = adjusted
+		}
 
+		if disk.Properties != nil {
 			if disk.Properties.Encryption != nil &&
 				disk.Properties.Encryption.DiskEncryptionSetID != nil {
 				diskEncryptionSetID = *disk.Properties.Encryption.DiskEncryptionSetID
@@ -163,11 +188,9 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 				return -1, fmt.Errorf("state of disk(%s) is %s, not in expected %s state", diskURI, *disk.Properties.DiskState, armcompute.DiskStateUnattached)
 			}
 		}
-		if disk.SKU != nil && disk.SKU.Name != nil && *disk.SKU.Name == armcompute.DiskStorageAccountTypesPremiumV2LRS {
-			klog.V(2).Infof("disk(%s) is PremiumV2LRS and only supports None caching mode", diskURI)
-			cachingMode = armcompute.CachingTypesNone
+		if disk.SKU != nil && disk.SKU.Name != nil {
+			skuName = string(*disk.SKU.Name)
 		}
-
 		if v, ok := disk.Tags[WriteAcceleratorEnabled]; ok {
 			if v != nil && strings.EqualFold(*v, "true") {
 				writeAcceleratorEnabled = true
@@ -184,7 +207,10 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 	}
 	node := strings.ToLower(string(nodeName))
 	diskuri := strings.ToLower(diskURI)
+	_, span := startSpan(ctx, "insertAttachDiskRequest", attrNode.String(node))
 	requestNum, err := c.insertAttachDiskRequest(diskuri, node, &options)
+	span.SetAttributes(attrQueueLength.Int(requestNum))
+	endSpan(span, err)
 	if err != nil {
 		return -1, err
 	}
@@ -192,7 +218,8 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 	var waitForDetachHappened bool
 	if c.WaitForDetach && c.isMaxDataDiskCountExceeded(ctx, string(nodeName)) {
 		// wait for disk detach to finish first on the same node
-		if err = kwait.PollUntilContextTimeout(ctx, 2*time.Second, 30*time.Second, true, func(context.Context) (bool, error) {
+		waitCtx, span := startSpan(ctx, "waitForDetach", attrNode.String(node))
+		if err = kwait.PollUntilContextTimeout(waitCtx, 2*time.Second, 30*time.Second, true, func(context.Context) (bool, error) {
 			detachDiskReqeustNum, err := c.getDetachDiskRequestNum(node)
 			if err != nil {
 				return false, err
@@ -200,27 +227,28 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 			if detachDiskReqeustNum == 0 {
 				return true, nil
 			}
-			klog.V(4).Infof("there are still %d detach disk requests on node %s, wait for detach to finish, current disk: %s", detachDiskReqeustNum, node, diskName)
+			logger.V(4).Info("there are still detach disk requests on node, wait for detach to finish", "detachRequests", detachDiskReqeustNum)
 			waitForDetachHappened = true
 			return false, nil
 		}); err != nil {
-			klog.Errorf("current disk: %s, wait for detach disk requests on node %s failed: %v", diskName, node, err)
+			logger.Error(err, "wait for detach disk requests on node failed")
 		}
+		endSpan(span, err)
 	}
 
-	c.lockMap.LockEntry(node)
+	c.lockNode(ctx, node, attachOperation)
 	defer c.lockMap.UnlockEntry(node)
 
 	if !waitForDetachHappened && c.AttachDetachInitialDelayInMs > 0 && requestNum == 1 {
-		klog.V(2).Infof("wait %dms for more requests on node %s, current disk attach: %s", c.AttachDetachInitialDelayInMs, node, diskURI)
-		time.Sleep(time.Duration(c.AttachDetachInitialDelayInMs) * time.Millisecond)
+		logger.V(2).Info("wait for more attach requests on node", "delayInMs", c.AttachDetachInitialDelayInMs)
+		c.waitForBatch(ctx, node, attachOperation)
 	}
 
 	numDisksAllowed := math.MaxInt
 	if c.CheckDiskCountForBatching {
 		_, instanceType, err := GetNodeInfoFromLabels(ctx, string(nodeName), c.cloud.KubeClient)
 		if err != nil {
-			klog.Errorf("failed to get node info from labels: %v", err)
+			logger.Error(err, "failed to get node info from labels")
 		} else if instanceType != "" {
 			maxNumDisks, instanceExists := GetMaxDataDiskCount(instanceType)
 			if instanceExists {
@@ -246,26 +274,34 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 	// Remove some disks from the batch if the number is more than the max number of disks allowed
 	removeDisks := len(diskMap) - numDisksAllowed
 	if removeDisks > 0 {
-		klog.V(2).Infof("too many disks to attach, remove %d disks from the request", removeDisks)
+		logger.V(2).Info("too many disks to attach, remove disks from the request", "removeDisks", removeDisks)
+		diskBatchTrimmedCount.WithLabelValues(node).Inc()
 		for diskURI, options := range diskMap {
 			if removeDisks == 0 {
 				break
 			}
 			if options != nil {
-				klog.V(2).Infof("remove disk(%s) from attach request from node(%s)", diskURI, nodeName)
+				logger.V(2).Info("remove disk from attach request", "removedVolumeID", diskURI)
 				delete(diskMap, diskURI)
 			}
 			removeDisks--
 		}
 	}
 
-	lun, err := c.SetDiskLun(ctx, nodeName, diskuri, diskMap, occupiedLuns)
+	lunCtx, span := startSpan(ctx, "SetDiskLun", attrNode.String(node), attrBatchSize.Int(len(diskMap)))
+	lun, err := c.SetDiskLun(lunCtx, nodeName, diskuri, diskMap, occupiedLuns)
+	span.SetAttributes(attrLun.Int(int(lun)))
+	endSpan(span, err)
 	if err != nil {
 		return -1, err
 	}
 
-	klog.V(2).Infof("Trying to attach volume %s lun %d to node %s, diskMap len:%d, %+v", diskURI, lun, nodeName, len(diskMap), diskMap)
+	ctx, logger = csicommon.NewLogContext(ctx, "lun", lun)
 	if len(diskMap) == 0 {
+		if batchID, ok := c.diskBatchIDs.LoadAndDelete(diskuri); ok {
+			logger = logger.WithValues("batchID", batchID)
+		}
+		logger.V(2).Info("volume was attached in the batch of another request")
 		if !c.DisableDiskLunCheck {
 			// always check disk lun after disk attach complete
 			diskLun, vmState, errGetLun := c.GetDiskLun(ctx, diskName, diskURI, nodeName)
@@ -277,12 +313,16 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 		return lun, nil
 	}
 
-	vmset, err := c.cloud.GetNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
+	vmset, err := c.getNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
 	if err != nil {
 		return -1, err
 	}
-	c.diskStateMap.Store(disk, "attaching")
-	defer c.diskStateMap.Delete(disk)
+	batchID := newDiskBatch(&c.diskBatchIDs, diskMap)
+	c.diskBatchIDs.Delete(diskuri)
+	ctx, logger = csicommon.NewLogContext(ctx, "batchID", batchID)
+	logger.V(2).Info("Trying to attach volume", "batchSize", len(diskMap), "diskMap", diskMap)
+	c.diskStateMap.Store(diskuri, "attaching")
+	defer c.diskStateMap.Delete(diskuri)
 
 	defer func() {
 		// invalidate the cache if there is error in disk attach
@@ -291,14 +331,18 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 		}
 	}()
 
-	err = vmset.AttachDisk(ctx, nodeName, diskMap)
+	diskBatchSize.WithLabelValues(attachOperation).Observe(float64(len(diskMap)))
+	attachCtx, span := startSpan(ctx, "vmset.AttachDisk", attrNode.String(node), attrBatchID.String(batchID),
+		attrBatchSize.Int(len(diskMap)), attrLun.Int(int(lun)), attrSKU.String(skuName))
+	err = vmset.AttachDisk(attachCtx, nodeName, diskMap)
+	endSpan(span, err)
 	if err != nil {
 		if strings.Contains(err.Error(), util.MaximumDataDiskExceededMsg) {
-			klog.Warningf("hit max data disk count when attaching disk %s, set cache for node(%s)", diskName, nodeName)
+			csicommon.LogWarning(ctx, "hit max data disk count when attaching disk, set cache for node", "diskName", diskName)
 			c.hitMaxDataDiskCountCache.Set(node, "")
 		}
 		if strings.Contains(err.Error(), "OperationPreempted") {
-			klog.Errorf("Retry VM Update on node (%s) due to error (%v)", nodeName, err)
+			logger.Error(err, "Retry VM Update on node")
 			err = vmset.UpdateVM(ctx, nodeName)
 		}
 		if err != nil {
@@ -317,6 +361,23 @@ func (c *controllerCommon) AttachDisk(ctx context.Context, diskName, diskURI str
 	return lun, nil
 }
 
+// lockNode acquires the attach/detach lock of node and records the wait in a span and a metric
+func (c *controllerCommon) lockNode(ctx context.Context, node, operation string) {
+	_, span := startSpan(ctx, "waitForNodeLock", attrNode.String(node), attrOperation.String(operation))
+	lockStart := time.Now()
+	c.lockMap.LockEntry(node)
+	observeNodeLockWait(operation, lockStart)
+	span.End()
+}
+
+// waitForBatch waits AttachDetachInitialDelayInMs for more requests to batch on node
+func (c *controllerCommon) waitForBatch(ctx context.Context, node, operation string) {
+	_, span := startSpan(ctx, "waitForBatch", attrNode.String(node), attrOperation.String(operation),
+		attribute.Int("azuredisk.delay_ms", c.AttachDetachInitialDelayInMs))
+	time.Sleep(time.Duration(c.AttachDetachInitialDelayInMs) * time.Millisecond)
+	span.End()
+}
+
 // insertAttachDiskRequest return (attachDiskRequestQueueLength, error)
 func (c *controllerCommon) insertAttachDiskRequest(diskURI, nodeName string, options *provider.AttachDiskOptions) (int, error) {
 	var diskMap map[string]*provider.AttachDiskOptions
@@ -339,6 +400,7 @@ func (c *controllerCommon) insertAttachDiskRequest(diskURI, nodeName string, opt
 	} else {
 		diskMap[diskURI] = options
 	}
+	diskQueueDepth.WithLabelValues(nodeName, attachOperation).Set(float64(len(diskMap)))
 	return len(diskMap), nil
 }
 
@@ -358,66 +420,87 @@ func (c *controllerCommon) cleanAttachDiskRequests(nodeName string) (map[string]
 		return diskMap, fmt.Errorf("convert attachDiskMap failure on node(%s)", nodeName)
 	}
 	c.attachDiskMap.Store(nodeName, make(map[string]*provider.AttachDiskOptions))
+	// an empty queue has no series so that nodes which went away do not leave one behind
+	deleteDiskQueueDepth(nodeName, attachOperation)
 	return diskMap, nil
 }
 
 // DetachDisk detaches a disk from VM
 func (c *controllerCommon) DetachDisk(ctx context.Context, diskName, diskURI string, nodeName types.NodeName) error {
+	logger := klog.FromContext(ctx)
 	if _, err := c.cloud.InstanceID(ctx, nodeName); err != nil {
 		if errors.Is(err, cloudprovider.InstanceNotFound) {
 			// if host doesn't exist, no need to detach
-			klog.Warningf("azureDisk - failed to get azure instance id(%s), DetachDisk(%s) will assume disk is already detached",
-				nodeName, diskURI)
+			csicommon.LogWarning(ctx, "azureDisk - failed to get azure instance id, DetachDisk will assume disk is already detached", "node", nodeName)
+			deleteNodeMetrics(string(nodeName))
 			return nil
 		}
-		klog.Warningf("failed to get azure instance id (%v)", err)
+		csicommon.LogWarning(ctx, "failed to get azure instance id", "err", err)
 		return fmt.Errorf("failed to get azure instance id for node %q: %w", nodeName, err)
 	}
 
-	vmset, err := c.cloud.GetNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
+	vmset, err := c.getNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
 	if err != nil {
 		return err
 	}
 
 	node := strings.ToLower(string(nodeName))
 	disk := strings.ToLower(diskURI)
+	_, span := startSpan(ctx, "insertDetachDiskRequest", attrNode.String(node))
 	requestNum, err := c.insertDetachDiskRequest(diskName, disk, node)
+	span.SetAttributes(attrQueueLength.Int(requestNum))
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
 
-	c.lockMap.LockEntry(node)
+	c.lockNode(ctx, node, detachOperation)
 	defer c.lockMap.UnlockEntry(node)
 
 	if c.AttachDetachInitialDelayInMs > 0 && requestNum == 1 {
-		klog.V(2).Infof("wait %dms for more requests on node %s, current disk detach: %s", c.AttachDetachInitialDelayInMs, node, diskURI)
-		time.Sleep(time.Duration(c.AttachDetachInitialDelayInMs) * time.Millisecond)
+		logger.V(2).Info("wait for more detach requests on node", "delayInMs", c.AttachDetachInitialDelayInMs)
+		c.waitForBatch(ctx, node, detachOperation)
 	}
 	diskMap, err := c.cleanDetachDiskRequests(node)
 	if err != nil {
 		return err
 	}
 
-	klog.V(2).Infof("Trying to detach volume %s from node %s, diskMap len:%d, %s", diskURI, nodeName, len(diskMap), diskMap)
 	if len(diskMap) > 0 {
+		batchID := newDiskBatch(&c.diskBatchIDs, diskMap)
+		c.diskBatchIDs.Delete(disk)
+		ctx, logger = csicommon.NewLogContext(ctx, "batchID", batchID)
+		logger.V(2).Info("Trying to detach volume", "batchSize", len(diskMap), "diskMap", diskMap)
 		c.diskStateMap.Store(disk, "detaching")
 		defer c.diskStateMap.Delete(disk)
-		if err = vmset.DetachDisk(ctx, nodeName, diskMap, false); err != nil {
+		diskBatchSize.WithLabelValues(detachOperation).Observe(float64(len(diskMap)))
+		detachCtx, span := startSpan(ctx, "vmset.DetachDisk", attrNode.String(node), attrBatchID.String(batchID), attrBatchSize.Int(len(diskMap)))
+		err = vmset.DetachDisk(detachCtx, nodeName, diskMap, false)
+		endSpan(span, err)
+		if err != nil {
 			if isInstanceNotFoundError(err) {
 				// if host doesn't exist, no need to detach
-				klog.Warningf("azureDisk - got InstanceNotFoundError(%v), DetachDisk(%s) will assume disk is already detached",
-					err, diskURI)
+				csicommon.LogWarning(ctx, "azureDisk - got InstanceNotFoundError, DetachDisk will assume disk is already detached", "err", err)
+				deleteNodeMetrics(node)
 				return nil
 			}
 			if c.ForceDetachBackoff && !azureutils.IsThrottlingError(err) {
-				klog.Errorf("azureDisk - DetachDisk(%s) from node %s failed with error: %v, retry with force detach", diskURI, nodeName, err)
-				err = vmset.DetachDisk(ctx, nodeName, diskMap, true)
+				logger.Error(err, "azureDisk - DetachDisk failed, retry with force detach")
+				detachCtx, span := startSpan(ctx, "vmset.DetachDisk", attrNode.String(node), attrBatchID.String(batchID),
+					attrBatchSize.Int(len(diskMap)), attribute.Bool("azuredisk.force_detach", true))
+				err = vmset.DetachDisk(detachCtx, nodeName, diskMap, true)
+				endSpan(span, err)
 			}
 		}
+	} else {
+		if batchID, ok := c.diskBatchIDs.LoadAndDelete(disk); ok {
+			logger = logger.WithValues("batchID", batchID)
+		}
+		logger.V(2).Info("volume was detached in the batch of another request")
 	}
 
 	if err != nil {
-		klog.Errorf("azureDisk - detach disk(%s, %s) failed, err: %v", diskName, diskURI, err)
+		logger.Error(err, "azureDisk - detach disk failed")
 		return err
 	}
 
@@ -429,13 +512,27 @@ func (c *controllerCommon) DetachDisk(ctx context.Context, diskName, diskURI str
 		}
 	}
 
-	klog.V(2).Infof("azureDisk - detach disk(%s, %s) succeeded", diskName, diskURI)
+	logger.V(2).Info("azureDisk - detach disk succeeded")
 	return nil
 }
 
+// newDiskBatch returns a random ID for an attach/detach batch and records it for the disks of the batch,
+// so that the requests whose disks were sent in the batch of another request can log it
+func newDiskBatch[V any](batchIDs *sync.Map, diskMap map[string]V) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	batchID := hex.EncodeToString(b)
+	for diskURI := range diskMap {
+		batchIDs.Store(diskURI, batchID)
+	}
+	return batchID
+}
+
 // UpdateVM updates a vm
 func (c *controllerCommon) UpdateVM(ctx context.Context, nodeName types.NodeName) error {
-	vmset, err := c.cloud.GetNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
+	vmset, err := c.getNodeVMSet(ctx, nodeName, azcache.CacheReadTypeUnsafe)
 	if err != nil {
 		return err
 	}
@@ -473,6 +570,7 @@ func (c *controllerCommon) insertDetachDiskRequest(diskName, diskURI, nodeName s
 	} else {
 		diskMap[diskURI] = diskName
 	}
+	diskQueueDepth.WithLabelValues(nodeName, detachOperation).Set(float64(len(diskMap)))
 	return len(diskMap), nil
 }
 
@@ -493,6 +591,7 @@ func (c *controllerCommon) cleanDetachDiskRequests(nodeName string) (map[string]
 	}
 	// clean up original requests in disk map
 	c.detachDiskMap.Store(nodeName, make(map[string]string))
+	deleteDiskQueueDepth(nodeName, detachOperation)
 	return diskMap, nil
 }
 
@@ -510,9 +609,18 @@ func (c *controllerCommon) getDetachDiskRequestNum(nodeName string) (int, error)
 	return -1, fmt.Errorf("convert detachDiskMap failure on node(%s)", nodeName)
 }
 
+// getNodeVMSet returns the VMSet of the node, wrapped in dry-run mode
+func (c *controllerCommon) getNodeVMSet(ctx context.Context, nodeName types.NodeName, crt azcache.AzureCacheReadType) (provider.VMSet, error) {
+	vmset, err := c.cloud.GetNodeVMSet(ctx, nodeName, crt)
+	if err != nil || c.dryRun == nil {
+		return vmset, err
+	}
+	return c.dryRun.vmSet(vmset), nil
+}
+
 // GetNodeDataDisks invokes vmSet interfaces to get data disks for the node.
 func (c *controllerCommon) GetNodeDataDisks(ctx context.Context, nodeName types.NodeName, crt azcache.AzureCacheReadType) ([]*armcompute.DataDisk, *string, error) {
-	vmset, err := c.cloud.GetNodeVMSet(ctx, nodeName, crt)
+	vmset, err := c.getNodeVMSet(ctx, nodeName, crt)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -521,7 +629,17 @@ func (c *controllerCommon) GetNodeDataDisks(ctx context.Context, nodeName types.
 }
 
 // GetDiskLun finds the lun on the host that the vhd is attached to, given a vhd's diskName and diskURI.
-func (c *controllerCommon) GetDiskLun(ctx context.Context, diskName, diskURI string, nodeName types.NodeName) (int32, *string, error) {
+func (c *controllerCommon) GetDiskLun(ctx context.Context, diskName, diskURI string, nodeName types.NodeName) (lun int32, vmState *string, err error) {
+	ctx, span := startSpan(ctx, "GetDiskLun", attrVolumeID.String(diskURI), attrNode.String(string(nodeName)))
+	defer func() {
+		span.SetAttributes(attrLun.Int(int(lun)), attribute.String("azuredisk.vm_state", ptr.Deref(vmState, "")))
+		if err != nil && strings.Contains(err.Error(), consts.CannotFindDiskLUN) {
+			// not an error of the lookup, the disk is not attached
+			span.End()
+			return
+		}
+		endSpan(span, err)
+	}()
 	// GetNodeDataDisks need to fetch the cached data/fresh data if cache expired here
 	// to ensure we get LUN based on latest entry.
 	disks, provisioningState, err := c.GetNodeDataDisks(ctx, nodeName, azcache.CacheReadTypeDefault)
@@ -613,6 +731,13 @@ func (c *controllerCommon) SetDiskLun(ctx context.Context, nodeName types.NodeNa
 		opt.Lun = diskLuns[count]
 		count++
 	}
+	usedNum := len(diskLuns)
+	for _, v := range used {
+		if v {
+			usedNum++
+		}
+	}
+	nodeLunUsed.WithLabelValues(strings.ToLower(string(nodeName))).Set(float64(usedNum))
 	if lun < 0 {
 		return lun, fmt.Errorf("could not find lun of diskURI(%s), diskMap(%v)", diskURI, diskMap)
 	}
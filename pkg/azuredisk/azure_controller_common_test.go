@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -204,6 +205,86 @@ func TestCommonAttachDisk(t *testing.T) {
 	}
 }
 
+func TestCommonAttachDiskState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCloud := provider.GetTestCloud(ctrl)
+	diskURI := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/disks/Disk-Name",
+		testCloud.SubscriptionID, testCloud.ResourceGroup)
+	testdiskController := &controllerCommon{
+		cloud:               testCloud,
+		lockMap:             newLockMap(),
+		DisableDiskLunCheck: true,
+	}
+	testdiskController.hitMaxDataDiskCountCache, _ = azcache.NewTimedCache(5*time.Minute,
+		func(_ context.Context, _ string) (interface{}, error) { return nil, nil }, false)
+
+	expectedVMs := setTestVirtualMachines(testCloud, map[string]string{"vm1": "PowerState/Running"}, false)
+	mockVMClient := testCloud.ComputeClientFactory.GetVirtualMachineClient().(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().Get(gomock.Any(), testCloud.ResourceGroup, "vm1", gomock.Any()).Return(&expectedVMs[0], nil).AnyTimes()
+	var stateDuringAttach interface{}
+	mockVMClient.EXPECT().CreateOrUpdate(gomock.Any(), testCloud.ResourceGroup, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, _ armcompute.VirtualMachine) (*armcompute.VirtualMachine, error) {
+			// the state is keyed by the lowercase disk URI, which DeleteManagedDisk looks up
+			stateDuringAttach, _ = testdiskController.diskStateMap.Load(strings.ToLower(diskURI))
+			return nil, nil
+		}).Times(1)
+
+	_, err := testdiskController.AttachDisk(context.Background(), "Disk-Name", diskURI, "vm1", armcompute.CachingTypesReadOnly, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "attaching", stateDuringAttach)
+	_, ok := testdiskController.diskStateMap.Load(strings.ToLower(diskURI))
+	assert.False(t, ok)
+}
+
+func TestGetAttachCachingMode(t *testing.T) {
+	tests := []struct {
+		desc            string
+		disk            *armcompute.Disk
+		cachingMode     armcompute.CachingTypes
+		expectedMode    armcompute.CachingTypes
+		expectedAdjusts bool
+	}{
+		{
+			desc:         "nil disk",
+			cachingMode:  armcompute.CachingTypesReadOnly,
+			expectedMode: armcompute.CachingTypesReadOnly,
+		},
+		{
+			desc:         "small disk",
+			disk:         &armcompute.Disk{Properties: &armcompute.DiskProperties{DiskSizeGB: ptr.To(int32(1024))}},
+			cachingMode:  armcompute.CachingTypesReadWrite,
+			expectedMode: armcompute.CachingTypesReadWrite,
+		},
+		{
+			desc:            "disk of 4TiB",
+			disk:            &armcompute.Disk{Properties: &armcompute.DiskProperties{DiskSizeGB: ptr.To(int32(diskCachingLimit))}},
+			cachingMode:     armcompute.CachingTypesReadOnly,
+			expectedMode:    armcompute.CachingTypesNone,
+			expectedAdjusts: true,
+		},
+		{
+			desc:            "PremiumV2 disk",
+			disk:            &armcompute.Disk{SKU: &armcompute.DiskSKU{Name: ptr.To(armcompute.DiskStorageAccountTypesPremiumV2LRS)}},
+			cachingMode:     armcompute.CachingTypesReadOnly,
+			expectedMode:    armcompute.CachingTypesNone,
+			expectedAdjusts: true,
+		},
+		{
+			desc:         "PremiumV2 disk with None caching",
+			disk:         &armcompute.Disk{SKU: &armcompute.DiskSKU{Name: ptr.To(armcompute.DiskStorageAccountTypesPremiumV2LRS)}},
+			cachingMode:  armcompute.CachingTypesNone,
+			expectedMode: armcompute.CachingTypesNone,
+		},
+	}
+	for _, test := range tests {
+		mode, reason := getAttachCachingMode(test.disk, test.cachingMode)
+		assert.Equal(t, test.expectedMode, mode, test.desc)
+		assert.Equal(t, test.expectedAdjusts, reason != "", test.desc)
+	}
+}
+
 func TestCommonDetachDisk(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -914,3 +995,15 @@ func setTestVirtualMachines(c *provider.Cloud, vmList map[string]string, isDataD
 
 	return expectedVMs
 }
+
+func TestNewDiskBatch(t *testing.T) {
+	var batchIDs sync.Map
+	batchID := newDiskBatch(&batchIDs, map[string]string{"disk1": "", "disk2": ""})
+	assert.Len(t, batchID, 8)
+	for _, disk := range []string{"disk1", "disk2"} {
+		id, ok := batchIDs.Load(disk)
+		assert.True(t, ok)
+		assert.Equal(t, batchID, id)
+	}
+	assert.NotEqual(t, batchID, newDiskBatch(&batchIDs, map[string]*provider.AttachDiskOptions{"disk1": nil}))
+}
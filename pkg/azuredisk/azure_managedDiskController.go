@@ -37,6 +37,7 @@ import (
 
 	azureconsts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
@@ -56,6 +57,8 @@ func NewManagedDiskController(provider *provider.Cloud) *ManagedDiskController {
 	}
 	getter := func(_ context.Context, _ string) (interface{}, error) { return nil, nil }
 	common.hitMaxDataDiskCountCache, _ = azcache.NewTimedCache(5*time.Minute, getter, false)
+	registerMetrics()
+	cacheState.setCache(hitMaxDataDiskCountCacheName, common.hitMaxDataDiskCountCache)
 
 	return &ManagedDiskController{common}
 }
@@ -113,7 +116,9 @@ type ManagedDiskOptions struct {
 // CreateManagedDisk: create managed disk
 func (c *ManagedDiskController) CreateManagedDisk(ctx context.Context, options *ManagedDiskOptions) (string, error) {
 	var err error
-	klog.V(4).Infof("azureDisk - creating new managed Name:%s StorageAccountType:%s Size:%v", options.DiskName, options.StorageAccountType, options.SizeGB)
+	// each member of a striped volume is created with its own name under the context of the volume
+	ctx, logger := csicommon.NewLogContext(ctx, "diskName", options.DiskName)
+	logger.V(4).Info("azureDisk - creating new managed disk", "storageAccountType", options.StorageAccountType, "sizeGB", options.SizeGB)
 
 	var createZones []string
 	if len(options.AvailabilityZone) > 0 {
@@ -206,7 +211,7 @@ func (c *ManagedDiskController) CreateManagedDisk(ctx context.Context, options *
 		}
 
 		if options.LogicalSectorSize != 0 {
-			klog.V(2).Infof("AzureDisk - requested LogicalSectorSize: %v", options.LogicalSectorSize)
+			logger.V(2).Info("AzureDisk - requested LogicalSectorSize", "logicalSectorSize", options.LogicalSectorSize)
 			diskProperties.CreationData.LogicalSectorSize = ptr.To(int32(options.LogicalSectorSize))
 		}
 	} else {
@@ -228,7 +233,7 @@ func (c *ManagedDiskController) CreateManagedDisk(ctx context.Context, options *
 		encryptionType := armcompute.EncryptionTypeEncryptionAtRestWithCustomerKey
 		if options.DiskEncryptionType != "" {
 			encryptionType = armcompute.EncryptionType(options.DiskEncryptionType)
-			klog.V(4).Infof("azureDisk - DiskEncryptionType: %s, DiskEncryptionSetID: %s", options.DiskEncryptionType, options.DiskEncryptionSetID)
+			logger.V(4).Info("azureDisk - set disk encryption", "diskEncryptionType", options.DiskEncryptionType, "diskEncryptionSetID", options.DiskEncryptionSetID)
 		}
 		diskProperties.Encryption = &armcompute.Encryption{
 			DiskEncryptionSetID: &options.DiskEncryptionSetID,
@@ -258,7 +263,7 @@ func (c *ManagedDiskController) CreateManagedDisk(ctx context.Context, options *
 	}
 
 	if c.cloud.HasExtendedLocation() {
-		klog.V(2).Infof("extended location Name:%s Type:%s is set on disk(%s)", c.cloud.ExtendedLocationName, c.cloud.ExtendedLocationType, options.DiskName)
+		logger.V(2).Info("extended location is set on disk", "extendedLocationName", c.cloud.ExtendedLocationName, "extendedLocationType", c.cloud.ExtendedLocationType)
 		model.ExtendedLocation = &armcompute.ExtendedLocation{
 			Name: ptr.To(c.cloud.ExtendedLocationName),
 			Type: to.Ptr(armcompute.ExtendedLocationTypes(c.cloud.ExtendedLocationType)),
@@ -288,10 +293,10 @@ func (c *ManagedDiskController) CreateManagedDisk(ctx context.Context, options *
 		}
 
 		if options.SkipGetDiskOperation {
-			klog.Warningf("azureDisk - GetDisk(%s, StorageAccountType:%s) is throttled, unable to confirm provisioningState in poll process", options.DiskName, options.StorageAccountType)
+			csicommon.LogWarning(ctx, "azureDisk - GetDisk is throttled, unable to confirm provisioningState in poll process", "storageAccountType", options.StorageAccountType)
 			return true, nil
 		}
-		klog.V(4).Infof("azureDisk - waiting for disk(%s) in resourceGroup(%s) to be provisioned", options.DiskName, rg)
+		logger.V(4).Info("azureDisk - waiting for disk to be provisioned", "resourceGroup", rg)
 		if disk, err = diskClient.Get(ctx, rg, options.DiskName); err != nil {
 			// We are waiting for provisioningState==Succeeded
 			// We don't want to hand-off managed disks to k8s while they are
@@ -302,9 +307,9 @@ func (c *ManagedDiskController) CreateManagedDisk(ctx context.Context, options *
 	})
 
 	if err != nil {
-		klog.Warningf("azureDisk - created new MD Name:%s StorageAccountType:%s Size:%v but was unable to confirm provisioningState in poll process", options.DiskName, options.StorageAccountType, options.SizeGB)
+		csicommon.LogWarning(ctx, "azureDisk - created new managed disk but was unable to confirm provisioningState in poll process", "volumeID", diskID, "sizeGB", options.SizeGB, "err", err)
 	} else {
-		klog.V(2).Infof("azureDisk - created new MD Name:%s StorageAccountType:%s Size:%v", options.DiskName, options.StorageAccountType, options.SizeGB)
+		logger.V(2).Info("azureDisk - created new managed disk", "volumeID", diskID)
 	}
 	return diskID, nil
 }
@@ -325,11 +330,12 @@ func (c *ManagedDiskController) DeleteManagedDisk(ctx context.Context, diskURI s
 		return err
 	}
 
+	logger := klog.FromContext(ctx).WithValues("diskName", diskName)
 	disk, err := diskClient.Get(ctx, resourceGroup, diskName)
 	if err != nil {
 		var respErr = &azcore.ResponseError{}
 		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
-			klog.V(2).Infof("azureDisk - disk(%s) is already deleted", diskURI)
+			logger.V(2).Info("azureDisk - disk is already deleted")
 			return nil
 		}
 		return err
@@ -343,7 +349,7 @@ func (c *ManagedDiskController) DeleteManagedDisk(ctx context.Context, diskURI s
 	}
 	// We don't need poll here, k8s will immediately stop referencing the disk
 	// the disk will be eventually deleted - cleanly - by ARM
-	klog.V(2).Infof("azureDisk - deleted a managed disk: %s", diskURI)
+	logger.V(2).Info("azureDisk - deleted a managed disk")
 	return nil
 }
 
@@ -390,7 +396,8 @@ func (c *ManagedDiskController) ResizeDisk(ctx context.Context, diskURI string,
 
 	newSizeQuant := resource.MustParse(fmt.Sprintf("%dGi", requestGiB))
 
-	klog.V(2).Infof("azureDisk - begin to resize disk(%s) with new size(%d), old size(%v)", diskName, requestGiB, oldSize)
+	logger := klog.FromContext(ctx).WithValues("diskName", diskName)
+	logger.V(2).Info("azureDisk - begin to resize disk", "newSizeGiB", requestGiB, "oldSize", oldSize.String())
 	// If disk already of greater or equal size than requested we return
 	if *result.Properties.DiskSizeGB >= requestGiB {
 		return newSizeQuant, nil
@@ -410,18 +417,19 @@ func (c *ManagedDiskController) ResizeDisk(ctx context.Context, diskURI string,
 		return oldSize, err
 	}
 
-	klog.V(2).Infof("azureDisk - resize disk(%s) with new size(%d) completed", diskName, requestGiB)
+	logger.V(2).Info("azureDisk - resize disk completed", "newSizeGiB", requestGiB)
 	return newSizeQuant, nil
 }
 
 // ModifyDisk: modify disk
 func (c *ManagedDiskController) ModifyDisk(ctx context.Context, options *ManagedDiskOptions) error {
-	klog.V(4).Infof("azureDisk - modifying managed disk URI:%s, StorageAccountType:%s, DiskIOPSReadWrite:%s, DiskMBpsReadWrite:%s", options.SourceResourceID, options.StorageAccountType, options.DiskIOPSReadWrite, options.DiskMBpsReadWrite)
-
 	subsID, rg, diskName, err := azureutils.GetInfoFromURI(options.SourceResourceID)
 	if err != nil {
 		return err
 	}
+	logger := klog.FromContext(ctx).WithValues("diskName", diskName)
+	logger.V(4).Info("azureDisk - modifying managed disk", "storageAccountType", options.StorageAccountType,
+		"diskIOPSReadWrite", options.DiskIOPSReadWrite, "diskMBpsReadWrite", options.DiskMBpsReadWrite)
 
 	diskClient, err := c.clientFactory.GetDiskClientForSub(subsID)
 	if err != nil {
@@ -482,7 +490,7 @@ func (c *ManagedDiskController) ModifyDisk(ctx context.Context, options *Managed
 			return err
 		}
 	} else {
-		klog.V(4).Infof("azureDisk - no modification needed for disk(%s)", diskName)
+		logger.V(4).Info("azureDisk - no modification needed for disk")
 	}
 	return nil
 }
@@ -17,18 +17,23 @@ limitations under the License.
 package azuredisk
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -40,16 +45,24 @@ import (
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/volume/util/hostutil"
 	"k8s.io/mount-utils"
+	"k8s.io/utils/keymutex"
 	"k8s.io/utils/ptr"
 
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/audit"
 	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
 	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/faultinject"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/optimization"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/ratelimit"
 	volumehelper "sigs.k8s.io/azuredisk-csi-driver/pkg/util"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
@@ -64,6 +77,8 @@ var (
 		Factor:   2,
 		Steps:    10, // Max delay = 0.5 * 2^9 = ~4 minutes
 	}
+	// faultInjectionReloadInterval is the interval of reading the fault injection rules again
+	faultInjectionReloadInterval = 30 * time.Second
 )
 
 // CSIDriver defines the interface for a CSI driver.
@@ -129,6 +144,7 @@ type Driver struct {
 	disableAVSetNodes            bool
 	removeNotReadyTaint          bool
 	kubeClient                   clientset.Interface
+	eventRecorder                record.EventRecorder
 	// a timed cache storing volume stats <volumeID, volumeStats>
 	volStatsCache           azcache.Resource
 	maxConcurrentFormat     int64
@@ -139,6 +155,48 @@ type Driver struct {
 	throttlingCache azcache.Resource
 	// a timed cache for disk lun collision check throttling
 	checkDiskLunThrottlingCache azcache.Resource
+	// shared rate limiter of disk, snapshot and VM calls, nil if disabled
+	armRateLimiter *ratelimit.Limiter
+	// interceptors of the disk, snapshot and VM clients of the cloud provider
+	armInterceptors []interceptor.Interceptor
+	// auditLogger records the mutating cloud operations, nil if the audit log is disabled
+	auditLogger *audit.Logger
+	// dryRun answers the mutating cloud calls with a synthesized success, nil if not in dry-run mode
+	dryRun *dryRun
+	// faultInjector injects errors and latencies into the cloud calls, nil if fault injection is disabled
+	faultInjector *faultinject.Injector
+	// file and <namespace>/<name> of the ConfigMap holding the fault injection rules
+	faultInjectionConfig    string
+	faultInjectionConfigMap string
+	// file and <namespace>/<name> of the ConfigMap overriding the max data disk count of VM sizes
+	maxDataDiskCountConfig    string
+	maxDataDiskCountConfigMap string
+	// file and <namespace>/<name> of the ConfigMap defining the named perf profiles
+	perfProfilesConfig    string
+	perfProfilesConfigMap string
+	// directory of the original and applied device settings of the staged volumes
+	deviceTuningStateDir string
+	// PersistentVolumes the latest volume context of the tuned and restored staged volumes and the deleted thin volumes
+	// are read from, nil if there is no kubeClient
+	pvLister       corelisters.PersistentVolumeLister
+	pvListerSynced cache.InformerSynced
+	// parameters of the VolumeAttributesClasses by name, which are immutable
+	volumeAttributesClassParameters sync.Map
+	// file with the default mount options of the filesystem types on the node
+	fsDefaultsConfig string
+	// maximum duration of a filesystem check or repair on NodeStageVolume, no limit if 0
+	fsckTimeout time.Duration
+	// interval of checking the staged volumes for a read-only remount, disabled if 0
+	readOnlyRemountCheckInterval time.Duration
+	// filesystem volumes staged on the node, watched for a read-only remount
+	stagedVolumes stagedVolumeTable
+	// held by the recovery of a read-only remount while the staging path is unmounted, NodePublishVolume waits for it
+	stagingPathLocks keymutex.KeyMutex
+	// number of thin volumes added to the max volumes per node, the LVM thin pool of the node is disabled if 0
+	lvmThinVolumesPerNode int64
+	// lease keeping the throttling windows across controller restarts
+	throttlingStateLeaseName      string
+	throttlingStateLeaseNamespace string
 }
 
 // NewDriver Creates a NewCSIDriver object. Assumes vendor version is equal to driver version &
@@ -185,15 +243,82 @@ func NewDriver(options *DriverOptions) *Driver {
 	driver.maxConcurrentFormat = options.MaxConcurrentFormat
 	driver.concurrentFormatTimeout = options.ConcurrentFormatTimeout
 	driver.enableMinimumRetryAfter = options.EnableMinimumRetryAfter
+	driver.throttlingStateLeaseName = options.ThrottlingStateLeaseName
+	driver.throttlingStateLeaseNamespace = options.ThrottlingStateLeaseNamespace
 	driver.volumeLocks = volumehelper.NewVolumeLocks()
+	driver.stagingPathLocks = keymutex.NewHashed(0)
 	driver.ioHandler = azureutils.NewOSIOHandler()
 	driver.hostUtil = hostutil.NewHostUtil()
 
+	if options.EnableARMRateLimiter {
+		config := ratelimit.DefaultConfig()
+		config.ReadQPS = options.ARMRateLimiterReadQPS
+		config.ReadBurst = options.ARMRateLimiterReadBurst
+		config.WriteQPS = options.ARMRateLimiterWriteQPS
+		config.WriteBurst = options.ARMRateLimiterWriteBurst
+		config.MaxRetryAfter = time.Duration(options.ARMRateLimiterMaxRetryAfterInSec) * time.Second
+		config.MaxWait[ratelimit.PriorityCreate] = time.Duration(options.ARMRateLimiterCreateMaxWaitInSec) * time.Second
+		if err := config.Validate(); err != nil {
+			klog.Fatalf("invalid ARM rate limiter configuration: %v", err)
+		}
+		driver.armRateLimiter = ratelimit.NewLimiter(config)
+		driver.armInterceptors = append(driver.armInterceptors, driver.armRateLimiter.Interceptor())
+	}
+	driver.maxDataDiskCountConfig = options.MaxDataDiskCountConfig
+	driver.maxDataDiskCountConfigMap = options.MaxDataDiskCountConfigMap
+	driver.perfProfilesConfig = options.PerfProfilesConfig
+	driver.perfProfilesConfigMap = options.PerfProfilesConfigMap
+	driver.fsDefaultsConfig = options.FsDefaultsConfig
+	driver.fsckTimeout = time.Duration(options.FsckTimeoutInSeconds) * time.Second
+	if driver.NodeID != "" && runtime.GOOS == "linux" {
+		driver.readOnlyRemountCheckInterval = time.Duration(options.ReadOnlyRemountCheckIntervalInSec) * time.Second
+		driver.lvmThinVolumesPerNode = options.LVMThinVolumesPerNode
+	}
+	if driver.lvmThinVolumesPerNode > 0 && driver.Name == consts.DefaultDriverName {
+		klog.Fatalf("--lvm-thin-volumes-per-node requires its own --drivername, thin volumes must not share the max volumes per node of %s", consts.DefaultDriverName)
+	}
+	if driver.NodeID != "" && driver.perfOptimizationEnabled {
+		driver.deviceTuningStateDir = options.DeviceTuningStateDir
+		if driver.deviceTuningStateDir == "" {
+			driver.deviceTuningStateDir = getDeviceTuningStateDir(driver.endpoint)
+		}
+	}
+	if options.FaultInjectionConfig != "" || options.FaultInjectionConfigMap != "" {
+		klog.Warning("fault injection is enabled: disk, snapshot and VM calls may fail on purpose")
+		driver.faultInjector = faultinject.NewInjector()
+		driver.faultInjectionConfig = options.FaultInjectionConfig
+		driver.faultInjectionConfigMap = options.FaultInjectionConfigMap
+		// inside the rate limiter, so that injected throttling adapts its rate
+		driver.armInterceptors = append(driver.armInterceptors, driver.faultInjector.Interceptor())
+	}
+	if options.DryRun {
+		klog.Warning("dry-run mode: mutating disk, snapshot and VM calls will not be sent to Azure")
+		driver.dryRun = newDryRun()
+		// innermost, so that the intercepted calls still wait for the rate limiter and get traced
+		driver.armInterceptors = append(driver.armInterceptors, driver.dryRun.interceptor())
+	}
+	if options.AuditLogPath != "" {
+		key, err := os.ReadFile(options.AuditLogHMACKeyFile)
+		if err != nil {
+			klog.Fatalf("failed to read the HMAC key of the audit log, set --audit-log-hmac-key-file: %v", err)
+		}
+		auditLogger, err := audit.NewLogger(options.AuditLogPath, bytes.TrimSpace(key), strings.Split(options.AuditLogRedactKeys, ","))
+		if err != nil {
+			klog.Fatalf("failed to create audit log: %v", err)
+		}
+		driver.auditLogger = auditLogger
+	}
+	if options.EnableOtelTracing {
+		// outermost, so that the ARM span includes the wait for the rate limiter
+		driver.armInterceptors = append([]interceptor.Interceptor{armTracingInterceptor(driver.armRateLimiter)}, driver.armInterceptors...)
+	}
+
 	if driver.NodeID == "" {
 		// nodeid is not needed in controller component
 		klog.Warning("nodeid is empty")
 	}
 	topologyKey = fmt.Sprintf("topology.%s/zone", driver.Name)
+	nodeTopologyKey = fmt.Sprintf("topology.%s/node", driver.Name)
 
 	getter := func(_ context.Context, _ string) (interface{}, error) { return nil, nil }
 	var err error
@@ -203,6 +328,9 @@ func NewDriver(options *DriverOptions) *Driver {
 	if driver.checkDiskLunThrottlingCache, err = azcache.NewTimedCache(30*time.Minute, getter, false); err != nil {
 		klog.Fatalf("%v", err)
 	}
+	registerMetrics()
+	cacheState.setCache(throttlingCacheName, driver.throttlingCache)
+	cacheState.setCache(checkDiskLunThrottlingName, driver.checkDiskLunThrottlingCache)
 
 	if options.VolStatsCacheExpireInMinutes <= 0 {
 		options.VolStatsCacheExpireInMinutes = 10 // default expire in 10 minutes
@@ -219,6 +347,32 @@ func NewDriver(options *DriverOptions) *Driver {
 		klog.Warningf("get kubeconfig(%s) failed with error: %v", options.Kubeconfig, err)
 	}
 	driver.kubeClient = kubeClient
+	if kubeClient == nil && driver.lvmThinVolumesPerNode > 0 {
+		klog.Fatalf("--lvm-thin-volumes-per-node requires a kube client, the logical volumes of the deleted thin volumes are removed with their persistent volume")
+	}
+	if kubeClient != nil {
+		driver.eventRecorder = newEventRecorder(kubeClient, driver.Name)
+	}
+	if driver.faultInjector != nil {
+		if err := driver.loadFaultInjectionRules(context.Background()); err != nil {
+			klog.Errorf("failed to load fault injection rules: %v", err)
+		}
+	}
+	if driver.maxDataDiskCountConfig != "" || driver.maxDataDiskCountConfigMap != "" {
+		if err := driver.loadMaxDataDiskCountOverride(context.Background()); err != nil {
+			klog.Errorf("failed to load max data disk count override: %v", err)
+		}
+	}
+	if driver.perfProfilesConfig != "" || driver.perfProfilesConfigMap != "" {
+		if err := driver.loadPerfProfiles(context.Background()); err != nil {
+			klog.Errorf("failed to load perf profiles: %v", err)
+		}
+	}
+	if driver.fsDefaultsConfig != "" {
+		if err := driver.loadFsDefaults(); err != nil {
+			klog.Errorf("failed to load filesystem defaults: %v", err)
+		}
+	}
 
 	cloud, err := azureutils.GetCloudProviderFromClient(context.Background(), kubeClient, driver.cloudConfigSecretName, driver.cloudConfigSecretNamespace,
 		userAgent, driver.allowEmptyCloudConfig, driver.enableTrafficManager, driver.enableMinimumRetryAfter, driver.trafficManagerPort)
@@ -228,6 +382,7 @@ func NewDriver(options *DriverOptions) *Driver {
 	driver.cloud = cloud
 
 	if driver.cloud != nil {
+		driver.interceptCloudClients(driver.cloud)
 		driver.clientFactory = driver.cloud.ComputeClientFactory
 		if driver.vmType != "" {
 			klog.V(2).Infof("override VMType(%s) in cloud config as %s", driver.cloud.VMType, driver.vmType)
@@ -263,6 +418,10 @@ func NewDriver(options *DriverOptions) *Driver {
 		driver.diskController.ForceDetachBackoff = driver.forceDetachBackoff
 		driver.diskController.WaitForDetach = driver.waitForDetach
 		driver.diskController.CheckDiskCountForBatching = driver.checkDiskCountForBatching
+		if driver.dryRun != nil {
+			driver.diskController.dryRun = driver.dryRun
+			driver.dryRun.getDisk = driver.diskController.GetDiskByURI
+		}
 	}
 
 	driver.deviceHelper = optimization.NewSafeDeviceHelper()
@@ -303,12 +462,17 @@ func NewDriver(options *DriverOptions) *Driver {
 			csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
 			csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
 		})
-	driver.AddNodeServiceCapabilities([]csi.NodeServiceCapability_RPC_Type{
+	nodeCap := []csi.NodeServiceCapability_RPC_Type{
 		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
 		csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
-	})
+	}
+	if driver.readOnlyRemountCheckInterval > 0 || driver.lvmThinVolumesPerNode > 0 {
+		// the read-only remount check and the thin pool usage report the abnormal volumes in NodeGetVolumeStats
+		nodeCap = append(nodeCap, csi.NodeServiceCapability_RPC_VOLUME_CONDITION)
+	}
+	driver.AddNodeServiceCapabilities(nodeCap)
 
 	if kubeClient != nil && driver.removeNotReadyTaint && driver.NodeID != "" {
 		// Remove taint from node to indicate driver startup success
@@ -358,6 +522,68 @@ func (d *Driver) Run(ctx context.Context) error {
 		<-ctx.Done()
 		s.GracefulStop()
 	}()
+
+	if d.NodeID == "" && d.throttlingStateLeaseName != "" {
+		// restore the throttling windows of the previous controller before serving requests
+		d.syncThrottlingState(ctx)
+		go wait.UntilWithContext(ctx, d.syncThrottlingState, throttlingStateSyncInterval)
+	}
+	if d.faultInjector != nil {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := d.loadFaultInjectionRules(ctx); err != nil {
+				klog.Warningf("failed to reload fault injection rules, keeping the previous rules: %v", err)
+			}
+		}, faultInjectionReloadInterval)
+	}
+	if d.maxDataDiskCountConfig != "" {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := d.loadMaxDataDiskCountOverride(ctx); err != nil {
+				klog.Warningf("failed to reload max data disk count override, keeping the previous table: %v", err)
+			}
+		}, maxDataDiskCountReloadInterval)
+	} else if d.maxDataDiskCountConfigMap != "" {
+		if err := d.watchMaxDataDiskCountConfigMap(ctx); err != nil {
+			klog.Warningf("failed to watch max data disk count ConfigMap, keeping the table read at startup: %v", err)
+		}
+	}
+	if d.perfProfilesConfig != "" || d.perfProfilesConfigMap != "" {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := d.loadPerfProfiles(ctx); err != nil {
+				klog.Warningf("failed to reload perf profiles, keeping the previous profiles: %v", err)
+			}
+		}, perfProfilesReloadInterval)
+	}
+	if d.fsDefaultsConfig != "" {
+		go wait.UntilWithContext(ctx, func(_ context.Context) {
+			if err := d.loadFsDefaults(); err != nil {
+				klog.Warningf("failed to reload filesystem defaults, keeping the previous defaults: %v", err)
+			}
+		}, fsDefaultsReloadInterval)
+	}
+	// the controller of the thin volumes reads the pool volumes of the nodes from the PV informer
+	isThinVolumesController := d.NodeID == "" && d.Name != consts.DefaultDriverName
+	if d.kubeClient != nil && (d.deviceTuningStateDir != "" || d.readOnlyRemountCheckInterval > 0 || d.lvmThinVolumesPerNode > 0 || isThinVolumesController) {
+		d.startPVInformer(ctx)
+	}
+	if d.deviceTuningStateDir != "" {
+		go wait.UntilWithContext(ctx, d.reconcileDeviceTuning, deviceTuningReconcileInterval)
+	}
+	if d.readOnlyRemountCheckInterval > 0 {
+		go func() {
+			// the staged volumes are restored with the volume context of their PVs, without blocking requests
+			if d.pvLister != nil {
+				cache.WaitForCacheSync(ctx.Done(), d.pvListerSynced)
+			}
+			d.restoreStagedVolumes(ctx)
+			wait.UntilWithContext(ctx, d.checkReadOnlyRemounts, d.readOnlyRemountCheckInterval)
+		}()
+	}
+	if d.lvmThinVolumesPerNode > 0 && d.kubeClient != nil {
+		go func() {
+			cache.WaitForCacheSync(ctx.Done(), d.pvListerSynced)
+			wait.UntilWithContext(ctx, d.collectThinVolumes, thinVolumeCollectInterval)
+		}()
+	}
 	// Driver d act as IdentityServer, ControllerServer and NodeServer
 	listener, err := csicommon.Listen(ctx, d.endpoint)
 	if err != nil {
@@ -371,7 +597,44 @@ func (d *Driver) Run(ctx context.Context) error {
 	return err
 }
 
+// interceptCloudClients passes the disk, snapshot and VM calls of cloud, including the calls
+// made by its vmsets, through the driver interceptors
+func (d *Driver) interceptCloudClients(cloud *azure.Cloud) {
+	if cloud == nil || len(d.armInterceptors) == 0 {
+		return
+	}
+	cloud.ComputeClientFactory = interceptor.NewClientFactory(cloud.ComputeClientFactory, cloud.SubscriptionID, d.armInterceptors...)
+}
+
+// loadFaultInjectionRules reads the fault injection rules from the file or the ConfigMap
+func (d *Driver) loadFaultInjectionRules(ctx context.Context) error {
+	if d.faultInjectionConfig != "" {
+		return d.faultInjector.LoadFile(d.faultInjectionConfig)
+	}
+	namespace, name, found := strings.Cut(d.faultInjectionConfigMap, "/")
+	if !found || namespace == "" || name == "" {
+		return fmt.Errorf("invalid fault injection ConfigMap %q, expected <namespace>/<name>", d.faultInjectionConfigMap)
+	}
+	if d.kubeClient == nil {
+		return fmt.Errorf("kubeClient is nil, can not read fault injection ConfigMap %s", d.faultInjectionConfigMap)
+	}
+	return d.faultInjector.LoadConfigMap(ctx, d.kubeClient, namespace, name)
+}
+
+// sleepIfThrottled sleeps until a throttling error is expected to clear. With the ARM rate
+// limiter enabled the limiter holds back the following calls instead, so it returns at once.
+func (d *Driver) sleepIfThrottled(err error) {
+	if d.armRateLimiter != nil {
+		return
+	}
+	azureutils.SleepIfThrottled(err, consts.SnapshotOpThrottlingSleepSec)
+}
+
 func (d *Driver) isGetDiskThrottled(ctx context.Context) bool {
+	if d.armRateLimiter != nil && d.cloud != nil &&
+		d.armRateLimiter.IsThrottled(d.cloud.SubscriptionID, ratelimit.Class(&interceptor.Operation{ResourceType: interceptor.ResourceTypeDisk})) {
+		return true
+	}
 	cache, err := d.throttlingCache.Get(ctx, consts.GetDiskThrottlingKey, azcache.CacheReadTypeDefault)
 	if err != nil {
 		klog.Warningf("throttlingCache(%s) return with error: %s", consts.GetDiskThrottlingKey, err)
@@ -510,8 +773,17 @@ func (d *Driver) getSnapshotCompletionPercent(ctx context.Context, subsID, resou
 }
 
 // waitForSnapshotReady wait for completionPercent of snapshot is 100.0
-func (d *Driver) waitForSnapshotReady(ctx context.Context, subsID, resourceGroup, snapshotName string, intervel, timeout time.Duration) error {
-	completionPercent, err := d.getSnapshotCompletionPercent(ctx, subsID, resourceGroup, snapshotName)
+func (d *Driver) waitForSnapshotReady(ctx context.Context, subsID, resourceGroup, snapshotName string, intervel, timeout time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "waitForSnapshotReady", attrRG.String(resourceGroup), attrResourceName.String(snapshotName))
+	var completionPercent float32
+	polls := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("azuredisk.polls", polls), attribute.Float64("azuredisk.completion_percent", float64(completionPercent)))
+		endSpan(span, err)
+	}()
+
+	polls++
+	completionPercent, err = d.getSnapshotCompletionPercent(ctx, subsID, resourceGroup, snapshotName)
 	if err != nil {
 		return err
 	}
@@ -526,6 +798,7 @@ func (d *Driver) waitForSnapshotReady(ctx context.Context, subsID, resourceGroup
 	for {
 		select {
 		case <-timeTick:
+			polls++
 			completionPercent, err = d.getSnapshotCompletionPercent(ctx, subsID, resourceGroup, snapshotName)
 			if err != nil {
 				return err
@@ -574,6 +847,17 @@ func (d *Driver) getUsedLunsFromVolumeAttachments(ctx context.Context, nodeName
 				}
 				usedLuns = append(usedLuns, lun)
 			}
+			// the other members of a striped volume
+			if k, ok := va.Status.AttachmentMetadata[consts.StripeLUNs]; ok {
+				for _, member := range strings.Split(k, ",")[1:] {
+					lun, err := strconv.Atoi(member)
+					if err != nil {
+						klog.Warningf("VolumeAttachment(%s) stripe lun(%s) is not a valid integer", va.Name, member)
+						continue
+					}
+					usedLuns = append(usedLuns, lun)
+				}
+			}
 		}
 	}
 	return usedLuns, nil
@@ -69,6 +69,30 @@ type DriverOptions struct {
 	MaxConcurrentFormat               int64
 	ConcurrentFormatTimeout           int64
 	GoMaxProcs                        int64
+	EnableARMRateLimiter              bool
+	ARMRateLimiterReadQPS             float64
+	ARMRateLimiterReadBurst           int
+	ARMRateLimiterWriteQPS            float64
+	ARMRateLimiterWriteBurst          int
+	ARMRateLimiterMaxRetryAfterInSec  int64
+	ARMRateLimiterCreateMaxWaitInSec  int64
+	ThrottlingStateLeaseName          string
+	ThrottlingStateLeaseNamespace     string
+	AuditLogPath                      string
+	AuditLogRedactKeys                string
+	AuditLogHMACKeyFile               string
+	DryRun                            bool
+	FaultInjectionConfig              string
+	FaultInjectionConfigMap           string
+	MaxDataDiskCountConfig            string
+	MaxDataDiskCountConfigMap         string
+	PerfProfilesConfig                string
+	PerfProfilesConfigMap             string
+	DeviceTuningStateDir              string
+	FsDefaultsConfig                  string
+	FsckTimeoutInSeconds              int64
+	ReadOnlyRemountCheckIntervalInSec int64
+	LVMThinVolumesPerNode             int64
 }
 
 func (o *DriverOptions) AddFlags() *flag.FlagSet {
@@ -119,5 +143,29 @@ func (o *DriverOptions) AddFlags() *flag.FlagSet {
 	fs.Int64Var(&o.MaxConcurrentFormat, "max-concurrent-format", 2, "maximum number of concurrent format exec calls")
 	fs.Int64Var(&o.ConcurrentFormatTimeout, "concurrent-format-timeout", 300, "maximum time in seconds duration of a format operation before its concurrency token is released")
 	fs.Int64Var(&o.GoMaxProcs, "max-procs", 2, "maximum number of CPUs that can be executing simultaneously in golang runtime")
+	fs.BoolVar(&o.EnableARMRateLimiter, "enable-arm-rate-limiter", false, "boolean flag to send all disk, snapshot, VM and VMSS calls through a shared rate limiter which adapts to ARM throttling")
+	fs.Float64Var(&o.ARMRateLimiterReadQPS, "arm-rate-limiter-read-qps", 20, "ARM rate limiter QPS for read calls per subscription and resource type, must be greater than 0")
+	fs.IntVar(&o.ARMRateLimiterReadBurst, "arm-rate-limiter-read-burst", 100, "ARM rate limiter burst for read calls per subscription and resource type")
+	fs.Float64Var(&o.ARMRateLimiterWriteQPS, "arm-rate-limiter-write-qps", 5, "ARM rate limiter QPS for write calls per subscription and resource type, must be greater than 0")
+	fs.IntVar(&o.ARMRateLimiterWriteBurst, "arm-rate-limiter-write-burst", 50, "ARM rate limiter burst for write calls per subscription and resource type")
+	fs.Int64Var(&o.ARMRateLimiterMaxRetryAfterInSec, "arm-rate-limiter-max-retry-after-seconds", 300, "maximum time in seconds a throttling response blocks the calls of a subscription and resource type whatever its Retry-After, must be greater than 0")
+	fs.Int64Var(&o.ARMRateLimiterCreateMaxWaitInSec, "arm-rate-limiter-create-max-wait-seconds", 60, "maximum time in seconds a disk or snapshot creation waits in the ARM rate limiter before it is rejected, 0 means no limit")
+	fs.StringVar(&o.ThrottlingStateLeaseName, "throttling-state-lease-name", "", "name of the lease which keeps throttling windows across controller restarts, disabled if empty")
+	fs.StringVar(&o.ThrottlingStateLeaseNamespace, "throttling-state-lease-namespace", "kube-system", "namespace of the throttling state lease")
+	fs.StringVar(&o.AuditLogPath, "audit-log-path", "", "file the controller appends the audit records of mutating cloud operations to, - means stdout, disabled if empty")
+	fs.StringVar(&o.AuditLogHMACKeyFile, "audit-log-hmac-key-file", "", "file holding the key of the HMAC chaining the audit records, e.g. mounted from a Secret, required with --audit-log-path")
+	fs.StringVar(&o.AuditLogRedactKeys, "audit-log-redact-keys", "", "comma separated parameter keys whose values are redacted in the audit log, in addition to keys containing secret, password or token")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "boolean flag to answer the mutating disk, snapshot and VM calls of the controller with a synthesized success instead of sending them to Azure, reads still go to Azure")
+	fs.StringVar(&o.FaultInjectionConfig, "fault-injection-config", "", "file with the rules of the errors and latencies injected into disk, snapshot and VM calls, for failure testing only, disabled if empty")
+	fs.StringVar(&o.FaultInjectionConfigMap, "fault-injection-configmap", "", "<namespace>/<name> of the ConfigMap whose rules key holds the fault injection rules, for failure testing only, disabled if empty")
+	fs.StringVar(&o.MaxDataDiskCountConfig, "max-data-disk-count-config", "", "file with a VM size to max data disk count map or a resource SKU list, which overrides the built-in max data disk count of VM sizes, disabled if empty. The CSINode allocatable count picks up a change after a restart of the node plugin")
+	fs.StringVar(&o.MaxDataDiskCountConfigMap, "max-data-disk-count-configmap", "", "<namespace>/<name> of the ConfigMap whose maxDataDiskCount key overrides the built-in max data disk count of VM sizes, disabled if empty. The CSINode allocatable count picks up a change after a restart of the node plugin")
+	fs.StringVar(&o.PerfProfilesConfig, "perf-profiles-config", "", "file with the named perf profiles that StorageClasses select with perfProfile, set it on both the controller and the node plugin, disabled if empty")
+	fs.StringVar(&o.PerfProfilesConfigMap, "perf-profiles-configmap", "", "<namespace>/<name> of the ConfigMap whose perfProfiles key holds the named perf profiles, disabled if empty")
+	fs.StringVar(&o.DeviceTuningStateDir, "device-tuning-state-dir", "", "directory recording the original and applied device settings of the staged volumes of the node plugin, defaults to the device-tuning directory next to the unix socket of the endpoint")
+	fs.StringVar(&o.FsDefaultsConfig, "fs-defaults-config", "", "file with the default mount options per fstype which the node plugin adds to the mount options of staged volumes, disabled if empty")
+	fs.Int64Var(&o.FsckTimeoutInSeconds, "fsck-timeout-seconds", 600, "maximum time in seconds of a filesystem check or repair requested by the fsckPolicy of a volume, 0 means no limit")
+	fs.Int64Var(&o.ReadOnlyRemountCheckIntervalInSec, "readonly-remount-check-interval-seconds", 0, "interval in seconds of checking the staged volumes of the node plugin for a remount read-only after filesystem errors, only supported on Linux, disabled if 0")
+	fs.Int64Var(&o.LVMThinVolumesPerNode, "lvm-thin-volumes-per-node", 0, "max number of thin volumes of the LVM thin pool of the node, a value greater than 0 makes the node plugin serve only thin volumes with this max volumes per node, requires its own --drivername, only supported on Linux")
 	return fs
 }
@@ -34,6 +34,8 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/utils/ptr"
 	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/ratelimit"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/diskclient/mock_diskclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/snapshotclient/mock_snapshotclient"
@@ -99,6 +101,32 @@ func TestCheckDiskCapacityWithThrottling(t *testing.T) {
 	assert.Equal(t, flag, true)
 }
 
+func TestCheckDiskCapacityWithARMRateLimiter(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, _ := NewFakeDriver(cntl)
+	d := fd.(*fakeDriver)
+	d.armRateLimiter = ratelimit.NewLimiter(ratelimit.DefaultConfig())
+	d.armInterceptors = []interceptor.Interceptor{d.armRateLimiter.Interceptor()}
+
+	diskClient := mock_diskclient.NewMockInterface(cntl)
+	d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetDiskClientForSub("").Return(diskClient, nil).AnyTimes()
+	diskClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("Retriable: true, RetryAfter: 30s, HTTPStatusCode: 429, RawError: %s", consts.TooManyRequests)).Times(1)
+
+	d.interceptCloudClients(d.cloud)
+	d.diskController.clientFactory = d.cloud.ComputeClientFactory
+	assert.False(t, d.isGetDiskThrottled(context.TODO()))
+	flag, err := d.checkDiskCapacity(context.TODO(), "", "unit-test", "unit-test", 11)
+	assert.True(t, flag)
+	assert.NoError(t, err)
+
+	// the limiter blocks GetDisk after the throttling response
+	assert.True(t, d.isGetDiskThrottled(context.TODO()))
+	flag, err = d.checkDiskCapacity(context.TODO(), "", "unit-test", "unit-test", 11)
+	assert.True(t, flag)
+	assert.NoError(t, err)
+}
+
 func TestRun(t *testing.T) {
 	fakeCredFile := "fake-cred-file.json"
 	fakeCredContent := `{
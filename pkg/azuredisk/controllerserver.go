@@ -39,9 +39,12 @@ import (
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/audit"
 	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/optimization"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/ratelimit"
 	volumehelper "sigs.k8s.io/azuredisk-csi-driver/pkg/util"
 	azureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
@@ -65,8 +68,9 @@ type listVolumeStatus struct {
 
 // CreateVolume provisions an azure disk
 func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityCreate)
 	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
-		klog.Errorf("invalid create volume req: %v", req)
+		klog.FromContext(ctx).Error(err, "invalid create volume request")
 		return nil, err
 	}
 	params := make(map[string]string, len(req.GetParameters())+len(req.GetMutableParameters()))
@@ -92,6 +96,34 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	if err := azureutils.IsValidVolumeCapabilities(volCaps, diskParams.MaxShares); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	stripeCount := max(diskParams.StripeCount, 1)
+	if stripeCount > 1 {
+		if diskParams.MaxShares > 1 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported with shared disks", consts.StripeCountField)
+		}
+		for _, volCap := range volCaps {
+			if volCap.GetBlock() != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s is not supported with block volumes", consts.StripeCountField)
+			}
+		}
+	}
+	switch diskParams.LVMThinPool {
+	case consts.LVMThinPoolVolume:
+		if d.Name == consts.DefaultDriverName {
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s is provisioned by the thin volumes driver name, not by %s", consts.LVMThinPoolField, consts.LVMThinPoolVolume, d.Name)
+		}
+		if stripeCount > 1 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported with %s %s", consts.StripeCountField, consts.LVMThinPoolField, consts.LVMThinPoolVolume)
+		}
+		// a thin volume is carved out of the thin pool of a node, there is no disk to create
+		return d.createThinVolume(ctx, req, diskParams.VolumeContext)
+	case consts.LVMThinPoolPool:
+		for _, volCap := range volCaps {
+			if volCap.GetBlock() == nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s %s must be a block volume", consts.LVMThinPoolField, consts.LVMThinPoolPool)
+			}
+		}
+	}
 	isAdvancedPerfProfile := strings.EqualFold(diskParams.PerfProfile, consts.PerfProfileAdvanced)
 	// If perfProfile is set to advanced and no/invalid device settings are provided, fail the request
 	if d.getPerfOptimizationEnabled() && isAdvancedPerfProfile {
@@ -105,19 +137,33 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	}
 	defer d.volumeLocks.Release(name)
 
+	logger := klog.FromContext(ctx)
 	capacityBytes := req.GetCapacityRange().GetRequiredBytes()
 	volSizeBytes := int64(capacityBytes)
 	requestGiB := int(volumehelper.RoundUpGiB(volSizeBytes))
 
 	if diskParams.PerformancePlus != nil && *diskParams.PerformancePlus && requestGiB < consts.PerformancePlusMinimumDiskSizeGiB {
-		klog.Warningf("using PerformancePlus, increasing requested disk size from %vGiB to %vGiB (minimal size for PerformancePlus feature)", requestGiB, consts.PerformancePlusMinimumDiskSizeGiB)
+		csicommon.LogWarning(ctx, "using PerformancePlus, increasing requested disk size to the minimal size for PerformancePlus feature",
+			"requestGiB", requestGiB, "minimumGiB", consts.PerformancePlusMinimumDiskSizeGiB)
+		d.recordPVCEvent(ctx, params, v1.EventTypeWarning, eventReasonDiskSizeAdjusted,
+			"increased requested disk size from %dGiB to %dGiB, the minimal size for PerformancePlus", requestGiB, consts.PerformancePlusMinimumDiskSizeGiB)
 		requestGiB = consts.PerformancePlusMinimumDiskSizeGiB
 	}
 	if requestGiB < consts.MinimumDiskSizeGiB {
-		klog.Infof("increasing requested disk size from %vGiB to %vGiB (minimal disk size)", requestGiB, consts.MinimumDiskSizeGiB)
+		logger.Info("increasing requested disk size to the minimal disk size", "requestGiB", requestGiB, "minimumGiB", consts.MinimumDiskSizeGiB)
 		requestGiB = consts.MinimumDiskSizeGiB
 	}
 
+	// a striped volume is made of stripeCount disks of diskSizeGiB
+	diskSizeGiB := requestGiB
+	if stripeCount > 1 {
+		diskSizeGiB = int(getStripeMemberGiB(int64(requestGiB), stripeCount))
+		if diskParams.PerformancePlus != nil && *diskParams.PerformancePlus && diskSizeGiB < consts.PerformancePlusMinimumDiskSizeGiB {
+			diskSizeGiB = consts.PerformancePlusMinimumDiskSizeGiB
+		}
+		requestGiB = diskSizeGiB * stripeCount
+	}
+
 	maxVolSize := int(volumehelper.RoundUpGiB(req.GetCapacityRange().GetLimitBytes()))
 	if (maxVolSize > 0) && (maxVolSize < requestGiB) {
 		return nil, status.Error(codes.InvalidArgument, "After round-up, volume size exceeds the limit specified")
@@ -132,6 +178,7 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "create cloud with UserAgent(%s) failed with: (%s)", diskParams.UserAgent, err)
 		}
+		d.interceptCloudClients(localCloud)
 		localDiskController = &ManagedDiskController{
 			controllerCommon: &controllerCommon{
 				cloud:                     localCloud,
@@ -168,14 +215,15 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 				return nil, status.Error(codes.InvalidArgument, "CreateVolume diskName template must resolve to a non-empty value")
 			}
 			diskParams.DiskName = diskName
-			klog.V(2).Infof("Disk name (template) will be: %s, the name length is %d.", diskName, len(diskName))
+			logger.V(2).Info("disk name from template", "diskName", diskName, "length", len(diskName))
 		} else {
 			// Fallback to default name (original upstream behavior)
 			diskParams.DiskName = name
-			klog.V(2).Infof("Disk name (default) will be: %s, the name length is %d.", name, len(name))
+			logger.V(2).Info("disk name from volume name", "diskName", name, "length", len(name))
 		}
 	}
 	diskParams.DiskName = azureutils.CreateValidDiskName(diskParams.DiskName)
+	logger = logger.WithValues("diskName", diskParams.DiskName)
 
 	if diskParams.ResourceGroup == "" {
 		diskParams.ResourceGroup = d.cloud.ResourceGroup
@@ -192,6 +240,10 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	}
 	if skuName == armcompute.DiskStorageAccountTypesPremiumV2LRS {
 		// PremiumV2LRS only supports None caching mode
+		if diskParams.CachingMode != "" && diskParams.CachingMode != v1.AzureDataDiskCachingNone {
+			d.recordPVCEvent(ctx, params, v1.EventTypeWarning, eventReasonCachingModeAdjusted,
+				"set cachingMode as None instead of %s since %s only supports None caching mode", diskParams.CachingMode, skuName)
+		}
 		azureutils.SetKeyValueInMap(diskParams.VolumeContext, consts.CachingModeField, string(v1.AzureDataDiskCachingNone))
 	}
 
@@ -214,14 +266,14 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		diskParams.Location = d.cloud.Location
 		region := azureutils.GetRegionFromAvailabilityZone(diskZone)
 		if region != "" && region != d.cloud.Location {
-			klog.V(2).Infof("got a different region from zone %s for disk %s", diskZone, diskParams.DiskName)
+			logger.V(2).Info("got a different region from zone", "diskZone", diskZone, "location", region)
 			diskParams.Location = region
 		}
 	}
 	accessibleTopology := []*csi.Topology{}
 
 	if d.enableDiskCapacityCheck {
-		if ok, err := d.checkDiskCapacity(ctx, diskParams.SubscriptionID, diskParams.ResourceGroup, diskParams.DiskName, requestGiB); !ok {
+		if ok, err := d.checkDiskCapacity(ctx, diskParams.SubscriptionID, diskParams.ResourceGroup, diskParams.DiskName, diskSizeGiB); !ok {
 			return nil, err
 		}
 	}
@@ -256,31 +308,38 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 					},
 				},
 			}
-			subsID, resourceGroup, diskName, err := azureutils.GetInfoFromURI(sourceID)
+			subsID, resourceGroup, diskName, err := azureutils.GetInfoFromURI(splitStripedID(sourceID)[0])
 			if err != nil {
 				return nil, status.Errorf(codes.NotFound, "%v", err)
 			}
 			sourceGiB, disk, err := d.GetSourceDiskSize(ctx, subsID, resourceGroup, diskName, 0, consts.SourceDiskSearchMaxDepth)
 			if err == nil {
-				if sourceGiB != nil && *sourceGiB < int32(requestGiB) {
+				if sourceGiB != nil && *sourceGiB < int32(diskSizeGiB) {
 					diskParams.VolumeContext[consts.ResizeRequired] = strconv.FormatBool(true)
-					klog.V(2).Infof("source disk(%s) size(%d) is less than requested size(%d), set resizeRequired as true", sourceID, *sourceGiB, requestGiB)
+					logger.V(2).Info("source disk size is less than requested size, set resizeRequired as true", "sourceID", sourceID, "sourceGiB", *sourceGiB, "sizeGiB", diskSizeGiB)
 				}
 				if disk != nil && len(disk.Zones) == 1 {
 					if disk.Zones[0] != nil {
 						diskZone = fmt.Sprintf("%s-%s", diskParams.Location, *disk.Zones[0])
-						klog.V(2).Infof("source disk(%s) is in zone(%s), set diskZone as %s", sourceID, *disk.Zones[0], diskZone)
+						logger.V(2).Info("source disk is in a zone, set diskZone", "sourceID", sourceID, "sourceZone", *disk.Zones[0], "diskZone", diskZone)
 					}
 				}
 			} else {
-				klog.Warningf("failed to get source disk(%s) size, err: %v", sourceID, err)
+				csicommon.LogWarning(ctx, "failed to get source disk size", "diskName", diskParams.DiskName, "sourceID", sourceID, "err", err)
 			}
 			metricsRequest = "controller_create_volume_from_volume"
 		}
 	}
+	if err := validateStripeSource(sourceID, stripeCount); err != nil {
+		return nil, err
+	}
 
 	if strings.HasSuffix(strings.ToLower(string(skuName)), "zrs") {
-		klog.V(2).Infof("diskZone(%s) is reset as empty since disk(%s) is ZRS(%s)", diskZone, diskParams.DiskName, skuName)
+		logger.V(2).Info("diskZone is reset as empty since disk is ZRS", "diskZone", diskZone, "accountType", skuName)
+		if diskZone != "" {
+			d.recordPVCEvent(ctx, params, v1.EventTypeNormal, eventReasonDiskZoneReset,
+				"ignored zone %s since disk %s is %s and spans all zones of the region", diskZone, diskParams.DiskName, skuName)
+		}
 		diskZone = ""
 		// make volume scheduled on all 3 availability zones
 		for i := 1; i <= 3; i++ {
@@ -302,15 +361,17 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		}
 	}
 
-	klog.V(2).Infof("begin to create azure disk(%s) account type(%s) rg(%s) location(%s) size(%d) diskZone(%v) maxShares(%d)",
-		diskParams.DiskName, skuName, diskParams.ResourceGroup, diskParams.Location, requestGiB, diskZone, diskParams.MaxShares)
+	logger.V(2).Info("begin to create azure disk", "accountType", skuName, "resourceGroup", diskParams.ResourceGroup,
+		"location", diskParams.Location, "sizeGiB", diskSizeGiB, "diskZone", diskZone, "maxShares", diskParams.MaxShares, "stripeCount", stripeCount)
 
 	if skuName == armcompute.DiskStorageAccountTypesUltraSSDLRS {
 		if diskParams.DiskIOPSReadWrite == "" && diskParams.DiskMBPSReadWrite == "" {
 			// set default DiskIOPSReadWrite, DiskMBPSReadWrite per request size
-			diskParams.DiskIOPSReadWrite = strconv.Itoa(getDefaultDiskIOPSReadWrite(requestGiB))
-			diskParams.DiskMBPSReadWrite = strconv.Itoa(getDefaultDiskMBPSReadWrite(requestGiB))
-			klog.V(2).Infof("set default DiskIOPSReadWrite as %s, DiskMBPSReadWrite as %s on disk(%s)", diskParams.DiskIOPSReadWrite, diskParams.DiskMBPSReadWrite, diskParams.DiskName)
+			diskParams.DiskIOPSReadWrite = strconv.Itoa(getDefaultDiskIOPSReadWrite(diskSizeGiB))
+			diskParams.DiskMBPSReadWrite = strconv.Itoa(getDefaultDiskMBPSReadWrite(diskSizeGiB))
+			logger.V(2).Info("set default DiskIOPSReadWrite and DiskMBPSReadWrite", "diskIOPSReadWrite", diskParams.DiskIOPSReadWrite, "diskMBPSReadWrite", diskParams.DiskMBPSReadWrite)
+			d.recordPVCEvent(ctx, params, v1.EventTypeNormal, eventReasonDiskPerformanceDefaulted,
+				"set default DiskIOPSReadWrite as %s and DiskMBpsReadWrite as %s for %dGiB %s disk", diskParams.DiskIOPSReadWrite, diskParams.DiskMBPSReadWrite, diskSizeGiB, skuName)
 		}
 	}
 
@@ -327,7 +388,7 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		MaxShares:           int32(diskParams.MaxShares),
 		ResourceGroup:       diskParams.ResourceGroup,
 		SubscriptionID:      diskParams.SubscriptionID,
-		SizeGB:              requestGiB,
+		SizeGB:              diskSizeGiB,
 		StorageAccountType:  skuName,
 		SourceResourceID:    sourceID,
 		SourceType:          sourceType,
@@ -348,21 +409,38 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 
 	var diskURI string
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, metricsRequest, d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start(metricsRequest, params)
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.VolumeID, diskURI)
+		auditOp.End(audit.Outcome(isOperationSucceeded), diskURI)
 	}()
 
-	diskURI, err = localDiskController.CreateManagedDisk(ctx, volumeOptions)
-	if err != nil {
-		if strings.Contains(err.Error(), consts.NotFound) {
-			return nil, status.Error(codes.NotFound, err.Error())
+	// the members of a striped volume are created from the members of a striped source
+	sourceIDs := splitStripedID(sourceID)
+	memberURIs := make([]string, stripeCount)
+	for i := range memberURIs {
+		memberOptions := *volumeOptions
+		memberOptions.DiskName = getStripeMemberName(diskParams.DiskName, i)
+		memberOptions.SourceResourceID = sourceIDs[min(i, len(sourceIDs)-1)]
+		memberURIs[i], err = localDiskController.CreateManagedDisk(ctx, &memberOptions)
+		if err != nil {
+			// a retry creates the missing members with the same names, the created members are only
+			// deleted if the volume will not be created
+			if i > 0 && !isRetriableStripeError(err) {
+				deleteStripeMembers(ctx, localDiskController, memberURIs[:i])
+			}
+			if strings.Contains(err.Error(), consts.NotFound) {
+				return nil, status.Error(codes.NotFound, err.Error())
+			}
+			return nil, status.Errorf(codes.Internal, "%v", err)
 		}
-		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
+	diskURI = joinStripedID(memberURIs)
 
 	isOperationSucceeded = true
-	klog.V(2).Infof("create azure disk(%s) account type(%s) rg(%s) location(%s) size(%d) tags(%s) successfully", diskParams.DiskName, skuName, diskParams.ResourceGroup, diskParams.Location, requestGiB, diskParams.Tags)
+	logger.V(2).Info("create azure disk successfully", "volumeID", diskURI, "accountType", skuName, "resourceGroup", diskParams.ResourceGroup,
+		"location", diskParams.Location, "sizeGiB", requestGiB, "tags", diskParams.Tags)
 
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
@@ -386,9 +464,15 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 		return nil, status.Errorf(codes.Internal, "invalid delete volume req: %v", req)
 	}
 	diskURI := volumeID
+	if members := splitStripedID(volumeID); len(members) > 1 {
+		return d.deleteStripedVolume(ctx, req, members)
+	}
+	if _, name, isThin := parseThinVolumeID(volumeID); isThin {
+		return d.deleteThinVolume(ctx, volumeID, name)
+	}
 
 	if !azureutils.IsARMResourceID(diskURI) {
-		klog.Errorf("diskURI(%s) is not a valid ARM resource ID", diskURI)
+		klog.FromContext(ctx).Error(nil, "volume ID is not a valid ARM resource ID", "volumeID", diskURI)
 		return &csi.DeleteVolumeResponse{}, nil
 	}
 
@@ -397,15 +481,19 @@ func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 	}
 	defer d.volumeLocks.Release(volumeID)
 
+	ctx, logger := csicommon.NewLogContext(ctx, "volumeID", diskURI)
+
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "controller_delete_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start("controller_delete_volume", map[string]string{consts.VolumeID: diskURI})
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.VolumeID, diskURI)
+		auditOp.End(audit.Outcome(isOperationSucceeded), diskURI)
 	}()
 
-	klog.V(2).Infof("deleting azure disk(%s)", diskURI)
+	logger.V(2).Info("deleting azure disk")
 	err := d.diskController.DeleteManagedDisk(ctx, diskURI)
-	klog.V(2).Infof("delete azure disk(%s) returned with %v", diskURI, err)
+	logger.V(2).Info("delete azure disk returned", "err", err)
 	isOperationSucceeded = (err == nil)
 	return &csi.DeleteVolumeResponse{}, err
 }
@@ -425,6 +513,12 @@ func (d *Driver) ControllerModifyVolume(ctx context.Context, req *csi.Controller
 	if err := d.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_MODIFY_VOLUME); err != nil {
 		return nil, status.Errorf(codes.Internal, "invalid modify volume req: %v", req)
 	}
+	if members := splitStripedID(volumeID); len(members) > 1 {
+		return d.modifyStripedVolume(ctx, req, members)
+	}
+	if _, _, isThin := parseThinVolumeID(volumeID); isThin {
+		return nil, status.Error(codes.InvalidArgument, "thin volumes can not be modified")
+	}
 	diskURI := volumeID
 	if _, err := d.checkDiskExists(ctx, diskURI); err != nil {
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("Volume not found, failed with error: %v", err))
@@ -444,8 +538,9 @@ func (d *Driver) ControllerModifyVolume(ctx context.Context, req *csi.Controller
 		skuName = ""
 	}
 
-	klog.V(2).Infof("begin to modify azure disk(%s) account type(%s) rg(%s) location(%s)",
-		diskParams.DiskName, skuName, diskParams.ResourceGroup, diskParams.Location)
+	logger := klog.FromContext(ctx).WithValues("volumeID", diskURI)
+	logger.V(2).Info("begin to modify azure disk", "accountType", skuName, "diskIOPSReadWrite", diskParams.DiskIOPSReadWrite,
+		"diskMBpsReadWrite", diskParams.DiskMBPSReadWrite)
 
 	volumeOptions := &ManagedDiskOptions{
 		DiskIOPSReadWrite:  diskParams.DiskIOPSReadWrite,
@@ -458,9 +553,11 @@ func (d *Driver) ControllerModifyVolume(ctx context.Context, req *csi.Controller
 	}
 
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "controller_modify_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start("controller_modify_volume", req.GetMutableParameters())
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.VolumeID, diskURI)
+		auditOp.End(audit.Outcome(isOperationSucceeded), diskURI)
 	}()
 
 	if err = d.diskController.ModifyDisk(ctx, volumeOptions); err != nil {
@@ -471,13 +568,14 @@ func (d *Driver) ControllerModifyVolume(ctx context.Context, req *csi.Controller
 	}
 
 	isOperationSucceeded = true
-	klog.V(2).Infof("modify azure disk(%s) account type(%s) rg(%s) location(%s) successfully", diskParams.DiskName, skuName, diskParams.ResourceGroup, diskParams.Location)
+	logger.V(2).Info("modify azure disk successfully", "accountType", skuName)
 
 	return &csi.ControllerModifyVolumeResponse{}, err
 }
 
 // ControllerPublishVolume attach an azure disk to a required node
 func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityAttach)
 	diskURI := req.GetVolumeId()
 	if len(diskURI) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -497,12 +595,19 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 	if err := azureutils.IsValidVolumeCapabilities(caps, maxShares); err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	if members := splitStripedID(diskURI); len(members) > 1 {
+		return d.publishStripedVolume(ctx, req, members)
+	}
+	if _, _, isThin := parseThinVolumeID(diskURI); isThin {
+		// the thin volume is on the disk of the thin pool, which is attached with the pool volume
+		return &csi.ControllerPublishVolumeResponse{PublishContext: map[string]string{}}, nil
+	}
 
 	disk, err := d.checkDiskExists(ctx, diskURI)
 	if err != nil {
 		if strings.Contains(err.Error(), "context deadline") {
 			disk = nil
-			klog.Warningf("checkDiskExists(%s) failed with %v, proceed to attach disk", diskURI, err)
+			csicommon.LogWarning(ctx, "checkDiskExists failed, proceed to attach disk", "volumeID", diskURI, "err", err)
 		} else {
 			return nil, status.Error(codes.NotFound, fmt.Sprintf("Volume not found, failed with error: %v", err))
 		}
@@ -518,11 +623,15 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
+	ctx, logger := csicommon.NewLogContext(ctx, "volumeID", diskURI, "node", nodeName)
 
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "controller_publish_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start("controller_publish_volume", req.GetVolumeContext())
+	auditOp.SetNode(string(nodeName))
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.VolumeID, diskURI, consts.Node, string(nodeName))
+		auditOp.End(audit.Outcome(isOperationSucceeded), diskURI)
 	}()
 
 	lun, vmState, err := d.diskController.GetDiskLun(ctx, diskName, diskURI, nodeName)
@@ -535,7 +644,7 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 		vmStateStr = *vmState
 	}
 
-	klog.V(2).Infof("GetDiskLun returned: %v. Initiating attaching volume %s to node %s (vmState %s).", err, diskURI, nodeName, vmStateStr)
+	logger.V(2).Info("GetDiskLun returned, initiating attaching volume", "err", err, "vmState", vmStateStr)
 
 	volumeContext := req.GetVolumeContext()
 	if volumeContext == nil {
@@ -544,13 +653,13 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 
 	if err == nil {
 		if vmState != nil && strings.ToLower(*vmState) == "failed" {
-			klog.Warningf("VM(%s) is in failed state, update VM first", nodeName)
+			csicommon.LogWarning(ctx, "VM is in failed state, update VM first")
 			if err := d.diskController.UpdateVM(ctx, nodeName); err != nil {
 				return nil, status.Errorf(codes.Internal, "update instance %q failed with %v", nodeName, err)
 			}
 		}
 		// Volume is already attached to node.
-		klog.V(2).Infof("Attach operation is successful. volume %s is already attached to node %s at lun %d.", diskURI, nodeName, lun)
+		logger.V(2).Info("Attach operation is successful, volume is already attached to node", "lun", lun)
 	} else {
 		if !strings.Contains(err.Error(), azureconsts.CannotFindDiskLUN) {
 			return nil, status.Errorf(codes.Internal, "could not get disk lun for volume %s: %v", diskURI, err)
@@ -560,33 +669,36 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 			return nil, status.Errorf(codes.Internal, "%v", err)
 		}
 
-		occupiedLuns := d.getOccupiedLunsFromNode(ctx, nodeName, diskURI)
-		klog.V(2).Infof("Trying to attach volume %s to node %s", diskURI, nodeName)
+		occupiedLuns := d.getOccupiedLunsFromNode(ctx, nodeName)
+		logger.V(2).Info("Trying to attach volume")
 
 		attachDiskInitialDelay := azureutils.GetAttachDiskInitialDelay(volumeContext)
 		if attachDiskInitialDelay > 0 {
-			klog.V(2).Infof("attachDiskInitialDelayInMs is set to %d", attachDiskInitialDelay)
+			logger.V(2).Info("attachDiskInitialDelayInMs is set", "attachDiskInitialDelayInMs", attachDiskInitialDelay)
 			d.diskController.AttachDetachInitialDelayInMs = attachDiskInitialDelay
 		}
+		if _, reason := getAttachCachingMode(disk, cachingMode); reason != "" {
+			d.recordAttachEvent(ctx, getAttachVolumeHandle(ctx, diskURI), nodeName, volumeContext, v1.EventTypeWarning, eventReasonCachingModeAdjusted, "disk %s: %s", diskName, reason)
+		}
 		lun, err = d.diskController.AttachDisk(ctx, diskName, diskURI, nodeName, cachingMode, disk, occupiedLuns)
 		if err == nil {
-			klog.V(2).Infof("Attach operation successful: volume %s attached to node %s.", diskURI, nodeName)
+			logger.V(2).Info("Attach operation successful", "lun", lun)
 		} else {
 			if derr, ok := err.(*volerr.DanglingAttachError); ok {
 				if strings.EqualFold(string(nodeName), string(derr.CurrentNode)) {
 					err := status.Errorf(codes.Internal, "volume %s is actually attached to current node %s, return error", diskURI, nodeName)
-					klog.Warningf("%v", err)
+					csicommon.LogWarning(ctx, err.Error())
 					return nil, err
 				}
-				klog.Warningf("volume %s is already attached to node %s, try detach first", diskURI, derr.CurrentNode)
+				csicommon.LogWarning(ctx, "volume is already attached to another node, try detach first", "currentNode", derr.CurrentNode)
 				if err = d.diskController.DetachDisk(ctx, diskName, diskURI, derr.CurrentNode); err != nil {
 					return nil, status.Errorf(codes.Internal, "Could not detach volume %s from node %s: %v", diskURI, derr.CurrentNode, err)
 				}
-				klog.V(2).Infof("Trying to attach volume %s to node %s again", diskURI, nodeName)
+				logger.V(2).Info("Trying to attach volume again")
 				lun, err = d.diskController.AttachDisk(ctx, diskName, diskURI, nodeName, cachingMode, disk, occupiedLuns)
 			}
 			if err != nil {
-				klog.Errorf("Attach volume %s to instance %s failed with %v", diskURI, nodeName, err)
+				logger.Error(err, "Attach volume failed")
 				errMsg := fmt.Sprintf("Attach volume %s to instance %s failed with %v", diskURI, nodeName, err)
 				if len(errMsg) > maxErrMsgLength {
 					errMsg = errMsg[:maxErrMsgLength]
@@ -594,13 +706,14 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 				return nil, status.Errorf(codes.Internal, "%v", errMsg)
 			}
 		}
-		klog.V(2).Infof("attach volume %s to node %s successfully", diskURI, nodeName)
+		logger.V(2).Info("attach volume successfully", "lun", lun)
 	}
 
 	publishContext := map[string]string{consts.LUN: strconv.Itoa(int(lun))}
+	azureutils.InsertDiskIdentity(disk, publishContext)
 	if disk != nil {
 		if _, ok := volumeContext[consts.RequestedSizeGib]; !ok {
-			klog.V(6).Infof("found static PV(%s), insert disk properties to volumeattachments", diskURI)
+			logger.V(6).Info("found static PV, insert disk properties to volumeattachments")
 			azureutils.InsertDiskProperties(disk, publishContext)
 		}
 	}
@@ -610,6 +723,7 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 
 // ControllerUnpublishVolume detach an azure disk from a required node
 func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityDetach)
 	diskURI := req.GetVolumeId()
 	if len(diskURI) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -620,25 +734,36 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 		return nil, status.Error(codes.InvalidArgument, "Node ID not provided")
 	}
 	nodeName := types.NodeName(nodeID)
+	if members := splitStripedID(diskURI); len(members) > 1 {
+		return d.unpublishStripedVolume(ctx, req, members)
+	}
+	if _, _, isThin := parseThinVolumeID(diskURI); isThin {
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
 
 	_, _, diskName, err := azureutils.GetInfoFromURI(diskURI)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "%v", err)
 	}
 
+	ctx, logger := csicommon.NewLogContext(ctx, "volumeID", diskURI, "node", nodeName)
+
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "controller_unpublish_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start("controller_unpublish_volume", map[string]string{consts.VolumeID: diskURI, consts.Node: nodeID})
+	auditOp.SetNode(string(nodeName))
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.VolumeID, diskURI, consts.Node, string(nodeName))
+		auditOp.End(audit.Outcome(isOperationSucceeded), diskURI)
 	}()
 
-	klog.V(2).Infof("Trying to detach volume %s from node %s", diskURI, nodeID)
+	logger.V(2).Info("Trying to detach volume")
 
 	if err := d.diskController.DetachDisk(ctx, diskName, diskURI, nodeName); err != nil {
 		if strings.Contains(err.Error(), consts.ErrDiskNotFound) {
-			klog.Warningf("volume %s already detached from node %s", diskURI, nodeID)
+			csicommon.LogWarning(ctx, "volume already detached from node")
 		} else {
-			klog.Errorf("Could not detach volume %s from node %s: %v", diskURI, nodeID, err)
+			logger.Error(err, "Could not detach volume")
 			errMsg := fmt.Sprintf("Could not detach volume %s from node %s: %v", diskURI, nodeID, err)
 			if len(errMsg) > maxErrMsgLength {
 				errMsg = errMsg[:maxErrMsgLength]
@@ -646,7 +771,7 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 			return nil, status.Errorf(codes.Internal, "%v", errMsg)
 		}
 	}
-	klog.V(2).Infof("detach volume %s from node %s successfully", diskURI, nodeID)
+	logger.V(2).Info("detach volume successfully")
 	isOperationSucceeded = true
 
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
@@ -674,8 +799,12 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
 	}
 
-	if _, err := d.checkDiskExists(ctx, diskURI); err != nil {
-		return nil, status.Error(codes.NotFound, fmt.Sprintf("Volume not found, failed with error: %v", err))
+	if _, _, isThin := parseThinVolumeID(diskURI); !isThin {
+		for _, member := range splitStripedID(diskURI) {
+			if _, err := d.checkDiskExists(ctx, member); err != nil {
+				return nil, status.Error(codes.NotFound, fmt.Sprintf("Volume not found, failed with error: %v", err))
+			}
+		}
 	}
 
 	return &csi.ValidateVolumeCapabilitiesResponse{
@@ -685,11 +814,13 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 }
 
 // getOccupiedLunsFromNode returns the occupied luns from node
-func (d *Driver) getOccupiedLunsFromNode(ctx context.Context, nodeName types.NodeName, diskURI string) []int {
+// with the volume ID and node logged through ctx
+func (d *Driver) getOccupiedLunsFromNode(ctx context.Context, nodeName types.NodeName) []int {
 	var occupiedLuns []int
 	if d.checkDiskLUNCollision && !d.isCheckDiskLunThrottled(ctx) {
+		logger := klog.FromContext(ctx)
 		timer := time.AfterFunc(checkDiskLunThrottleLatency, func() {
-			klog.Warningf("checkDiskLun(%s) on node %s took longer than %v, disable disk lun check temporarily", diskURI, nodeName, checkDiskLunThrottleLatency)
+			csicommon.LogWarning(ctx, "checkDiskLun took too long, disable disk lun check temporarily", "limit", checkDiskLunThrottleLatency)
 			d.checkDiskLunThrottlingCache.Set(consts.CheckDiskLunThrottlingKey, "")
 		})
 		now := time.Now()
@@ -698,23 +829,25 @@ func (d *Driver) getOccupiedLunsFromNode(ctx context.Context, nodeName types.Nod
 				if usedLunsFromNode, err := d.getUsedLunsFromNode(ctx, nodeName); err == nil {
 					occupiedLuns = volumehelper.GetElementsInArray1NotInArray2(usedLunsFromVA, usedLunsFromNode)
 					if len(occupiedLuns) > 0 {
-						klog.Warningf("node: %s, usedLuns from VolumeAttachments: %v, usedLuns from Node: %v, occupiedLuns: %v, disk: %s", nodeName, usedLunsFromVA, usedLunsFromNode, occupiedLuns, diskURI)
+						csicommon.LogWarning(ctx, "found occupied luns on node",
+							"usedLunsFromVolumeAttachments", usedLunsFromVA, "usedLunsFromNode", usedLunsFromNode, "occupiedLuns", occupiedLuns)
 					} else {
-						klog.V(6).Infof("node: %s, usedLuns from VolumeAttachments: %v, usedLuns from Node: %v, occupiedLuns: %v, disk: %s", nodeName, usedLunsFromVA, usedLunsFromNode, occupiedLuns, diskURI)
+						logger.V(6).Info("no occupied luns on node",
+							"usedLunsFromVolumeAttachments", usedLunsFromVA, "usedLunsFromNode", usedLunsFromNode)
 					}
 				} else {
-					klog.Warningf("getUsedLunsFromNode(%s, %s) failed with %v", nodeName, diskURI, err)
+					csicommon.LogWarning(ctx, "getUsedLunsFromNode failed", "err", err)
 				}
 			}
 		} else {
-			klog.Warningf("getUsedLunsFromVolumeAttachments(%s, %s) failed with %v", nodeName, diskURI, err)
+			csicommon.LogWarning(ctx, "getUsedLunsFromVolumeAttachments failed", "err", err)
 		}
 		latency := time.Since(now)
 		if latency > checkDiskLunThrottleLatency {
-			klog.Warningf("checkDiskLun(%s) on node %s took %v (limit: %v)", diskURI, nodeName, latency, checkDiskLunThrottleLatency)
+			csicommon.LogWarning(ctx, "checkDiskLun took too long", "latency", latency, "limit", checkDiskLunThrottleLatency)
 		} else {
 			timer.Stop() // cancel the timer
-			klog.V(6).Infof("checkDiskLun(%s) on node %s took %v", diskURI, nodeName, latency)
+			logger.V(6).Info("checkDiskLun finished", "latency", latency)
 		}
 	}
 	return occupiedLuns
@@ -746,10 +879,10 @@ func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (
 		}
 	}
 	if d.cloud.KubeClient != nil && d.cloud.KubeClient.CoreV1() != nil && d.cloud.KubeClient.CoreV1().PersistentVolumes() != nil {
-		klog.V(6).Infof("List Volumes in Cluster:")
+		klog.FromContext(ctx).V(6).Info("List Volumes in Cluster")
 		return d.listVolumesInCluster(ctx, start, int(req.MaxEntries))
 	}
-	klog.V(6).Infof("List Volumes in Node Resource Group: %s", d.cloud.ResourceGroup)
+	klog.FromContext(ctx).V(6).Info("List Volumes in Node Resource Group", "resourceGroup", d.cloud.ResourceGroup)
 	return d.listVolumesInNodeResourceGroup(ctx, start, int(req.MaxEntries))
 }
 
@@ -768,7 +901,7 @@ func (d *Driver) listVolumesInCluster(ctx context.Context, start, maxEntries int
 			diskURI := pv.Spec.CSI.VolumeHandle
 			_, rg, _, err := azureutils.GetInfoFromURI(diskURI)
 			if err != nil {
-				klog.Warningf("failed to get subscription id, resource group from disk uri (%s) with error(%v)", diskURI, err)
+				csicommon.LogWarning(ctx, "failed to get subscription id, resource group from volume ID", "volumeID", diskURI, "err", err)
 				continue
 			}
 			rg, diskURI = strings.ToLower(rg), strings.ToLower(diskURI)
@@ -935,6 +1068,13 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 	requestSize := *resource.NewQuantity(capacityBytes, resource.BinarySI)
 
 	diskURI := req.GetVolumeId()
+	if members := splitStripedID(diskURI); len(members) > 1 {
+		return d.expandStripedVolume(ctx, req, members)
+	}
+	if node, _, isThin := parseThinVolumeID(diskURI); isThin {
+		return d.expandThinVolume(ctx, diskURI, node, capacityBytes)
+	}
+	ctx, logger := csicommon.NewLogContext(ctx, "volumeID", diskURI)
 	result, rerr := d.diskController.GetDiskByURI(ctx, diskURI)
 	if rerr != nil {
 		return nil, status.Errorf(codes.Internal, "GetDiskByURI(%s) failed with error(%v)", diskURI, rerr)
@@ -945,12 +1085,14 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 	oldSize := *resource.NewQuantity(int64(*result.Properties.DiskSizeGB), resource.BinarySI)
 
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "controller_expand_volume", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start("controller_expand_volume", map[string]string{"requiredBytes": strconv.FormatInt(capacityBytes, 10)})
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.VolumeID, diskURI)
+		auditOp.End(audit.Outcome(isOperationSucceeded), diskURI)
 	}()
 
-	klog.V(2).Infof("begin to expand azure disk(%s) with new size(%d)", diskURI, requestSize.Value())
+	logger.V(2).Info("begin to expand azure disk", "newSize", requestSize.Value())
 	newSize, err := d.diskController.ResizeDisk(ctx, diskURI, oldSize, requestSize, d.enableDiskOnlineResize)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to resize disk(%s) with error(%v)", diskURI, err)
@@ -962,17 +1104,17 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 	}
 
 	isOperationSucceeded = true
-	klog.V(2).Infof("expand azure disk(%s) successfully, currentSize(%d)", diskURI, currentSize)
+	logger.V(2).Info("expand azure disk successfully", "currentSize", currentSize)
 
 	if result.ManagedBy != nil {
 		attachedNode, err := d.cloud.VMSet.GetNodeNameByProviderID(ctx, *result.ManagedBy)
 		if err == nil {
-			klog.V(2).Infof("delete cache for node (%s, %s) after disk(%s) expanded", attachedNode, *result.ManagedBy, diskURI)
+			logger.V(2).Info("delete cache for node after disk expanded", "node", attachedNode, "managedBy", *result.ManagedBy)
 			if err = d.cloud.VMSet.DeleteCacheForNode(ctx, string(attachedNode)); err != nil {
-				klog.Warningf("failed to delete cache for node %s with error(%v)", attachedNode, err)
+				csicommon.LogWarning(ctx, "failed to delete cache for node", "node", attachedNode, "err", err)
 			}
 		} else {
-			klog.Warningf("failed to get attached node for disk(%s) with error(%v)", diskURI, err)
+			csicommon.LogWarning(ctx, "failed to get attached node for disk", "err", err)
 		}
 	}
 
@@ -984,6 +1126,7 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 
 // CreateSnapshot create a snapshot
 func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityCreate)
 	sourceVolumeID := req.GetSourceVolumeId()
 	if len(sourceVolumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "CreateSnapshot Source Volume ID must be provided")
@@ -992,8 +1135,15 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 	if len(snapshotName) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "snapshot name must be provided")
 	}
+	if members := splitStripedID(sourceVolumeID); len(members) > 1 {
+		return d.createStripedSnapshot(ctx, req, members)
+	}
+	if _, _, isThin := parseThinVolumeID(sourceVolumeID); isThin {
+		return nil, status.Error(codes.InvalidArgument, "thin volumes do not support snapshots")
+	}
 
 	snapshotName = azureutils.CreateValidDiskName(snapshotName)
+	ctx, logger := csicommon.NewLogContext(ctx, "snapshotName", snapshotName, "sourceVolumeID", sourceVolumeID)
 
 	var customTags string
 	// set incremental snapshot as true by default
@@ -1043,7 +1193,7 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 	}
 
 	if azureutils.IsAzureStackCloud(localCloud.Config.Cloud, localCloud.Config.DisableAzureStackCloud) {
-		klog.V(2).Info("Use full snapshot instead as Azure Stack does not support incremental snapshot.")
+		logger.V(2).Info("Use full snapshot instead as Azure Stack does not support incremental snapshot.")
 		incremental = false
 	}
 
@@ -1077,7 +1227,7 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 	}
 
 	if d.cloud.HasExtendedLocation() {
-		klog.V(2).Infof("extended location Name:%s Type:%s is set on snapshot %s, source volume %s", d.cloud.ExtendedLocationName, d.cloud.ExtendedLocationType, snapshotName, sourceVolumeID)
+		logger.V(2).Info("extended location is set on snapshot", "extendedLocationName", d.cloud.ExtendedLocationName, "extendedLocationType", d.cloud.ExtendedLocationType)
 		snapshot.ExtendedLocation = &armcompute.ExtendedLocation{
 			Name: to.Ptr(d.cloud.ExtendedLocationName),
 			Type: to.Ptr(armcompute.ExtendedLocationTypes(d.cloud.ExtendedLocationType)),
@@ -1111,15 +1261,20 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 		metricsRequest = "controller_create_snapshot_cross_region"
 	}
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, metricsRequest, d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start(metricsRequest, req.GetParameters())
+	var snapshotID string
 	isOperationSucceeded := false
 	isOperationInProgress := false
 	defer func() {
 		if !isOperationInProgress {
 			mc.ObserveOperationWithResult(isOperationSucceeded, consts.SourceResourceID, sourceVolumeID, consts.SnapshotName, snapshotName)
+			auditOp.End(audit.Outcome(isOperationSucceeded), sourceVolumeID, snapshotID)
+		} else {
+			auditOp.End(audit.OutcomeInProgress, sourceVolumeID, snapshotID)
 		}
 	}()
 
-	klog.V(2).Infof("begin to create snapshot(%s, incremental: %v) under rg(%s) region(%s)", snapshotName, incremental, resourceGroup, d.cloud.Location)
+	logger.V(2).Info("begin to create snapshot", "incremental", incremental, "resourceGroup", resourceGroup, "region", d.cloud.Location)
 	snapshotClient, err := d.clientFactory.GetSnapshotClientForSub(subsID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get snapshot client for subscription(%s) with error(%v)", subsID, err)
@@ -1132,7 +1287,7 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 				return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("request snapshot(%s) under rg(%s) already exists, but the SourceVolumeId is different, error details: %v", snapshotName, resourceGroup, err))
 			}
 
-			azureutils.SleepIfThrottled(err, consts.SnapshotOpThrottlingSleepSec)
+			d.sleepIfThrottled(err)
 			return nil, status.Error(codes.Internal, fmt.Sprintf("create snapshot error: %v", err.Error()))
 		}
 	}
@@ -1142,13 +1297,13 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 			return nil, status.Error(codes.Internal, fmt.Sprintf("waitForSnapshotReady(%s, %s, %s) failed with %v", subsID, resourceGroup, snapshotName, err))
 		}
 	}
-	klog.V(2).Infof("create snapshot(%s) under rg(%s) region(%s) successfully", snapshotName, resourceGroup, d.cloud.Location)
+	logger.V(2).Info("create snapshot successfully", "resourceGroup", resourceGroup, "region", d.cloud.Location)
 
 	csiSnapshot, err = d.getSnapshotByID(ctx, subsID, resourceGroup, snapshotName, sourceVolumeID)
 	if err != nil {
 		return nil, err
 	} else if csiSnapshot == nil {
-		klog.Errorf("getSnapshotByID(%s, %s, %s) did not return a valid snapshot", subsID, resourceGroup, snapshotName)
+		logger.Error(nil, "getSnapshotByID did not return a valid snapshot", "subscriptionID", subsID, "resourceGroup", resourceGroup)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("getSnapshotByID(%s, %s, %s) did not return a valid snapshot", subsID, resourceGroup, snapshotName))
 	}
 
@@ -1166,16 +1321,16 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 			copySnapshot.Properties.CreationData.CreateOption = to.Ptr(armcompute.DiskCreateOptionCopyStart)
 			copySnapshot.Location = &location
 
-			klog.V(2).Infof("begin to create snapshot(%s, incremental: %v) under rg(%s) region(%s)", crossRegionSnapshotName, incremental, resourceGroup, location)
+			logger.V(2).Info("begin to create cross region snapshot", "crossRegionSnapshotName", crossRegionSnapshotName, "incremental", incremental, "resourceGroup", resourceGroup, "region", location)
 			if _, err := snapshotClient.CreateOrUpdate(ctx, resourceGroup, crossRegionSnapshotName, copySnapshot); err != nil {
 				if strings.Contains(err.Error(), "existing disk") {
 					return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("request snapshot(%s) under rg(%s) already exists, but the SourceVolumeId is different, error details: %v", crossRegionSnapshotName, resourceGroup, err))
 				}
 
-				azureutils.SleepIfThrottled(err, consts.SnapshotOpThrottlingSleepSec)
+				d.sleepIfThrottled(err)
 				return nil, status.Error(codes.Internal, fmt.Sprintf("create snapshot error: %v", err))
 			}
-			klog.V(2).Infof("create snapshot(%s) under rg(%s) region(%s) successfully", crossRegionSnapshotName, resourceGroup, location)
+			logger.V(2).Info("create cross region snapshot successfully", "crossRegionSnapshotName", crossRegionSnapshotName, "resourceGroup", resourceGroup, "region", location)
 		}
 
 		if d.shouldWaitForSnapshotReady {
@@ -1190,12 +1345,12 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 		}
 
 		if csiSnapshot.ReadyToUse {
-			klog.V(2).Infof("begin to delete snapshot(%s) under rg(%s) region(%s)", snapshotName, resourceGroup, d.cloud.Location)
+			logger.V(2).Info("begin to delete snapshot", "resourceGroup", resourceGroup, "region", d.cloud.Location)
 			if err = snapshotClient.Delete(ctx, resourceGroup, snapshotName); err != nil {
-				klog.Errorf("delete snapshot error: %v", err)
-				azureutils.SleepIfThrottled(err, consts.SnapshotOpThrottlingSleepSec)
+				logger.Error(err, "delete snapshot error")
+				d.sleepIfThrottled(err)
 			} else {
-				klog.V(2).Infof("delete snapshot(%s) under rg(%s) region(%s) successfully", snapshotName, resourceGroup, d.cloud.Location)
+				logger.V(2).Info("delete snapshot successfully", "resourceGroup", resourceGroup, "region", d.cloud.Location)
 			}
 		}
 
@@ -1204,6 +1359,7 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 		csiSnapshot.SnapshotId = strings.TrimSuffix(csiSnapshot.SnapshotId, snapshotName) + crossRegionSnapshotName
 	}
 
+	snapshotID = csiSnapshot.SnapshotId
 	isOperationInProgress = !csiSnapshot.ReadyToUse
 
 	createResp := &csi.CreateSnapshotResponse{
@@ -1219,6 +1375,9 @@ func (d *Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequ
 	if len(snapshotID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Snapshot ID must be provided")
 	}
+	if members := splitStripedID(snapshotID); len(members) > 1 {
+		return d.deleteStripedSnapshot(ctx, req, members)
+	}
 
 	var err error
 	var subsID string
@@ -1232,22 +1391,25 @@ func (d *Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequ
 		}
 	}
 
+	ctx, logger := csicommon.NewLogContext(ctx, "snapshotID", snapshotID)
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "controller_delete_snapshot", d.cloud.ResourceGroup, d.cloud.SubscriptionID, d.Name)
+	auditOp := d.auditLogger.Start("controller_delete_snapshot", map[string]string{consts.SnapshotID: snapshotID})
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded, consts.SnapshotID, snapshotID)
+		auditOp.End(audit.Outcome(isOperationSucceeded), snapshotID)
 	}()
 
-	klog.V(2).Infof("begin to delete snapshot(%s) under rg(%s)", snapshotName, resourceGroup)
+	logger.V(2).Info("begin to delete snapshot", "resourceGroup", resourceGroup)
 	snapshotClient, err := d.clientFactory.GetSnapshotClientForSub(subsID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get snapshot client for subscription(%s) with error(%v)", subsID, err)
 	}
 	if err := snapshotClient.Delete(ctx, resourceGroup, snapshotName); err != nil {
-		azureutils.SleepIfThrottled(err, consts.SnapshotOpThrottlingSleepSec)
+		d.sleepIfThrottled(err)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("delete snapshot error: %v", err))
 	}
-	klog.V(2).Infof("delete snapshot(%s) under rg(%s) successfully", snapshotName, resourceGroup)
+	logger.V(2).Info("delete snapshot successfully", "resourceGroup", resourceGroup)
 	isOperationSucceeded = true
 	return &csi.DeleteSnapshotResponse{}, nil
 }
@@ -1318,7 +1480,7 @@ func (d *Driver) GetSourceDiskSize(ctx context.Context, subsID, resourceGroup, d
 	}
 
 	if result.Properties.CreationData != nil && result.Properties.CreationData.CreateOption != nil && *result.Properties.CreationData.CreateOption == armcompute.DiskCreateOptionCopy {
-		klog.V(2).Infof("Clone source disk has a parent source")
+		klog.FromContext(ctx).V(2).Info("Clone source disk has a parent source", "diskName", diskName)
 		sourceResourceID := *result.Properties.CreationData.SourceResourceID
 		subsID, parentResourceGroup, parentDiskName, err := azureutils.GetInfoFromURI(sourceResourceID)
 		if err != nil {
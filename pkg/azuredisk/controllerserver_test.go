@@ -17,23 +17,31 @@ limitations under the License.
 package azuredisk
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/audit"
 	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azuredisk/mockcorev1"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azuredisk/mockkubeclient"
@@ -454,6 +462,96 @@ func TestCreateVolume(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "valid striped request",
+			testFunc: func(t *testing.T) {
+				cntl := gomock.NewController(t)
+				defer cntl.Finish()
+				d, _ := NewFakeDriver(cntl)
+				req := &csi.CreateVolumeRequest{
+					Name:               testVolumeName,
+					VolumeCapabilities: stdVolumeCapabilities,
+					CapacityRange:      &csi.CapacityRange{RequiredBytes: volumehelper.GiBToBytes(10)},
+					Parameters:         map[string]string{consts.StripeCountField: "3"},
+				}
+				sizes := map[string]int32{}
+				diskClient := mock_diskclient.NewMockInterface(cntl)
+				d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetDiskClientForSub(gomock.Any()).Return(diskClient, nil).AnyTimes()
+				diskClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, rg, name string, disk armcompute.Disk) (*armcompute.Disk, error) {
+						sizes[name] = *disk.Properties.DiskSizeGB
+						id := fmt.Sprintf(consts.ManagedDiskPath, "subs", rg, name)
+						disk.ID = &id
+						disk.Name = &name
+						disk.Properties.ProvisioningState = ptr.To("Succeeded")
+						return &disk, nil
+					}).Times(3)
+				diskClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(&armcompute.Disk{
+					Properties: &armcompute.DiskProperties{ProvisioningState: ptr.To("Succeeded")},
+				}, nil).AnyTimes()
+				res, err := d.CreateVolume(context.Background(), req)
+				require.NoError(t, err)
+				assert.Equal(t, volumehelper.GiBToBytes(12), res.Volume.CapacityBytes)
+				assert.Equal(t, map[string]int32{testVolumeName: 4, testVolumeName + "-stripe1": 4, testVolumeName + "-stripe2": 4}, sizes)
+				members := splitStripedID(res.Volume.VolumeId)
+				require.Len(t, members, 3)
+				assert.True(t, strings.HasSuffix(members[2], "/"+testVolumeName+"-stripe2"))
+
+				req.VolumeCapabilities = []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				}}
+				_, err = d.CreateVolume(context.Background(), req)
+				assert.Equal(t, status.Error(codes.InvalidArgument, "stripecount is not supported with block volumes"), err)
+			},
+		},
+		{
+			name: "striped request deletes the created members on failure",
+			testFunc: func(t *testing.T) {
+				cntl := gomock.NewController(t)
+				defer cntl.Finish()
+				d, _ := NewFakeDriver(cntl)
+				req := &csi.CreateVolumeRequest{
+					Name:               testVolumeName,
+					VolumeCapabilities: stdVolumeCapabilities,
+					CapacityRange:      &csi.CapacityRange{RequiredBytes: volumehelper.GiBToBytes(10)},
+					Parameters:         map[string]string{consts.StripeCountField: "3"},
+				}
+				createErr := &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "QuotaExceeded"}
+				deleted := []string{}
+				diskClient := mock_diskclient.NewMockInterface(cntl)
+				d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetDiskClientForSub(gomock.Any()).Return(diskClient, nil).AnyTimes()
+				diskClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, rg, name string, disk armcompute.Disk) (*armcompute.Disk, error) {
+						if name == testVolumeName+"-stripe2" {
+							return nil, createErr
+						}
+						id := fmt.Sprintf(consts.ManagedDiskPath, "subs", rg, name)
+						disk.ID = &id
+						disk.Name = &name
+						disk.Properties.ProvisioningState = ptr.To("Succeeded")
+						return &disk, nil
+					}).AnyTimes()
+				diskClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(&armcompute.Disk{
+					Properties: &armcompute.DiskProperties{ProvisioningState: ptr.To("Succeeded")},
+				}, nil).AnyTimes()
+				diskClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, name string) error {
+						deleted = append(deleted, name)
+						return nil
+					}).AnyTimes()
+				_, err := d.CreateVolume(context.Background(), req)
+				assert.Equal(t, codes.Internal, status.Code(err))
+				assert.Equal(t, []string{testVolumeName, testVolumeName + "-stripe1"}, deleted)
+
+				// the created members are kept for the retry if Azure throttled the request
+				deleted = []string{}
+				createErr.StatusCode = http.StatusTooManyRequests
+				_, err = d.CreateVolume(context.Background(), req)
+				assert.Equal(t, codes.Internal, status.Code(err))
+				assert.Empty(t, deleted)
+			},
+		},
 		{
 			name: "invalid parameter",
 			testFunc: func(t *testing.T) {
@@ -623,6 +721,13 @@ func TestDeleteVolume(t *testing.T) {
 			},
 			expectedResp: &csi.DeleteVolumeResponse{},
 		},
+		{
+			desc: "success striped",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testVolumeID + ",member",
+			},
+			expectedResp: &csi.DeleteVolumeResponse{},
+		},
 		{
 			desc: "fail with no volume id",
 			req: &csi.DeleteVolumeRequest{
@@ -649,8 +754,8 @@ func TestDeleteVolume(t *testing.T) {
 		}
 		diskClient := mock_diskclient.NewMockInterface(cntl)
 		d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetDiskClientForSub(gomock.Any()).Return(diskClient, nil).AnyTimes()
-		diskClient.EXPECT().Get(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(disk, nil).AnyTimes()
-		diskClient.EXPECT().Delete(gomock.Eq(ctx), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		diskClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(disk, nil).AnyTimes()
+		diskClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		result, err := d.DeleteVolume(ctx, test.req)
 		if err != nil {
@@ -2382,6 +2487,46 @@ func TestDeleteSnapshot(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "delete Snapshot is audited",
+			testFunc: func(t *testing.T) {
+				cntl := gomock.NewController(t)
+				defer cntl.Finish()
+				fd, _ := NewFakeDriver(cntl)
+				d := fd.(*fakeDriver)
+				d.setCloud(&azure.Cloud{})
+				auditLogPath := filepath.Join(t.TempDir(), "audit.log")
+				auditLogger, err := audit.NewLogger(auditLogPath, []byte("audit-key"), nil)
+				assert.NoError(t, err)
+				d.auditLogger = auditLogger
+				mockSnapshotClient := mock_snapshotclient.NewMockInterface(cntl)
+				d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetSnapshotClientForSub(gomock.Any()).Return(mockSnapshotClient, nil).AnyTimes()
+				mockSnapshotClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("delete snapshot error")).Times(1)
+				mockSnapshotClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				snapshotID := "/subscriptions/12/resourceGroups/23/providers/Microsoft.Compute/snapshots/snapshot-name"
+				req := &csi.DeleteSnapshotRequest{SnapshotId: snapshotID}
+				_, err = d.DeleteSnapshot(context.Background(), req)
+				assert.Error(t, err)
+				_, err = d.DeleteSnapshot(context.Background(), req)
+				assert.NoError(t, err)
+				assert.NoError(t, auditLogger.Close())
+
+				data, err := os.ReadFile(auditLogPath)
+				assert.NoError(t, err)
+				count, err := audit.Verify(bytes.NewReader(data), []byte("audit-key"))
+				assert.NoError(t, err)
+				assert.Equal(t, 2, count)
+				lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+				for i, outcome := range []string{audit.OutcomeFailed, audit.OutcomeSucceeded} {
+					var record audit.Record
+					assert.NoError(t, json.Unmarshal([]byte(lines[i]), &record))
+					assert.Equal(t, "controller_delete_snapshot", record.Operation)
+					assert.Equal(t, outcome, record.Outcome)
+					assert.Equal(t, []string{snapshotID}, record.ResourceIDs)
+					assert.Equal(t, snapshotID, record.Parameters[consts.SnapshotID])
+				}
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, tc.testFunc)
@@ -0,0 +1,124 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"fmt"
+	"time"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// DebugState is a point-in-time snapshot of the in-memory state of the driver
+type DebugState struct {
+	// pending attach requests, <nodeName, map<diskURI, attach options>>
+	AttachDiskRequests map[string]map[string]*provider.AttachDiskOptions `json:"attachDiskRequests"`
+	// pending detach requests, <nodeName, map<diskURI, diskName>>
+	DetachDiskRequests map[string]map[string]string `json:"detachDiskRequests"`
+	// disks being attached or detached, <diskURI, state>
+	DiskStates map[string]string `json:"diskStates"`
+	// volume IDs whose CSI operation locks are held
+	VolumeLocks []string `json:"volumeLocks"`
+	// controller lockMap entries which are currently locked
+	LockMapEntries []string `json:"lockMapEntries"`
+	// live throttling cache entries, <cacheName, map<key, expiry time>>
+	CacheEntries map[string]map[string]time.Time `json:"cacheEntries"`
+}
+
+// GetDebugState returns a snapshot of the attach/detach queues, locks and throttling caches
+func (d *Driver) GetDebugState() *DebugState {
+	state := &DebugState{
+		AttachDiskRequests: map[string]map[string]*provider.AttachDiskOptions{},
+		DetachDiskRequests: map[string]map[string]string{},
+		DiskStates:         map[string]string{},
+		LockMapEntries:     []string{},
+		CacheEntries:       map[string]map[string]time.Time{},
+	}
+	if d.volumeLocks != nil {
+		state.VolumeLocks = d.volumeLocks.List()
+	}
+
+	now := time.Now()
+	caches := map[string]azcache.Resource{
+		throttlingCacheName:        d.throttlingCache,
+		checkDiskLunThrottlingName: d.checkDiskLunThrottlingCache,
+	}
+	if d.diskController != nil && d.diskController.controllerCommon != nil {
+		c := d.diskController.controllerCommon
+		c.dumpDebugState(state)
+		caches[hitMaxDataDiskCountCacheName] = c.hitMaxDataDiskCountCache
+	}
+	for name, cache := range caches {
+		if cache == nil {
+			continue
+		}
+		entries := map[string]time.Time{}
+		for key, remaining := range liveCacheEntries(cache, now) {
+			entries[key] = now.Add(remaining)
+		}
+		state.CacheEntries[name] = entries
+	}
+	return state
+}
+
+// dumpDebugState copies the attach/detach queues, disk states and held locks into state
+func (c *controllerCommon) dumpDebugState(state *DebugState) {
+	// collect held locks first since copying the queues below takes lockMap entries
+	if c.lockMap != nil {
+		state.LockMapEntries = c.lockMap.HeldEntries()
+	}
+
+	c.diskStateMap.Range(func(key, value interface{}) bool {
+		state.DiskStates[fmt.Sprint(key)] = fmt.Sprint(value)
+		return true
+	})
+
+	c.attachDiskMap.Range(func(key, value interface{}) bool {
+		nodeName := fmt.Sprint(key)
+		attachDiskMapKey := nodeName + attachDiskMapKeySuffix
+		c.lockMap.LockEntry(attachDiskMapKey)
+		defer c.lockMap.UnlockEntry(attachDiskMapKey)
+		if diskMap, ok := value.(map[string]*provider.AttachDiskOptions); ok && len(diskMap) > 0 {
+			requests := make(map[string]*provider.AttachDiskOptions, len(diskMap))
+			for diskURI, options := range diskMap {
+				if options != nil {
+					opt := *options
+					options = &opt
+				}
+				requests[diskURI] = options
+			}
+			state.AttachDiskRequests[nodeName] = requests
+		}
+		return true
+	})
+
+	c.detachDiskMap.Range(func(key, value interface{}) bool {
+		nodeName := fmt.Sprint(key)
+		detachDiskMapKey := nodeName + detachDiskMapKeySuffix
+		c.lockMap.LockEntry(detachDiskMapKey)
+		defer c.lockMap.UnlockEntry(detachDiskMapKey)
+		if diskMap, ok := value.(map[string]string); ok && len(diskMap) > 0 {
+			requests := make(map[string]string, len(diskMap))
+			for diskURI, diskName := range diskMap {
+				requests[diskURI] = diskName
+			}
+			state.DetachDiskRequests[nodeName] = requests
+		}
+		return true
+	})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func TestGetDebugState(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	assert.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	state := d.GetDebugState()
+	assert.Empty(t, state.AttachDiskRequests)
+	assert.Empty(t, state.DetachDiskRequests)
+	assert.Empty(t, state.DiskStates)
+	assert.Empty(t, state.VolumeLocks)
+	assert.Empty(t, state.LockMapEntries)
+
+	c := d.diskController.controllerCommon
+	_, err = c.insertAttachDiskRequest("diskuri1", "node1", &provider.AttachDiskOptions{DiskName: "disk1", Lun: 3})
+	assert.NoError(t, err)
+	_, err = c.insertDetachDiskRequest("disk2", "diskuri2", "node1")
+	assert.NoError(t, err)
+	c.diskStateMap.Store("diskuri3", "attaching")
+	c.lockMap.LockEntry("node1")
+	assert.True(t, d.volumeLocks.TryAcquire("vol-1"))
+	d.setThrottlingCache(consts.GetDiskThrottlingKey, "")
+
+	state = d.GetDebugState()
+	assert.Equal(t, "disk1", state.AttachDiskRequests["node1"]["diskuri1"].DiskName)
+	assert.Equal(t, int32(3), state.AttachDiskRequests["node1"]["diskuri1"].Lun)
+	assert.Equal(t, map[string]string{"diskuri2": "disk2"}, state.DetachDiskRequests["node1"])
+	assert.Equal(t, map[string]string{"diskuri3": "attaching"}, state.DiskStates)
+	assert.Equal(t, []string{"vol-1"}, state.VolumeLocks)
+	assert.Equal(t, []string{"node1"}, state.LockMapEntries)
+	assert.Contains(t, state.CacheEntries[throttlingCacheName], consts.GetDiskThrottlingKey)
+	assert.Empty(t, state.CacheEntries[hitMaxDataDiskCountCacheName])
+
+	c.lockMap.UnlockEntry("node1")
+	d.volumeLocks.Release("vol-1")
+	state = d.GetDebugState()
+	assert.Empty(t, state.LockMapEntries)
+	assert.Empty(t, state.VolumeLocks)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+// errDeviceIdentityMismatch is returned if the device on the LUN is not the disk of the publish context
+var errDeviceIdentityMismatch = errors.New("device does not match the disk")
+
+// verifyDeviceIdentity checks that the device found on the LUN is the disk described in the publish context,
+// so that a disk which reused the LUN of a detached one is not formatted or mounted. The WWID identifies the disk,
+// the size is a weaker check for devices whose WWID does not carry the disk unique ID
+func (d *Driver) verifyDeviceIdentity(devicePath string, publishContext map[string]string) error {
+	sizeStr := publishContext[consts.DiskSizeBytesField]
+	uniqueID := publishContext[consts.DiskUniqueIDField]
+	if sizeStr == "" && uniqueID == "" {
+		// the disk was attached by a controller which does not publish its identity
+		return nil
+	}
+
+	if id := normalizeDiskID(uniqueID); id != "" {
+		if wwid := getDeviceWWID(d.ioHandler, devicePath); wwid != "" {
+			if strings.Contains(normalizeDiskID(wwid), id) {
+				klog.V(4).Infof("device %s matches disk %s by WWID %s", devicePath, uniqueID, wwid)
+				return nil
+			}
+			// a WWID which carries a disk unique ID identifies another disk
+			if isAzureDiskWWID(wwid) {
+				return fmt.Errorf("%w: WWID %s of device %s does not carry disk unique ID %s", errDeviceIdentityMismatch, wwid, devicePath, uniqueID)
+			}
+			// the WWID of a disk does not always carry its unique ID, fall back to the size
+			klog.V(4).Infof("WWID %s of device %s does not carry disk unique ID %s", wwid, devicePath, uniqueID)
+		}
+	}
+
+	// the device of a Windows node is a disk number which has no block size
+	if sizeStr == "" || runtime.GOOS == "windows" {
+		return nil
+	}
+	diskSize, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q in publish context: %w", consts.DiskSizeBytesField, sizeStr, err)
+	}
+	deviceSize, err := getBlockSizeBytes(devicePath, d.mounter)
+	if err != nil {
+		return err
+	}
+	// the publish context keeps the size of the disk at attach time, the device of a disk expanded online
+	// or created smaller than requested is bigger, only a smaller device can not be the disk
+	if deviceSize < diskSize {
+		return fmt.Errorf("%w: size of device %s is %d bytes, disk %s has %d bytes", errDeviceIdentityMismatch, devicePath, deviceSize, uniqueID, diskSize)
+	}
+	if deviceSize > diskSize {
+		klog.V(4).Infof("size of device %s is %d bytes, disk %s had %d bytes when it was attached", devicePath, deviceSize, uniqueID, diskSize)
+	}
+	return nil
+}
+
+// isAzureDiskWWID tells whether a WWID has the uuid.<GUID> format which carries the unique ID of an Azure disk
+func isAzureDiskWWID(wwid string) bool {
+	guid, found := strings.CutPrefix(strings.ToLower(wwid), "uuid.")
+	return found && len(guid) == 36 && len(normalizeDiskID(guid)) == 32
+}
+
+// normalizeDiskID keeps the lowercase hex digits of a disk ID, so that GUIDs compare with WWIDs
+func normalizeDiskID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'f':
+			return r
+		case r >= 'A' && r <= 'F':
+			return r - 'A' + 'a'
+		}
+		return -1
+	}, id)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	testingexec "k8s.io/utils/exec/testing"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+// wwidIOHandler reports the WWID of every device
+type wwidIOHandler struct {
+	azureutils.IOHandler
+	wwid string
+}
+
+func (handler *wwidIOHandler) Readlink(_ string) (string, error) {
+	return "", fmt.Errorf("not a link")
+}
+
+func (handler *wwidIOHandler) ReadFile(filename string) ([]byte, error) {
+	if filename == "/sys/class/block/sdd/device/wwid" {
+		return []byte(handler.wwid + "\n"), nil
+	}
+	return handler.IOHandler.ReadFile(filename)
+}
+
+func TestVerifyDeviceIdentity(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+	fakeMounter, err := mounter.NewFakeSafeMounter()
+	require.NoError(t, err)
+	d.setMounter(fakeMounter)
+
+	blockdev := func(size int64) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			return []byte(fmt.Sprintf("%d\n", size)), []byte{}, nil
+		}
+	}
+	const uniqueID = "4E2B1C3A-90F1-4C6B-9E4A-0C1D2E3F4A5B"
+	identity := map[string]string{
+		consts.LUN:                "1",
+		consts.DiskSizeBytesField: "10737418240",
+		consts.DiskUniqueIDField:  uniqueID,
+	}
+
+	tests := []struct {
+		desc           string
+		publishContext map[string]string
+		wwid           string
+		outputScripts  []testingexec.FakeAction
+		expectedErr    error
+	}{
+		{
+			desc:           "publish context without identity",
+			publishContext: map[string]string{consts.LUN: "1"},
+		},
+		{
+			desc:           "WWID carries the unique ID",
+			publishContext: identity,
+			wwid:           "uuid.4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b",
+		},
+		{
+			desc:           "WWID carries another unique ID",
+			publishContext: identity,
+			wwid:           "uuid.0b9c1e2d-3f4a-4b5c-8d6e-7f8091a2b3c4",
+			expectedErr:    errDeviceIdentityMismatch,
+		},
+		{
+			desc:           "same size",
+			publishContext: identity,
+			wwid:           "naa.600224800000000000000000000000aa",
+			outputScripts:  []testingexec.FakeAction{blockdev(10737418240)},
+		},
+		{
+			desc:           "bigger device of a disk expanded online",
+			publishContext: identity,
+			outputScripts:  []testingexec.FakeAction{blockdev(21474836480)},
+		},
+		{
+			desc:           "smaller device",
+			publishContext: identity,
+			outputScripts:  []testingexec.FakeAction{blockdev(5368709120)},
+			expectedErr:    errDeviceIdentityMismatch,
+		},
+		{
+			desc:           "invalid size",
+			publishContext: map[string]string{consts.DiskSizeBytesField: "ten"},
+			expectedErr:    fmt.Errorf(`invalid disksizebytes "ten" in publish context: strconv.ParseInt: parsing "ten": invalid syntax`),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			d.ioHandler = &wwidIOHandler{IOHandler: azureutils.NewFakeIOHandler(), wwid: test.wwid}
+			d.setNextCommandOutputScripts(test.outputScripts...)
+			err := d.verifyDeviceIdentity("/dev/sdd", test.publishContext)
+			switch {
+			case test.expectedErr == nil:
+				assert.NoError(t, err)
+			case errors.Is(test.expectedErr, errDeviceIdentityMismatch):
+				assert.ErrorIs(t, err, errDeviceIdentityMismatch)
+			default:
+				assert.EqualError(t, err, test.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestIsAzureDiskWWID(t *testing.T) {
+	assert.True(t, isAzureDiskWWID("uuid.4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b"))
+	assert.True(t, isAzureDiskWWID("UUID.4E2B1C3A-90F1-4C6B-9E4A-0C1D2E3F4A5B"))
+	assert.False(t, isAzureDiskWWID("naa.600224800000000000000000000000aa"))
+	assert.False(t, isAzureDiskWWID("uuid.not-a-guid"))
+}
+
+func TestNormalizeDiskID(t *testing.T) {
+	assert.Equal(t, "4e2b1c3a90f14c6b", normalizeDiskID("4E2B1C3A-90F1-4C6B"))
+	assert.Equal(t, "", normalizeDiskID("xyz-"))
+}
@@ -0,0 +1,414 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/klog/v2"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/optimization"
+	volumehelper "sigs.k8s.io/azuredisk-csi-driver/pkg/util"
+)
+
+const (
+	// deviceTuningStateDirName is the directory of the device tuning states next to the socket of the node plugin
+	deviceTuningStateDirName = "device-tuning"
+	// deviceTuningReconcileInterval is the interval of checking the device settings of the staged volumes
+	deviceTuningReconcileInterval = time.Minute
+)
+
+// deviceTuningState records the device settings of a staged volume, settings are relative to the block device directory in sysfs
+type deviceTuningState struct {
+	VolumeID string `json:"volumeID"`
+	// MemberID is the disk of a striped volume member, empty if the volume is a single disk
+	MemberID string `json:"memberID,omitempty"`
+	LUN      string `json:"lun"`
+	// WWID is the WWID of the tuned device, which is checked before its settings are written again
+	WWID string `json:"wwid,omitempty"`
+	// StagingPath is the staging path of the volume, the state is dropped once it is gone
+	StagingPath string `json:"stagingPath,omitempty"`
+	// VolumeContext is the volume context the settings are computed from
+	VolumeContext map[string]string `json:"volumeContext"`
+	// Settings are the settings computed from the volume context
+	Settings map[string]string `json:"settings"`
+	// Applied are the values read back after writing the settings, which the kernel may have adjusted
+	Applied map[string]string `json:"applied"`
+	// Original are the values before the volume was tuned, restored on NodeUnstageVolume
+	Original map[string]string `json:"original"`
+}
+
+// getDeviceTuningStateDir returns the device-tuning directory next to the unix socket of the endpoint,
+// it is empty if the endpoint is not a unix socket
+func getDeviceTuningStateDir(endpoint string) string {
+	proto, addr, err := csicommon.ParseEndpoint(endpoint)
+	if err != nil || proto != "unix" {
+		return ""
+	}
+	if runtime.GOOS != "windows" {
+		addr = "/" + addr
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(addr)), deviceTuningStateDirName)
+}
+
+// diskID returns the disk the state records the device settings of
+func (state *deviceTuningState) diskID() string {
+	if state.MemberID != "" {
+		return state.MemberID
+	}
+	return state.VolumeID
+}
+
+func (d *Driver) deviceTuningStatePath(diskID string) string {
+	return filepath.Join(d.deviceTuningStateDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(diskID))))
+}
+
+// readDeviceTuningState returns the recorded device tuning of the disk, nil if there is none
+func (d *Driver) readDeviceTuningState(diskID string) (*deviceTuningState, error) {
+	data, err := os.ReadFile(d.deviceTuningStatePath(diskID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &deviceTuningState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse device tuning state of disk %s: %w", diskID, err)
+	}
+	return state, nil
+}
+
+func (d *Driver) writeDeviceTuningState(state *deviceTuningState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.deviceTuningStateDir, 0750); err != nil {
+		return err
+	}
+	path := d.deviceTuningStatePath(state.diskID())
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// getDesiredDeviceSettings returns the device settings of the perf attributes in the volume context,
+// which are empty if the volume is not tuned
+func (d *Driver) getDesiredDeviceSettings(volumeContext map[string]string) (map[string]string, error) {
+	profile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettings, err := optimization.GetDiskPerfAttributes(volumeContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get perf attributes: %w", err)
+	}
+	if !d.getDeviceHelper().DiskSupportsPerfOptimization(profile, accountType) {
+		return map[string]string{}, nil
+	}
+	return d.getDeviceHelper().GetDeviceSettings(d.getNodeInfo(), profile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettings)
+}
+
+// tuneDevice applies the device settings of a disk of a volume being staged and records them with the original values,
+// diskID is the volume ID or the member of a striped volume
+func (d *Driver) tuneDevice(volumeID, diskID, lun, stagingPath, devicePath string, volumeContext, deviceSettings map[string]string) error {
+	if d.deviceTuningStateDir == "" {
+		return d.getDeviceHelper().ApplyDeviceSettings(devicePath, deviceSettings)
+	}
+	state, err := d.readDeviceTuningState(diskID)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &deviceTuningState{VolumeID: volumeID}
+		if diskID != volumeID {
+			state.MemberID = diskID
+		}
+	}
+	state.LUN = lun
+	state.WWID = getDeviceWWID(d.ioHandler, devicePath)
+	state.StagingPath = stagingPath
+	state.VolumeContext = volumeContext
+	if err := d.applyDeviceTuning(state, devicePath, deviceSettings); err != nil {
+		return err
+	}
+	return d.writeDeviceTuningState(state)
+}
+
+// applyDeviceTuning writes the settings to the device, it reads the original value of a setting before it is tuned
+// the first time and restores the original values of the settings that are no longer tuned
+func (d *Driver) applyDeviceTuning(state *deviceTuningState, devicePath string, deviceSettings map[string]string) error {
+	deviceHelper := d.getDeviceHelper()
+	if state.Original == nil {
+		state.Original = map[string]string{}
+	}
+	var untuned []string
+	for setting := range deviceSettings {
+		if _, ok := state.Original[setting]; !ok {
+			untuned = append(untuned, setting)
+		}
+	}
+	if len(untuned) > 0 {
+		original, err := deviceHelper.ReadDeviceSettings(devicePath, untuned)
+		if err != nil {
+			return err
+		}
+		maps.Copy(state.Original, original)
+	}
+
+	restore := map[string]string{}
+	for setting, value := range state.Original {
+		if _, ok := deviceSettings[setting]; !ok {
+			restore[setting] = value
+		}
+	}
+	if len(restore) > 0 {
+		if err := deviceHelper.ApplyDeviceSettings(devicePath, restore); err != nil {
+			return err
+		}
+		for setting := range restore {
+			delete(state.Original, setting)
+		}
+	}
+
+	state.Settings = deviceSettings
+	state.Applied = map[string]string{}
+	if len(deviceSettings) == 0 {
+		return nil
+	}
+	if err := deviceHelper.ApplyDeviceSettings(devicePath, deviceSettings); err != nil {
+		return err
+	}
+	applied, err := deviceHelper.ReadDeviceSettings(devicePath, slices.Collect(maps.Keys(deviceSettings)))
+	if err != nil {
+		return err
+	}
+	state.Applied = applied
+	return nil
+}
+
+// restoreDeviceTuning writes back the original device settings of a disk of a volume being unstaged and removes
+// its record, failures are logged since they must not block unstaging
+func (d *Driver) restoreDeviceTuning(ctx context.Context, diskID string) {
+	if d.deviceTuningStateDir == "" {
+		return
+	}
+	logger := klog.FromContext(ctx).WithValues("diskID", diskID)
+	state, err := d.readDeviceTuningState(diskID)
+	if err != nil {
+		logger.Error(err, "failed to read device tuning state")
+	}
+	if state != nil && len(state.Original) > 0 {
+		if devicePath, err := d.findTunedDevice(state); err != nil {
+			logger.Error(err, "failed to find device to restore its settings", "lun", state.LUN)
+		} else if err := d.getDeviceHelper().ApplyDeviceSettings(devicePath, state.Original); err != nil {
+			logger.Error(err, "failed to restore device settings", "devicePath", devicePath, "deviceSettings", state.Original)
+		} else {
+			logger.V(2).Info("restored device settings", "devicePath", devicePath, "deviceSettings", state.Original)
+		}
+	}
+	if err := os.Remove(d.deviceTuningStatePath(diskID)); err != nil && !os.IsNotExist(err) {
+		logger.Error(err, "failed to remove device tuning state")
+	}
+}
+
+// findDevicePathWithLUN finds the device of the LUN without rescanning or waiting for it
+func (d *Driver) findDevicePathWithLUN(lunStr string) (string, error) {
+	lun, err := azureutils.GetDiskLUN(lunStr)
+	if err != nil {
+		return "", err
+	}
+	devicePath, err := findDiskByLun(int(lun), d.ioHandler, d.mounter)
+	if err == nil && devicePath == "" {
+		err = fmt.Errorf("no device found on lun %d", lun)
+	}
+	return devicePath, err
+}
+
+// findTunedDevice finds the device on the LUN of a state and checks that it is still the tuned disk,
+// the LUN may have been reused by another disk since the disk was detached
+func (d *Driver) findTunedDevice(state *deviceTuningState) (string, error) {
+	devicePath, err := d.findDevicePathWithLUN(state.LUN)
+	if err != nil {
+		return "", err
+	}
+	if state.WWID != "" {
+		if wwid := getDeviceWWID(d.ioHandler, devicePath); wwid != state.WWID {
+			return "", fmt.Errorf("%w: WWID of device %s on lun %s is %q, the tuned disk has %q", errDeviceIdentityMismatch, devicePath, state.LUN, wwid, state.WWID)
+		}
+	}
+	return devicePath, nil
+}
+
+// reconcileDeviceTuning applies the device settings of the staged volumes again if they drifted, e.g. after a device
+// re-enumeration, or if the perf attributes of the volume changed, e.g. after ControllerModifyVolume
+func (d *Driver) reconcileDeviceTuning(ctx context.Context) {
+	entries, err := os.ReadDir(d.deviceTuningStateDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("failed to list device tuning states: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(d.deviceTuningStateDir, entry.Name()))
+		if err != nil {
+			klog.Errorf("failed to read device tuning state %s: %v", entry.Name(), err)
+			continue
+		}
+		state := &deviceTuningState{}
+		if err := json.Unmarshal(data, state); err != nil || state.VolumeID == "" {
+			klog.Errorf("failed to parse device tuning state %s: %v", entry.Name(), err)
+			continue
+		}
+		if acquired := d.volumeLocks.TryAcquire(state.VolumeID); !acquired {
+			continue
+		}
+		if err := d.reconcileVolumeDeviceTuning(ctx, state); err != nil {
+			klog.Warningf("failed to reconcile device settings of volume %s: %v", state.VolumeID, err)
+		}
+		d.volumeLocks.Release(state.VolumeID)
+	}
+}
+
+func (d *Driver) reconcileVolumeDeviceTuning(ctx context.Context, state *deviceTuningState) error {
+	// the volume may have been unstaged since the state was listed
+	statePath := d.deviceTuningStatePath(state.diskID())
+	if _, err := os.Stat(statePath); err != nil {
+		return nil
+	}
+	// the volume was unstaged without its state being removed, e.g. the node plugin restarted during NodeUnstageVolume
+	if state.StagingPath != "" {
+		if _, err := os.Stat(state.StagingPath); os.IsNotExist(err) {
+			klog.V(2).Infof("staging path %s of volume %s is gone, removing the device tuning state of disk %s", state.StagingPath, state.VolumeID, state.diskID())
+			return os.Remove(statePath)
+		}
+	}
+	volumeContext := d.getLatestVolumeContext(ctx, state.VolumeContext)
+	deviceSettings, err := d.getDesiredDeviceSettings(volumeContext)
+	if err != nil {
+		return err
+	}
+	devicePath, err := d.findTunedDevice(state)
+	if err != nil {
+		return err
+	}
+
+	if maps.Equal(deviceSettings, state.Settings) {
+		if len(state.Applied) == 0 {
+			return nil
+		}
+		current, err := d.getDeviceHelper().ReadDeviceSettings(devicePath, slices.Collect(maps.Keys(state.Applied)))
+		if err != nil {
+			return err
+		}
+		if maps.Equal(current, state.Applied) {
+			return nil
+		}
+		klog.V(2).Infof("device settings of volume %s on %s drifted from %v to %v, applying them again", state.VolumeID, devicePath, state.Applied, current)
+	} else {
+		klog.V(2).Infof("device settings of volume %s on %s changed from %v to %v", state.VolumeID, devicePath, state.Settings, deviceSettings)
+	}
+
+	if err := d.applyDeviceTuning(state, devicePath, deviceSettings); err != nil {
+		return err
+	}
+	state.VolumeContext = volumeContext
+	return d.writeDeviceTuningState(state)
+}
+
+// startPVInformer starts the PersistentVolume informer the latest volume context of the staged volumes is read from,
+// it also removes the thin volumes of the deleted PersistentVolumes and the controller of the thin volumes reads the pool volumes from it
+func (d *Driver) startPVInformer(ctx context.Context) {
+	factory := informers.NewSharedInformerFactory(d.kubeClient, 0)
+	pvInformer := factory.Core().V1().PersistentVolumes()
+	d.pvLister = pvInformer.Lister()
+	d.pvListerSynced = pvInformer.Informer().HasSynced
+	if d.lvmThinVolumesPerNode > 0 {
+		if _, err := pvInformer.Informer().AddEventHandler(d.thinVolumeEventHandler(ctx)); err != nil {
+			klog.Errorf("failed to add thin volume event handler to PV informer: %v", err)
+		}
+	}
+	factory.Start(ctx.Done())
+}
+
+// getLatestVolumeContext returns the volume attributes of the PersistentVolume with the capacity as requested size
+// and the parameters of its VolumeAttributesClass applied, or the recorded volume context if the PV is unknown
+func (d *Driver) getLatestVolumeContext(ctx context.Context, volumeContext map[string]string) map[string]string {
+	pvName := volumeContext[consts.PvNameKey]
+	if d.pvLister == nil || !d.pvListerSynced() || pvName == "" {
+		return volumeContext
+	}
+	pv, err := d.pvLister.Get(pvName)
+	if err != nil || pv.Spec.CSI == nil {
+		klog.V(4).Infof("using the recorded volume context of PV %s: %v", pvName, err)
+		return volumeContext
+	}
+
+	latest := maps.Clone(pv.Spec.CSI.VolumeAttributes)
+	if latest == nil {
+		latest = map[string]string{}
+	}
+	if capacity, ok := pv.Spec.Capacity[v1.ResourceStorage]; ok {
+		azureutils.SetKeyValueInMap(latest, consts.RequestedSizeGib, strconv.FormatInt(volumehelper.RoundUpGiB(capacity.Value()), 10))
+	}
+	if className := pv.Spec.VolumeAttributesClassName; className != nil && *className != "" {
+		parameters, err := d.getVolumeAttributesClassParameters(ctx, *className)
+		if err != nil {
+			klog.V(4).Infof("using the recorded volume context of PV %s: %v", pvName, err)
+			return volumeContext
+		}
+		for key, value := range parameters {
+			azureutils.SetKeyValueInMap(latest, key, value)
+		}
+	}
+	return latest
+}
+
+// getVolumeAttributesClassParameters returns the parameters of a VolumeAttributesClass, which are read once
+// since the parameters of a class can not be changed
+func (d *Driver) getVolumeAttributesClassParameters(ctx context.Context, className string) (map[string]string, error) {
+	if parameters, ok := d.volumeAttributesClassParameters.Load(className); ok {
+		return parameters.(map[string]string), nil
+	}
+	if d.kubeClient == nil {
+		return nil, fmt.Errorf("kubeClient is nil, can not read VolumeAttributesClass %s", className)
+	}
+	class, err := d.kubeClient.StorageV1beta1().VolumeAttributesClasses().Get(ctx, className, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	d.volumeAttributesClassParameters.Store(className, class.Parameters)
+	return class.Parameters, nil
+}
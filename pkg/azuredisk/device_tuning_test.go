@@ -0,0 +1,292 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/optimization/mockoptimization"
+)
+
+// deviceWWIDIOHandler reports the same WWID for every device
+type deviceWWIDIOHandler struct {
+	azureutils.IOHandler
+	wwid string
+}
+
+func (handler *deviceWWIDIOHandler) ReadFile(filename string) ([]byte, error) {
+	if strings.HasSuffix(filename, "/device/wwid") {
+		return []byte(handler.wwid + "\n"), nil
+	}
+	return handler.IOHandler.ReadFile(filename)
+}
+
+// startFakePVInformer starts the PersistentVolume informer of the driver on a fake client with the objects
+func startFakePVInformer(ctx context.Context, t *testing.T, d *Driver, objects ...k8sruntime.Object) {
+	d.kubeClient = fake.NewSimpleClientset(objects...)
+	d.startPVInformer(ctx)
+	require.True(t, cache.WaitForCacheSync(ctx.Done(), d.pvListerSynced))
+}
+
+func TestGetDeviceTuningStateDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	assert.Equal(t, "/csi/device-tuning", getDeviceTuningStateDir("unix:///csi/csi.sock"))
+	assert.Equal(t, "", getDeviceTuningStateDir("tcp://127.0.0.1:0"))
+	assert.Equal(t, "", getDeviceTuningStateDir("invalid"))
+}
+
+func TestTuneDevice(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+	d.deviceTuningStateDir = t.TempDir()
+	deviceHelper := d.getDeviceHelper().(*mockoptimization.MockInterface)
+
+	volumeContext := map[string]string{consts.PerfProfileField: "basic"}
+	settings := map[string]string{"queue/scheduler": "none", "queue/nr_requests": "64"}
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sdd", gomock.Any()).Return(map[string]string{"queue/scheduler": "mq-deadline", "queue/nr_requests": "256"}, nil)
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sdd", settings).Return(nil)
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sdd", gomock.Any()).Return(settings, nil)
+	require.NoError(t, d.tuneDevice("vol", "vol", "1", "/staging", "/dev/sdd", volumeContext, settings))
+
+	state, err := d.readDeviceTuningState("vol")
+	require.NoError(t, err)
+	assert.Equal(t, &deviceTuningState{
+		VolumeID:      "vol",
+		LUN:           "1",
+		StagingPath:   "/staging",
+		VolumeContext: volumeContext,
+		Settings:      settings,
+		Applied:       settings,
+		Original:      map[string]string{"queue/scheduler": "mq-deadline", "queue/nr_requests": "256"},
+	}, state)
+
+	// staging again keeps the original values and restores the settings which are no longer tuned
+	settings = map[string]string{"queue/scheduler": "kyber"}
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sdd", map[string]string{"queue/nr_requests": "256"}).Return(nil)
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sdd", settings).Return(nil)
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sdd", []string{"queue/scheduler"}).Return(settings, nil)
+	require.NoError(t, d.tuneDevice("vol", "vol", "1", "/staging", "/dev/sdd", volumeContext, settings))
+	state, err = d.readDeviceTuningState("vol")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"queue/scheduler": "mq-deadline"}, state.Original)
+	assert.Equal(t, settings, state.Applied)
+
+	// members of a striped volume keep their own state
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sde", gomock.Any()).Return(map[string]string{"queue/scheduler": "none"}, nil)
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sde", settings).Return(nil)
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sde", gomock.Any()).Return(settings, nil)
+	require.NoError(t, d.tuneDevice("vol", "vol_1", "2", "/staging", "/dev/sde", volumeContext, settings))
+	state, err = d.readDeviceTuningState("vol_1")
+	require.NoError(t, err)
+	assert.Equal(t, "vol", state.VolumeID)
+	assert.Equal(t, "vol_1", state.MemberID)
+	assert.Equal(t, "2", state.LUN)
+
+	state, err = d.readDeviceTuningState("unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+}
+
+func TestRestoreDeviceTuning(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+	d.deviceTuningStateDir = t.TempDir()
+	deviceHelper := d.getDeviceHelper().(*mockoptimization.MockInterface)
+
+	d.ioHandler = &deviceWWIDIOHandler{IOHandler: azureutils.NewFakeIOHandler(), wwid: "uuid.4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b"}
+	state := &deviceTuningState{
+		VolumeID: "vol",
+		LUN:      "1",
+		WWID:     "uuid.4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b",
+		Settings: map[string]string{"queue/scheduler": "none"},
+		Applied:  map[string]string{"queue/scheduler": "none"},
+		Original: map[string]string{"queue/scheduler": "mq-deadline"},
+	}
+	require.NoError(t, d.writeDeviceTuningState(state))
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sdd", map[string]string{"queue/scheduler": "mq-deadline"}).Return(nil)
+	d.restoreDeviceTuning(context.Background(), "vol")
+	_, err = os.Stat(d.deviceTuningStatePath("vol"))
+	assert.True(t, os.IsNotExist(err))
+
+	// another disk on the lun is left alone
+	state.WWID = "uuid.0b9c1e2d-3f4a-4b5c-8d6e-7f8091a2b3c4"
+	require.NoError(t, d.writeDeviceTuningState(state))
+	d.restoreDeviceTuning(context.Background(), "vol")
+	_, err = os.Stat(d.deviceTuningStatePath("vol"))
+	assert.True(t, os.IsNotExist(err))
+
+	// volumes without a state are ignored
+	d.restoreDeviceTuning(context.Background(), "vol")
+}
+
+func TestReconcileDeviceTuning(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+	d.deviceTuningStateDir = t.TempDir()
+	deviceHelper := d.getDeviceHelper().(*mockoptimization.MockInterface)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const wwid = "uuid.4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b"
+	d.ioHandler = &deviceWWIDIOHandler{IOHandler: azureutils.NewFakeIOHandler(), wwid: wwid}
+	stagingPath := t.TempDir()
+
+	volumeContext := map[string]string{consts.PerfProfileField: "basic", consts.SkuNameField: "Premium_LRS"}
+	settings := map[string]string{"queue/scheduler": "none"}
+	require.NoError(t, d.writeDeviceTuningState(&deviceTuningState{
+		VolumeID:      "vol",
+		LUN:           "1",
+		WWID:          wwid,
+		StagingPath:   stagingPath,
+		VolumeContext: volumeContext,
+		Settings:      settings,
+		Applied:       settings,
+		Original:      map[string]string{"queue/scheduler": "mq-deadline"},
+	}))
+
+	// settings in place
+	deviceHelper.EXPECT().DiskSupportsPerfOptimization("basic", "Premium_LRS").Return(true)
+	deviceHelper.EXPECT().GetDeviceSettings(gomock.Any(), "basic", "Premium_LRS", "", "", "", gomock.Any()).Return(settings, nil)
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sdd", []string{"queue/scheduler"}).Return(settings, nil)
+	d.reconcileDeviceTuning(ctx)
+
+	// settings drifted
+	deviceHelper.EXPECT().DiskSupportsPerfOptimization("basic", "Premium_LRS").Return(true)
+	deviceHelper.EXPECT().GetDeviceSettings(gomock.Any(), "basic", "Premium_LRS", "", "", "", gomock.Any()).Return(settings, nil)
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sdd", []string{"queue/scheduler"}).Return(map[string]string{"queue/scheduler": "mq-deadline"}, nil)
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sdd", settings).Return(nil)
+	deviceHelper.EXPECT().ReadDeviceSettings("/dev/sdd", []string{"queue/scheduler"}).Return(settings, nil)
+	d.reconcileDeviceTuning(ctx)
+
+	// perf profile changed to none
+	startFakePVInformer(ctx, t, &d.Driver,
+		&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{VolumeAttributes: volumeContext},
+				},
+				VolumeAttributesClassName: ptr.To("untuned"),
+			},
+		},
+		&storagev1beta1.VolumeAttributesClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "untuned"},
+			Parameters: map[string]string{consts.PerfProfileField: "none"},
+		},
+	)
+	state, err := d.readDeviceTuningState("vol")
+	require.NoError(t, err)
+	state.VolumeContext[consts.PvNameKey] = "pv"
+	require.NoError(t, d.writeDeviceTuningState(state))
+	deviceHelper.EXPECT().DiskSupportsPerfOptimization("none", "Premium_LRS").Return(false)
+	deviceHelper.EXPECT().ApplyDeviceSettings("/dev/sdd", map[string]string{"queue/scheduler": "mq-deadline"}).Return(nil)
+	d.reconcileDeviceTuning(ctx)
+
+	state, err = d.readDeviceTuningState("vol")
+	require.NoError(t, err)
+	assert.Empty(t, state.Settings)
+	assert.Empty(t, state.Original)
+	assert.Equal(t, "none", state.VolumeContext[consts.PerfProfileField])
+
+	// another disk on the lun is not tuned
+	state.Settings = settings
+	state.Original = map[string]string{"queue/scheduler": "mq-deadline"}
+	d.ioHandler = &deviceWWIDIOHandler{IOHandler: azureutils.NewFakeIOHandler(), wwid: "uuid.0b9c1e2d-3f4a-4b5c-8d6e-7f8091a2b3c4"}
+	require.NoError(t, d.writeDeviceTuningState(state))
+	deviceHelper.EXPECT().DiskSupportsPerfOptimization("none", "Premium_LRS").Return(false)
+	d.reconcileDeviceTuning(ctx)
+	state, err = d.readDeviceTuningState("vol")
+	require.NoError(t, err)
+	assert.Equal(t, settings, state.Settings)
+
+	// the state of a volume whose staging path is gone is removed
+	require.NoError(t, os.Remove(stagingPath))
+	d.reconcileDeviceTuning(ctx)
+	state, err = d.readDeviceTuningState("vol")
+	require.NoError(t, err)
+	assert.Nil(t, state)
+}
+
+func TestGetLatestVolumeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := map[string]string{consts.PvNameKey: "pv", consts.PerfProfileField: "basic", consts.RequestedSizeGib: "10"}
+	d := &Driver{}
+	assert.Equal(t, recorded, d.getLatestVolumeContext(ctx, recorded))
+
+	startFakePVInformer(ctx, t, d)
+	assert.Equal(t, recorded, d.getLatestVolumeContext(ctx, recorded))
+
+	startFakePVInformer(ctx, t, d, &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("20Gi")},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{VolumeAttributes: recorded},
+			},
+			VolumeAttributesClassName: ptr.To("fast"),
+		},
+	})
+	// the VolumeAttributesClass is not found
+	assert.Equal(t, recorded, d.getLatestVolumeContext(ctx, recorded))
+
+	_, err := d.kubeClient.StorageV1beta1().VolumeAttributesClasses().Create(ctx, &storagev1beta1.VolumeAttributesClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "fast"},
+		Parameters: map[string]string{"PerfProfile": "advanced", consts.DiskIOPSReadWriteField: "5000"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		consts.PvNameKey:              "pv",
+		consts.PerfProfileField:       "advanced",
+		consts.RequestedSizeGib:       "20",
+		consts.DiskIOPSReadWriteField: "5000",
+	}, d.getLatestVolumeContext(ctx, recorded))
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+const (
+	// exit codes of a low-level blkid probe
+	blkidExitNothingFound = 2
+	blkidExitAmbivalent   = 8
+)
+
+// errForeignDataSignature is returned if a device carries data which formatting it with the requested fstype would destroy
+var errForeignDataSignature = errors.New("device carries foreign data signatures")
+
+// checkDiskSignatures refuses to stage a device carrying signatures, e.g. an LVM physical volume, a partition table,
+// a ZFS pool or BitLocker, other than a filesystem of the requested fstype, since formatAndMount would wipe it.
+// A volume context with allowFormatWithExistingData=true skips the check.
+func (d *Driver) checkDiskSignatures(ctx context.Context, diskURI, source, fstype string, volumeContext map[string]string) error {
+	if allowFormatWithExistingData(volumeContext) {
+		return nil
+	}
+
+	signatures, err := getDiskSignatures(source, d.mounter)
+	if err != nil {
+		return err
+	}
+	return d.refuseForeignSignatures(ctx, diskURI, source, fstype, getForeignSignatures(signatures, fstype), volumeContext)
+}
+
+// getForeignSignatures returns the signatures other than a filesystem of fstype
+func getForeignSignatures(signatures []string, fstype string) []string {
+	var foreign []string
+	for _, signature := range signatures {
+		if !strings.EqualFold(signature, fstype) {
+			foreign = append(foreign, signature)
+		}
+	}
+	return foreign
+}
+
+// refuseForeignSignatures records an event and returns errForeignDataSignature if foreign signatures were found on source
+func (d *Driver) refuseForeignSignatures(ctx context.Context, diskURI, source, fstype string, foreign []string, volumeContext map[string]string) error {
+	if len(foreign) == 0 {
+		return nil
+	}
+
+	klog.FromContext(ctx).V(2).Info("refusing to format device with foreign data signatures", "source", source, "fstype", fstype, "signatures", foreign)
+	d.recordAttachEvent(ctx, diskURI, types.NodeName(d.NodeID), volumeContext, v1.EventTypeWarning, eventReasonFormatRefused,
+		"device %s on node %s carries %s, refusing to format it with %s, set %s=true in the volume attributes to format it anyway",
+		source, d.NodeID, strings.Join(foreign, ", "), fstype, consts.AllowFormatWithExistingDataField)
+	return fmt.Errorf("%w: %s found on %s", errForeignDataSignature, strings.Join(foreign, ", "), source)
+}
+
+// allowFormatWithExistingData returns whether the volume context opts in to formatting a device carrying other data
+func allowFormatWithExistingData(volumeContext map[string]string) bool {
+	for k, v := range volumeContext {
+		if strings.EqualFold(k, consts.AllowFormatWithExistingDataField) {
+			return strings.EqualFold(v, consts.TrueValue)
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"k8s.io/client-go/tools/record"
+	testingexec "k8s.io/utils/exec/testing"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+func TestCheckDiskSignatures(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	output := func(out string, exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte(out), []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte(out), []byte{}, nil
+		}
+	}
+
+	tests := []struct {
+		desc          string
+		volumeContext map[string]string
+		outputScripts []testingexec.FakeAction
+		expectedErr   error
+		expectedEvent bool
+	}{
+		{
+			desc:          "blank disk",
+			outputScripts: []testingexec.FakeAction{output("", blkidExitNothingFound)},
+		},
+		{
+			desc:          "filesystem of the requested fstype",
+			outputScripts: []testingexec.FakeAction{output("DEVNAME=/dev/sdd\nUUID=4e2b1c3a\nTYPE=ext4\nUSAGE=filesystem\n", 0)},
+		},
+		{
+			desc:          "LVM physical volume",
+			outputScripts: []testingexec.FakeAction{output("DEVNAME=/dev/sdd\nTYPE=LVM2_member\nUSAGE=raid\n", 0)},
+			expectedErr:   fmt.Errorf("%w: LVM2_member found on /dev/sdd", errForeignDataSignature),
+			expectedEvent: true,
+		},
+		{
+			desc:          "partition table",
+			outputScripts: []testingexec.FakeAction{output("DEVNAME=/dev/sdd\nPTUUID=8d3f\nPTTYPE=gpt\n", 0)},
+			expectedErr:   fmt.Errorf("%w: gpt partition table found on /dev/sdd", errForeignDataSignature),
+			expectedEvent: true,
+		},
+		{
+			desc: "ambivalent signatures listed by wipefs",
+			outputScripts: []testingexec.FakeAction{
+				output("", blkidExitAmbivalent),
+				output("ext4\nzfs_member\nzfs_member\n", 0),
+			},
+			expectedErr:   fmt.Errorf("%w: zfs_member found on /dev/sdd", errForeignDataSignature),
+			expectedEvent: true,
+		},
+		{
+			desc:          "opted in to format with existing data",
+			volumeContext: map[string]string{"allowFormatWithExistingData": "true"},
+		},
+		{
+			desc:          "probe failure",
+			outputScripts: []testingexec.FakeAction{output("I/O error", 1)},
+			expectedErr:   fmt.Errorf("failed to probe signatures of /dev/sdd: output: I/O error, err: exit 1"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			fakeMounter, err := mounter.NewFakeSafeMounter()
+			require.NoError(t, err)
+			d.setMounter(fakeMounter)
+			d.setNextCommandOutputScripts(test.outputScripts...)
+			recorder := record.NewFakeRecorder(10)
+			d.eventRecorder = recorder
+			volumeContext := map[string]string{consts.PvNameKey: "pv-1"}
+			for k, v := range test.volumeContext {
+				volumeContext[k] = v
+			}
+
+			err = d.checkDiskSignatures(context.Background(), "vol_1", "/dev/sdd", "ext4", volumeContext)
+			if test.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectedErr.Error())
+			}
+			if test.expectedEvent {
+				assert.ErrorIs(t, err, errForeignDataSignature)
+				assert.Contains(t, <-recorder.Events, eventReasonFormatRefused)
+			} else {
+				assert.Empty(t, recorder.Events)
+			}
+		})
+	}
+}
+
+func TestAllowFormatWithExistingData(t *testing.T) {
+	assert.False(t, allowFormatWithExistingData(nil))
+	assert.False(t, allowFormatWithExistingData(map[string]string{consts.AllowFormatWithExistingDataField: "false"}))
+	assert.True(t, allowFormatWithExistingData(map[string]string{"allowFormatWithExistingData": "True"}))
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// dryRun answers the mutating disk, snapshot and VM calls of the controller with a synthesized
+// success, while the reads still go to Azure. It remembers the disks and snapshots it pretended
+// to create and the disks it pretended to attach or detach, so that the reads following a
+// mutating call see its result.
+type dryRun struct {
+	mu sync.Mutex
+	// <lower case resource ID, synthesized disk>
+	disks map[string]*armcompute.Disk
+	// <lower case resource ID, synthesized snapshot>
+	snapshots map[string]*armcompute.Snapshot
+	// <lower case node name, <lower case disk URI, data disk>>
+	attached map[string]map[string]*armcompute.DataDisk
+	// <lower case node name, <lower case disk URI>>
+	detached map[string]map[string]bool
+	// getDisk reads a disk from Azure, it is used to fill in the size of synthesized snapshots
+	getDisk func(ctx context.Context, diskURI string) (*armcompute.Disk, error)
+}
+
+func newDryRun() *dryRun {
+	return &dryRun{
+		disks:     map[string]*armcompute.Disk{},
+		snapshots: map[string]*armcompute.Snapshot{},
+		attached:  map[string]map[string]*armcompute.DataDisk{},
+		detached:  map[string]map[string]bool{},
+	}
+}
+
+// logIntercepted logs an intercepted mutating call with its full request payload
+func logIntercepted(ctx context.Context, call string, keysAndValues []interface{}, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%+v", payload))
+	}
+	keysAndValues = append(keysAndValues, "call", call, "payload", string(data))
+	klog.FromContext(ctx).Info("dry-run: intercepted mutating call", keysAndValues...)
+}
+
+// interceptor returns the ARM interceptor of the dry-run mode, it must be the innermost interceptor
+func (r *dryRun) interceptor() interceptor.Interceptor {
+	return func(ctx context.Context, op *interceptor.Operation, invoke interceptor.Invoker) (interface{}, error) {
+		if !op.Mutating {
+			if op.Method == "Get" {
+				if result := r.get(op); result != nil {
+					return result, nil
+				}
+			}
+			return invoke(ctx)
+		}
+
+		logIntercepted(ctx, string(op.ResourceType)+"."+op.Method, []interface{}{"subscriptionID", op.SubscriptionID,
+			"resourceGroup", op.ResourceGroup, "parentResourceName", op.ParentResourceName, "resourceName", op.ResourceName}, op.Parameters)
+		return r.synthesize(ctx, op)
+	}
+}
+
+// get returns the synthesized disk or snapshot of a Get call, nil if there is none
+func (r *dryRun) get(op *interceptor.Operation) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch op.ResourceType {
+	case interceptor.ResourceTypeDisk:
+		if disk, ok := r.disks[resourceKey(managedDiskPath, op)]; ok {
+			return disk
+		}
+	case interceptor.ResourceTypeSnapshot:
+		if snapshot, ok := r.snapshots[resourceKey(diskSnapshotPath, op)]; ok {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// synthesize returns the result of a successful mutating call, with the type the client method returns
+func (r *dryRun) synthesize(ctx context.Context, op *interceptor.Operation) (interface{}, error) {
+	switch op.ResourceType {
+	case interceptor.ResourceTypeDisk:
+		key := resourceKey(managedDiskPath, op)
+		switch op.Method {
+		case "CreateOrUpdate":
+			disk, _ := op.Parameters.(armcompute.Disk)
+			disk.ID = ptr.To(fmt.Sprintf(managedDiskPath, op.SubscriptionID, op.ResourceGroup, op.ResourceName))
+			disk.Name = ptr.To(op.ResourceName)
+			if disk.Properties == nil {
+				disk.Properties = &armcompute.DiskProperties{}
+			}
+			disk.Properties.ProvisioningState = ptr.To("Succeeded")
+			disk.Properties.TimeCreated = ptr.To(time.Now())
+			disk.Properties.DiskState = ptr.To(armcompute.DiskStateUnattached)
+			r.mu.Lock()
+			r.disks[key] = &disk
+			r.mu.Unlock()
+			return &disk, nil
+		case "Patch":
+			r.mu.Lock()
+			disk, ok := r.disks[key]
+			r.mu.Unlock()
+			if !ok {
+				// the disk was not created in dry-run mode, the patch applies to the disk read from Azure
+				// and the following reads see the patched disk
+				diskURI := fmt.Sprintf(managedDiskPath, op.SubscriptionID, op.ResourceGroup, op.ResourceName)
+				if r.getDisk == nil {
+					return nil, fmt.Errorf("dry-run: can not read disk %s to patch it", diskURI)
+				}
+				current, err := r.getDisk(ctx, diskURI)
+				if err != nil {
+					return nil, fmt.Errorf("dry-run: failed to read disk %s to patch it: %w", diskURI, err)
+				}
+				if current == nil {
+					return nil, fmt.Errorf("dry-run: disk %s to patch was not found", diskURI)
+				}
+				disk = current
+			}
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if update, ok := op.Parameters.(armcompute.DiskUpdate); ok {
+				applyDiskUpdate(disk, &update)
+			}
+			r.disks[key] = disk
+			return disk, nil
+		case "Delete":
+			r.mu.Lock()
+			delete(r.disks, key)
+			r.mu.Unlock()
+			return nil, nil
+		}
+	case interceptor.ResourceTypeSnapshot:
+		key := resourceKey(diskSnapshotPath, op)
+		switch op.Method {
+		case "CreateOrUpdate":
+			snapshot, _ := op.Parameters.(armcompute.Snapshot)
+			snapshot.ID = ptr.To(fmt.Sprintf(diskSnapshotPath, op.SubscriptionID, op.ResourceGroup, op.ResourceName))
+			snapshot.Name = ptr.To(op.ResourceName)
+			if snapshot.Properties == nil {
+				snapshot.Properties = &armcompute.SnapshotProperties{}
+			}
+			snapshot.Properties.ProvisioningState = ptr.To("Succeeded")
+			snapshot.Properties.TimeCreated = ptr.To(time.Now())
+			snapshot.Properties.CompletionPercent = ptr.To(float32(100))
+			snapshot.Properties.DiskSizeGB = r.sourceSizeGB(ctx, snapshot.Properties.CreationData)
+			r.mu.Lock()
+			r.snapshots[key] = &snapshot
+			r.mu.Unlock()
+			return &snapshot, nil
+		case "Delete":
+			r.mu.Lock()
+			delete(r.snapshots, key)
+			r.mu.Unlock()
+			return nil, nil
+		}
+	case interceptor.ResourceTypeVirtualMachine:
+		switch op.Method {
+		case "CreateOrUpdate":
+			vm, _ := op.Parameters.(armcompute.VirtualMachine)
+			return &vm, nil
+		case "Delete":
+			return nil, nil
+		}
+	case interceptor.ResourceTypeVirtualMachineScaleSetVM:
+		switch op.Method {
+		case "Update":
+			vm, _ := op.Parameters.(armcompute.VirtualMachineScaleSetVM)
+			return &vm, nil
+		case "AttachDetachDataDisks":
+			return &armcompute.VirtualMachineScaleSetVMsClientAttachDetachDataDisksResponse{}, nil
+		case "Delete":
+			return nil, nil
+		}
+	}
+	// long running VM operations return a poller, which can not be synthesized; attach and detach
+	// never get here since they are answered by dryRunVMSet
+	return nil, fmt.Errorf("dry-run: %s.%s is not supported", op.ResourceType, op.Method)
+}
+
+// sourceSizeGB returns the size of the source disk or snapshot of a synthesized snapshot
+func (r *dryRun) sourceSizeGB(ctx context.Context, creationData *armcompute.CreationData) *int32 {
+	if creationData == nil || creationData.SourceResourceID == nil {
+		return ptr.To(int32(0))
+	}
+	sourceID := *creationData.SourceResourceID
+	r.mu.Lock()
+	snapshot, ok := r.snapshots[strings.ToLower(sourceID)]
+	r.mu.Unlock()
+	if ok {
+		return snapshot.Properties.DiskSizeGB
+	}
+	if r.getDisk != nil {
+		if disk, err := r.getDisk(ctx, sourceID); err == nil && disk != nil && disk.Properties != nil && disk.Properties.DiskSizeGB != nil {
+			return disk.Properties.DiskSizeGB
+		}
+	}
+	return ptr.To(int32(0))
+}
+
+// applyDiskUpdate sets the properties of disk which are set in update
+func applyDiskUpdate(disk *armcompute.Disk, update *armcompute.DiskUpdate) {
+	if update.SKU != nil {
+		disk.SKU = update.SKU
+	}
+	if update.Tags != nil {
+		disk.Tags = update.Tags
+	}
+	if update.Properties == nil {
+		return
+	}
+	if disk.Properties == nil {
+		disk.Properties = &armcompute.DiskProperties{}
+	}
+	if update.Properties.DiskSizeGB != nil {
+		disk.Properties.DiskSizeGB = update.Properties.DiskSizeGB
+	}
+	if update.Properties.DiskIOPSReadWrite != nil {
+		disk.Properties.DiskIOPSReadWrite = update.Properties.DiskIOPSReadWrite
+	}
+	if update.Properties.DiskMBpsReadWrite != nil {
+		disk.Properties.DiskMBpsReadWrite = update.Properties.DiskMBpsReadWrite
+	}
+	if update.Properties.BurstingEnabled != nil {
+		disk.Properties.BurstingEnabled = update.Properties.BurstingEnabled
+	}
+}
+
+func resourceKey(format string, op *interceptor.Operation) string {
+	return strings.ToLower(fmt.Sprintf(format, op.SubscriptionID, op.ResourceGroup, op.ResourceName))
+}
+
+// vmSet wraps vmset so that attach, detach and VM updates are answered with a synthesized success
+func (r *dryRun) vmSet(vmset provider.VMSet) provider.VMSet {
+	return &dryRunVMSet{VMSet: vmset, dryRun: r}
+}
+
+// dryRunVMSet answers the mutating calls of a VMSet with a synthesized success and
+// returns the data disks of a node as if the intercepted attach and detach calls were done
+type dryRunVMSet struct {
+	provider.VMSet
+	dryRun *dryRun
+}
+
+func (v *dryRunVMSet) AttachDisk(ctx context.Context, nodeName types.NodeName, diskMap map[string]*provider.AttachDiskOptions) error {
+	logIntercepted(ctx, "vmset.AttachDisk", []interface{}{"node", nodeName}, diskMap)
+	node := strings.ToLower(string(nodeName))
+	v.dryRun.mu.Lock()
+	defer v.dryRun.mu.Unlock()
+	if v.dryRun.attached[node] == nil {
+		v.dryRun.attached[node] = map[string]*armcompute.DataDisk{}
+	}
+	for diskURI, opt := range diskMap {
+		diskURI = strings.ToLower(diskURI)
+		delete(v.dryRun.detached[node], diskURI)
+		v.dryRun.attached[node][diskURI] = &armcompute.DataDisk{
+			Name:                    ptr.To(opt.DiskName),
+			Lun:                     ptr.To(opt.Lun),
+			Caching:                 ptr.To(opt.CachingMode),
+			CreateOption:            ptr.To(armcompute.DiskCreateOptionTypesAttach),
+			ManagedDisk:             &armcompute.ManagedDiskParameters{ID: ptr.To(diskURI)},
+			WriteAcceleratorEnabled: ptr.To(opt.WriteAcceleratorEnabled),
+		}
+	}
+	return nil
+}
+
+func (v *dryRunVMSet) DetachDisk(ctx context.Context, nodeName types.NodeName, diskMap map[string]string, forceDetach bool) error {
+	logIntercepted(ctx, "vmset.DetachDisk", []interface{}{"node", nodeName, "forceDetach", forceDetach}, diskMap)
+	node := strings.ToLower(string(nodeName))
+	v.dryRun.mu.Lock()
+	defer v.dryRun.mu.Unlock()
+	if v.dryRun.detached[node] == nil {
+		v.dryRun.detached[node] = map[string]bool{}
+	}
+	for diskURI := range diskMap {
+		diskURI = strings.ToLower(diskURI)
+		delete(v.dryRun.attached[node], diskURI)
+		v.dryRun.detached[node][diskURI] = true
+	}
+	return nil
+}
+
+func (v *dryRunVMSet) UpdateVM(ctx context.Context, nodeName types.NodeName) error {
+	logIntercepted(ctx, "vmset.UpdateVM", []interface{}{"node", nodeName}, nil)
+	return nil
+}
+
+func (v *dryRunVMSet) GetDataDisks(ctx context.Context, nodeName types.NodeName, crt azcache.AzureCacheReadType) ([]*armcompute.DataDisk, *string, error) {
+	disks, provisioningState, err := v.VMSet.GetDataDisks(ctx, nodeName, crt)
+	if err != nil {
+		return disks, provisioningState, err
+	}
+	node := strings.ToLower(string(nodeName))
+	v.dryRun.mu.Lock()
+	defer v.dryRun.mu.Unlock()
+	result := make([]*armcompute.DataDisk, 0, len(disks)+len(v.dryRun.attached[node]))
+	for _, disk := range disks {
+		if disk.ManagedDisk != nil && disk.ManagedDisk.ID != nil {
+			diskURI := strings.ToLower(*disk.ManagedDisk.ID)
+			if v.dryRun.detached[node][diskURI] || v.dryRun.attached[node][diskURI] != nil {
+				continue
+			}
+		}
+		result = append(result, disk)
+	}
+	for _, disk := range v.dryRun.attached[node] {
+		result = append(result, disk)
+	}
+	return result, provisioningState, nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/diskclient/mock_diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/snapshotclient/mock_snapshotclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachineclient/mock_virtualmachineclient"
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func TestDryRunInterceptor(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	factory := mock_azclient.NewMockClientFactory(cntl)
+	disks := mock_diskclient.NewMockInterface(cntl)
+	snapshots := mock_snapshotclient.NewMockInterface(cntl)
+	vms := mock_virtualmachineclient.NewMockInterface(cntl)
+	factory.EXPECT().GetDiskClientForSub("subs").Return(disks, nil).AnyTimes()
+	factory.EXPECT().GetSnapshotClientForSub("subs").Return(snapshots, nil).AnyTimes()
+	factory.EXPECT().GetVirtualMachineClient().Return(vms).AnyTimes()
+
+	r := newDryRun()
+	r.getDisk = func(_ context.Context, diskURI string) (*armcompute.Disk, error) {
+		switch diskURI {
+		case "sourceDiskURI":
+			return &armcompute.Disk{Properties: &armcompute.DiskProperties{DiskSizeGB: ptr.To(int32(20))}}, nil
+		case fmt.Sprintf(managedDiskPath, "subs", "rg", "existing"):
+			return &armcompute.Disk{Name: ptr.To("existing"), Properties: &armcompute.DiskProperties{DiskSizeGB: ptr.To(int32(40))}}, nil
+		}
+		return nil, fmt.Errorf("disk %s not found", diskURI)
+	}
+	ctx := context.Background()
+	clientFactory := interceptor.NewClientFactory(factory, "subs", r.interceptor())
+	diskClient, _ := clientFactory.GetDiskClientForSub("subs")
+	snapshotClient, _ := clientFactory.GetSnapshotClientForSub("subs")
+	diskID := fmt.Sprintf(managedDiskPath, "subs", "rg", "disk")
+
+	// reads of other resources go to Azure
+	disks.EXPECT().Get(gomock.Any(), "rg", "other").Return(&armcompute.Disk{Name: ptr.To("other")}, nil).Times(1)
+	disk, err := diskClient.Get(ctx, "rg", "other")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", *disk.Name)
+
+	// created disks are synthesized and returned by the following reads
+	disk, err = diskClient.CreateOrUpdate(ctx, "rg", "disk", armcompute.Disk{Properties: &armcompute.DiskProperties{DiskSizeGB: ptr.To(int32(10))}})
+	assert.NoError(t, err)
+	assert.Equal(t, diskID, *disk.ID)
+	assert.Equal(t, "Succeeded", *disk.Properties.ProvisioningState)
+	disk, err = diskClient.Get(ctx, "RG", "disk")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(10), *disk.Properties.DiskSizeGB)
+
+	_, err = diskClient.Patch(ctx, "rg", "disk", armcompute.DiskUpdate{Properties: &armcompute.DiskUpdateProperties{DiskSizeGB: ptr.To(int32(30))}})
+	assert.NoError(t, err)
+	disk, _ = diskClient.Get(ctx, "rg", "disk")
+	assert.Equal(t, int32(30), *disk.Properties.DiskSizeGB)
+
+	// a patch of a disk which was not created in dry-run mode applies to the disk read from Azure
+	disk, err = diskClient.Patch(ctx, "rg", "existing", armcompute.DiskUpdate{Properties: &armcompute.DiskUpdateProperties{
+		DiskSizeGB: ptr.To(int32(50)), DiskIOPSReadWrite: ptr.To(int64(5000))}})
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", *disk.Name)
+	assert.Equal(t, int32(50), *disk.Properties.DiskSizeGB)
+	disk, err = diskClient.Get(ctx, "rg", "existing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000), *disk.Properties.DiskIOPSReadWrite)
+	_, err = diskClient.Patch(ctx, "rg", "missing", armcompute.DiskUpdate{})
+	assert.ErrorContains(t, err, "dry-run: failed to read disk")
+
+	// a snapshot gets the size of its source, a cross region copy the size of the copied snapshot
+	snapshot, err := snapshotClient.CreateOrUpdate(ctx, "rg", "snapshot", armcompute.Snapshot{Properties: &armcompute.SnapshotProperties{
+		CreationData: &armcompute.CreationData{SourceResourceID: ptr.To("sourceDiskURI")}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), *snapshot.Properties.DiskSizeGB)
+	snapshot, err = snapshotClient.CreateOrUpdate(ctx, "rg", "copy", armcompute.Snapshot{Properties: &armcompute.SnapshotProperties{
+		CreationData: &armcompute.CreationData{SourceResourceID: snapshot.ID}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), *snapshot.Properties.DiskSizeGB)
+	snapshot, err = snapshotClient.Get(ctx, "rg", "copy")
+	assert.NoError(t, err)
+	assert.Equal(t, float32(100), *snapshot.Properties.CompletionPercent)
+
+	assert.NoError(t, snapshotClient.Delete(ctx, "rg", "copy"))
+	snapshots.EXPECT().Get(gomock.Any(), "rg", "copy").Return(nil, fmt.Errorf("not found")).Times(1)
+	_, err = snapshotClient.Get(ctx, "rg", "copy")
+	assert.Error(t, err)
+
+	assert.NoError(t, diskClient.Delete(ctx, "rg", "disk"))
+	disks.EXPECT().Get(gomock.Any(), "rg", "disk").Return(nil, fmt.Errorf("not found")).Times(1)
+	_, err = diskClient.Get(ctx, "rg", "disk")
+	assert.Error(t, err)
+
+	// long running VM operations can not be synthesized
+	_, err = clientFactory.GetVirtualMachineClient().BeginUpdate(ctx, "rg", "vm", armcompute.VirtualMachineUpdate{}, nil)
+	assert.ErrorContains(t, err, "dry-run: virtualMachine.BeginUpdate is not supported")
+}
+
+func TestDryRunVMSet(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	mockVMSet := provider.NewMockVMSet(cntl)
+	nodeName := types.NodeName("node")
+	existingDiskURI := fmt.Sprintf(managedDiskPath, "subs", "rg", "existing")
+	newDiskURI := fmt.Sprintf(managedDiskPath, "subs", "rg", "new")
+	mockVMSet.EXPECT().GetDataDisks(gomock.Any(), nodeName, azcache.CacheReadTypeDefault).Return([]*armcompute.DataDisk{
+		{Lun: ptr.To(int32(0)), Name: ptr.To("existing"), ManagedDisk: &armcompute.ManagedDiskParameters{ID: ptr.To(existingDiskURI)}},
+	}, ptr.To("Succeeded"), nil).AnyTimes()
+
+	c := &controllerCommon{dryRun: newDryRun()}
+	vmset := c.dryRun.vmSet(mockVMSet)
+	ctx := context.Background()
+
+	assert.NoError(t, vmset.AttachDisk(ctx, nodeName, map[string]*provider.AttachDiskOptions{
+		newDiskURI: {DiskName: "new", Lun: 1, CachingMode: armcompute.CachingTypesReadOnly},
+	}))
+	assert.NoError(t, vmset.UpdateVM(ctx, nodeName))
+	dataDisks, state, err := vmset.GetDataDisks(ctx, nodeName, azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Succeeded", *state)
+	assert.Len(t, dataDisks, 2)
+	assert.Equal(t, int32(1), *dataDisks[1].Lun)
+
+	assert.NoError(t, vmset.DetachDisk(ctx, nodeName, map[string]string{existingDiskURI: "existing", newDiskURI: "new"}, false))
+	dataDisks, _, err = vmset.GetDataDisks(ctx, nodeName, azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Empty(t, dataDisks)
+
+	// other nodes are not changed
+	mockVMSet.EXPECT().GetDataDisks(gomock.Any(), types.NodeName("other"), azcache.CacheReadTypeDefault).Return(nil, nil, nil).Times(1)
+	dataDisks, _, err = vmset.GetDataDisks(ctx, "other", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Empty(t, dataDisks)
+}
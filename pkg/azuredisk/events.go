@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+// reasons of the events recorded when the driver changes a request
+const (
+	eventReasonDiskSizeAdjusted         = "DiskSizeAdjusted"
+	eventReasonDiskZoneReset            = "DiskZoneReset"
+	eventReasonCachingModeAdjusted      = "CachingModeAdjusted"
+	eventReasonDiskPerformanceDefaulted = "DiskPerformanceDefaulted"
+	eventReasonFormatRefused            = "FormatRefused"
+	eventReasonFilesystemChecked        = "FilesystemChecked"
+	eventReasonReadOnlyRemount          = "ReadOnlyRemount"
+	eventReasonReadOnlyRemountRecovery  = "ReadOnlyRemountRecovery"
+)
+
+// newEventRecorder returns a recorder which writes events through kubeClient
+func newEventRecorder(kubeClient clientset.Interface, component string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component})
+}
+
+// recordPVCEvent records an event on the PVC named by the csi.storage.k8s.io/pvc/name and
+// csi.storage.k8s.io/pvc/namespace parameters of a CreateVolume request
+func (d *Driver) recordPVCEvent(ctx context.Context, parameters map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	if d.eventRecorder == nil {
+		return
+	}
+	name, namespace := parameters[consts.PvcNameKey], parameters[consts.PvcNamespaceKey]
+	if name == "" || namespace == "" {
+		return
+	}
+	var object runtime.Object = &v1.ObjectReference{Kind: "PersistentVolumeClaim", APIVersion: "v1", Name: name, Namespace: namespace}
+	if d.kubeClient != nil {
+		if pvc, err := d.kubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object = pvc
+		} else {
+			klog.V(4).Infof("failed to get pvc(%s/%s) for event %s: %v", namespace, name, reason, err)
+		}
+	}
+	d.eventRecorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// recordAttachEvent records an event on the VolumeAttachment of diskURI and nodeName and on its PV
+func (d *Driver) recordAttachEvent(ctx context.Context, diskURI string, nodeName types.NodeName, volumeContext map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	if d.eventRecorder == nil {
+		return
+	}
+	pvName := volumeContext[consts.PvNameKey]
+	if d.kubeClient != nil {
+		vaName := getVolumeAttachmentName(d.Name, diskURI, string(nodeName))
+		if va, err := d.kubeClient.StorageV1().VolumeAttachments().Get(ctx, vaName, metav1.GetOptions{}); err == nil {
+			d.eventRecorder.Eventf(va, eventType, reason, messageFmt, args...)
+			if name := ptr.Deref(va.Spec.Source.PersistentVolumeName, ""); name != "" {
+				pvName = name
+			}
+		} else {
+			klog.V(4).Infof("failed to get volumeattachment(%s) for event %s: %v", vaName, reason, err)
+		}
+	}
+	if pvName == "" {
+		return
+	}
+	var object runtime.Object = &v1.ObjectReference{Kind: "PersistentVolume", APIVersion: "v1", Name: pvName}
+	if d.kubeClient != nil {
+		if pv, err := d.kubeClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{}); err == nil {
+			object = pv
+		}
+	}
+	d.eventRecorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// getVolumeAttachmentName returns the name kubernetes gives the VolumeAttachment of a CSI volume on a node
+func getVolumeAttachmentName(driverName, volumeHandle, nodeName string) string {
+	return fmt.Sprintf("csi-%x", sha256.Sum256([]byte(volumeHandle+driverName+nodeName)))
+}
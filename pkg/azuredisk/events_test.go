@@ -0,0 +1,120 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+func TestRecordPVCEvent(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	assert.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	// no recorder, no event
+	d.recordPVCEvent(context.Background(), nil, v1.EventTypeNormal, eventReasonDiskZoneReset, "message")
+
+	recorder := &objectRecorder{FakeRecorder: record.NewFakeRecorder(10)}
+	d.eventRecorder = recorder
+	d.kubeClient = fake.NewSimpleClientset(&v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "default", UID: "pvc-uid"},
+	})
+
+	// the PVC is only known with both the pvc name and namespace parameters
+	d.recordPVCEvent(context.Background(), map[string]string{consts.PvcNameKey: "pvc"}, v1.EventTypeNormal, eventReasonDiskZoneReset, "message")
+	assert.Empty(t, recorder.Events)
+
+	params := map[string]string{consts.PvcNameKey: "pvc", consts.PvcNamespaceKey: "default"}
+	d.recordPVCEvent(context.Background(), params, v1.EventTypeWarning, eventReasonDiskSizeAdjusted, "increased size to %dGiB", 513)
+	assert.Equal(t, "Warning DiskSizeAdjusted increased size to 513GiB", <-recorder.Events)
+	assert.Equal(t, types.UID("pvc-uid"), recorder.objects[0].(metav1.Object).GetUID())
+
+	// a missing PVC is referenced by name
+	params[consts.PvcNameKey] = "missing"
+	d.recordPVCEvent(context.Background(), params, v1.EventTypeNormal, eventReasonDiskZoneReset, "message")
+	assert.Equal(t, "Normal DiskZoneReset message", <-recorder.Events)
+	assert.Equal(t, "missing", recorder.objects[1].(*v1.ObjectReference).Name)
+}
+
+func TestRecordAttachEvent(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	assert.NoError(t, err)
+	d := fd.(*fakeDriver)
+	recorder := &objectRecorder{FakeRecorder: record.NewFakeRecorder(10)}
+	d.eventRecorder = recorder
+
+	diskURI := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/disk"
+	d.kubeClient = fake.NewSimpleClientset(
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: getVolumeAttachmentName(d.Name, diskURI, "node1"), UID: "va-uid"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: d.Name,
+				NodeName: "node1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: ptr.To("pv")},
+			},
+		},
+		&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv", UID: "pv-uid"}},
+	)
+
+	d.recordAttachEvent(context.Background(), diskURI, types.NodeName("node1"), nil, v1.EventTypeWarning, eventReasonCachingModeAdjusted, "set cacheMode as None")
+	assert.Len(t, recorder.objects, 2)
+	assert.Equal(t, types.UID("va-uid"), recorder.objects[0].(metav1.Object).GetUID())
+	assert.Equal(t, types.UID("pv-uid"), recorder.objects[1].(metav1.Object).GetUID())
+
+	// without a VolumeAttachment the PV name is taken from the volume context
+	d.recordAttachEvent(context.Background(), diskURI, types.NodeName("node2"), map[string]string{consts.PvNameKey: "pv"}, v1.EventTypeWarning, eventReasonCachingModeAdjusted, "set cacheMode as None")
+	assert.Len(t, recorder.objects, 3)
+	assert.Equal(t, types.UID("pv-uid"), recorder.objects[2].(metav1.Object).GetUID())
+
+	d.recordAttachEvent(context.Background(), diskURI, types.NodeName("node2"), nil, v1.EventTypeWarning, eventReasonCachingModeAdjusted, "set cacheMode as None")
+	assert.Len(t, recorder.objects, 3)
+}
+
+func TestGetVolumeAttachmentName(t *testing.T) {
+	// same name as the one kubernetes computes in pkg/volume/csi
+	assert.Equal(t, "csi-ea8b1529ca837cc8f0020c3be8e367d9ffe969b2750a5aee009d3683f831d2bf",
+		getVolumeAttachmentName("disk.csi.azure.com", "vol", "node"))
+}
+
+// objectRecorder is a FakeRecorder which also keeps the objects of the events
+type objectRecorder struct {
+	*record.FakeRecorder
+	objects []runtime.Object
+}
+
+func (r *objectRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.objects = append(r.objects, object)
+	r.FakeRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
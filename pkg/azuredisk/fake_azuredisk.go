@@ -27,6 +27,7 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/mount-utils"
 	testingexec "k8s.io/utils/exec/testing"
+	"k8s.io/utils/keymutex"
 
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
 	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
@@ -92,8 +93,8 @@ type FakeDriver interface {
 	checkDiskExists(ctx context.Context, diskURI string) (*armcompute.Disk, error)
 	waitForSnapshotReady(context.Context, string, string, string, time.Duration, time.Duration) error
 	getSnapshotByID(context.Context, string, string, string, string) (*csi.Snapshot, error)
-	ensureMountPoint(string) (bool, error)
-	ensureBlockTargetFile(string) error
+	ensureMountPoint(context.Context, string) (bool, error)
+	ensureBlockTargetFile(context.Context, string) error
 	getDevicePathWithLUN(lunStr string) (string, error)
 	setThrottlingCache(key string, value string)
 	getUsedLunsFromVolumeAttachments(context.Context, string) ([]int, error)
@@ -112,6 +113,7 @@ func NewFakeDriver(ctrl *gomock.Controller) (FakeDriver, error) {
 	driver.NodeID = fakeNodeID
 	driver.CSIDriver = *csicommon.NewFakeCSIDriver()
 	driver.volumeLocks = volumehelper.NewVolumeLocks()
+	driver.stagingPathLocks = keymutex.NewHashed(0)
 	driver.VolumeAttachLimit = -1
 	driver.supportZone = true
 	driver.ioHandler = azureutils.NewFakeIOHandler()
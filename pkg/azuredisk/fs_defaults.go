@@ -0,0 +1,288 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// fsDefaultsReloadInterval is the interval of reading the filesystem defaults again
+const fsDefaultsReloadInterval = time.Minute
+
+// atimeMountOptions are the mount options choosing the atime update policy, a volume sets at most one of them
+var atimeMountOptions = []string{"atime", "noatime", "relatime", "norelatime", "strictatime", "nostrictatime"}
+
+var (
+	numberOptionRegex = regexp.MustCompile(`^[0-9]+$`)
+	// sizeOptionRegex matches a number with an optional unit, e.g. 256k
+	sizeOptionRegex = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+)
+
+// genericMountOptions are the filesystem independent mount options allowed as defaults besides the atime options,
+// ro is left out since it breaks the staging of read-write volumes
+var genericMountOptions = map[string]*regexp.Regexp{
+	"diratime":   nil,
+	"nodiratime": nil,
+	"lazytime":   nil,
+	"nolazytime": nil,
+	"nodev":      nil,
+	"nosuid":     nil,
+	"noexec":     nil,
+}
+
+var ext2MountOptions = map[string]*regexp.Regexp{
+	"discard":              nil,
+	"nodiscard":            nil,
+	"errors":               regexp.MustCompile(`^(continue|remount-ro|panic)$`),
+	"acl":                  nil,
+	"noacl":                nil,
+	"user_xattr":           nil,
+	"stripe":               numberOptionRegex,
+	"init_itable":          numberOptionRegex,
+	"noinit_itable":        nil,
+	"inode_readahead_blks": numberOptionRegex,
+}
+
+// ext3MountOptions add the journal options
+var ext3MountOptions = withMountOptions(ext2MountOptions, map[string]*regexp.Regexp{
+	"barrier":            nil,
+	"nobarrier":          nil,
+	"commit":             numberOptionRegex,
+	"data":               regexp.MustCompile(`^(ordered|writeback|journal)$`),
+	"journal_checksum":   nil,
+	"nojournal_checksum": nil,
+	"max_batch_time":     numberOptionRegex,
+	"min_batch_time":     numberOptionRegex,
+})
+
+// ext4MountOptions add the delayed allocation options
+var ext4MountOptions = withMountOptions(ext3MountOptions, map[string]*regexp.Regexp{
+	"delalloc":        nil,
+	"nodelalloc":      nil,
+	"auto_da_alloc":   nil,
+	"noauto_da_alloc": nil,
+})
+
+// fsMountOptions are the mount options which the node defaults may set, by fstype. The value of an option
+// matches its pattern, an option with a nil pattern takes no value.
+var fsMountOptions = map[string]map[string]*regexp.Regexp{
+	"ext2": ext2MountOptions,
+	"ext3": ext3MountOptions,
+	"ext4": ext4MountOptions,
+	// barrier and nobarrier were removed from xfs in kernel 4.19
+	"xfs": {
+		"discard":     nil,
+		"nodiscard":   nil,
+		"allocsize":   sizeOptionRegex,
+		"largeio":     nil,
+		"nolargeio":   nil,
+		"inode32":     nil,
+		"inode64":     nil,
+		"logbufs":     numberOptionRegex,
+		"logbsize":    sizeOptionRegex,
+		"noalign":     nil,
+		"swalloc":     nil,
+		"wsync":       nil,
+		"sunit":       numberOptionRegex,
+		"swidth":      numberOptionRegex,
+		"ikeep":       nil,
+		"noikeep":     nil,
+		"grpid":       nil,
+		"nogrpid":     nil,
+		"filestreams": nil,
+	},
+}
+
+// withMountOptions returns the union of two sets of mount options
+func withMountOptions(base, options map[string]*regexp.Regexp) map[string]*regexp.Regexp {
+	union := maps.Clone(base)
+	maps.Copy(union, options)
+	return union
+}
+
+// checkFsDefaultMountOption checks a default mount option against the options allowed for fstype
+func checkFsDefaultMountOption(fstype, option string) error {
+	allowed, ok := fsMountOptions[fstype]
+	if !ok {
+		return fmt.Errorf("default mount options are not supported with fstype %s", fstype)
+	}
+	key, val, hasValue := strings.Cut(option, "=")
+	if slices.Contains(atimeMountOptions, key) && !hasValue {
+		return nil
+	}
+	pattern, ok := allowed[key]
+	if !ok {
+		if pattern, ok = genericMountOptions[key]; !ok {
+			return fmt.Errorf("mount option %s is not allowed with fstype %s", key, fstype)
+		}
+	}
+	switch {
+	case pattern == nil && hasValue:
+		return fmt.Errorf("mount option %s takes no value", key)
+	case pattern != nil && !pattern.MatchString(val):
+		return fmt.Errorf("invalid value %q of mount option %s", val, key)
+	}
+	return nil
+}
+
+// fsDefaults are the node defaults of a filesystem type, e.g.
+//
+//	ext4:
+//	  mountOptions: [noatime, discard]
+//	xfs:
+//	  mountOptions: [noatime, logbsize=256k]
+type fsDefaults struct {
+	// MountOptions are added to the mount options of a volume which does not set them or their negation
+	MountOptions []string `json:"mountOptions,omitempty"`
+}
+
+// fsDefaultsTable holds the filesystem defaults loaded from the node config file
+type fsDefaultsTable struct {
+	mu sync.RWMutex
+	// defaults by lower case fstype
+	defaults map[string]fsDefaults
+}
+
+var nodeFsDefaults = &fsDefaultsTable{}
+
+// get returns the defaults of fstype
+func (t *fsDefaultsTable) get(fstype string) fsDefaults {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.defaults[strings.ToLower(fstype)]
+}
+
+// set replaces the defaults with the ones parsed from data, the defaults are kept if data is invalid
+func (t *fsDefaultsTable) set(data []byte) error {
+	defaults, err := parseFsDefaults(data)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.defaults = defaults
+	return nil
+}
+
+// parseFsDefaults parses a YAML or JSON map of fstype to its defaults
+func parseFsDefaults(data []byte) (map[string]fsDefaults, error) {
+	var config map[string]fsDefaults
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse filesystem defaults: %w", err)
+	}
+	defaults := make(map[string]fsDefaults, len(config))
+	for fstype, fsDefault := range config {
+		fstype = strings.ToLower(fstype)
+		for _, option := range fsDefault.MountOptions {
+			if option == "" || strings.ContainsAny(option, ", \t\n") {
+				return nil, fmt.Errorf("invalid mount option %q of fstype %s", option, fstype)
+			}
+			if err := checkFsDefaultMountOption(fstype, option); err != nil {
+				return nil, err
+			}
+		}
+		defaults[fstype] = fsDefault
+	}
+	return defaults, nil
+}
+
+// loadFsDefaults reads the filesystem defaults from the node config file
+func (d *Driver) loadFsDefaults() error {
+	data, err := os.ReadFile(d.fsDefaultsConfig)
+	if err != nil {
+		return err
+	}
+	if err := nodeFsDefaults.set(data); err != nil {
+		return err
+	}
+	klog.V(4).Infof("loaded filesystem defaults from %s", d.fsDefaultsConfig)
+	return nil
+}
+
+// withFsDefaultMountOptions appends the default mount options of fstype which do not conflict with options
+func withFsDefaultMountOptions(fstype string, options []string) []string {
+	for _, option := range nodeFsDefaults.get(fstype).MountOptions {
+		if !mountOptionConflicts(option, options) {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// missingFsDefaultMountOptions returns the default mount options of fstype which are added to the options of a volume
+// but which the volume is not mounted with, e.g. since the defaults were changed after the volume was staged
+func missingFsDefaultMountOptions(fstype string, options, mountedOptions []string) []string {
+	var missing []string
+	for _, option := range withFsDefaultMountOptions(fstype, slices.Clone(options))[len(options):] {
+		if !slices.Contains(mountedOptions, option) {
+			missing = append(missing, option)
+		}
+	}
+	return missing
+}
+
+// remountWithFsDefaults remounts the filesystem mounted at path with the default mount options it is missing, so an
+// expanded volume gets the defaults the volume would be staged with. A failed remount keeps the volume mounted as is.
+func (d *Driver) remountWithFsDefaults(ctx context.Context, path string, mountFlags []string) {
+	logger := klog.FromContext(ctx).WithValues("path", path)
+	mountPoints, err := d.mounter.List()
+	if err != nil {
+		logger.Error(err, "failed to list mount points")
+		return
+	}
+	for _, mp := range mountPoints {
+		if mp.Path != path {
+			continue
+		}
+		missing := missingFsDefaultMountOptions(mp.Type, collectMountOptions(mp.Type, mountFlags), mp.Opts)
+		if len(missing) == 0 {
+			return
+		}
+		logger.V(2).Info("remounting with the default mount options", "fstype", mp.Type, "mountOptions", missing)
+		if err := d.mounter.Mount(mp.Device, path, "", append([]string{"remount"}, missing...)); err != nil {
+			logger.Error(err, "failed to remount with the default mount options", "fstype", mp.Type, "mountOptions", missing)
+		}
+		return
+	}
+}
+
+// mountOptionConflicts returns whether options set option, its negation or, for an atime option, another atime option
+func mountOptionConflicts(option string, options []string) bool {
+	key, _, _ := strings.Cut(option, "=")
+	isAtime := slices.Contains(atimeMountOptions, key)
+	for _, o := range options {
+		k, _, _ := strings.Cut(o, "=")
+		switch {
+		case k == key, k == "no"+key, "no"+k == key:
+			return true
+		case isAtime && slices.Contains(atimeMountOptions, k):
+			return true
+		}
+	}
+	return false
+}
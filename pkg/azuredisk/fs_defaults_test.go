@@ -0,0 +1,137 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mount "k8s.io/mount-utils"
+)
+
+func TestLoadFsDefaults(t *testing.T) {
+	defer func() { nodeFsDefaults.defaults = nil }()
+	config := filepath.Join(t.TempDir(), "fs-defaults.yaml")
+	d := &Driver{}
+	d.fsDefaultsConfig = config
+
+	require.NoError(t, os.WriteFile(config, []byte("EXT4:\n  mountOptions: [noatime, discard]\nxfs:\n  mountOptions: [logbsize=256k]\n"), 0600))
+	require.NoError(t, d.loadFsDefaults())
+	assert.Equal(t, []string{"noatime", "discard"}, nodeFsDefaults.get("ext4").MountOptions)
+	assert.Equal(t, []string{"logbsize=256k"}, nodeFsDefaults.get("XFS").MountOptions)
+
+	// invalid defaults keep the loaded ones
+	require.NoError(t, os.WriteFile(config, []byte("ext4:\n  mountOptions: [\"noatime,discard\"]\n"), 0600))
+	assert.EqualError(t, d.loadFsDefaults(), `invalid mount option "noatime,discard" of fstype ext4`)
+	for data, expectedErr := range map[string]string{
+		"xfs:\n  mountOptions: [nobarrier]\n":       "mount option nobarrier is not allowed with fstype xfs",
+		"ext4:\n  mountOptions: [ro]\n":             "mount option ro is not allowed with fstype ext4",
+		"ext2:\n  mountOptions: [data=journal]\n":   "mount option data is not allowed with fstype ext2",
+		"ext4:\n  mountOptions: [data=unordered]\n": `invalid value "unordered" of mount option data`,
+		"ext4:\n  mountOptions: [discard=1]\n":      "mount option discard takes no value",
+		"btrfs:\n  mountOptions: [noatime]\n":       "default mount options are not supported with fstype btrfs",
+	} {
+		_, err := parseFsDefaults([]byte(data))
+		assert.EqualError(t, err, expectedErr, data)
+	}
+	require.NoError(t, os.WriteFile(config, []byte("ext4:\n  mountoption: [noatime]\n"), 0600))
+	assert.Error(t, d.loadFsDefaults())
+	assert.Equal(t, []string{"noatime", "discard"}, nodeFsDefaults.get("ext4").MountOptions)
+}
+
+func TestWithFsDefaultMountOptions(t *testing.T) {
+	defer func() { nodeFsDefaults.defaults = nil }()
+	require.NoError(t, nodeFsDefaults.set([]byte("ext4:\n  mountOptions: [noatime, discard, commit=30]\n")))
+
+	tests := []struct {
+		desc     string
+		fstype   string
+		options  []string
+		expected []string
+	}{
+		{
+			desc:     "no defaults of fstype",
+			fstype:   "xfs",
+			options:  []string{"nouuid"},
+			expected: []string{"nouuid"},
+		},
+		{
+			desc:     "defaults added",
+			fstype:   "ext4",
+			options:  []string{"ro"},
+			expected: []string{"ro", "noatime", "discard", "commit=30"},
+		},
+		{
+			desc:     "volume options take precedence",
+			fstype:   "ext4",
+			options:  []string{"relatime", "nodiscard", "commit=5"},
+			expected: []string{"relatime", "nodiscard", "commit=5"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, withFsDefaultMountOptions(test.fstype, test.options))
+		})
+	}
+}
+
+func TestRemountWithFsDefaults(t *testing.T) {
+	defer func() { nodeFsDefaults.defaults = nil }()
+	require.NoError(t, nodeFsDefaults.set([]byte("ext4:\n  mountOptions: [noatime, discard, commit=30]\n")))
+
+	tests := []struct {
+		desc            string
+		mountFlags      []string
+		mountedOpts     []string
+		expectedRemount []string
+	}{
+		{
+			desc:            "missing defaults remounted",
+			mountedOpts:     []string{"rw", "relatime", "discard"},
+			expectedRemount: []string{"remount", "noatime", "commit=30"},
+		},
+		{
+			desc:        "volume options take precedence",
+			mountFlags:  []string{"relatime", "commit=5"},
+			mountedOpts: []string{"rw", "relatime", "discard", "commit=5"},
+		},
+		{
+			desc:        "mounted with the defaults",
+			mountedOpts: []string{"rw", "noatime", "discard", "commit=30"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			fakeMounter := mount.NewFakeMounter([]mount.MountPoint{{Device: "/dev/sdc", Path: "/staging", Type: "ext4", Opts: test.mountedOpts}})
+			d := &Driver{}
+			d.setMounter(&mount.SafeFormatAndMount{Interface: fakeMounter})
+			d.remountWithFsDefaults(context.Background(), "/staging", test.mountFlags)
+			mountPoints, err := fakeMounter.List()
+			require.NoError(t, err)
+			if test.expectedRemount == nil {
+				assert.Len(t, mountPoints, 1)
+				return
+			}
+			require.Len(t, mountPoints, 2)
+			assert.Equal(t, mount.MountPoint{Device: "/dev/sdc", Path: "/staging", Opts: test.expectedRemount}, mountPoints[1])
+		})
+	}
+}
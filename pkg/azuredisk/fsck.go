@@ -0,0 +1,115 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+)
+
+// fsckResult is the outcome of a filesystem check
+type fsckResult string
+
+const (
+	fsckResultClean    fsckResult = "clean"
+	fsckResultRepaired fsckResult = "repaired"
+	fsckResultErrors   fsckResult = "errors"
+	fsckResultFailed   fsckResult = "failed"
+	fsckResultTimeout  fsckResult = "timeout"
+)
+
+// fsckOutputMaxLength is the length of the end of the fsck output kept in events
+const fsckOutputMaxLength = 512
+
+// fsck checks the filesystem on source, or repairs it if policy is repair, within the fsck timeout of the driver.
+// The result is recorded as an event on the VolumeAttachment and PV and in the fsck duration metric.
+func (d *Driver) fsck(ctx context.Context, diskURI, source, fstype, policy, reason string, volumeContext map[string]string) fsckResult {
+	logger := klog.FromContext(ctx).WithValues("source", source, "fstype", fstype, "fsckPolicy", policy)
+	fsckCtx := ctx
+	if d.fsckTimeout > 0 {
+		var cancel context.CancelFunc
+		fsckCtx, cancel = context.WithTimeout(ctx, d.fsckTimeout)
+		defer cancel()
+	}
+
+	logger.V(2).Info("checking filesystem", "reason", reason)
+	start := time.Now()
+	_, span := startSpan(ctx, "fsck", attrVolumeID.String(diskURI), attrFsType.String(fstype))
+	result, output, err := checkFilesystem(fsckCtx, source, fstype, policy == consts.FsckPolicyRepair, d.mounter)
+	endSpan(span, err)
+	elapsed := time.Since(start)
+	if result == "" {
+		// the filesystem can not be checked on this node
+		logger.V(2).Info("skip filesystem check", "error", err)
+		return result
+	}
+	fsckDuration.WithLabelValues(fstype, policy, string(result)).Observe(elapsed.Seconds())
+	logger.V(2).Info("checked filesystem", "result", result, "elapsed", elapsed, "error", err)
+
+	eventType := v1.EventTypeNormal
+	if result != fsckResultClean && result != fsckResultRepaired {
+		eventType = v1.EventTypeWarning
+	}
+	if output == "" && err != nil {
+		output = err.Error()
+	}
+	if len(output) > fsckOutputMaxLength {
+		output = "..." + output[len(output)-fsckOutputMaxLength:]
+	}
+	d.recordAttachEvent(ctx, diskURI, types.NodeName(d.NodeID), volumeContext, eventType, eventReasonFilesystemChecked,
+		"fsck (%s) of %s filesystem on %s of node %s since %s: %s after %s, output: %s",
+		policy, fstype, source, d.NodeID, reason, result, elapsed.Round(time.Millisecond), output)
+	return result
+}
+
+// isSharedDisk tells whether the disk has maxShares > 1 in the volume or publish context, its filesystem may be
+// mounted on other nodes, so a check reports bogus errors and a repair corrupts it
+func isSharedDisk(volumeContext, publishContext map[string]string) bool {
+	for _, attributes := range []map[string]string{volumeContext, publishContext} {
+		if maxShares, err := azureutils.GetMaxShares(attributes); err == nil && maxShares > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// fsckIfDirty checks or repairs the filesystem on source if it is marked dirty,
+// an error is returned if the repair policy could not repair it
+func (d *Driver) fsckIfDirty(ctx context.Context, diskURI, source, fstype, policy string, volumeContext map[string]string) error {
+	dirty, err := isFilesystemDirty(source, fstype, d.mounter)
+	if err != nil {
+		// e.g. the device is not formatted yet
+		klog.FromContext(ctx).V(4).Info("could not read the filesystem state", "source", source, "error", err)
+		return nil
+	}
+	if !dirty {
+		return nil
+	}
+	result := d.fsck(ctx, diskURI, source, fstype, policy, "filesystem is dirty", volumeContext)
+	if policy == consts.FsckPolicyRepair && result != fsckResultClean && result != fsckResultRepaired {
+		return fmt.Errorf("fsck of dirty %s filesystem finished with %s", fstype, result)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+func TestFsckIfDirty(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	output := func(out string, exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte(out), []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte(out), []byte{}, nil
+		}
+	}
+	clean := output("Filesystem volume name:   <none>\nFilesystem state:         clean\n", 0)
+	dirty := output("Filesystem volume name:   <none>\nFilesystem state:         not clean\n", 0)
+	needsRecovery := output("Filesystem state:         clean\nFilesystem features:      has_journal ext_attr needs_recovery extent\n", 0)
+	hasErrors := output("Filesystem state:         clean\nFS Error count:           3\n", 0)
+
+	tests := []struct {
+		desc          string
+		fstype        string
+		policy        string
+		fsckTimeout   time.Duration
+		outputScripts []testingexec.FakeAction
+		expectedErr   string
+		expectedEvent string
+	}{
+		{
+			desc:          "clean filesystem",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyRepair,
+			outputScripts: []testingexec.FakeAction{clean},
+		},
+		{
+			desc:          "clean filesystem without errors",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyRepair,
+			outputScripts: []testingexec.FakeAction{output("Filesystem state:         clean\nFilesystem features:      has_journal extent\nFS Error count:           0\n", 0)},
+		},
+		{
+			desc:          "journal needs recovery",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyRepair,
+			outputScripts: []testingexec.FakeAction{needsRecovery, output("", 0)},
+			expectedEvent: "Normal FilesystemChecked fsck (repair) of ext4 filesystem on /dev/sdd of node fakeNodeID since filesystem is dirty: clean",
+		},
+		{
+			desc:          "recorded filesystem errors",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyCheck,
+			outputScripts: []testingexec.FakeAction{hasErrors, output("Inode 12 has illegal blocks.", 4)},
+			expectedEvent: "Warning FilesystemChecked fsck (check) of ext4 filesystem on /dev/sdd of node fakeNodeID since filesystem is dirty: errors",
+		},
+		{
+			desc:          "unformatted device",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyRepair,
+			outputScripts: []testingexec.FakeAction{output("dumpe2fs: Bad magic number in super-block", 1)},
+		},
+		{
+			desc:   "xfs keeps no state",
+			fstype: "xfs",
+			policy: consts.FsckPolicyRepair,
+		},
+		{
+			desc:          "dirty filesystem repaired",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyRepair,
+			outputScripts: []testingexec.FakeAction{dirty, output("/dev/sdd: ***** FILE SYSTEM WAS MODIFIED *****", 1)},
+			expectedEvent: "Normal FilesystemChecked fsck (repair) of ext4 filesystem on /dev/sdd of node fakeNodeID since filesystem is dirty: repaired",
+		},
+		{
+			desc:          "dirty filesystem not repaired",
+			fstype:        "ext4",
+			policy:        consts.FsckPolicyRepair,
+			outputScripts: []testingexec.FakeAction{dirty, output("UNEXPECTED INCONSISTENCY; RUN fsck MANUALLY.", 4)},
+			expectedErr:   "fsck of dirty ext4 filesystem finished with errors",
+			expectedEvent: "Warning FilesystemChecked fsck (repair) of ext4 filesystem on /dev/sdd of node fakeNodeID since filesystem is dirty: errors",
+		},
+		{
+			desc:          "dirty filesystem checked",
+			fstype:        "ext3",
+			policy:        consts.FsckPolicyCheck,
+			outputScripts: []testingexec.FakeAction{dirty, output("Inode 12 has illegal blocks.", 4)},
+			expectedEvent: "Warning FilesystemChecked fsck (check) of ext3 filesystem on /dev/sdd of node fakeNodeID since filesystem is dirty: errors",
+		},
+		{
+			desc:        "repair timed out",
+			fstype:      "ext4",
+			policy:      consts.FsckPolicyRepair,
+			fsckTimeout: time.Millisecond,
+			outputScripts: []testingexec.FakeAction{dirty, func() ([]byte, []byte, error) {
+				time.Sleep(50 * time.Millisecond)
+				return []byte{}, []byte{}, testingexec.FakeExitError{Status: 137}
+			}},
+			expectedErr:   "fsck of dirty ext4 filesystem finished with timeout",
+			expectedEvent: "Warning FilesystemChecked fsck (repair) of ext4 filesystem on /dev/sdd of node fakeNodeID since filesystem is dirty: timeout",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			fakeMounter, err := mounter.NewFakeSafeMounter()
+			require.NoError(t, err)
+			d.setMounter(fakeMounter)
+			d.setNextCommandOutputScripts(test.outputScripts...)
+			d.fsckTimeout = test.fsckTimeout
+			recorder := record.NewFakeRecorder(10)
+			d.eventRecorder = recorder
+			volumeContext := map[string]string{consts.PvNameKey: "pv-1"}
+
+			err = d.fsckIfDirty(context.Background(), "vol_1", "/dev/sdd", test.fstype, test.policy, volumeContext)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectedErr)
+			}
+			if test.expectedEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, test.expectedEvent)
+			}
+		})
+	}
+}
+
+func TestFsckXfs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+	fakeMounter, err := mounter.NewFakeSafeMounter()
+	require.NoError(t, err)
+	d.setMounter(fakeMounter)
+
+	var cmds []string
+	fakeMounter.Exec.(*mounter.FakeSafeMounter).CommandScript = []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd {
+			cmds = append(cmds, strings.Join(append([]string{cmd}, args...), " "))
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+					return []byte("ERROR: The filesystem has valuable metadata changes in a log"), []byte{}, testingexec.FakeExitError{Status: 2}
+				}},
+			}, cmd, args...)
+		},
+		func(cmd string, args ...string) exec.Cmd {
+			cmds = append(cmds, strings.Join(append([]string{cmd}, args...), " "))
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+					return []byte("done"), []byte{}, nil
+				}},
+			}, cmd, args...)
+		},
+	}
+
+	assert.Equal(t, fsckResultErrors, d.fsck(context.Background(), "vol_1", "/dev/sdd", "xfs", consts.FsckPolicyCheck, "mount failed", nil))
+	assert.Equal(t, fsckResultClean, d.fsck(context.Background(), "vol_1", "/dev/sdd", "xfs", consts.FsckPolicyRepair, "mount failed", nil))
+	assert.Equal(t, []string{"xfs_repair -n /dev/sdd", "xfs_repair /dev/sdd"}, cmds)
+	assert.Equal(t, fsckResult(""), d.fsck(context.Background(), "vol_1", "/dev/sdd", "btrfs", consts.FsckPolicyRepair, "mount failed", nil))
+}
+
+func TestIsSharedDisk(t *testing.T) {
+	assert.False(t, isSharedDisk(nil, nil))
+	assert.False(t, isSharedDisk(map[string]string{consts.MaxSharesField: "1"}, map[string]string{consts.LUN: "1"}))
+	assert.False(t, isSharedDisk(map[string]string{consts.MaxSharesField: "invalid"}, nil))
+	assert.True(t, isSharedDisk(map[string]string{"MaxShares": "2"}, nil))
+	assert.True(t, isSharedDisk(nil, map[string]string{consts.MaxSharesField: "3"}))
+}
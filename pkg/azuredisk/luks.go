@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// luksMapperPrefix is the prefix of the device-mapper names of the LUKS volumes opened by the driver
+	luksMapperPrefix = "azuredisk-luks-"
+	// luksSignature is the signature blkid reports for a LUKS header
+	luksSignature = "crypto_LUKS"
+	// luksExitNotLUKS is the exit code of cryptsetup isLuks for a device without a LUKS header
+	luksExitNotLUKS = 1
+)
+
+// devMapperDir is the directory of the device-mapper devices, a variable to be replaced in tests
+var devMapperDir = "/dev/mapper"
+
+// getLUKSMapperName returns the device-mapper name of the LUKS volume of volumeID, which is stable
+// across NodeStageVolume, NodeExpandVolume and NodeUnstageVolume
+func getLUKSMapperName(volumeID string) string {
+	return fmt.Sprintf("%s%x", luksMapperPrefix, sha256.Sum256([]byte(volumeID)))[:len(luksMapperPrefix)+32]
+}
+
+// parseLUKSMapperName returns the device-mapper name if devicePath is a LUKS volume opened by the driver
+func parseLUKSMapperName(devicePath string) (string, bool) {
+	name := filepath.Base(devicePath)
+	if filepath.Dir(devicePath) != devMapperDir || !strings.HasPrefix(name, luksMapperPrefix) {
+		return "", false
+	}
+	return name, true
+}
+
+// cryptsetup runs cryptsetup with args, passing the passphrase on stdin if it is not empty
+func (d *Driver) cryptsetup(passphrase string, args ...string) ([]byte, error) {
+	cmd := d.mounter.Exec.Command("cryptsetup", args...)
+	if passphrase != "" {
+		cmd.SetStdin(strings.NewReader(passphrase))
+	}
+	return cmd.CombinedOutput()
+}
+
+// openLUKS opens the LUKS volume on source with the passphrase and returns the path of its mapped device.
+// Only a device without any data signature is formatted with LUKS2 first, a device carrying other data is refused.
+func (d *Driver) openLUKS(ctx context.Context, diskURI, source, passphrase string, volumeContext map[string]string) (string, error) {
+	logger := klog.FromContext(ctx).WithValues("source", source)
+	name := getLUKSMapperName(diskURI)
+	mapperPath := filepath.Join(devMapperDir, name)
+	if _, err := os.Stat(mapperPath); err == nil {
+		// opened by a previous NodeStageVolume
+		logger.V(2).Info("LUKS volume is already open", "mapperPath", mapperPath)
+		return mapperPath, nil
+	}
+
+	signatures, err := getDiskSignatures(source, d.mounter)
+	if err != nil {
+		return "", err
+	}
+	// luksFormat wipes the device, it is never run on a device carrying data, even with allowFormatWithExistingData
+	if foreign := slices.DeleteFunc(slices.Clone(signatures), func(signature string) bool { return signature == luksSignature }); len(foreign) > 0 {
+		logger.V(2).Info("refusing to format device with foreign data signatures with LUKS", "signatures", foreign)
+		d.recordAttachEvent(ctx, diskURI, types.NodeName(d.NodeID), volumeContext, v1.EventTypeWarning, eventReasonFormatRefused,
+			"device %s on node %s carries %s, refusing to format it with LUKS, wipe the device to use it", source, d.NodeID, strings.Join(foreign, ", "))
+		return "", fmt.Errorf("%w: %s found on %s", errForeignDataSignature, strings.Join(foreign, ", "), source)
+	}
+	if output, err := d.cryptsetup("", "isLuks", source); err != nil {
+		// isLuks exits with 1 if the device has no LUKS header, other failures leave the header unknown
+		var exitErr utilexec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitStatus() != luksExitNotLUKS {
+			return "", fmt.Errorf("failed to check LUKS header of %s: output: %s, err: %v", source, string(output), err)
+		}
+		// a LUKS signature which cryptsetup does not recognize may be a damaged header, formatting would lose its keys
+		if len(signatures) > 0 {
+			return "", fmt.Errorf("%s carries a %s signature which is not a valid LUKS header, refusing to format it", source, luksSignature)
+		}
+		logger.V(2).Info("formatting device with LUKS")
+		if output, err := d.cryptsetup(passphrase, "luksFormat", "--batch-mode", "--type", "luks2", "--key-file", "-", source); err != nil {
+			return "", fmt.Errorf("failed to format %s with LUKS: output: %s, err: %v", source, string(output), err)
+		}
+	}
+	if output, err := d.cryptsetup(passphrase, "luksOpen", "--key-file", "-", source, name); err != nil {
+		return "", fmt.Errorf("failed to open LUKS volume on %s: output: %s, err: %v", source, string(output), err)
+	}
+	logger.V(2).Info("opened LUKS volume", "mapperPath", mapperPath)
+	return mapperPath, nil
+}
+
+// closeLUKS closes the LUKS volume of volumeID if it is open
+func (d *Driver) closeLUKS(ctx context.Context, volumeID string) error {
+	name := getLUKSMapperName(volumeID)
+	if _, err := os.Stat(filepath.Join(devMapperDir, name)); err != nil {
+		return nil
+	}
+	if output, err := d.cryptsetup("", "luksClose", name); err != nil {
+		return fmt.Errorf("failed to close LUKS volume %s: output: %s, err: %v", name, string(output), err)
+	}
+	klog.FromContext(ctx).V(2).Info("closed LUKS volume", "name", name)
+	return nil
+}
+
+// getLUKSBackingDevice returns the device of the open LUKS volume name
+func (d *Driver) getLUKSBackingDevice(name string) (string, error) {
+	output, err := d.cryptsetup("", "status", name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get status of LUKS volume %s: output: %s, err: %v", name, string(output), err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, found := strings.Cut(strings.TrimSpace(line), ":"); found && key == "device" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("no device in status of LUKS volume %s: %s", name, string(output))
+}
+
+// resizeLUKS grows the LUKS volume name to the size of its device. LUKS2 keeps the volume key in the kernel
+// keyring instead of the device-mapper table, so the resize needs the passphrase to unlock the key again.
+func (d *Driver) resizeLUKS(name, passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("resizing LUKS volume %s requires its passphrase", name)
+	}
+	if output, err := d.cryptsetup(passphrase, "resize", "--key-file", "-", name); err != nil {
+		return fmt.Errorf("failed to resize LUKS volume %s: output: %s, err: %v", name, string(output), err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+// luksCommand is a command run by the LUKS functions with the passphrase it read from stdin
+type luksCommand struct {
+	cmd   string
+	stdin string
+}
+
+func TestLUKS(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	defer func(dir string) { devMapperDir = dir }(devMapperDir)
+	devMapperDir = t.TempDir()
+	name := getLUKSMapperName("vol_1")
+	mapperPath := filepath.Join(devMapperDir, name)
+	assert.Len(t, name, len(luksMapperPrefix)+32)
+
+	output := func(out string, exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte(out), []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte(out), []byte{}, nil
+		}
+	}
+	var cmds []luksCommand
+	setScripts := func(actions ...testingexec.FakeAction) {
+		cmds = nil
+		fakeMounter, err := mounter.NewFakeSafeMounter()
+		require.NoError(t, err)
+		d.setMounter(fakeMounter)
+		fakeExec := fakeMounter.Exec.(*mounter.FakeSafeMounter)
+		for _, action := range actions {
+			fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+				fakeCmd := &testingexec.FakeCmd{}
+				fakeCmd.CombinedOutputScript = []testingexec.FakeAction{func() ([]byte, []byte, error) {
+					command := luksCommand{cmd: strings.Join(append([]string{cmd}, args...), " ")}
+					if fakeCmd.Stdin != nil {
+						stdin, _ := io.ReadAll(fakeCmd.Stdin)
+						command.stdin = string(stdin)
+					}
+					cmds = append(cmds, command)
+					return action()
+				}}
+				return testingexec.InitFakeCmd(fakeCmd, cmd, args...)
+			})
+		}
+	}
+
+	t.Run("format empty device", func(t *testing.T) {
+		setScripts(output("", 2), output("", 1), output("", 0), output("", 0))
+		path, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", nil)
+		require.NoError(t, err)
+		assert.Equal(t, mapperPath, path)
+		assert.Equal(t, []luksCommand{
+			{cmd: "blkid -p -o export /dev/sdc"},
+			{cmd: "cryptsetup isLuks /dev/sdc"},
+			{cmd: "cryptsetup luksFormat --batch-mode --type luks2 --key-file - /dev/sdc", stdin: "secret"},
+			{cmd: "cryptsetup luksOpen --key-file - /dev/sdc " + name, stdin: "secret"},
+		}, cmds)
+	})
+
+	t.Run("open LUKS device", func(t *testing.T) {
+		setScripts(output("DEVNAME=/dev/sdc\nTYPE=crypto_LUKS\n", 0), output("", 0), output("", 0))
+		path, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", nil)
+		require.NoError(t, err)
+		assert.Equal(t, mapperPath, path)
+		assert.Equal(t, "cryptsetup luksOpen --key-file - /dev/sdc "+name, cmds[2].cmd)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		setScripts(output("DEVNAME=/dev/sdc\nTYPE=crypto_LUKS\n", 0), output("", 0), output("No key available with this passphrase.", 2))
+		_, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "wrong", nil)
+		assert.ErrorContains(t, err, "failed to open LUKS volume on /dev/sdc: output: No key available with this passphrase.")
+	})
+
+	t.Run("refuse device with data", func(t *testing.T) {
+		setScripts(output("DEVNAME=/dev/sdc\nTYPE=ext4\n", 0))
+		_, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", nil)
+		assert.True(t, errors.Is(err, errForeignDataSignature))
+		assert.Len(t, cmds, 1)
+	})
+
+	t.Run("refuse device with data despite allowFormatWithExistingData", func(t *testing.T) {
+		setScripts(output("DEVNAME=/dev/sdc\nTYPE=ext4\n", 0))
+		_, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", map[string]string{consts.AllowFormatWithExistingDataField: "true"})
+		assert.True(t, errors.Is(err, errForeignDataSignature))
+		assert.Len(t, cmds, 1)
+	})
+
+	t.Run("refuse damaged LUKS header", func(t *testing.T) {
+		setScripts(output("DEVNAME=/dev/sdc\nTYPE=crypto_LUKS\n", 0), output("", 1))
+		_, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", nil)
+		assert.ErrorContains(t, err, "/dev/sdc carries a crypto_LUKS signature which is not a valid LUKS header")
+		assert.Len(t, cmds, 2)
+	})
+
+	t.Run("isLuks failure", func(t *testing.T) {
+		setScripts(output("", 2), output("Cannot use device /dev/sdc.", 4))
+		_, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", nil)
+		assert.ErrorContains(t, err, "failed to check LUKS header of /dev/sdc: output: Cannot use device /dev/sdc.")
+		assert.Len(t, cmds, 2)
+	})
+
+	t.Run("close not open volume", func(t *testing.T) {
+		setScripts()
+		assert.NoError(t, d.closeLUKS(context.Background(), "vol_1"))
+	})
+
+	require.NoError(t, os.WriteFile(mapperPath, nil, 0600))
+
+	t.Run("already open", func(t *testing.T) {
+		setScripts()
+		path, err := d.openLUKS(context.Background(), "vol_1", "/dev/sdc", "secret", nil)
+		require.NoError(t, err)
+		assert.Equal(t, mapperPath, path)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		setScripts(output("", 0))
+		assert.NoError(t, d.closeLUKS(context.Background(), "vol_1"))
+		assert.Equal(t, []luksCommand{{cmd: "cryptsetup luksClose " + name}}, cmds)
+	})
+
+	t.Run("resize", func(t *testing.T) {
+		luksName, ok := parseLUKSMapperName(mapperPath)
+		require.True(t, ok)
+		_, ok = parseLUKSMapperName("/dev/sdc")
+		assert.False(t, ok)
+
+		setScripts(output("/dev/mapper/"+luksName+" is active and is in use.\n  type:    LUKS2\n  cipher:  aes-xts-plain64\n  device:  /dev/sdc\n  sector size:  512\n", 0), output("", 0), output("", 0))
+		device, err := d.getLUKSBackingDevice(luksName)
+		require.NoError(t, err)
+		assert.Equal(t, "/dev/sdc", device)
+		assert.EqualError(t, d.resizeLUKS(luksName, ""), "resizing LUKS volume "+luksName+" requires its passphrase")
+		assert.NoError(t, d.resizeLUKS(luksName, "secret"))
+		assert.Equal(t, []luksCommand{
+			{cmd: "cryptsetup status " + luksName},
+			{cmd: "cryptsetup resize --key-file - " + luksName, stdin: "secret"},
+		}, cmds)
+	})
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// maxDataDiskCountConfigMapKey is the key of the override table in the ConfigMap
+	maxDataDiskCountConfigMapKey = "maxDataDiskCount"
+	// maxDataDiskCountReloadInterval is the interval of reading the override table file again
+	maxDataDiskCountReloadInterval = time.Minute
+)
+
+// maxDataDiskCountOverride holds the VM size to max data disk count table loaded at runtime,
+// it takes precedence over the compiled-in maxDataDiskCountMap
+type maxDataDiskCountOverride struct {
+	mu sync.RWMutex
+	// counts by upper case VM size
+	counts map[string]int64
+	// data is the content the counts were parsed from, to skip unchanged reloads
+	data []byte
+	// fallbacks are the VM sizes whose fallback to the default limit was logged
+	fallbacks sync.Map
+}
+
+var dataDiskCountOverride = &maxDataDiskCountOverride{}
+
+// get returns the count of an upper case VM size from the override table
+func (o *maxDataDiskCountOverride) get(vmsize string) (int64, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	count, ok := o.counts[vmsize]
+	return count, ok
+}
+
+// set replaces the table with the one parsed from data, the table is kept if data is invalid
+func (o *maxDataDiskCountOverride) set(data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.data != nil && bytes.Equal(o.data, data) {
+		return nil
+	}
+	counts, err := parseMaxDataDiskCounts(data)
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("loaded max data disk count of %d VM sizes", len(counts))
+	o.counts = counts
+	o.data = data
+	// cleared in place, lookups read fallbacks without holding mu
+	o.fallbacks.Clear()
+	return nil
+}
+
+// parseMaxDataDiskCounts parses a YAML or JSON map of VM size to max data disk count, or a JSON list of
+// resource SKUs as returned by `az vm list-skus`, whose virtualMachines SKUs have a MaxDataDiskCount capability
+func parseMaxDataDiskCounts(data []byte) (map[string]int64, error) {
+	counts := map[string]int64{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var skus []*armcompute.ResourceSKU
+		if err := json.Unmarshal(trimmed, &skus); err != nil {
+			return nil, fmt.Errorf("failed to parse resource SKUs: %w", err)
+		}
+		for _, sku := range skus {
+			if sku == nil || sku.Name == nil || sku.ResourceType == nil || !strings.EqualFold(*sku.ResourceType, "virtualMachines") {
+				continue
+			}
+			for _, capability := range sku.Capabilities {
+				if capability == nil || capability.Name == nil || capability.Value == nil || !strings.EqualFold(*capability.Name, "MaxDataDiskCount") {
+					continue
+				}
+				count, err := strconv.ParseInt(*capability.Value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid MaxDataDiskCount %q of VM size %s: %w", *capability.Value, *sku.Name, err)
+				}
+				counts[strings.ToUpper(*sku.Name)] = count
+			}
+		}
+		return counts, nil
+	}
+
+	var table map[string]int64
+	if err := yaml.UnmarshalStrict(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse max data disk count table: %w", err)
+	}
+	for vmsize, count := range table {
+		if count < 0 {
+			return nil, fmt.Errorf("negative max data disk count %d of VM size %s", count, vmsize)
+		}
+		counts[strings.ToUpper(vmsize)] = count
+	}
+	return counts, nil
+}
+
+// loadMaxDataDiskCountOverride reads the max data disk count table from the file or the ConfigMap
+func (d *Driver) loadMaxDataDiskCountOverride(ctx context.Context) error {
+	data, err := d.readConfigData(ctx, d.maxDataDiskCountConfig, d.maxDataDiskCountConfigMap, maxDataDiskCountConfigMapKey, "max data disk count")
+	if err != nil {
+		return err
+	}
+	return dataDiskCountOverride.set(data)
+}
+
+// watchMaxDataDiskCountConfigMap reloads the max data disk count table on every change of the ConfigMap,
+// the informer only lists and watches the ConfigMap itself in its namespace.
+// The node reports its allocatable volume count in NodeGetInfo at plugin registration only,
+// so a reloaded table reaches the CSINode after a restart of the node plugin.
+func (d *Driver) watchMaxDataDiskCountConfigMap(ctx context.Context) error {
+	namespace, name, err := splitConfigMapName(d.maxDataDiskCountConfigMap, "max data disk count")
+	if err != nil {
+		return err
+	}
+	if d.kubeClient == nil {
+		return fmt.Errorf("kubeClient is nil, can not watch max data disk count ConfigMap %s", d.maxDataDiskCountConfigMap)
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(d.kubeClient, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector(metav1.ObjectNameField, name).String()
+		}))
+	reload := func(data []byte) {
+		if err := dataDiskCountOverride.set(data); err != nil {
+			klog.Warningf("failed to reload max data disk count override, keeping the previous table: %v", err)
+		}
+	}
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if configMap, ok := obj.(*v1.ConfigMap); ok && configMap.Name == name {
+				reload([]byte(configMap.Data[maxDataDiskCountConfigMapKey]))
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if configMap, ok := newObj.(*v1.ConfigMap); ok && configMap.Name == name {
+				reload([]byte(configMap.Data[maxDataDiskCountConfigMapKey]))
+			}
+		},
+		DeleteFunc: func(_ interface{}) {
+			// a missing ConfigMap reads as an empty table
+			reload([]byte{})
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add event handler to max data disk count ConfigMap informer: %w", err)
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
+
+// splitConfigMapName splits a <namespace>/<name> ConfigMap name
+func splitConfigMapName(configMapName, what string) (string, string, error) {
+	namespace, name, found := strings.Cut(configMapName, "/")
+	if !found || namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid %s ConfigMap %q, expected <namespace>/<name>", what, configMapName)
+	}
+	return namespace, name, nil
+}
+
+// readConfigData reads a config from the file if set, or else from the key of the <namespace>/<name> ConfigMap,
+// a missing ConfigMap reads as an empty config
+func (d *Driver) readConfigData(ctx context.Context, path, configMapName, key, what string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	namespace, name, err := splitConfigMapName(configMapName, what)
+	if err != nil {
+		return nil, err
+	}
+	if d.kubeClient == nil {
+		return nil, fmt.Errorf("kubeClient is nil, can not read %s ConfigMap %s", what, configMapName)
+	}
+	configMap, err := d.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return []byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(configMap.Data[key]), nil
+}
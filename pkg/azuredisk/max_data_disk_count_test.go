@@ -0,0 +1,198 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseMaxDataDiskCounts(t *testing.T) {
+	skus, err := os.ReadFile("../tool/skus-sample.json")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		desc        string
+		data        string
+		expected    map[string]int64
+		expectedErr string
+	}{
+		{
+			desc:     "yaml map",
+			data:     "Standard_New_v9: 64\nstandard_d2_v2: 4\n",
+			expected: map[string]int64{"STANDARD_NEW_V9": 64, "STANDARD_D2_V2": 4},
+		},
+		{
+			desc:     "json map",
+			data:     `{"Standard_New_v9": 32}`,
+			expected: map[string]int64{"STANDARD_NEW_V9": 32},
+		},
+		{
+			desc:     "resource SKUs",
+			data:     string(skus),
+			expected: map[string]int64{"STANDARD_A1_V2": 2},
+		},
+		{
+			desc:     "empty",
+			data:     "",
+			expected: map[string]int64{},
+		},
+		{
+			desc:        "negative count",
+			data:        "Standard_New_v9: -1",
+			expectedErr: "negative max data disk count -1 of VM size Standard_New_v9",
+		},
+		{
+			desc:        "invalid SKU capability",
+			data:        `[{"name": "Standard_New_v9", "resourceType": "virtualMachines", "capabilities": [{"name": "MaxDataDiskCount", "value": "many"}]}]`,
+			expectedErr: `invalid MaxDataDiskCount "many" of VM size Standard_New_v9`,
+		},
+		{
+			desc:        "invalid table",
+			data:        "Standard_New_v9: [1]",
+			expectedErr: "failed to parse max data disk count table",
+		},
+	}
+	for _, test := range tests {
+		counts, err := parseMaxDataDiskCounts([]byte(test.data))
+		if test.expectedErr != "" {
+			assert.ErrorContains(t, err, test.expectedErr, test.desc)
+			continue
+		}
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.expected, counts, test.desc)
+	}
+}
+
+func TestMaxDataDiskCountOverride(t *testing.T) {
+	t.Cleanup(func() { dataDiskCountOverride = &maxDataDiskCountOverride{} })
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "max-data-disk-count.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("Standard_New_v9: 64\nStandard_D2_v2: 4\n"), 0600))
+	d := &Driver{}
+	d.maxDataDiskCountConfig = path
+	assert.NoError(t, d.loadMaxDataDiskCountOverride(ctx))
+
+	// the override takes precedence over the built-in table
+	count, exists := GetMaxDataDiskCount("standard_new_v9")
+	assert.True(t, exists)
+	assert.Equal(t, int64(64), count)
+	count, _ = GetMaxDataDiskCount("Standard_D2_v2")
+	assert.Equal(t, int64(4), count)
+	count, _ = GetMaxDataDiskCount("Standard_DS14_v2")
+	assert.Equal(t, int64(64), count)
+	count, exists = GetMaxDataDiskCount("NOT_EXISTING")
+	assert.False(t, exists)
+	assert.Equal(t, int64(defaultAzureVolumeLimit), count)
+
+	// an invalid file keeps the previous table
+	assert.NoError(t, os.WriteFile(path, []byte("Standard_New_v9: many"), 0600))
+	assert.Error(t, d.loadMaxDataDiskCountOverride(ctx))
+	count, _ = GetMaxDataDiskCount("Standard_New_v9")
+	assert.Equal(t, int64(64), count)
+
+	d = &Driver{}
+	d.maxDataDiskCountConfigMap = "kube-system/max-data-disk-count"
+	assert.ErrorContains(t, d.loadMaxDataDiskCountOverride(ctx), "kubeClient is nil")
+	d.kubeClient = fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "max-data-disk-count"},
+		Data:       map[string]string{maxDataDiskCountConfigMapKey: "Standard_New_v9: 16"},
+	})
+	assert.NoError(t, d.loadMaxDataDiskCountOverride(ctx))
+	count, _ = GetMaxDataDiskCount("Standard_New_v9")
+	assert.Equal(t, int64(16), count)
+	count, _ = GetMaxDataDiskCount("Standard_D2_v2")
+	assert.Equal(t, int64(8), count)
+
+	// a deleted ConfigMap removes the override
+	assert.NoError(t, d.kubeClient.CoreV1().ConfigMaps("kube-system").Delete(ctx, "max-data-disk-count", metav1.DeleteOptions{}))
+	assert.NoError(t, d.loadMaxDataDiskCountOverride(ctx))
+	_, exists = GetMaxDataDiskCount("Standard_New_v9")
+	assert.False(t, exists)
+
+	d.maxDataDiskCountConfigMap = "max-data-disk-count"
+	assert.ErrorContains(t, d.loadMaxDataDiskCountOverride(ctx), "expected <namespace>/<name>")
+}
+
+func TestWatchMaxDataDiskCountConfigMap(t *testing.T) {
+	t.Cleanup(func() { dataDiskCountOverride = &maxDataDiskCountOverride{} })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &Driver{}
+	d.maxDataDiskCountConfigMap = "kube-system/max-data-disk-count"
+	assert.ErrorContains(t, d.watchMaxDataDiskCountConfigMap(ctx), "kubeClient is nil")
+	d.kubeClient = fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "max-data-disk-count"},
+		Data:       map[string]string{maxDataDiskCountConfigMapKey: "Standard_New_v9: 16"},
+	})
+	assert.NoError(t, d.watchMaxDataDiskCountConfigMap(ctx))
+	countOf := func() int64 {
+		count, _ := GetMaxDataDiskCount("Standard_New_v9")
+		return count
+	}
+	assert.Eventually(t, func() bool { return countOf() == 16 }, 10*time.Second, 10*time.Millisecond)
+
+	_, err := d.kubeClient.CoreV1().ConfigMaps("kube-system").Update(ctx, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "max-data-disk-count"},
+		Data:       map[string]string{maxDataDiskCountConfigMapKey: "Standard_New_v9: 32"},
+	}, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return countOf() == 32 }, 10*time.Second, 10*time.Millisecond)
+
+	// a deleted ConfigMap removes the override
+	assert.NoError(t, d.kubeClient.CoreV1().ConfigMaps("kube-system").Delete(ctx, "max-data-disk-count", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool { return countOf() == defaultAzureVolumeLimit }, 10*time.Second, 10*time.Millisecond)
+
+	d.maxDataDiskCountConfigMap = "max-data-disk-count"
+	assert.ErrorContains(t, d.watchMaxDataDiskCountConfigMap(ctx), "expected <namespace>/<name>")
+}
+
+func TestMaxDataDiskCountOverrideConcurrentReload(t *testing.T) {
+	t.Cleanup(func() { dataDiskCountOverride = &maxDataDiskCountOverride{} })
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, dataDiskCountOverride.set([]byte(fmt.Sprintf("Standard_New_v9: %d", i))))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			GetMaxDataDiskCount("NOT_EXISTING")
+		}
+	}()
+	wg.Wait()
+
+	count, exists := GetMaxDataDiskCount("Standard_New_v9")
+	assert.True(t, exists)
+	assert.Equal(t, int64(99), count)
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+const (
+	attachOperation = "attach"
+	detachOperation = "detach"
+
+	throttlingCacheName          = "throttling"
+	checkDiskLunThrottlingName   = "check_disk_lun_throttling"
+	hitMaxDataDiskCountCacheName = "hit_max_data_disk_count"
+)
+
+var (
+	registerMetricsOnce sync.Once
+
+	// diskQueueDepth is the number of attach/detach requests waiting to be batched on a node
+	diskQueueDepth = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "disk_queue_depth",
+			Help:           "Number of disk attach/detach requests waiting to be batched on a node",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"node", "operation"},
+	)
+
+	// diskBatchSize is the number of disks sent to vmset.AttachDisk/DetachDisk in one call
+	diskBatchSize = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "disk_batch_size",
+			Help:           "Number of disks sent to the VM in a single attach/detach batch",
+			Buckets:        []float64{1, 2, 4, 8, 16, 32, 64},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	// nodeLockWaitDuration is the time spent waiting for the per-node attach/detach lock
+	nodeLockWaitDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "node_lock_wait_duration_seconds",
+			Help:           "Time spent waiting for the per-node disk attach/detach lock",
+			Buckets:        []float64{0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	// diskBatchTrimmedCount is the number of attach batches trimmed by CheckDiskCountForBatching
+	diskBatchTrimmedCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "disk_batch_trimmed_total",
+			Help:           "Number of attach batches trimmed because the node would exceed its max data disk count",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"node"},
+	)
+
+	// nodeLunUsed is the number of LUNs in use on a node after the last LUN allocation
+	nodeLunUsed = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "node_lun_used",
+			Help:           "Number of data disk LUNs in use on a node after the last LUN allocation",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"node"},
+	)
+
+	// fsckDuration is the time spent checking or repairing filesystems on NodeStageVolume
+	fsckDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "fsck_duration_seconds",
+			Help:           "Time spent checking or repairing the filesystem of a volume before it is mounted",
+			Buckets:        []float64{0.5, 1, 5, 10, 30, 60, 120, 300, 600, 1800},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"fstype", "policy", "result"},
+	)
+
+	// cacheState exports the throttling related timed caches
+	cacheState = newCacheStateCollector()
+)
+
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(diskQueueDepth)
+		legacyregistry.MustRegister(diskBatchSize)
+		legacyregistry.MustRegister(nodeLockWaitDuration)
+		legacyregistry.MustRegister(diskBatchTrimmedCount)
+		legacyregistry.MustRegister(nodeLunUsed)
+		legacyregistry.MustRegister(fsckDuration)
+		legacyregistry.CustomMustRegister(cacheState)
+	})
+}
+
+// cacheStateCollector reports the remaining TTL of every live entry in the registered timed caches
+type cacheStateCollector struct {
+	metrics.BaseStableCollector
+
+	lock    sync.RWMutex
+	caches  map[string]azcache.Resource
+	desc    *metrics.Desc
+	nowFunc func() time.Time
+}
+
+func newCacheStateCollector() *cacheStateCollector {
+	return &cacheStateCollector{
+		caches: map[string]azcache.Resource{},
+		desc: metrics.NewDesc(
+			metrics.BuildFQName(consts.AzureDiskCSIDriverName, "", "cache_entry_remaining_seconds"),
+			"Remaining time in seconds before a throttling cache entry expires",
+			[]string{"cache", "key"}, nil,
+			metrics.ALPHA, "",
+		),
+		nowFunc: time.Now,
+	}
+}
+
+// setCache registers or replaces the cache reported under name
+func (c *cacheStateCollector) setCache(name string, cache azcache.Resource) {
+	if cache == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.caches[name] = cache
+}
+
+// DescribeWithStability implements metrics.StableCollector
+func (c *cacheStateCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.desc
+}
+
+// CollectWithStability implements metrics.StableCollector
+func (c *cacheStateCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for name, cache := range c.caches {
+		for key, remaining := range liveCacheEntries(cache, c.nowFunc()) {
+			ch <- metrics.NewLazyConstMetric(c.desc, metrics.GaugeValue, remaining.Seconds(), name, key)
+		}
+	}
+}
+
+// liveCacheEntries returns <key, remaining TTL> of entries holding data that has not expired yet
+func liveCacheEntries(cache azcache.Resource, now time.Time) map[string]time.Duration {
+	entries := map[string]time.Duration{}
+	timedCache, ok := cache.(*azcache.TimedCache)
+	if !ok || timedCache.Store == nil {
+		return entries
+	}
+	for _, obj := range timedCache.Store.List() {
+		entry, ok := obj.(*azcache.AzureCacheEntry)
+		if !ok {
+			continue
+		}
+		entry.Lock.Lock()
+		hasData, createdOn := entry.Data != nil, entry.CreatedOn
+		entry.Lock.Unlock()
+		if !hasData {
+			continue
+		}
+		if remaining := timedCache.TTL - now.Sub(createdOn); remaining > 0 {
+			entries[entry.Key] = remaining
+		}
+	}
+	return entries
+}
+
+// deleteDiskQueueDepth removes the queue depth series of node once its queue of operation is empty
+func deleteDiskQueueDepth(node, operation string) {
+	diskQueueDepth.Delete(map[string]string{"node": node, "operation": operation})
+}
+
+// deleteNodeMetrics removes the series of node from the node labelled metrics once the node does not exist anymore
+func deleteNodeMetrics(node string) {
+	node = strings.ToLower(node)
+	for _, operation := range []string{attachOperation, detachOperation} {
+		deleteDiskQueueDepth(node, operation)
+	}
+	diskBatchTrimmedCount.Delete(map[string]string{"node": node})
+	nodeLunUsed.Delete(map[string]string{"node": node})
+}
+
+// observeNodeLockWait records the time spent waiting for the per-node lock since start
+func observeNodeLockWait(operation string, start time.Time) {
+	nodeLockWaitDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/component-base/metrics"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+func TestLiveCacheEntries(t *testing.T) {
+	getter := func(_ context.Context, _ string) (interface{}, error) { return nil, nil }
+	cache, err := azcache.NewTimedCache(5*time.Minute, getter, false)
+	assert.NoError(t, err)
+
+	cache.Set("node1", "")
+	// Get on a missing key creates an entry without data, which must not be reported
+	_, _ = cache.Get(context.Background(), "node2", azcache.CacheReadTypeDefault)
+
+	entries := liveCacheEntries(cache, time.Now())
+	assert.Len(t, entries, 1)
+	assert.Greater(t, entries["node1"], 4*time.Minute)
+
+	entries = liveCacheEntries(cache, time.Now().Add(6*time.Minute))
+	assert.Empty(t, entries)
+
+	disabled, err := azcache.NewTimedCache(5*time.Minute, getter, true)
+	assert.NoError(t, err)
+	assert.Empty(t, liveCacheEntries(disabled, time.Now()))
+}
+
+func TestCacheStateCollector(t *testing.T) {
+	getter := func(_ context.Context, _ string) (interface{}, error) { return nil, nil }
+	throttling, _ := azcache.NewTimedCache(5*time.Minute, getter, false)
+	lunThrottling, _ := azcache.NewTimedCache(30*time.Minute, getter, false)
+
+	collector := newCacheStateCollector()
+	collector.setCache(throttlingCacheName, throttling)
+	collector.setCache(checkDiskLunThrottlingName, lunThrottling)
+	collector.setCache("nil", nil)
+
+	throttling.Set("getdisk", "")
+	lunThrottling.Set("checkdisklun", "")
+	lunThrottling.Set("another", "")
+
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(collector)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+	assert.Len(t, families[0].GetMetric(), 3)
+}
+
+func TestDeleteNodeMetrics(t *testing.T) {
+	registry := metrics.NewKubeRegistry()
+	registry.MustRegister(diskQueueDepth, diskBatchTrimmedCount, nodeLunUsed)
+	// the metrics are global, drop the series left by the tests of attach and detach
+	diskQueueDepth.Reset()
+	diskBatchTrimmedCount.Reset()
+	nodeLunUsed.Reset()
+	defer func() {
+		deleteNodeMetrics("node-2")
+		registry.Reset()
+	}()
+
+	for _, node := range []string{"node-1", "node-2"} {
+		diskQueueDepth.WithLabelValues(node, attachOperation).Set(2)
+		diskBatchTrimmedCount.WithLabelValues(node).Inc()
+		nodeLunUsed.WithLabelValues(node).Set(3)
+	}
+	deleteNodeMetrics("Node-1")
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families, 3)
+	for _, family := range families {
+		assert.Len(t, family.GetMetric(), 1, family.GetName())
+		for _, label := range family.GetMetric()[0].GetLabel() {
+			if label.GetName() == "node" {
+				assert.Equal(t, "node-2", label.GetValue())
+			}
+		}
+	}
+}
@@ -18,10 +18,12 @@ package azuredisk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -41,6 +43,7 @@ import (
 	"k8s.io/klog/v2"
 	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
 )
 
 const (
@@ -59,7 +62,7 @@ func getDefaultFsType() string {
 }
 
 // NodeStageVolume mount disk device to a staging path
-func (d *Driver) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
 	diskURI := req.GetVolumeId()
 	if len(diskURI) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -85,6 +88,58 @@ func (d *Driver) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequ
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	hostEncryption, err := azureutils.GetHostEncryption(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	passphrase := req.GetSecrets()[consts.LUKSPassphraseKey]
+	if hostEncryption == consts.HostEncryptionLUKS {
+		switch {
+		case runtime.GOOS != "linux":
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s is only supported on Linux", consts.HostEncryptionField, hostEncryption)
+		case volumeCapability.GetBlock() != nil:
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s is not supported with block volumes", consts.HostEncryptionField, hostEncryption)
+		case passphrase == "":
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s requires the %s key in the node stage secret", consts.HostEncryptionField, hostEncryption, consts.LUKSPassphraseKey)
+		}
+	}
+	stripeMembers := len(splitStripedID(diskURI))
+	if stripeMembers > 1 {
+		_, hasPartition := params[consts.VolumeAttributePartition]
+		switch {
+		case runtime.GOOS != "linux":
+			return nil, status.Error(codes.InvalidArgument, "striped volumes are only supported on Linux")
+		case volumeCapability.GetBlock() != nil:
+			return nil, status.Error(codes.InvalidArgument, "striped volumes are not supported with block volumes")
+		case hasPartition:
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not supported with striped volumes", consts.VolumeAttributePartition)
+		}
+	}
+	thinPool, err := azureutils.GetLVMThinPool(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	thinVolumeNode, thinVolumeName, isThinVolume := parseThinVolumeID(diskURI)
+	// thin volumes are served by their own driver name so that they do not share the data disk slots of the node
+	switch {
+	case isThinVolume && d.lvmThinVolumesPerNode == 0:
+		return nil, status.Errorf(codes.InvalidArgument, "thin volume %s is not served by driver %s, thin volumes need a driver name started with --lvm-thin-volumes-per-node", diskURI, d.Name)
+	case !isThinVolume && d.lvmThinVolumesPerNode > 0:
+		return nil, status.Errorf(codes.InvalidArgument, "driver %s only serves thin volumes, volume %s is a disk", d.Name, diskURI)
+	}
+	if thinPool != "" || isThinVolume {
+		switch {
+		case runtime.GOOS != "linux":
+			return nil, status.Errorf(codes.InvalidArgument, "%s is only supported on Linux", consts.LVMThinPoolField)
+		case thinPool == consts.LVMThinPoolPool && volumeCapability.GetBlock() == nil:
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s must be a block volume", consts.LVMThinPoolField, consts.LVMThinPoolPool)
+		case isThinVolume && volumeCapability.GetBlock() != nil:
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s is not supported with block volumes", consts.LVMThinPoolField, consts.LVMThinPoolVolume)
+		case isThinVolume && !strings.EqualFold(thinVolumeNode, d.NodeID):
+			return nil, status.Errorf(codes.FailedPrecondition, "thin volume %s is on node %s, not on node %s", diskURI, thinVolumeNode, d.NodeID)
+		}
+	}
+
 	mc := metrics.NewMetricContext(consts.AzureDiskCSIDriverName, "node_stage_volume", d.cloud.ResourceGroup, "", d.Name)
 	isOperationSucceeded := false
 	defer func() {
@@ -96,46 +151,95 @@ func (d *Driver) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequ
 	}
 	defer d.volumeLocks.Release(diskURI)
 
-	lun, ok := req.PublishContext[consts.LUN]
-	if !ok {
-		return nil, status.Error(codes.InvalidArgument, "lun not provided")
-	}
-
-	source, err := d.getDevicePathWithLUN(lun)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to find disk on lun %s. %v", lun, err)
-	}
+	logger := klog.FromContext(ctx).WithValues("volumeID", diskURI)
+	var lun, source string
+	var devices []string
+	if isThinVolume {
+		// the filesystem of a thin volume is created on its logical volume in the thin pool of the node
+		if source, err = d.ensureThinVolume(ctx, thinVolumeName, req.GetVolumeContext()); err != nil {
+			if errors.Is(err, errThinPoolNotReady) {
+				return nil, status.Errorf(codes.Unavailable, "could not stage thin volume %s: %v", diskURI, err)
+			}
+			return nil, status.Errorf(codes.Internal, "could not activate thin volume %s: %v", diskURI, err)
+		}
+	} else {
+		var ok bool
+		if lun, ok = req.PublishContext[consts.LUN]; !ok {
+			return nil, status.Error(codes.InvalidArgument, "lun not provided")
+		}
+		logger = logger.WithValues("lun", lun)
 
-	// If perf optimizations are enabled
-	// tweak device settings to enhance performance
-	if d.getPerfOptimizationEnabled() {
-		profile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettings, err := optimization.GetDiskPerfAttributes(req.GetVolumeContext())
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to get perf attributes for %s. Error: %v", source, err)
+		// every member of a striped volume is verified and tuned like the disk of a volume
+		memberContexts := []map[string]string{req.GetPublishContext()}
+		if stripeMembers > 1 {
+			if memberContexts, err = getStripeMemberPublishContexts(req.GetPublishContext(), stripeMembers); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
 		}
+		memberIDs := splitStripedID(diskURI)
+		for i, memberContext := range memberContexts {
+			memberLun := memberContext[consts.LUN]
+			_, span := startSpan(ctx, "getDevicePathWithLUN", attrVolumeID.String(diskURI), attrLun.String(memberLun))
+			device, err := d.getDevicePathWithLUN(memberLun)
+			endSpan(span, err)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to find disk on lun %s. %v", memberLun, err)
+			}
+			if err := d.verifyDeviceIdentity(device, memberContext); err != nil {
+				if errors.Is(err, errDeviceIdentityMismatch) {
+					return nil, status.Errorf(codes.FailedPrecondition, "device %s on lun %s is not volume %s: %v", device, memberLun, memberIDs[i], err)
+				}
+				return nil, status.Errorf(codes.Internal, "failed to verify device %s on lun %s: %v", device, memberLun, err)
+			}
+
+			// If perf optimizations are enabled
+			// tweak device settings to enhance performance
+			if d.getPerfOptimizationEnabled() {
+				profile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettings, err := optimization.GetDiskPerfAttributes(req.GetVolumeContext())
+				if err != nil {
+					return nil, status.Errorf(codes.Internal, "failed to get perf attributes for %s. Error: %v", device, err)
+				}
 
-		if d.getDeviceHelper().DiskSupportsPerfOptimization(profile, accountType) {
-			if err := d.getDeviceHelper().OptimizeDiskPerformance(d.getNodeInfo(), source, profile, accountType,
-				diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettings); err != nil {
-				return nil, status.Errorf(codes.Internal, "failed to optimize device performance for target(%s) error(%s)", source, err)
+				if d.getDeviceHelper().DiskSupportsPerfOptimization(profile, accountType) {
+					deviceSettings, err = d.getDeviceHelper().GetDeviceSettings(d.getNodeInfo(), profile, accountType,
+						diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettings)
+					if err == nil {
+						// the original settings are recorded to be restored on NodeUnstageVolume
+						err = d.tuneDevice(diskURI, memberIDs[i], memberLun, req.GetStagingTargetPath(), device, req.GetVolumeContext(), deviceSettings)
+					}
+					if err != nil {
+						return nil, status.Errorf(codes.Internal, "failed to optimize device performance for target(%s) error(%s)", device, err)
+					}
+				} else {
+					logger.V(6).Info("NodeStageVolume: perf optimization is disabled", "source", device, "perfProfile", profile, "accountType", accountType)
+				}
 			}
-		} else {
-			klog.V(6).Infof("NodeStageVolume: perf optimization is disabled for %s. perfProfile %s accountType %s", source, profile, accountType)
+			devices = append(devices, device)
 		}
+		source = devices[0]
 	}
 
 	// If the access type is block, do nothing for stage
 	switch req.GetVolumeCapability().GetAccessType().(type) {
 	case *csi.VolumeCapability_Block:
+		// the thin pool of the node is created on the block device of the pool volume
+		if thinPool == consts.LVMThinPoolPool {
+			if err := d.ensureThinPool(ctx, diskURI, source, req.GetVolumeContext()); err != nil {
+				if errors.Is(err, errForeignDataSignature) {
+					return nil, status.Errorf(codes.FailedPrecondition, "could not create thin pool on %s(lun: %s): %v", source, lun, err)
+				}
+				return nil, status.Errorf(codes.Internal, "could not create thin pool on %s(lun: %s): %v", source, lun, err)
+			}
+		}
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
-	mnt, err := d.ensureMountPoint(target)
+	mnt, err := d.ensureMountPoint(ctx, target)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not mount target %q: %v", target, err)
 	}
 	if mnt {
-		klog.V(2).Infof("NodeStageVolume: already mounted on target %s", target)
+		logger.V(2).Info("NodeStageVolume: already mounted on target", "target", target)
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
@@ -154,18 +258,98 @@ func (d *Driver) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequ
 		// respect "fstype" setting in storage class parameters
 		fstype = volContextFSType
 	}
+	options = withFsDefaultMountOptions(fstype, options)
+	formatOptions, err := azureutils.ParseFormatOptions(fstype, azureutils.GetFormatOptions(req.GetVolumeContext()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	fsckPolicy, err := azureutils.GetFsckPolicy(req.GetVolumeContext())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	readOnlyRemountRecovery, err := azureutils.GetReadOnlyRemountRecovery(req.GetVolumeContext())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// the filesystem of a shared disk is never checked or repaired, the recovery repairs it as well
+	if (fsckPolicy != consts.FsckPolicyNone || readOnlyRemountRecovery) && isSharedDisk(req.GetVolumeContext(), req.GetPublishContext()) {
+		csicommon.LogWarning(ctx, "NodeStageVolume: skip filesystem check and repair of a shared disk", "volumeID", diskURI, "fsckPolicy", fsckPolicy, "readOnlyRemountRecovery", readOnlyRemountRecovery)
+		fsckPolicy = consts.FsckPolicyNone
+		readOnlyRemountRecovery = false
+	}
+
+	// the filesystem of a striped volume is created on the logical volume striped over its members
+	if stripeMembers > 1 {
+		lvPath, err := d.assembleStripedVolume(ctx, diskURI, devices, req.GetVolumeContext())
+		if err != nil {
+			if errors.Is(err, errForeignDataSignature) {
+				return nil, status.Errorf(codes.FailedPrecondition, "could not stripe volume %s: %v", diskURI, err)
+			}
+			return nil, status.Errorf(codes.Internal, "could not assemble striped volume %s: %v", diskURI, err)
+		}
+		source = lvPath
+	}
 
 	// If partition is specified, should mount it only instead of the entire disk.
 	if partition, ok := req.GetVolumeContext()[consts.VolumeAttributePartition]; ok {
-		source = source + "-part" + partition
+		if strings.EqualFold(partition, consts.VolumeAttributePartitionAuto) {
+			if runtime.GOOS != "linux" {
+				return nil, status.Errorf(codes.InvalidArgument, "%s %s is only supported on Linux", consts.VolumeAttributePartition, partition)
+			}
+			partitionPath, err := d.ensureDiskPartition(ctx, source)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "could not partition %s(lun: %s): %v", source, lun, err)
+			}
+			source = partitionPath
+		} else {
+			source = source + "-part" + partition
+		}
+	}
+
+	// the filesystem is created on the mapped device of the LUKS volume
+	if hostEncryption == consts.HostEncryptionLUKS {
+		mapperPath, err := d.openLUKS(ctx, diskURI, source, passphrase, req.GetVolumeContext())
+		if err != nil {
+			if errors.Is(err, errForeignDataSignature) {
+				return nil, status.Errorf(codes.FailedPrecondition, "could not encrypt %s(lun: %s): %v", source, lun, err)
+			}
+			return nil, status.Errorf(codes.Internal, "could not open LUKS volume on %s(lun: %s): %v", source, lun, err)
+		}
+		source = mapperPath
+	}
+
+	// directmount never formats the device
+	if !slices.Contains(options, "directmount") {
+		if err := d.checkDiskSignatures(ctx, diskURI, source, fstype, req.GetVolumeContext()); err != nil {
+			if errors.Is(err, errForeignDataSignature) {
+				return nil, status.Errorf(codes.FailedPrecondition, "could not format %s(lun: %s) with %s: %v", source, lun, fstype, err)
+			}
+			return nil, status.Errorf(codes.Internal, "could not probe signatures of %s(lun: %s): %v", source, lun, err)
+		}
+	}
+
+	if fsckPolicy != consts.FsckPolicyNone {
+		if err := d.fsckIfDirty(ctx, diskURI, source, fstype, fsckPolicy, req.GetVolumeContext()); err != nil {
+			return nil, status.Errorf(codes.Internal, "could not repair %s(lun: %s): %v", source, lun, err)
+		}
 	}
 
 	// FormatAndMount will format only if needed
-	klog.V(2).Infof("NodeStageVolume: formatting %s and mounting at %s with mount options(%s)", source, target, options)
-	if err := d.formatAndMount(source, target, fstype, options); err != nil {
+	logger.V(2).Info("NodeStageVolume: formatting and mounting", "source", source, "target", target, "mountOptions", options, "formatOptions", formatOptions)
+	_, span := startSpan(ctx, "formatAndMount", attrVolumeID.String(diskURI), attrFsType.String(fstype), attrTargetPath.String(target))
+	err = d.formatAndMount(source, target, fstype, options, formatOptions)
+	endSpan(span, err)
+	if err != nil && fsckPolicy != consts.FsckPolicyNone {
+		result := d.fsck(ctx, diskURI, source, fstype, fsckPolicy, "mount failed", req.GetVolumeContext())
+		if fsckPolicy == consts.FsckPolicyRepair && (result == fsckResultClean || result == fsckResultRepaired) {
+			logger.V(2).Info("NodeStageVolume: mounting again after filesystem repair", "source", source, "target", target, "mountError", err.Error())
+			err = d.formatAndMount(source, target, fstype, options, formatOptions)
+		}
+	}
+	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not format %s(lun: %s), and mount it at %s, failed with %v", source, lun, target, err)
 	}
-	klog.V(2).Infof("NodeStageVolume: format %s and mounting at %s successfully.", source, target)
+	logger.V(2).Info("NodeStageVolume: format and mount successfully", "source", source, "target", target)
 
 	var needResize bool
 	if required, ok := req.GetVolumeContext()[consts.ResizeRequired]; ok && strings.EqualFold(required, consts.TrueValue) {
@@ -175,24 +359,37 @@ func (d *Driver) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequ
 		// Filesystem resize is required after snapshot restore / volume clone
 		// https://github.com/kubernetes/kubernetes/issues/94929
 		if needResize, err = needResizeVolume(source, target, d.mounter); err != nil {
-			klog.Errorf("NodeStageVolume: could not determine if volume %s needs to be resized: %v", diskURI, err)
+			logger.Error(err, "NodeStageVolume: could not determine if volume needs to be resized")
 		}
 	}
 
 	// if resize is required, resize filesystem
 	if needResize {
-		klog.V(2).Infof("NodeStageVolume: fs resize initiating on target(%s) volumeid(%s)", target, diskURI)
-		if err := resizeVolume(source, target, d.mounter); err != nil {
+		logger.V(2).Info("NodeStageVolume: fs resize initiating", "target", target)
+		_, span = startSpan(ctx, "resizeVolume", attrVolumeID.String(diskURI), attrTargetPath.String(target))
+		err = resizeVolume(source, target, d.mounter)
+		endSpan(span, err)
+		if err != nil {
 			return nil, status.Errorf(codes.Internal, "NodeStageVolume: could not resize volume %s (%s):  %v", source, target, err)
 		}
-		klog.V(2).Infof("NodeStageVolume: fs resize successful on target(%s) volumeid(%s).", target, diskURI)
+		logger.V(2).Info("NodeStageVolume: fs resize successful", "target", target)
+	}
+	if !slices.Contains(options, "ro") {
+		d.stagedVolumes.add(&stagedVolume{
+			volumeID:      diskURI,
+			stagingPath:   target,
+			fstype:        fstype,
+			mountOptions:  options,
+			volumeContext: req.GetVolumeContext(),
+			recovery:      readOnlyRemountRecovery,
+		})
 	}
 	isOperationSucceeded = true
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
 // NodeUnstageVolume unmount disk device from a staging path
-func (d *Driver) NodeUnstageVolume(_ context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+func (d *Driver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -214,18 +411,42 @@ func (d *Driver) NodeUnstageVolume(_ context.Context, req *csi.NodeUnstageVolume
 	}
 	defer d.volumeLocks.Release(volumeID)
 
-	klog.V(2).Infof("NodeUnstageVolume: unmounting %s", stagingTargetPath)
+	logger := klog.FromContext(ctx).WithValues("volumeID", volumeID, "stagingTargetPath", stagingTargetPath)
+	logger.V(2).Info("NodeUnstageVolume: unmounting")
 	if err := CleanupMountPoint(stagingTargetPath, d.mounter, true /*extensiveMountPointCheck*/); err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to unmount staging target %q: %v", stagingTargetPath, err)
 	}
-	klog.V(2).Infof("NodeUnstageVolume: unmount %s successfully", stagingTargetPath)
+	logger.V(2).Info("NodeUnstageVolume: unmount successfully")
+	if err := d.closeLUKS(ctx, volumeID); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	if len(splitStripedID(volumeID)) > 1 {
+		if err := d.deactivateStripedVolume(ctx, volumeID); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+	if _, name, isThin := parseThinVolumeID(volumeID); isThin {
+		if err := d.deactivateThinVolume(ctx, name); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	} else if err := d.deactivateThinPool(ctx, volumeID); err != nil {
+		// the pool volume is detached once the thin volumes of the node are unstaged
+		if errors.Is(err, errThinPoolInUse) {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	d.stagedVolumes.remove(volumeID)
+	for _, diskID := range splitStripedID(volumeID) {
+		d.restoreDeviceTuning(ctx, diskID)
+	}
 
 	isOperationSucceeded = true
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
 // NodePublishVolume mount the volume from staging to target path
-func (d *Driver) NodePublishVolume(_ context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in the request")
@@ -261,6 +482,7 @@ func (d *Driver) NodePublishVolume(_ context.Context, req *csi.NodePublishVolume
 		return nil, status.Error(codes.Internal, fmt.Sprintf("Target path could not be prepared: %v", err))
 	}
 
+	logger := klog.FromContext(ctx).WithValues("volumeID", volumeID, "target", target)
 	mountOptions := []string{"bind"}
 	if req.GetReadonly() {
 		mountOptions = append(mountOptions, "ro")
@@ -277,33 +499,43 @@ func (d *Driver) NodePublishVolume(_ context.Context, req *csi.NodePublishVolume
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to find device path with lun %s. %v", lun, err)
 		}
-		klog.V(2).Infof("NodePublishVolume [block]: found device path %s with lun %s", source, lun)
-		if err = d.ensureBlockTargetFile(target); err != nil {
+		logger.V(2).Info("NodePublishVolume [block]: found device path", "source", source, "lun", lun)
+		if err = d.ensureBlockTargetFile(ctx, target); err != nil {
 			return nil, status.Errorf(codes.Internal, "%v", err)
 		}
 	case *csi.VolumeCapability_Mount:
-		mnt, err := d.ensureMountPoint(target)
+		// the recovery of a read-only remount unmounts the staging path, wait until it is mounted again
+		d.stagingPathLocks.LockKey(volumeID)
+		defer func() { _ = d.stagingPathLocks.UnlockKey(volumeID) }()
+		mnt, err := d.ensureMountPoint(ctx, target)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "could not mount target %q: %v", target, err)
 		}
 		if mnt {
-			klog.V(2).Infof("NodePublishVolume: already mounted on target %s", target)
+			logger.V(2).Info("NodePublishVolume: already mounted on target")
+			d.stagedVolumes.publish(volumeID, target, req.GetReadonly())
 			return &csi.NodePublishVolumeResponse{}, nil
 		}
 	}
 
-	klog.V(2).Infof("NodePublishVolume: mounting %s at %s", source, target)
-	if err := d.mounter.Mount(source, target, "", mountOptions); err != nil {
+	logger.V(2).Info("NodePublishVolume: mounting", "source", source)
+	_, span := startSpan(ctx, "mount", attrVolumeID.String(volumeID), attrTargetPath.String(target))
+	err = d.mounter.Mount(source, target, "", mountOptions)
+	endSpan(span, err)
+	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not mount %q at %q: %v", source, target, err)
 	}
 
-	klog.V(2).Infof("NodePublishVolume: mount %s at %s successfully", source, target)
+	logger.V(2).Info("NodePublishVolume: mount successfully", "source", source)
+	if req.GetVolumeCapability().GetMount() != nil {
+		d.stagedVolumes.publish(volumeID, target, req.GetReadonly())
+	}
 
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
 // NodeUnpublishVolume unmount the volume from the target path
-func (d *Driver) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	targetPath := req.GetTargetPath()
 	volumeID := req.GetVolumeId()
 
@@ -314,7 +546,8 @@ func (d *Driver) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpublishVo
 		return nil, status.Error(codes.InvalidArgument, "Target path missing in request")
 	}
 
-	klog.V(2).Infof("NodeUnpublishVolume: unmounting volume %s on %s", volumeID, targetPath)
+	logger := klog.FromContext(ctx).WithValues("volumeID", volumeID, "targetPath", targetPath)
+	logger.V(2).Info("NodeUnpublishVolume: unmounting volume")
 	extensiveMountPointCheck := true
 	if runtime.GOOS == "windows" {
 		// on Windows, this parameter indicates whether to unmount volume, not necessary in NodeUnpublishVolume
@@ -324,7 +557,8 @@ func (d *Driver) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpublishVo
 		return nil, status.Errorf(codes.Internal, "failed to unmount target %q: %v", targetPath, err)
 	}
 
-	klog.V(2).Infof("NodeUnpublishVolume: unmount volume %s on %s successfully", volumeID, targetPath)
+	logger.V(2).Info("NodeUnpublishVolume: unmount volume successfully")
+	d.stagedVolumes.unpublish(volumeID, targetPath)
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
@@ -338,6 +572,7 @@ func (d *Driver) NodeGetCapabilities(_ context.Context, _ *csi.NodeGetCapabiliti
 
 // NodeGetInfo return info of the node on which this plugin is running
 func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	ctx, logger := csicommon.NewLogContext(ctx, "node", d.NodeID)
 	topology := &csi.Topology{
 		Segments: map[string]string{topologyKey: ""},
 	}
@@ -356,7 +591,7 @@ func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*c
 				zone, err = d.cloud.GetZone(ctx)
 			}
 			if err != nil {
-				klog.Warningf("get zone(%s) failed with: %v, fall back to get zone from node labels", d.NodeID, err)
+				csicommon.LogWarning(ctx, "get zone failed, fall back to get zone from node labels", "err", err)
 				failureDomainFromLabels, instanceTypeFromLabels, err = GetNodeInfoFromLabels(ctx, d.NodeID, d.cloud.KubeClient)
 			}
 		}
@@ -367,7 +602,7 @@ func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*c
 			zone.FailureDomain = failureDomainFromLabels
 		}
 
-		klog.V(2).Infof("NodeGetInfo, nodeName: %s, failureDomain: %s", d.NodeID, zone.FailureDomain)
+		logger.V(2).Info("NodeGetInfo: got failure domain", "failureDomain", zone.FailureDomain)
 		if azureutils.IsValidAvailabilityZone(zone.FailureDomain, d.cloud.Location) {
 			topology.Segments[topologyKey] = zone.FailureDomain
 			topology.Segments[consts.WellKnownTopologyKey] = zone.FailureDomain
@@ -388,26 +623,26 @@ func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*c
 				metadata, err = d.cloud.Metadata.GetMetadata(ctx, azcache.CacheReadTypeDefault)
 				if err == nil && metadata != nil && metadata.Compute != nil {
 					instanceType = metadata.Compute.VMSize
-					klog.V(2).Infof("NodeGetInfo: nodeName(%s), VM Size(%s)", d.NodeID, instanceType)
+					logger.V(2).Info("NodeGetInfo: got VM size from instance metadata", "vmSize", instanceType)
 				}
 			} else {
 				instances, ok := d.cloud.Instances()
 				if !ok {
-					klog.Warningf("failed to get instances from cloud provider")
+					csicommon.LogWarning(ctx, "failed to get instances from cloud provider")
 				} else {
 					instanceType, err = instances.InstanceType(ctx, types.NodeName(d.NodeID))
 				}
 			}
 			if err != nil {
-				klog.Warningf("get instance type(%s) failed with: %v", d.NodeID, err)
+				csicommon.LogWarning(ctx, "get instance type failed", "err", err)
 			}
 			if instanceType == "" && instanceTypeFromLabels == "" {
-				klog.Warningf("fall back to get instance type from node labels")
+				csicommon.LogWarning(ctx, "fall back to get instance type from node labels")
 				_, instanceTypeFromLabels, err = GetNodeInfoFromLabels(ctx, d.NodeID, d.cloud.KubeClient)
 			}
 		}
 		if err != nil {
-			klog.Warningf("GetNodeInfoFromLabels on node(%s) failed with %v", d.NodeID, err)
+			csicommon.LogWarning(ctx, "GetNodeInfoFromLabels failed", "err", err)
 		}
 		if instanceType == "" {
 			instanceType = instanceTypeFromLabels
@@ -420,14 +655,14 @@ func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*c
 	if d.getNodeIDFromIMDS && d.cloud.UseInstanceMetadata && d.cloud.Metadata != nil {
 		metadata, err := d.cloud.Metadata.GetMetadata(ctx, azcache.CacheReadTypeDefault)
 		if err == nil && metadata != nil && metadata.Compute != nil {
-			klog.V(2).Infof("NodeGetInfo: NodeID(%s), metadata.Compute.Name(%s)", d.NodeID, metadata.Compute.Name)
+			logger.V(2).Info("NodeGetInfo: got compute name from instance metadata", "computeName", metadata.Compute.Name)
 			if metadata.Compute.Name != "" {
 				if metadata.Compute.VMScaleSetName != "" {
 					id, err := getVMSSInstanceName(metadata.Compute.Name)
 					if err != nil {
-						klog.Errorf("getVMSSInstanceName failed with %v", err)
+						logger.Error(err, "getVMSSInstanceName failed")
 						if nodeID == "" {
-							klog.V(2).Infof("NodeGetInfo: NodeID is empty, use metadata.Compute.Name(%s)", metadata.Compute.Name)
+							logger.V(2).Info("NodeGetInfo: NodeID is empty, use compute name from instance metadata", "computeName", metadata.Compute.Name)
 							nodeID = metadata.Compute.Name
 						}
 					} else {
@@ -438,10 +673,17 @@ func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*c
 				}
 			}
 		} else {
-			klog.Warningf("get instance type(%s) failed with: %v", d.NodeID, err)
+			csicommon.LogWarning(ctx, "get instance metadata failed", "err", err)
 		}
 	}
 
+	if d.lvmThinVolumesPerNode > 0 {
+		// thin volumes are node-local and counted by the scheduler against their own driver name,
+		// they do not use the data disk slots of the node
+		topology.Segments[nodeTopologyKey] = d.NodeID
+		maxDataDiskCount = d.lvmThinVolumesPerNode
+	}
+
 	return &csi.NodeGetInfoResponse{
 		NodeId:             nodeID,
 		MaxVolumesPerNode:  maxDataDiskCount,
@@ -449,15 +691,25 @@ func (d *Driver) NodeGetInfo(ctx context.Context, _ *csi.NodeGetInfoRequest) (*c
 	}, nil
 }
 
+// GetMaxDataDiskCount returns the max data disk count of a VM size from the runtime override table,
+// then from the compiled-in table, the bool is false if the default volume limit is returned
 func GetMaxDataDiskCount(instanceType string) (int64, bool) {
 	vmsize := strings.ToUpper(instanceType)
+	if maxDataDiskCount, exists := dataDiskCountOverride.get(vmsize); exists {
+		klog.V(5).Infof("got a matching size in max data disk count override, VM Size: %s, MaxDataDiskCount: %d", vmsize, maxDataDiskCount)
+		return maxDataDiskCount, true
+	}
 	maxDataDiskCount, exists := maxDataDiskCountMap[vmsize]
 	if exists {
 		klog.V(5).Infof("got a matching size in getMaxDataDiskCount, VM Size: %s, MaxDataDiskCount: %d", vmsize, maxDataDiskCount)
 		return maxDataDiskCount, true
 	}
 
-	klog.V(5).Infof("not found a matching size in getMaxDataDiskCount, VM Size: %s, use default volume limit: %d", vmsize, defaultAzureVolumeLimit)
+	if _, logged := dataDiskCountOverride.fallbacks.LoadOrStore(vmsize, true); !logged && vmsize != "" {
+		klog.Warningf("not found a matching size in getMaxDataDiskCount, VM Size: %s, use default volume limit: %d, add the size with --max-data-disk-count-config or --max-data-disk-count-configmap", vmsize, defaultAzureVolumeLimit)
+	} else {
+		klog.V(5).Infof("not found a matching size in getMaxDataDiskCount, VM Size: %s, use default volume limit: %d", vmsize, defaultAzureVolumeLimit)
+	}
 	return defaultAzureVolumeLimit, false
 }
 
@@ -471,15 +723,21 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 
 	volUsage, err := d.GetVolumeStats(ctx, d.mounter, req.VolumeId, req.VolumePath, d.hostUtil)
 	if err != nil {
-		klog.Errorf("NodeGetVolumeStats: failed to get volume stats for volume %s path %s: %v", req.VolumeId, req.VolumePath, err)
+		klog.FromContext(ctx).Error(err, "NodeGetVolumeStats: failed to get volume stats", "volumeID", req.VolumeId, "volumePath", req.VolumePath)
+	}
+	condition := d.stagedVolumes.condition(req.VolumeId)
+	if _, _, isThin := parseThinVolumeID(req.VolumeId); isThin && (condition == nil || !condition.Abnormal) {
+		// thin volumes fail writes once the thin pool of the node is exhausted
+		condition = d.getThinPoolCondition()
 	}
 	return &csi.NodeGetVolumeStatsResponse{
-		Usage: volUsage,
+		Usage:           volUsage,
+		VolumeCondition: condition,
 	}, err
 }
 
 // NodeExpandVolume node expand volume
-func (d *Driver) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
+func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -492,6 +750,7 @@ func (d *Driver) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRe
 	if len(volumePath) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "volume path must be provided")
 	}
+	ctx, logger := csicommon.NewLogContext(ctx, "volumeID", volumeID, "volumePath", volumePath)
 
 	isBlock, err := d.getHostUtil().PathIsDevice(volumePath)
 	if err != nil {
@@ -506,12 +765,16 @@ func (d *Driver) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRe
 
 	if isBlock {
 		if d.enableDiskOnlineResize {
-			klog.V(2).Infof("NodeExpandVolume begin to rescan all devices on block volume(%s)", volumeID)
+			logger.V(2).Info("NodeExpandVolume: begin to rescan all devices on block volume")
 			if err := rescanAllVolumes(d.ioHandler); err != nil {
-				klog.Errorf("NodeExpandVolume rescanAllVolumes failed with error: %v", err)
+				logger.Error(err, "NodeExpandVolume: rescanAllVolumes failed")
 			}
 		}
-		klog.V(2).Infof("NodeExpandVolume skip resize operation on block volume(%s)", volumeID)
+		// the thin pool grows with its pool volume
+		if err := d.growThinPool(ctx, volumeID); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+		logger.V(2).Info("NodeExpandVolume: skip resize operation on block volume")
 		return &csi.NodeExpandVolumeResponse{}, nil
 	}
 
@@ -531,17 +794,68 @@ func (d *Driver) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRe
 		return nil, status.Errorf(codes.NotFound, "%v", err)
 	}
 
-	if d.enableDiskOnlineResize {
-		klog.V(2).Infof("NodeExpandVolume begin to rescan device %s on volume(%s)", devicePath, volumeID)
-		if err := rescanVolume(d.ioHandler, devicePath); err != nil {
-			klog.Errorf("NodeExpandVolume rescanVolume failed with error: %v", err)
+	// the device of a LUKS volume is rescanned before the crypt mapping is resized,
+	// the disk of a partition before the partition is grown, and the members of a
+	// striped volume before the logical volume is extended
+	rescanPath := devicePath
+	luksName, isLUKS := parseLUKSMapperName(devicePath)
+	if isLUKS {
+		// the passphrase is checked before the device is touched
+		if req.GetSecrets()[consts.LUKSPassphraseKey] == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "LUKS volume %s requires the %s key in the node expand secret to be resized", volumeID, consts.LUKSPassphraseKey)
+		}
+		if rescanPath, err = d.getLUKSBackingDevice(luksName); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+	partitionPath := rescanPath
+	disk, partitionNumber, isPartition, err := getPartitionDisk(d.ioHandler, partitionPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	if isPartition {
+		rescanPath = disk
+	}
+	vgName, isStriped := parseStripeVGName(rescanPath)
+	thinLVName, isThin := parseThinLVName(rescanPath)
+
+	if isStriped {
+		logger.V(2).Info("NodeExpandVolume: begin to grow striped volume", "volumeGroup", vgName)
+		if err := d.growStripedVolume(ctx, vgName); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	} else if isThin {
+		logger.V(2).Info("NodeExpandVolume: begin to grow thin volume", "logicalVolume", thinLVName)
+		if err := d.growThinVolume(ctx, thinLVName, requestGiB); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	} else if d.enableDiskOnlineResize {
+		logger.V(2).Info("NodeExpandVolume: begin to rescan device", "device", rescanPath)
+		if err := rescanVolume(d.ioHandler, rescanPath); err != nil {
+			logger.Error(err, "NodeExpandVolume: rescanVolume failed", "device", rescanPath)
+		}
+	}
+
+	if isPartition {
+		if err := d.growPartition(ctx, disk, partitionNumber, partitionPath); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
+		}
+	}
+
+	if isLUKS {
+		logger.V(2).Info("NodeExpandVolume: begin to resize LUKS volume", "luksName", luksName)
+		if err := d.resizeLUKS(luksName, req.GetSecrets()[consts.LUKSPassphraseKey]); err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", err)
 		}
 	}
 
 	var retErr error
-	if err := resizeVolume(devicePath, volumePath, d.mounter); err != nil {
+	_, span := startSpan(ctx, "resizeVolume", attrVolumeID.String(volumeID), attrTargetPath.String(volumePath))
+	err = resizeVolume(devicePath, volumePath, d.mounter)
+	endSpan(span, err)
+	if err != nil {
 		retErr = status.Errorf(codes.Internal, "could not resize volume %q (%q):  %v", volumeID, devicePath, err)
-		klog.Errorf("%v, will continue checking whether the volume has been resized", retErr)
+		logger.Error(err, "NodeExpandVolume: could not resize volume, will continue checking whether the volume has been resized", "devicePath", devicePath)
 	}
 
 	if runtime.GOOS == "windows" && d.enableWindowsHostProcess {
@@ -561,7 +875,16 @@ func (d *Driver) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRe
 		return nil, status.Errorf(codes.Internal, "resize requested for %v, but after resizing volume size was %v", requestGiB, gotBlockGiB)
 	}
 
-	klog.V(2).Infof("NodeExpandVolume succeeded on resizing volume %v to %v", volumeID, gotBlockSizeBytes)
+	logger.V(2).Info("NodeExpandVolume: resized volume successfully", "sizeBytes", gotBlockSizeBytes)
+
+	// the filesystem defaults are applied on resize as on format
+	if runtime.GOOS != "windows" {
+		remountPath := req.GetStagingTargetPath()
+		if remountPath == "" {
+			remountPath = volumePath
+		}
+		d.remountWithFsDefaults(ctx, remountPath, req.GetVolumeCapability().GetMount().GetMountFlags())
+	}
 
 	isOperationSucceeded = true
 	return &csi.NodeExpandVolumeResponse{
@@ -571,12 +894,13 @@ func (d *Driver) NodeExpandVolume(_ context.Context, req *csi.NodeExpandVolumeRe
 
 // ensureMountPoint: create mount point if not exists
 // return <true, nil> if it's already a mounted point otherwise return <false, nil>
-func (d *Driver) ensureMountPoint(target string) (bool, error) {
+func (d *Driver) ensureMountPoint(ctx context.Context, target string) (bool, error) {
+	logger := klog.FromContext(ctx).WithValues("target", target)
 	notMnt, err := d.mounter.IsLikelyNotMountPoint(target)
 	if err != nil && !os.IsNotExist(err) {
 		if azureutils.IsCorruptedDir(target) {
 			notMnt = false
-			klog.Warningf("detected corrupted mount for targetPath [%s]", target)
+			csicommon.LogWarning(ctx, "detected corrupted mount for target", "target", target)
 		} else {
 			return !notMnt, err
 		}
@@ -607,13 +931,13 @@ func (d *Driver) ensureMountPoint(target string) (bool, error) {
 		// testing original mount point, make sure the mount link is valid
 		_, err := os.ReadDir(target)
 		if err == nil {
-			klog.V(2).Infof("already mounted to target %s", target)
+			logger.V(2).Info("already mounted to target")
 			return !notMnt, nil
 		}
 		// mount link is invalid, now unmount and remount later
-		klog.Warningf("ReadDir %s failed with %v, unmount this directory", target, err)
+		csicommon.LogWarning(ctx, "ReadDir failed, unmount this directory", "target", target, "err", err)
 		if err := d.mounter.Unmount(target); err != nil {
-			klog.Errorf("Unmount directory %s failed with %v", target, err)
+			logger.Error(err, "Unmount directory failed")
 			return !notMnt, err
 		}
 		notMnt = true
@@ -623,7 +947,7 @@ func (d *Driver) ensureMountPoint(target string) (bool, error) {
 	if runtime.GOOS != "windows" {
 		// in windows, we will use mklink to mount, will MkdirAll in Mount func
 		if err := volumehelper.MakeDir(target); err != nil {
-			klog.Errorf("mkdir failed on target: %s (%v)", target, err)
+			logger.Error(err, "mkdir failed on target")
 			return !notMnt, err
 		}
 	}
@@ -631,8 +955,8 @@ func (d *Driver) ensureMountPoint(target string) (bool, error) {
 	return !notMnt, nil
 }
 
-func (d *Driver) formatAndMount(source, target, fstype string, options []string) error {
-	return formatAndMount(source, target, fstype, options, d.mounter)
+func (d *Driver) formatAndMount(source, target, fstype string, options, formatOptions []string) error {
+	return formatAndMount(source, target, fstype, options, formatOptions, d.mounter)
 }
 
 func (d *Driver) getDevicePathWithLUN(lunStr string) (string, error) {
@@ -663,14 +987,14 @@ func (d *Driver) getDevicePathWithLUN(lunStr string) (string, error) {
 	return newDevicePath, err
 }
 
-func (d *Driver) ensureBlockTargetFile(target string) error {
+func (d *Driver) ensureBlockTargetFile(ctx context.Context, target string) error {
 	// Since the block device target path is file, its parent directory should be ensured to be valid.
 	parentDir := filepath.Dir(target)
-	if _, err := d.ensureMountPoint(parentDir); err != nil {
+	if _, err := d.ensureMountPoint(ctx, parentDir); err != nil {
 		return status.Errorf(codes.Internal, "could not mount target %q: %v", parentDir, err)
 	}
 	// Create the mount point as a file since bind mount device node requires it to be a file
-	klog.V(2).Infof("ensureBlockTargetFile [block]: making target file %s", target)
+	klog.FromContext(ctx).V(2).Info("ensureBlockTargetFile [block]: making target file", "target", target)
 	err := volumehelper.MakeFile(target)
 	if err != nil {
 		if removeErr := os.Remove(target); removeErr != nil {
@@ -36,6 +36,7 @@ import (
 	"go.uber.org/mock/gomock"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/utils/exec"
 	testingexec "k8s.io/utils/exec/testing"
 	"k8s.io/utils/ptr"
 	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
@@ -213,7 +214,7 @@ func TestEnsureMountPoint(t *testing.T) {
 		assert.NoError(t, err)
 		d.setMounter(fakeMounter)
 		if !(runtime.GOOS == "windows" && test.skipOnWindows) && !(runtime.GOOS == "darwin" && test.skipOnDarwin) {
-			mnt, err := d.ensureMountPoint(test.target)
+			mnt, err := d.ensureMountPoint(context.Background(), test.target)
 			if !testutil.AssertError(&test.expectedErr, err) {
 				t.Errorf("desc: %s\n actualErr: (%v), expectedErr: (%v)", test.desc, err, test.expectedErr)
 			}
@@ -273,6 +274,24 @@ func TestNodeGetInfo(t *testing.T) {
 				assert.Len(t, resp.AccessibleTopology.Segments, 2)
 			},
 		},
+		{
+			desc:         "[Success] Get node information of the thin volumes driver",
+			expectedErr:  nil,
+			skipOnDarwin: true,
+			setupFunc: func(_ *testing.T, d FakeDriver) {
+				d.(*fakeDriver).lvmThinVolumesPerNode = 100
+				mockVMClient := d.getCloud().ComputeClientFactory.GetVirtualMachineClient().(*mockvmclient.MockInterface)
+				mockVMClient.EXPECT().
+					Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&testVM, nil).
+					AnyTimes()
+			},
+			validateFunc: func(t *testing.T, resp *csi.NodeGetInfoResponse) {
+				// thin volumes do not share the data disk slots of the node
+				assert.Equal(t, int64(100), resp.MaxVolumesPerNode)
+				assert.Equal(t, "fakeNodeID", resp.AccessibleTopology.Segments[nodeTopologyKey])
+			},
+		},
 		{
 			desc:        "[Failure] Get node information for non-existing VM",
 			expectedErr: status.Error(codes.Internal, fmt.Sprintf("GetNodeInfoFromLabels on node(%s) failed with %s", "fakeNodeID", "kubeClient is nil")),
@@ -440,6 +459,9 @@ func TestNodeStageVolume(t *testing.T) {
 	blkidAction := func() ([]byte, []byte, error) {
 		return []byte("DEVICE=/dev/sdd\nTYPE=ext4"), []byte{}, nil
 	}
+	lvmBlkidAction := func() ([]byte, []byte, error) {
+		return []byte("DEVICE=/dev/sdd\nTYPE=LVM2_member"), []byte{}, nil
+	}
 	fsckAction := func() ([]byte, []byte, error) {
 		return []byte{}, []byte{}, nil
 	}
@@ -519,7 +541,7 @@ func TestNodeStageVolume(t *testing.T) {
 			skipOnDarwin:  true,
 			skipOnWindows: true,
 			setupFunc: func(_ *testing.T, d FakeDriver) {
-				d.setNextCommandOutputScripts(blkidAction, fsckAction, blockSizeAction, blkidAction, blockSizeAction, blkidAction)
+				d.setNextCommandOutputScripts(blkidAction, blkidAction, fsckAction, blockSizeAction, blkidAction, blockSizeAction, blkidAction)
 			},
 			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
 				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
@@ -529,12 +551,54 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			desc:          "Successfully staged a disk expanded online",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			setupFunc: func(_ *testing.T, d FakeDriver) {
+				// the device is bigger than the disk size published at attach time
+				d.setNextCommandOutputScripts(blockSizeAction, blkidAction, blkidAction, fsckAction, blockSizeAction, blkidAction, blockSizeAction, blkidAction)
+			},
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: map[string]string{
+					consts.LUN:                "/dev/disk/azure/scsi1/lun1",
+					consts.DiskSizeBytesField: fmt.Sprintf("%d", volumehelper.GiBToBytes(10)),
+					consts.DiskUniqueIDField:  "4E2B1C3A-90F1-4C6B-9E4A-0C1D2E3F4A5B",
+				},
+				VolumeContext: volumeContext,
+			},
+			expectedErr: nil,
+		},
+		{
+			desc:          "Successfully staged a shared disk without fsck",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			setupFunc: func(t *testing.T, d FakeDriver) {
+				d.setNextCommandOutputScripts(blkidAction, blkidAction, fsckAction, blockSizeAction, blkidAction, blockSizeAction, blkidAction)
+				fakeExec := d.(*fakeDriver).mounter.Exec.(*mounter.FakeSafeMounter)
+				for i, script := range fakeExec.CommandScript {
+					fakeExec.CommandScript[i] = func(cmd string, args ...string) exec.Cmd {
+						assert.NotContains(t, []string{"dumpe2fs", "e2fsck"}, cmd, "the filesystem of a shared disk must not be checked")
+						return script(cmd, args...)
+					}
+				}
+			},
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+				VolumeContext:  map[string]string{consts.FsTypeField: defaultLinuxFsType, consts.FsckPolicyField: "repair", consts.MaxSharesField: "2"},
+			},
+			expectedErr: nil,
+		},
 		{
 			desc:          "Successfully with resize",
 			skipOnDarwin:  true,
 			skipOnWindows: true,
 			setupFunc: func(_ *testing.T, d FakeDriver) {
-				d.setNextCommandOutputScripts(blkidAction, fsckAction, blkidAction, resize2fsAction)
+				d.setNextCommandOutputScripts(blkidAction, blkidAction, fsckAction, blkidAction, resize2fsAction)
 			},
 			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
 				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
@@ -544,6 +608,122 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			desc:          "Refused to format a disk with foreign data",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			setupFunc: func(_ *testing.T, d FakeDriver) {
+				d.setNextCommandOutputScripts(lvmBlkidAction)
+			},
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+				VolumeContext:  volumeContext,
+			},
+			expectedErr: status.Errorf(codes.FailedPrecondition, "could not format /dev/sdd(lun: /dev/disk/azure/scsi1/lun1) with ext4: %v",
+				fmt.Errorf("%w: LVM2_member found on /dev/sdd", errForeignDataSignature)),
+		},
+		{
+			desc:          "Invalid format options",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+				VolumeContext:  map[string]string{consts.FsTypeField: defaultLinuxFsType, consts.FormatOptionsField: "-F"},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "mkfs option -F is not allowed in formatoptions with fsType ext4"),
+		},
+		{
+			desc:          "Invalid fsck policy",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+				VolumeContext:  map[string]string{consts.FsTypeField: defaultLinuxFsType, consts.FsckPolicyField: "force"},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "fsckpolicy force is not supported, supported policies are none, check and repair"),
+		},
+		{
+			desc:          "LUKS passphrase missing",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+				VolumeContext:  map[string]string{consts.FsTypeField: defaultLinuxFsType, consts.HostEncryptionField: "luks"},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "hostencryption luks requires the luksPassphrase key in the node stage secret"),
+		},
+		{
+			desc:          "LUKS block volume",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}},
+				PublishContext: publishContext,
+				VolumeContext:  map[string]string{consts.HostEncryptionField: "luks"},
+				Secrets:        map[string]string{consts.LUKSPassphraseKey: "secret"},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "hostencryption luks is not supported with block volumes"),
+		},
+		{
+			desc:          "Striped block volume",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1,vol_1-stripe1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}},
+				PublishContext: publishContext,
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "striped volumes are not supported with block volumes"),
+		},
+		{
+			desc:          "Thin volume without thin pool",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "lvmthin#node-1#pvc-1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				VolumeContext: map[string]string{consts.LVMThinPoolField: consts.LVMThinPoolVolume},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "thin volume lvmthin#node-1#pvc-1 is not served by driver disk.csi.azure.com, thin volumes need a driver name started with --lvm-thin-volumes-per-node"),
+		},
+		{
+			desc:          "Disk on the thin volumes driver",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			setupFunc: func(_ *testing.T, d FakeDriver) {
+				d.(*fakeDriver).lvmThinVolumesPerNode = 100
+			},
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "driver disk.csi.azure.com only serves thin volumes, volume vol_1 is a disk"),
+			cleanupFunc: func(_ *testing.T, d FakeDriver) {
+				d.(*fakeDriver).lvmThinVolumesPerNode = 0
+			},
+		},
+		{
+			desc:          "Invalid read-only remount recovery",
+			skipOnDarwin:  true,
+			skipOnWindows: true,
+			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
+				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
+					AccessType: stdVolCap},
+				PublishContext: publishContext,
+				VolumeContext:  map[string]string{consts.FsTypeField: defaultLinuxFsType, consts.ReadOnlyRemountRecoveryField: "yes"},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "invalid readonlyremountrecovery: yes"),
+		},
 		{
 			desc:          "failed to get perf attributes",
 			skipOnDarwin:  true,
@@ -573,12 +753,16 @@ func TestNodeStageVolume(t *testing.T) {
 				diskSupportsPerfOptimizationCall := mockoptimization.EXPECT().
 					DiskSupportsPerfOptimization(gomock.Any(), gomock.Any()).
 					Return(true)
+				getDeviceSettingsCall := mockoptimization.EXPECT().
+					GetDeviceSettings(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(map[string]string{"queue/scheduler": "none"}, nil).
+					After(diskSupportsPerfOptimizationCall)
 				mockoptimization.EXPECT().
-					OptimizeDiskPerformance(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					ApplyDeviceSettings("/dev/sdd", map[string]string{"queue/scheduler": "none"}).
 					Return(nil).
-					After(diskSupportsPerfOptimizationCall)
+					After(getDeviceSettingsCall)
 
-				d.setNextCommandOutputScripts(blkidAction, fsckAction, blockSizeAction, blockSizeAction)
+				d.setNextCommandOutputScripts(blkidAction, blkidAction, fsckAction, blockSizeAction, blockSizeAction)
 			},
 			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
 				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
@@ -602,8 +786,8 @@ func TestNodeStageVolume(t *testing.T) {
 					DiskSupportsPerfOptimization(gomock.Any(), gomock.Any()).
 					Return(true)
 				mockoptimization.EXPECT().
-					OptimizeDiskPerformance(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
-					Return(fmt.Errorf("failed to optimize device performance")).
+					GetDeviceSettings(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("failed to optimize device performance")).
 					After(diskSupportsPerfOptimizationCall)
 
 				d.setNextCommandOutputScripts(blkidAction, fsckAction, blockSizeAction, blockSizeAction)
@@ -630,7 +814,7 @@ func TestNodeStageVolume(t *testing.T) {
 					DiskSupportsPerfOptimization(gomock.Any(), gomock.Any()).
 					Return(false)
 
-				d.setNextCommandOutputScripts(blkidAction, fsckAction, blockSizeAction, blockSizeAction)
+				d.setNextCommandOutputScripts(blkidAction, blkidAction, fsckAction, blockSizeAction, blockSizeAction)
 			},
 			req: &csi.NodeStageVolumeRequest{VolumeId: "vol_1", StagingTargetPath: sourceTest,
 				VolumeCapability: &csi.VolumeCapability{AccessMode: &volumeCap,
@@ -1186,6 +1370,23 @@ func TestNodeExpandVolume(t *testing.T) {
 			skipOnDarwin:  true, // ResizeFs not supported on Darwin
 			outputScripts: []testingexec.FakeAction{findmntAction, blkidAction, resize2fsAction, blockdevAction},
 		},
+		{
+			desc: "LUKS volume without passphrase",
+			req: &csi.NodeExpandVolumeRequest{
+				CapacityRange:     stdCapacityRange,
+				VolumePath:        targetTest,
+				VolumeId:          "test",
+				StagingTargetPath: "test",
+			},
+			expectedErr: testutil.TestError{
+				DefaultError: status.Error(codes.InvalidArgument, "LUKS volume test requires the luksPassphrase key in the node expand secret to be resized"),
+			},
+			skipOnWindows: true,
+			skipOnDarwin:  true,
+			outputScripts: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+				return []byte(filepath.Join(devMapperDir, getLUKSMapperName("test"))), []byte{}, nil
+			}},
+		},
 		{
 			desc: "Block volume expansion",
 			req: &csi.NodeExpandVolumeRequest{
@@ -1325,7 +1526,7 @@ func TestEnsureBlockTargetFile(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		err := d.ensureBlockTargetFile(test.req)
+		err := d.ensureBlockTargetFile(context.Background(), test.req)
 		if !testutil.AssertError(&test.expectedErr, err) {
 			t.Errorf("desc: %s\n actualErr: (%v), expectedErr: (%v)", test.desc, err, test.expectedErr)
 		}
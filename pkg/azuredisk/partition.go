@@ -0,0 +1,165 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// partitionNodeInterval and partitionNodeTimeout bound the wait for udev to create the device node
+	// of a partition which is created or read by the kernel
+	partitionNodeInterval = 100 * time.Millisecond
+	partitionNodeTimeout  = 10 * time.Second
+)
+
+// diskPartition is a partition listed by sfdisk --json
+type diskPartition struct {
+	Node  string `json:"node"`
+	Start uint64 `json:"start"`
+	Size  uint64 `json:"size"`
+}
+
+// sfdiskTable is the partition table listed by sfdisk --json
+type sfdiskTable struct {
+	PartitionTable struct {
+		Label      string          `json:"label"`
+		Partitions []diskPartition `json:"partitions"`
+	} `json:"partitiontable"`
+}
+
+// listPartitions returns the partitions of device, partitioned is false if device has no partition table
+func (d *Driver) listPartitions(device string) (partitions []diskPartition, partitioned bool, err error) {
+	output, err := d.mounter.Exec.Command("sfdisk", "--json", device).Output()
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) {
+			// sfdisk fails if the device does not contain a recognized partition table
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to list partitions of %s: %v", device, err)
+	}
+	table := sfdiskTable{}
+	if err := json.Unmarshal(output, &table); err != nil {
+		return nil, false, fmt.Errorf("failed to parse partitions of %s: %v, output: %s", device, err, string(output))
+	}
+	return table.PartitionTable.Partitions, true, nil
+}
+
+// ensureDiskPartition returns the device to stage with partition=auto: the single partition of a partitioned disk,
+// a GPT partition spanning the disk which is created on an empty disk, or the disk itself if it carries a filesystem
+func (d *Driver) ensureDiskPartition(ctx context.Context, source string) (string, error) {
+	logger := klog.FromContext(ctx).WithValues("source", source)
+	device, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		device = source
+	}
+
+	signatures, err := getDiskSignatures(device, d.mounter)
+	if err != nil {
+		return "", err
+	}
+	if len(signatures) == 0 {
+		logger.V(2).Info("creating GPT partition on empty disk", "device", device)
+		cmd := d.mounter.Exec.Command("sfdisk", "--label", "gpt", device)
+		cmd.SetStdin(strings.NewReader(",,L\n"))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to create partition on %s: output: %s, err: %v", device, string(output), err)
+		}
+	}
+
+	partitions, partitioned, err := d.listPartitions(device)
+	if err != nil {
+		return "", err
+	}
+	if !partitioned {
+		logger.V(2).Info("disk carries no partition table, staging the whole disk", "signatures", signatures)
+		return source, nil
+	}
+	if len(partitions) != 1 {
+		return "", fmt.Errorf("%s has %d partitions, set the partition volume attribute to the number of the partition to stage", source, len(partitions))
+	}
+	node := partitions[0].Node
+	if err := waitForPartitionNode(ctx, node); err != nil {
+		return "", err
+	}
+	return node, nil
+}
+
+// waitForPartitionNode waits for udev to create the device node of a partition, sfdisk lists the
+// partitions from the partition table before the kernel has announced them
+func waitForPartitionNode(ctx context.Context, node string) error {
+	var statErr error
+	err := wait.PollUntilContextTimeout(ctx, partitionNodeInterval, partitionNodeTimeout, true, func(context.Context) (bool, error) {
+		if _, statErr = os.Stat(node); statErr != nil {
+			if os.IsNotExist(statErr) {
+				return false, nil
+			}
+			return false, statErr
+		}
+		return true, nil
+	})
+	if err != nil {
+		if statErr != nil {
+			err = statErr
+		}
+		return fmt.Errorf("device node of partition %s is not available: %v", node, err)
+	}
+	return nil
+}
+
+// growPartition grows the partition number of disk to the end of the disk, like growpart, and makes the kernel
+// read its new size. A partition which is not the last one of the disk is left unchanged.
+func (d *Driver) growPartition(ctx context.Context, disk, number, partitionPath string) error {
+	logger := klog.FromContext(ctx).WithValues("disk", disk, "partition", partitionPath)
+	partitions, _, err := d.listPartitions(disk)
+	if err != nil {
+		return err
+	}
+	var last *diskPartition
+	for i := range partitions {
+		if last == nil || partitions[i].Start > last.Start {
+			last = &partitions[i]
+		}
+	}
+	if last == nil || last.Node != partitionPath {
+		logger.V(2).Info("skip growing partition which is not the last one of the disk")
+		return nil
+	}
+
+	logger.V(2).Info("growing partition to the end of the disk")
+	cmd := d.mounter.Exec.Command("sfdisk", "--no-reread", "--no-tell-kernel", "-N", number, disk)
+	cmd.SetStdin(strings.NewReader(", +\n"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to grow partition %s of %s: output: %s, err: %v", number, disk, string(output), err)
+	}
+	if output, err := d.mounter.Exec.Command("partx", "--update", "--nr", number, disk).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to update size of partition %s of %s: output: %s, err: %v", number, disk, string(output), err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+const (
+	singlePartitionTable = `{"partitiontable": {"label": "gpt", "device": "/dev/sdc", "unit": "sectors",
+		"partitions": [{"node": "/dev/sdc1", "start": 2048, "size": 20969472, "type": "0FC63DAF-8483-4772-8E79-3D69D8477DE4"}]}}`
+	twoPartitionTable = `{"partitiontable": {"label": "gpt", "device": "/dev/sdc", "unit": "sectors",
+		"partitions": [{"node": "/dev/sdc1", "start": 2048, "size": 2048}, {"node": "/dev/sdc2", "start": 4096, "size": 20967424}]}}`
+)
+
+func TestPartition(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	// the device node of the partition of the tables is created in a temporary directory
+	dir := t.TempDir()
+	partitionNode := filepath.Join(dir, "sdc1")
+	require.NoError(t, os.WriteFile(partitionNode, nil, 0600))
+	partitionTable := strings.ReplaceAll(singlePartitionTable, "/dev/sdc1", partitionNode)
+
+	output := func(out string, exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte(out), []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte(out), []byte{}, nil
+		}
+	}
+	// cmds are the commands run with their stdin
+	var cmds []string
+	setScripts := func(actions ...testingexec.FakeAction) {
+		cmds = nil
+		fakeMounter, err := mounter.NewFakeSafeMounter()
+		require.NoError(t, err)
+		d.setMounter(fakeMounter)
+		fakeExec := fakeMounter.Exec.(*mounter.FakeSafeMounter)
+		for _, action := range actions {
+			fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+				fakeCmd := &testingexec.FakeCmd{}
+				record := func() ([]byte, []byte, error) {
+					command := strings.Join(append([]string{cmd}, args...), " ")
+					if fakeCmd.Stdin != nil {
+						stdin, _ := io.ReadAll(fakeCmd.Stdin)
+						command += " <<< " + strings.TrimSpace(string(stdin))
+					}
+					cmds = append(cmds, command)
+					return action()
+				}
+				fakeCmd.OutputScript = []testingexec.FakeAction{record}
+				fakeCmd.CombinedOutputScript = []testingexec.FakeAction{record}
+				return testingexec.InitFakeCmd(fakeCmd, cmd, args...)
+			})
+		}
+	}
+
+	tests := []struct {
+		desc          string
+		outputScripts []testingexec.FakeAction
+		expected      string
+		expectedErr   string
+		expectedCmds  []string
+	}{
+		{
+			desc:          "empty disk",
+			outputScripts: []testingexec.FakeAction{output("", 2), output("", 0), output(partitionTable, 0)},
+			expected:      partitionNode,
+			expectedCmds:  []string{"blkid -p -o export /dev/sdc", "sfdisk --label gpt /dev/sdc <<< ,,L", "sfdisk --json /dev/sdc"},
+		},
+		{
+			desc:          "partitioned disk",
+			outputScripts: []testingexec.FakeAction{output("DEVNAME=/dev/sdc\nPTUUID=0e0d\nPTTYPE=gpt\n", 0), output(partitionTable, 0)},
+			expected:      partitionNode,
+			expectedCmds:  []string{"blkid -p -o export /dev/sdc", "sfdisk --json /dev/sdc"},
+		},
+		{
+			desc:          "filesystem on the whole disk",
+			outputScripts: []testingexec.FakeAction{output("DEVNAME=/dev/sdc\nTYPE=ext4\n", 0), output("sfdisk: /dev/sdc: does not contain a recognized partition table", 1)},
+			expected:      "/dev/sdc",
+			expectedCmds:  []string{"blkid -p -o export /dev/sdc", "sfdisk --json /dev/sdc"},
+		},
+		{
+			desc:          "several partitions",
+			outputScripts: []testingexec.FakeAction{output("DEVNAME=/dev/sdc\nPTTYPE=gpt\n", 0), output(twoPartitionTable, 0)},
+			expectedErr:   "/dev/sdc has 2 partitions, set the partition volume attribute to the number of the partition to stage",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			setScripts(test.outputScripts...)
+			source, err := d.ensureDiskPartition(context.Background(), "/dev/sdc")
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, source)
+			assert.Equal(t, test.expectedCmds, cmds)
+		})
+	}
+
+	t.Run("partition node created late by udev", func(t *testing.T) {
+		lateNode := filepath.Join(dir, "sdd1")
+		setScripts(output("", 2), output("", 0), output(strings.ReplaceAll(singlePartitionTable, "/dev/sdc1", lateNode), 0))
+		time.AfterFunc(3*partitionNodeInterval, func() { _ = os.WriteFile(lateNode, nil, 0600) })
+		source, err := d.ensureDiskPartition(context.Background(), "/dev/sdc")
+		require.NoError(t, err)
+		assert.Equal(t, lateNode, source)
+	})
+
+	t.Run("partition node not available", func(t *testing.T) {
+		setScripts(output("DEVNAME=/dev/sdc\nPTTYPE=gpt\n", 0), output(strings.ReplaceAll(singlePartitionTable, "/dev/sdc1", filepath.Join(dir, "sde1")), 0))
+		ctx, cancel := context.WithTimeout(context.Background(), 3*partitionNodeInterval)
+		defer cancel()
+		_, err := d.ensureDiskPartition(ctx, "/dev/sdc")
+		assert.ErrorContains(t, err, "device node of partition "+filepath.Join(dir, "sde1")+" is not available")
+	})
+
+	t.Run("grow last partition", func(t *testing.T) {
+		setScripts(output(twoPartitionTable, 0), output("", 0), output("", 0))
+		require.NoError(t, d.growPartition(context.Background(), "/dev/sdc", "2", "/dev/sdc2"))
+		assert.Equal(t, []string{"sfdisk --json /dev/sdc", "sfdisk --no-reread --no-tell-kernel -N 2 /dev/sdc <<< , +", "partx --update --nr 2 /dev/sdc"}, cmds)
+	})
+
+	t.Run("skip partition followed by another", func(t *testing.T) {
+		setScripts(output(twoPartitionTable, 0))
+		require.NoError(t, d.growPartition(context.Background(), "/dev/sdc", "1", "/dev/sdc1"))
+		assert.Equal(t, []string{"sfdisk --json /dev/sdc"}, cmds)
+	})
+
+	t.Run("grow failed", func(t *testing.T) {
+		setScripts(output(singlePartitionTable, 0), output("sfdisk: /dev/sdc: partition 1: failed to resize", 1))
+		assert.ErrorContains(t, d.growPartition(context.Background(), "/dev/sdc", "1", "/dev/sdc1"), "failed to grow partition 1 of /dev/sdc")
+	})
+}
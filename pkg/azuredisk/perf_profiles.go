@@ -0,0 +1,40 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/optimization"
+)
+
+const (
+	// perfProfilesConfigMapKey is the key of the perf profiles in the ConfigMap
+	perfProfilesConfigMapKey = "perfProfiles"
+	// perfProfilesReloadInterval is the interval of reading the perf profiles again
+	perfProfilesReloadInterval = time.Minute
+)
+
+// loadPerfProfiles reads the named perf profiles from the file or the ConfigMap
+func (d *Driver) loadPerfProfiles(ctx context.Context) error {
+	data, err := d.readConfigData(ctx, d.perfProfilesConfig, d.perfProfilesConfigMap, perfProfilesConfigMapKey, "perf profiles")
+	if err != nil {
+		return err
+	}
+	return optimization.SetPerfProfiles(data)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/optimization"
+)
+
+func TestLoadPerfProfiles(t *testing.T) {
+	t.Cleanup(func() { assert.NoError(t, optimization.SetPerfProfiles([]byte{})) })
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "perf-profiles.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("profiles:\n  database:\n    settings:\n      queue/scheduler: mq-deadline\n"), 0600))
+	d := &Driver{}
+	d.perfProfilesConfig = path
+	assert.NoError(t, d.loadPerfProfiles(ctx))
+	assert.True(t, optimization.IsValidPerfProfile("database"))
+
+	// invalid profiles keep the previous ones
+	assert.NoError(t, os.WriteFile(path, []byte("profiles:\n  database: {}\n"), 0600))
+	assert.Error(t, d.loadPerfProfiles(ctx))
+	assert.True(t, optimization.IsValidPerfProfile("database"))
+
+	d = &Driver{}
+	d.perfProfilesConfigMap = "kube-system/perf-profiles"
+	assert.ErrorContains(t, d.loadPerfProfiles(ctx), "kubeClient is nil, can not read perf profiles ConfigMap")
+	d.kubeClient = fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "perf-profiles"},
+		Data:       map[string]string{perfProfilesConfigMapKey: "profiles:\n  streaming:\n    formulas:\n      queue/max_sectors_kb: min(node.MaxBwMbps, 512)\n"},
+	})
+	assert.NoError(t, d.loadPerfProfiles(ctx))
+	assert.True(t, optimization.IsValidPerfProfile("streaming"))
+	assert.False(t, optimization.IsValidPerfProfile("database"))
+
+	// a deleted ConfigMap removes the profiles
+	assert.NoError(t, d.kubeClient.CoreV1().ConfigMaps("kube-system").Delete(ctx, "perf-profiles", metav1.DeleteOptions{}))
+	assert.NoError(t, d.loadPerfProfiles(ctx))
+	assert.False(t, optimization.IsValidPerfProfile("streaming"))
+}
@@ -0,0 +1,428 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	mount "k8s.io/mount-utils"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+)
+
+const (
+	// restoreVolumeLockInterval and restoreVolumeLockTimeout bound the wait for a node operation on a volume
+	// being restored after a restart of the node plugin
+	restoreVolumeLockInterval = 100 * time.Millisecond
+	restoreVolumeLockTimeout  = 10 * time.Second
+	// kubeletVolumeDataFile is the file kubelet writes next to the staging and publish paths of a CSI volume
+	kubeletVolumeDataFile = "vol_data.json"
+	// kubeletStagingDirName and kubeletPublishDirName are the last elements of the staging and publish paths of kubelet
+	kubeletStagingDirName = "globalmount"
+	kubeletPublishDirName = "mount"
+)
+
+// isDeviceInUse is a variable so that unit tests, which have no block devices, can replace it
+var isDeviceInUse = deviceInUse
+
+// kubeletVolumeData is the part of the volume data of kubelet which identifies a volume
+type kubeletVolumeData struct {
+	DriverName   string `json:"driverName"`
+	VolumeHandle string `json:"volumeHandle"`
+	// SpecVolID is the PV name, only written next to the publish paths
+	SpecVolID string `json:"specVolID"`
+}
+
+// stagedVolume is a filesystem volume mounted read-write by NodeStageVolume,
+// which is watched for a remount read-only by the kernel after filesystem errors
+type stagedVolume struct {
+	volumeID      string
+	stagingPath   string
+	fstype        string
+	mountOptions  []string
+	volumeContext map[string]string
+	// recovery is whether the volume is unmounted, repaired and mounted again after a read-only remount
+	recovery bool
+	// publishPaths are the bind mounts of the staging path by NodePublishVolume, true if published read-only
+	publishPaths map[string]bool
+	// abnormal is the message of the abnormal volume condition, empty if the volume is healthy
+	abnormal string
+	// recoveryAttempted is whether the recovery was attempted since the volume was remounted read-only
+	recoveryAttempted bool
+}
+
+// stagedVolumeTable holds the staged volumes of the node plugin by volume ID
+type stagedVolumeTable struct {
+	mu      sync.Mutex
+	volumes map[string]*stagedVolume
+}
+
+// add records a volume staged by NodeStageVolume
+func (t *stagedVolumeTable) add(v *stagedVolume) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.volumes == nil {
+		t.volumes = map[string]*stagedVolume{}
+	}
+	if old, ok := t.volumes[v.volumeID]; ok && v.publishPaths == nil {
+		v.publishPaths = old.publishPaths
+	}
+	t.volumes[v.volumeID] = v
+}
+
+// addIfAbsent records a volume found staged after a restart of the node plugin,
+// unless NodeStageVolume recorded it since, it returns whether the volume was added
+func (t *stagedVolumeTable) addIfAbsent(v *stagedVolume) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.volumes[v.volumeID]; ok {
+		return false
+	}
+	if t.volumes == nil {
+		t.volumes = map[string]*stagedVolume{}
+	}
+	t.volumes[v.volumeID] = v
+	return true
+}
+
+// remove forgets a volume unstaged by NodeUnstageVolume
+func (t *stagedVolumeTable) remove(volumeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.volumes, volumeID)
+}
+
+// get returns a copy of the staged volume
+func (t *stagedVolumeTable) get(volumeID string) (stagedVolume, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.volumes[volumeID]
+	if !ok {
+		return stagedVolume{}, false
+	}
+	copied := *v
+	copied.publishPaths = maps.Clone(v.publishPaths)
+	return copied, true
+}
+
+// volumeIDs returns the IDs of the staged volumes
+func (t *stagedVolumeTable) volumeIDs() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Sorted(maps.Keys(t.volumes))
+}
+
+// update calls f with the staged volume if it is still staged
+func (t *stagedVolumeTable) update(volumeID string, f func(v *stagedVolume)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v, ok := t.volumes[volumeID]; ok {
+		f(v)
+	}
+}
+
+// publish records a bind mount of the volume by NodePublishVolume
+func (t *stagedVolumeTable) publish(volumeID, path string, readOnly bool) {
+	t.update(volumeID, func(v *stagedVolume) {
+		if v.publishPaths == nil {
+			v.publishPaths = map[string]bool{}
+		}
+		v.publishPaths[path] = readOnly
+	})
+}
+
+// unpublish forgets a bind mount of the volume removed by NodeUnpublishVolume
+func (t *stagedVolumeTable) unpublish(volumeID, path string) {
+	t.update(volumeID, func(v *stagedVolume) {
+		delete(v.publishPaths, path)
+	})
+}
+
+// condition returns the volume condition reported by NodeGetVolumeStats, nil if the volume is not watched
+func (t *stagedVolumeTable) condition(volumeID string) *csi.VolumeCondition {
+	v, ok := t.get(volumeID)
+	if !ok {
+		return nil
+	}
+	if v.abnormal != "" {
+		return &csi.VolumeCondition{Abnormal: true, Message: v.abnormal}
+	}
+	return &csi.VolumeCondition{Message: "volume is healthy"}
+}
+
+// checkReadOnlyRemounts checks the mounts of the staged volumes for a read-only remount, volumes with a node
+// operation in progress are checked in the next round. The mount table is read once per round.
+func (d *Driver) checkReadOnlyRemounts(ctx context.Context) {
+	volumeIDs := d.stagedVolumes.volumeIDs()
+	if len(volumeIDs) == 0 {
+		return
+	}
+	mountPoints, err := d.mounter.List()
+	if err != nil {
+		klog.Errorf("failed to list mount points to check the staged volumes: %v", err)
+		return
+	}
+	// the first mount point of a path is the staging mount, like the mount table is searched
+	mountPointsByPath := make(map[string]mount.MountPoint, len(mountPoints))
+	for _, mp := range mountPoints {
+		if _, ok := mountPointsByPath[mp.Path]; !ok {
+			mountPointsByPath[mp.Path] = mp
+		}
+	}
+	for _, volumeID := range volumeIDs {
+		if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
+			continue
+		}
+		d.checkReadOnlyRemount(ctx, volumeID, mountPointsByPath)
+		d.volumeLocks.Release(volumeID)
+	}
+}
+
+// checkReadOnlyRemount raises the abnormal condition of a staged volume which was remounted read-only and
+// attempts its recovery once if the volume enables it, the caller holds the volume lock
+func (d *Driver) checkReadOnlyRemount(ctx context.Context, volumeID string, mountPointsByPath map[string]mount.MountPoint) {
+	v, ok := d.stagedVolumes.get(volumeID)
+	if !ok {
+		return
+	}
+	logger := klog.FromContext(ctx).WithValues("volumeID", volumeID, "stagingTargetPath", v.stagingPath)
+	mp, ok := mountPointsByPath[v.stagingPath]
+	if !ok {
+		// the staging path was unmounted outside of NodeUnstageVolume
+		return
+	}
+	if !slices.Contains(mp.Opts, "ro") {
+		if v.abnormal != "" {
+			logger.V(2).Info("volume is mounted read-write again")
+			d.stagedVolumes.update(volumeID, func(v *stagedVolume) {
+				v.abnormal = ""
+				v.recoveryAttempted = false
+			})
+		}
+		return
+	}
+
+	if v.abnormal == "" {
+		message := fmt.Sprintf("%s filesystem on %s was remounted read-only, writes to the volume fail", v.fstype, mp.Device)
+		logger.Info("volume was remounted read-only", "device", mp.Device)
+		d.stagedVolumes.update(volumeID, func(v *stagedVolume) { v.abnormal = message })
+		d.recordAttachEvent(ctx, volumeID, types.NodeName(d.NodeID), v.volumeContext, v1.EventTypeWarning, eventReasonReadOnlyRemount,
+			"%s filesystem on %s of node %s was remounted read-only, writes to the volume fail", v.fstype, mp.Device, d.NodeID)
+	}
+	if !v.recovery || v.recoveryAttempted {
+		return
+	}
+	// NodePublishVolume waits while the staging path is unmounted, the publish paths are read with the lock held
+	d.stagingPathLocks.LockKey(volumeID)
+	defer func() { _ = d.stagingPathLocks.UnlockKey(volumeID) }()
+	if v, ok = d.stagedVolumes.get(volumeID); !ok {
+		return
+	}
+	if len(v.publishPaths) > 0 {
+		// the mount namespaces of the pods hold the filesystem even if the paths of the node are unmounted,
+		// the recovery waits until no pod uses the volume
+		logger.V(4).Info("volume is published, recovery waits until it is unpublished", "targetPaths", slices.Sorted(maps.Keys(v.publishPaths)))
+		return
+	}
+	d.stagedVolumes.update(volumeID, func(v *stagedVolume) { v.recoveryAttempted = true })
+	d.recoverReadOnlyRemount(ctx, &v, mp.Device)
+}
+
+// recoverReadOnlyRemount unmounts the staging path of an unpublished volume remounted read-only, repairs the
+// filesystem and mounts it again. The repair is refused if the device is still in use after the unmount, and the
+// filesystem is mounted read-only again if it was not repaired.
+func (d *Driver) recoverReadOnlyRemount(ctx context.Context, v *stagedVolume, device string) {
+	logger := klog.FromContext(ctx).WithValues("volumeID", v.volumeID, "stagingTargetPath", v.stagingPath, "device", device)
+	recordEvent := func(eventType, messageFmt string, args ...interface{}) {
+		d.recordAttachEvent(ctx, v.volumeID, types.NodeName(d.NodeID), v.volumeContext, eventType, eventReasonReadOnlyRemountRecovery,
+			"recovery of read-only %s filesystem on %s of node %s: "+messageFmt, append([]interface{}{v.fstype, device, d.NodeID}, args...)...)
+	}
+	// keep the data readable until the filesystem is repaired
+	readOnlyOptions := append(slices.Clone(v.mountOptions), "ro")
+
+	logger.V(2).Info("recovering read-only volume")
+	if err := d.mounter.Unmount(v.stagingPath); err != nil {
+		logger.Error(err, "failed to unmount the volume")
+		recordEvent(v1.EventTypeWarning, "could not unmount %s: %v", v.stagingPath, err)
+		return
+	}
+	// a repair of a filesystem which is mounted elsewhere corrupts it, the device must not be held by anyone
+	if inUse, err := isDeviceInUse(device); err != nil || inUse {
+		reason := "device is still in use"
+		if err != nil {
+			reason = err.Error()
+		}
+		logger.Info("refusing to repair the filesystem", "reason", reason)
+		if err := d.mounter.Mount(device, v.stagingPath, v.fstype, readOnlyOptions); err != nil {
+			logger.Error(err, "failed to mount the volume again")
+			recordEvent(v1.EventTypeWarning, "could not mount %s at %s again: %v", device, v.stagingPath, err)
+			return
+		}
+		recordEvent(v1.EventTypeWarning, "did not repair the filesystem (%s), mounted it read-only again", reason)
+		return
+	}
+
+	result := d.fsck(ctx, v.volumeID, device, v.fstype, consts.FsckPolicyRepair, "filesystem was remounted read-only", v.volumeContext)
+	repaired := result == fsckResultClean || result == fsckResultRepaired
+	options := v.mountOptions
+	if !repaired {
+		options = readOnlyOptions
+	}
+	if err := d.mounter.Mount(device, v.stagingPath, v.fstype, options); err != nil {
+		logger.Error(err, "failed to mount the volume again")
+		recordEvent(v1.EventTypeWarning, "could not mount %s at %s again: %v", device, v.stagingPath, err)
+		return
+	}
+	if !repaired {
+		recordEvent(v1.EventTypeWarning, "filesystem could not be repaired (%s), mounted it read-only again", result)
+		return
+	}
+	logger.V(2).Info("recovered read-only volume", "fsckResult", result)
+	d.stagedVolumes.update(v.volumeID, func(v *stagedVolume) {
+		v.abnormal = ""
+		v.recoveryAttempted = false
+	})
+	recordEvent(v1.EventTypeNormal, "filesystem is %s, mounted it read-write again", result)
+}
+
+// restoreStagedVolumes rebuilds the staged volumes from the mount points of the node after a restart of the node
+// plugin. The staging and publish paths of the driver are recognized by the volume data kubelet writes next to them,
+// and the volume context is read from the PV. Staging paths which are mounted read-only are skipped, since they may
+// have been staged read-only. It runs while the node plugin serves requests, so the mount points are read again
+// with each volume locked, and volumes staged by NodeStageVolume in the meantime are kept.
+func (d *Driver) restoreStagedVolumes(ctx context.Context) {
+	mountPoints, err := d.mounter.List()
+	if err != nil {
+		klog.Errorf("failed to list mount points to restore the staged volumes: %v", err)
+		return
+	}
+	staged, _, pvNames := d.findStagedVolumes(mountPoints)
+
+	volumeContexts := map[string]map[string]string{}
+	for volumeID := range staged {
+		volumeContext := map[string]string{}
+		if pvName := pvNames[volumeID]; pvName != "" {
+			volumeContext[consts.PvNameKey] = pvName
+		}
+		volumeContext = d.getLatestVolumeContext(ctx, volumeContext)
+		if pvName := pvNames[volumeID]; pvName != "" {
+			volumeContext[consts.PvNameKey] = pvName
+		}
+		volumeContexts[volumeID] = volumeContext
+	}
+
+	restored := 0
+	for _, volumeID := range slices.Sorted(maps.Keys(staged)) {
+		if d.restoreStagedVolume(ctx, volumeID, volumeContexts[volumeID]) {
+			restored++
+		}
+	}
+	klog.V(2).Infof("restored %d staged volumes from the mount points", restored)
+}
+
+// restoreStagedVolume adds the staged volume volumeID with the volume context if it is still staged, it holds
+// the locks of the volume only while it is restored so that a busy volume does not delay the node operations
+// on the other volumes
+func (d *Driver) restoreStagedVolume(ctx context.Context, volumeID string, volumeContext map[string]string) bool {
+	// a node operation started after the restart finishes first
+	if err := wait.PollUntilContextTimeout(ctx, restoreVolumeLockInterval, restoreVolumeLockTimeout, true, func(context.Context) (bool, error) {
+		return d.volumeLocks.TryAcquire(volumeID), nil
+	}); err != nil {
+		klog.Warningf("volume %s is busy, not watching it until it is staged again: %v", volumeID, err)
+		return false
+	}
+	defer d.volumeLocks.Release(volumeID)
+	// NodePublishVolume does not take the volume lock, it waits until the publish paths are restored
+	d.stagingPathLocks.LockKey(volumeID)
+	defer func() { _ = d.stagingPathLocks.UnlockKey(volumeID) }()
+
+	mountPoints, err := d.mounter.List()
+	if err != nil {
+		klog.Errorf("failed to list mount points to restore staged volume %s: %v", volumeID, err)
+		return false
+	}
+	staged, publishPaths, _ := d.findStagedVolumes(mountPoints)
+	v, ok := staged[volumeID]
+	if !ok {
+		// unstaged since the mount points were listed
+		return false
+	}
+	v.volumeContext = volumeContext
+	if v.recovery, err = azureutils.GetReadOnlyRemountRecovery(v.volumeContext); err != nil {
+		klog.Warningf("volume %s: %v, recovery is disabled", volumeID, err)
+	}
+	v.publishPaths = publishPaths[volumeID]
+	return d.stagedVolumes.addIfAbsent(v)
+}
+
+// findStagedVolumes returns the read-write staged volumes of the driver in the mount points, the publish paths
+// and the PV names by volume ID
+func (d *Driver) findStagedVolumes(mountPoints []mount.MountPoint) (map[string]*stagedVolume, map[string]map[string]bool, map[string]string) {
+	staged := map[string]*stagedVolume{}
+	publishPaths := map[string]map[string]bool{}
+	pvNames := map[string]string{}
+	for _, mp := range mountPoints {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(mp.Path), kubeletVolumeDataFile))
+		if err != nil {
+			continue
+		}
+		volumeData := kubeletVolumeData{}
+		if err := json.Unmarshal(data, &volumeData); err != nil || volumeData.DriverName != d.Name || volumeData.VolumeHandle == "" {
+			continue
+		}
+		volumeID := volumeData.VolumeHandle
+		switch filepath.Base(mp.Path) {
+		case kubeletStagingDirName:
+			if slices.Contains(mp.Opts, "ro") {
+				klog.V(2).Infof("staging path %s of volume %s is mounted read-only, not watching it", mp.Path, volumeID)
+				continue
+			}
+			staged[volumeID] = &stagedVolume{
+				volumeID:    volumeID,
+				stagingPath: mp.Path,
+				fstype:      mp.Type,
+				mountOptions: slices.DeleteFunc(slices.Clone(mp.Opts), func(opt string) bool {
+					// rw is the default and seclabel only reports the SELinux support of the filesystem
+					return opt == "rw" || opt == "seclabel"
+				}),
+			}
+		case kubeletPublishDirName:
+			if publishPaths[volumeID] == nil {
+				publishPaths[volumeID] = map[string]bool{}
+			}
+			publishPaths[volumeID][mp.Path] = slices.Contains(mp.Opts, "ro")
+			if volumeData.SpecVolID != "" {
+				pvNames[volumeID] = volumeData.SpecVolID
+			}
+		}
+	}
+	return staged, publishPaths, pvNames
+}
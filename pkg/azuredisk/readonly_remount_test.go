@@ -0,0 +1,369 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/mount-utils"
+	testingexec "k8s.io/utils/exec/testing"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+func TestStagedVolumeTable(t *testing.T) {
+	table := &stagedVolumeTable{}
+	table.publish("vol_1", "/pod/1", false)
+	assert.Nil(t, table.condition("vol_1"))
+
+	table.add(&stagedVolume{volumeID: "vol_1", stagingPath: "/staging"})
+	table.publish("vol_1", "/pod/1", false)
+	table.publish("vol_1", "/pod/2", true)
+	table.unpublish("vol_1", "/pod/1")
+	v, ok := table.get("vol_1")
+	require.True(t, ok)
+	assert.Equal(t, map[string]bool{"/pod/2": true}, v.publishPaths)
+	assert.Equal(t, &csi.VolumeCondition{Message: "volume is healthy"}, table.condition("vol_1"))
+
+	table.update("vol_1", func(v *stagedVolume) { v.abnormal = "read-only" })
+	assert.Equal(t, &csi.VolumeCondition{Abnormal: true, Message: "read-only"}, table.condition("vol_1"))
+	assert.Equal(t, []string{"vol_1"}, table.volumeIDs())
+
+	// a volume staged by NodeStageVolume is not replaced by the restored one
+	assert.False(t, table.addIfAbsent(&stagedVolume{volumeID: "vol_1", stagingPath: "/restored"}))
+	v, _ = table.get("vol_1")
+	assert.Equal(t, "/staging", v.stagingPath)
+	assert.True(t, table.addIfAbsent(&stagedVolume{volumeID: "vol_2", stagingPath: "/restored"}))
+	assert.Equal(t, []string{"vol_1", "vol_2"}, table.volumeIDs())
+
+	table.remove("vol_1")
+	assert.Nil(t, table.condition("vol_1"))
+}
+
+func TestCheckReadOnlyRemounts(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	fsckAction := func(exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte{}, []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte{}, []byte{}, nil
+		}
+	}
+
+	tests := []struct {
+		desc             string
+		roOpts           []string
+		recovery         bool
+		locked           bool
+		published        bool
+		deviceInUse      bool
+		unmountErrPath   string
+		outputScripts    []testingexec.FakeAction
+		expectedEvents   []string
+		expectedUnmounts []string
+		expectedAbnormal bool
+	}{
+		{
+			desc:   "mounted read-write",
+			roOpts: []string{"rw", "relatime"},
+		},
+		{
+			desc:             "remounted read-only",
+			roOpts:           []string{"ro", "relatime"},
+			expectedEvents:   []string{"Warning ReadOnlyRemount ext4 filesystem on /dev/sdc of node fakeNodeID was remounted read-only"},
+			expectedAbnormal: true,
+		},
+		{
+			desc:   "node operation in progress",
+			roOpts: []string{"ro", "relatime"},
+			locked: true,
+		},
+		{
+			desc:      "published volume",
+			roOpts:    []string{"ro", "relatime"},
+			recovery:  true,
+			published: true,
+			expectedEvents: []string{
+				"Warning ReadOnlyRemount ext4 filesystem on /dev/sdc of node fakeNodeID was remounted read-only",
+			},
+			expectedAbnormal: true,
+		},
+		{
+			desc:          "recovered",
+			roOpts:        []string{"ro", "relatime"},
+			recovery:      true,
+			outputScripts: []testingexec.FakeAction{fsckAction(1)},
+			expectedEvents: []string{
+				"Warning ReadOnlyRemount ext4 filesystem on /dev/sdc of node fakeNodeID was remounted read-only",
+				"Normal FilesystemChecked fsck (repair) of ext4 filesystem on /dev/sdc of node fakeNodeID since filesystem was remounted read-only: repaired",
+				"Normal ReadOnlyRemountRecovery recovery of read-only ext4 filesystem on /dev/sdc of node fakeNodeID: filesystem is repaired, mounted it read-write again",
+			},
+			expectedUnmounts: []string{"/staging"},
+		},
+		{
+			desc:          "not repaired",
+			roOpts:        []string{"ro", "relatime"},
+			recovery:      true,
+			outputScripts: []testingexec.FakeAction{fsckAction(4)},
+			expectedEvents: []string{
+				"Warning ReadOnlyRemount ext4 filesystem on /dev/sdc of node fakeNodeID was remounted read-only",
+				"Warning FilesystemChecked fsck (repair) of ext4 filesystem on /dev/sdc of node fakeNodeID since filesystem was remounted read-only: errors",
+				"Warning ReadOnlyRemountRecovery recovery of read-only ext4 filesystem on /dev/sdc of node fakeNodeID: filesystem could not be repaired (errors), mounted it read-only again",
+			},
+			expectedUnmounts: []string{"/staging"},
+			expectedAbnormal: true,
+		},
+		{
+			desc:           "volume busy",
+			roOpts:         []string{"ro", "relatime"},
+			recovery:       true,
+			unmountErrPath: "/staging",
+			expectedEvents: []string{
+				"Warning ReadOnlyRemount ext4 filesystem on /dev/sdc of node fakeNodeID was remounted read-only",
+				"Warning ReadOnlyRemountRecovery recovery of read-only ext4 filesystem on /dev/sdc of node fakeNodeID: could not unmount /staging: target is busy",
+			},
+			expectedAbnormal: true,
+		},
+		{
+			desc:        "device in use",
+			roOpts:      []string{"ro", "relatime"},
+			recovery:    true,
+			deviceInUse: true,
+			expectedEvents: []string{
+				"Warning ReadOnlyRemount ext4 filesystem on /dev/sdc of node fakeNodeID was remounted read-only",
+				"Warning ReadOnlyRemountRecovery recovery of read-only ext4 filesystem on /dev/sdc of node fakeNodeID: did not repair the filesystem (device is still in use), mounted it read-only again",
+			},
+			expectedUnmounts: []string{"/staging"},
+			expectedAbnormal: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			m, err := mounter.NewFakeSafeMounter()
+			require.NoError(t, err)
+			fakeMounter := m.Interface.(*mounter.FakeSafeMounter)
+			fakeMounter.MountPoints = []mount.MountPoint{
+				{Device: "/dev/sdc", Path: "/staging", Type: "ext4", Opts: test.roOpts},
+				{Device: "/dev/sdc", Path: "/pod/1", Type: "ext4", Opts: test.roOpts},
+				{Device: "/dev/sdc", Path: "/pod/2", Type: "ext4", Opts: test.roOpts},
+			}
+			fakeMounter.UnmountFunc = func(path string) error {
+				if path == test.unmountErrPath {
+					return fmt.Errorf("target is busy")
+				}
+				return nil
+			}
+			d.setMounter(m)
+			d.setNextCommandOutputScripts(test.outputScripts...)
+			recorder := record.NewFakeRecorder(10)
+			d.eventRecorder = recorder
+			d.stagedVolumes = stagedVolumeTable{}
+			d.stagedVolumes.add(&stagedVolume{
+				volumeID:      "vol_1",
+				stagingPath:   "/staging",
+				fstype:        "ext4",
+				volumeContext: map[string]string{consts.PvNameKey: "pv-1"},
+				recovery:      test.recovery,
+			})
+			if test.published {
+				d.stagedVolumes.publish("vol_1", "/pod/1", false)
+				d.stagedVolumes.publish("vol_1", "/pod/2", false)
+			}
+			isDeviceInUse = func(string) (bool, error) { return test.deviceInUse, nil }
+			defer func() { isDeviceInUse = deviceInUse }()
+			if test.locked {
+				d.volumeLocks.TryAcquire("vol_1")
+				defer d.volumeLocks.Release("vol_1")
+			}
+
+			// the recovery is attempted once and the event is recorded once
+			d.checkReadOnlyRemounts(context.Background())
+			d.checkReadOnlyRemounts(context.Background())
+
+			require.Len(t, recorder.Events, len(test.expectedEvents))
+			for _, expected := range test.expectedEvents {
+				assert.Contains(t, <-recorder.Events, expected)
+			}
+			var unmounts []string
+			for _, action := range fakeMounter.GetLog() {
+				if action.Action == mount.FakeActionUnmount {
+					unmounts = append(unmounts, action.Target)
+				}
+			}
+			assert.Equal(t, test.expectedUnmounts, unmounts)
+			assert.Equal(t, test.expectedAbnormal, d.stagedVolumes.condition("vol_1").Abnormal)
+		})
+	}
+}
+
+func TestRestoreStagedVolumes(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	dir := t.TempDir()
+	volumePath := func(path, volumeData string) string {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(path, 0750))
+		if volumeData != "" {
+			require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), kubeletVolumeDataFile), []byte(volumeData), 0600))
+		}
+		return path
+	}
+	staging1 := volumePath("plugins/1/globalmount", `{"driverName":"disk.csi.azure.com","volumeHandle":"vol_1"}`)
+	staging2 := volumePath("plugins/2/globalmount", `{"driverName":"disk.csi.azure.com","volumeHandle":"vol_2"}`)
+	staging3 := volumePath("plugins/3/globalmount", `{"driverName":"file.csi.azure.com","volumeHandle":"vol_3"}`)
+	staging4 := volumePath("plugins/4/globalmount", `{"driverName":"disk.csi.azure.com","volumeHandle":"vol_4"}`)
+	publish1 := volumePath("pods/1/volumes/kubernetes.io~csi/pv-1/mount", `{"driverName":"disk.csi.azure.com","volumeHandle":"vol_1","specVolID":"pv-1"}`)
+	other := volumePath("other", "")
+
+	m, err := mounter.NewFakeSafeMounter()
+	require.NoError(t, err)
+	m.Interface.(*mounter.FakeSafeMounter).MountPoints = []mount.MountPoint{
+		{Device: "/dev/sdc", Path: staging1, Type: "ext4", Opts: []string{"rw", "seclabel", "relatime"}},
+		{Device: "/dev/sdc", Path: publish1, Type: "ext4", Opts: []string{"rw", "seclabel", "relatime"}},
+		{Device: "/dev/sdd", Path: staging2, Type: "ext4", Opts: []string{"ro", "relatime"}},
+		{Device: "/dev/sde", Path: staging3, Type: "ext4", Opts: []string{"rw"}},
+		{Device: "/dev/sdg", Path: staging4, Type: "xfs", Opts: []string{"rw"}},
+		{Device: "/dev/sdf", Path: other, Type: "xfs", Opts: []string{"rw"}},
+	}
+	d.setMounter(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startFakePVInformer(ctx, t, &d.Driver, &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{
+				Driver:           "disk.csi.azure.com",
+				VolumeHandle:     "vol_1",
+				VolumeAttributes: map[string]string{consts.ReadOnlyRemountRecoveryField: "true"},
+			}},
+		},
+	})
+	d.stagedVolumes = stagedVolumeTable{}
+	// volumes with a node operation in progress are restored once it finished
+	require.True(t, d.volumeLocks.TryAcquire("vol_1"))
+	time.AfterFunc(3*restoreVolumeLockInterval, func() { d.volumeLocks.Release("vol_1") })
+	// the volumes are locked one at a time, vol_1 is restored and unlocked while vol_4 is busy
+	require.True(t, d.volumeLocks.TryAcquire("vol_4"))
+	restoredWhileBusy := make(chan bool, 1)
+	time.AfterFunc(6*restoreVolumeLockInterval, func() {
+		_, restored := d.stagedVolumes.get("vol_1")
+		unlocked := d.volumeLocks.TryAcquire("vol_1")
+		if unlocked {
+			d.volumeLocks.Release("vol_1")
+		}
+		restoredWhileBusy <- restored && unlocked
+		d.volumeLocks.Release("vol_4")
+	})
+
+	d.restoreStagedVolumes(ctx)
+
+	assert.True(t, <-restoredWhileBusy)
+	assert.Equal(t, []string{"vol_1", "vol_4"}, d.stagedVolumes.volumeIDs())
+	v, ok := d.stagedVolumes.get("vol_1")
+	require.True(t, ok)
+	assert.Equal(t, staging1, v.stagingPath)
+	assert.Equal(t, "ext4", v.fstype)
+	assert.Equal(t, []string{"relatime"}, v.mountOptions)
+	assert.True(t, v.recovery)
+	assert.Equal(t, "pv-1", v.volumeContext[consts.PvNameKey])
+	assert.Equal(t, map[string]bool{publish1: false}, v.publishPaths)
+}
+
+func TestNodePublishVolumeWaitsForRecovery(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+	m, err := mounter.NewFakeSafeMounter()
+	require.NoError(t, err)
+	d.setMounter(m)
+	d.stagedVolumes = stagedVolumeTable{}
+	staging := filepath.Join(t.TempDir(), "globalmount")
+	require.NoError(t, os.MkdirAll(staging, 0750))
+	d.stagedVolumes.add(&stagedVolume{volumeID: "vol_1", stagingPath: staging, fstype: "ext4"})
+
+	publish := func(target string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol_1",
+				StagingTargetPath: staging,
+				TargetPath:        target,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER},
+				},
+			})
+			done <- err
+		}()
+		return done
+	}
+
+	// concurrent publishes and node operations holding the volume lock do not abort a publish
+	require.True(t, d.volumeLocks.TryAcquire("vol_1"))
+	defer d.volumeLocks.Release("vol_1")
+	first, second := publish(filepath.Join(t.TempDir(), "mount")), publish(filepath.Join(t.TempDir(), "mount"))
+	require.NoError(t, <-first)
+	require.NoError(t, <-second)
+
+	// a publish waits while the recovery holds the staging path
+	d.stagingPathLocks.LockKey("vol_1")
+	target := filepath.Join(t.TempDir(), "mount")
+	done := publish(target)
+	select {
+	case err := <-done:
+		t.Fatalf("NodePublishVolume returned %v during the recovery", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, d.stagingPathLocks.UnlockKey("vol_1"))
+	require.NoError(t, <-done)
+	v, ok := d.stagedVolumes.get("vol_1")
+	require.True(t, ok)
+	assert.Len(t, v.publishPaths, 3)
+	assert.Contains(t, v.publishPaths, target)
+}
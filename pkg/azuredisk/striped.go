@@ -0,0 +1,584 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+	"k8s.io/utils/ptr"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	csicommon "sigs.k8s.io/azuredisk-csi-driver/pkg/csi-common"
+	volumehelper "sigs.k8s.io/azuredisk-csi-driver/pkg/util"
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+const (
+	// stripeMemberSeparator separates the members in the ID of a striped volume or snapshot,
+	// it is not a valid character of Azure resource names
+	stripeMemberSeparator = ","
+	// stripeMemberSuffix is appended to the name of a striped volume or snapshot with the index of the member
+	stripeMemberSuffix = "-stripe"
+	// stripeMemberNameMaxLength is the maximum length of a managed disk or snapshot name
+	stripeMemberNameMaxLength = 80
+	// stripeVGPrefix is the prefix of the LVM volume groups assembled by the driver from the members of a striped volume
+	stripeVGPrefix = "azuredisk_stripe_"
+	// stripeLVName is the name of the striped logical volume in the volume group
+	stripeLVName = "stripe"
+	// stripeSize is the amount of data written to a member before moving to the next one
+	stripeSize = "64k"
+	// lvmSignature is the signature blkid reports for an LVM physical volume
+	lvmSignature = "LVM2_member"
+	// vgsExitNotFound is the exit code of vgs if a volume group is not found
+	vgsExitNotFound = 5
+)
+
+// stripedVolumeIDKey is the context key of the ID of the striped volume a member is published for
+type stripedVolumeIDKey struct{}
+
+// withStripedVolumeID returns a context of the publish of a member of the striped volume volumeID
+func withStripedVolumeID(ctx context.Context, volumeID string) context.Context {
+	return context.WithValue(ctx, stripedVolumeIDKey{}, volumeID)
+}
+
+// getAttachVolumeHandle returns the volume handle kubernetes attaches for diskURI: the striped volume
+// if diskURI is published as one of its members, otherwise diskURI
+func getAttachVolumeHandle(ctx context.Context, diskURI string) string {
+	if volumeID, ok := ctx.Value(stripedVolumeIDKey{}).(string); ok {
+		return volumeID
+	}
+	return diskURI
+}
+
+// getStripeMemberName returns the name of member i of a striped volume or snapshot, the first member keeps the name
+func getStripeMemberName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	suffix := fmt.Sprintf("%s%d", stripeMemberSuffix, i)
+	if len(name)+len(suffix) > stripeMemberNameMaxLength {
+		name = name[:stripeMemberNameMaxLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// joinStripedID returns the ID of a striped volume or snapshot: the resource ID of the first member
+// followed by the names of the other members, which are in the same resource group
+func joinStripedID(memberIDs []string) string {
+	parts := []string{memberIDs[0]}
+	for _, id := range memberIDs[1:] {
+		parts = append(parts, path.Base(id))
+	}
+	return strings.Join(parts, stripeMemberSeparator)
+}
+
+// splitStripedID returns the resource IDs of the members of a striped volume or snapshot,
+// or the ID itself if it is not striped
+func splitStripedID(id string) []string {
+	parts := strings.Split(id, stripeMemberSeparator)
+	dir := path.Dir(parts[0])
+	for i := 1; i < len(parts); i++ {
+		parts[i] = dir + "/" + parts[i]
+	}
+	return parts
+}
+
+// getStripeMemberGiB returns the size of each member of a striped volume of sizeGiB
+func getStripeMemberGiB(sizeGiB int64, members int) int64 {
+	return (sizeGiB + int64(members) - 1) / int64(members)
+}
+
+// isRetriableStripeError reports whether the creation of a member of a striped volume failed for a reason
+// a retry of CreateVolume may overcome: the request timed out or Azure throttled or failed the request
+func isRetriableStripeError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && (respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode >= http.StatusInternalServerError)
+}
+
+// deleteStripeMembers deletes the members created by a CreateVolume which failed, so that they are not leaked
+func deleteStripeMembers(ctx context.Context, diskController *ManagedDiskController, memberURIs []string) {
+	logger := klog.FromContext(ctx)
+	for _, uri := range memberURIs {
+		if err := diskController.DeleteManagedDisk(ctx, uri); err != nil {
+			logger.Error(err, "failed to delete member of striped volume", "diskURI", uri)
+			continue
+		}
+		logger.V(2).Info("deleted member of striped volume which failed to be created", "diskURI", uri)
+	}
+}
+
+// deleteStripedVolume deletes all members of a striped volume
+func (d *Driver) deleteStripedVolume(ctx context.Context, req *csi.DeleteVolumeRequest, members []string) (*csi.DeleteVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer d.volumeLocks.Release(volumeID)
+	for _, member := range members {
+		if _, err := d.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: member, Secrets: req.GetSecrets()}); err != nil {
+			return nil, err
+		}
+	}
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// modifyStripedVolume modifies all members of a striped volume
+func (d *Driver) modifyStripedVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest, members []string) (*csi.ControllerModifyVolumeResponse, error) {
+	for _, member := range members {
+		if _, err := d.ControllerModifyVolume(ctx, &csi.ControllerModifyVolumeRequest{
+			VolumeId:          member,
+			Secrets:           req.GetSecrets(),
+			MutableParameters: req.GetMutableParameters(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+// publishStripedVolume attaches all members of a striped volume to the node. The members are attached
+// concurrently so that they are batched into the same VM update. The publish context is the one of the
+// first member with the LUNs, sizes and unique IDs of all members in order.
+func (d *Driver) publishStripedVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest, members []string) (*csi.ControllerPublishVolumeResponse, error) {
+	nodeID := req.GetNodeId()
+	if len(nodeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Node ID not provided")
+	}
+	nodeName := types.NodeName(nodeID)
+	disks, _, err := d.diskController.GetNodeDataDisks(ctx, nodeName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not get the data disks of node %s: %v", nodeName, err)
+	}
+	// the data disks are matched by name or ID like GetDiskLun does
+	attached := map[string]bool{}
+	for _, disk := range disks {
+		if ptr.Deref(disk.ToBeDetached, false) {
+			continue
+		}
+		if disk.Name != nil {
+			attached[strings.ToLower(*disk.Name)] = true
+		}
+		if disk.ManagedDisk != nil && disk.ManagedDisk.ID != nil {
+			attached[strings.ToLower(*disk.ManagedDisk.ID)] = true
+		}
+	}
+	isAttached := func(member string) bool {
+		return attached[strings.ToLower(member)] || attached[strings.ToLower(path.Base(member))]
+	}
+	var missing []string
+	for _, member := range members {
+		if !isAttached(member) {
+			missing = append(missing, member)
+		}
+	}
+	// every member takes a LUN while the scheduler counts the volume once against the max volumes per node
+	if free := d.getFreeDataDiskSlots(ctx, nodeID, len(disks)); free >= 0 && len(missing) > free {
+		return nil, status.Errorf(codes.ResourceExhausted, "node %s has %d free data disk slots, but %d members of striped volume %s are not attached yet",
+			nodeName, free, len(missing), req.GetVolumeId())
+	}
+
+	// the attach of a member is not canceled if another one fails, so that the attached members are known
+	responses := make([]*csi.ControllerPublishVolumeResponse, len(members))
+	memberCtx := withStripedVolumeID(ctx, req.GetVolumeId())
+	var g errgroup.Group
+	for i, member := range members {
+		g.Go(func() error {
+			resp, err := d.ControllerPublishVolume(memberCtx, &csi.ControllerPublishVolumeRequest{
+				VolumeId:         member,
+				NodeId:           nodeID,
+				VolumeCapability: req.GetVolumeCapability(),
+				Readonly:         req.GetReadonly(),
+				Secrets:          req.GetSecrets(),
+				VolumeContext:    req.GetVolumeContext(),
+			})
+			responses[i] = resp
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		// detach the members attached by this call, a member which failed may still have taken a LUN
+		// and is left to ControllerUnpublishVolume of the volume
+		var rollback []string
+		for i, member := range members {
+			if responses[i] != nil && !isAttached(member) {
+				rollback = append(rollback, member)
+			}
+		}
+		if len(rollback) > 0 {
+			if _, uerr := d.unpublishStripedVolume(ctx, &csi.ControllerUnpublishVolumeRequest{NodeId: nodeID, Secrets: req.GetSecrets()}, rollback); uerr != nil {
+				klog.FromContext(ctx).Error(uerr, "failed to detach the attached members of striped volume", "volumeID", req.GetVolumeId(), "node", nodeName)
+			}
+		}
+		return nil, err
+	}
+
+	luns := make([]string, len(members))
+	sizes := make([]string, len(members))
+	uniqueIDs := make([]string, len(members))
+	for i, resp := range responses {
+		luns[i] = resp.GetPublishContext()[consts.LUN]
+		sizes[i] = resp.GetPublishContext()[consts.DiskSizeBytesField]
+		uniqueIDs[i] = resp.GetPublishContext()[consts.DiskUniqueIDField]
+	}
+	publishContext := responses[0].GetPublishContext()
+	publishContext[consts.StripeLUNs] = strings.Join(luns, ",")
+	publishContext[consts.StripeDiskSizeBytes] = strings.Join(sizes, ",")
+	publishContext[consts.StripeDiskUniqueIDs] = strings.Join(uniqueIDs, ",")
+	return &csi.ControllerPublishVolumeResponse{PublishContext: publishContext}, nil
+}
+
+// getFreeDataDiskSlots returns the number of data disks which can still be attached to the node: the
+// allocatable count the node plugin reported in its CSINode minus the data disks of the VM, or -1 if unknown
+func (d *Driver) getFreeDataDiskSlots(ctx context.Context, nodeName string, dataDisks int) int {
+	if d.kubeClient == nil {
+		return -1
+	}
+	csiNode, err := d.kubeClient.StorageV1().CSINodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		csicommon.LogWarning(ctx, "failed to get CSINode, the free data disk slots of the node are not checked", "node", nodeName, "err", err)
+		return -1
+	}
+	for _, driver := range csiNode.Spec.Drivers {
+		if driver.Name == d.Name && driver.Allocatable != nil && driver.Allocatable.Count != nil {
+			return max(int(*driver.Allocatable.Count)-dataDisks, 0)
+		}
+	}
+	return -1
+}
+
+// unpublishStripedVolume detaches all members of a striped volume from the node, concurrently like they are attached.
+// The detach of a member is not canceled if another one fails, so that no member is left holding a LUN.
+func (d *Driver) unpublishStripedVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest, members []string) (*csi.ControllerUnpublishVolumeResponse, error) {
+	errs := make([]error, len(members))
+	var g errgroup.Group
+	for i, member := range members {
+		g.Go(func() error {
+			_, errs[i] = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+				VolumeId: member,
+				NodeId:   req.GetNodeId(),
+				Secrets:  req.GetSecrets(),
+			})
+			return nil
+		})
+	}
+	_ = g.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not detach all members of striped volume %s: %v", req.GetVolumeId(), err)
+	}
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
+}
+
+// expandStripedVolume grows all members of a striped volume to an equal share of the requested size. A member
+// which already has the size is not resized again, so a retry after a failure grows the remaining members, and
+// the expansion only succeeds once all members have the size.
+func (d *Driver) expandStripedVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest, members []string) (*csi.ControllerExpandVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer d.volumeLocks.Release(volumeID)
+
+	memberGiB := getStripeMemberGiB(volumehelper.RoundUpGiB(req.GetCapacityRange().GetRequiredBytes()), len(members))
+	for _, member := range members {
+		if _, err := d.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{
+			VolumeId:         member,
+			CapacityRange:    &csi.CapacityRange{RequiredBytes: volumehelper.GiBToBytes(memberGiB)},
+			Secrets:          req.GetSecrets(),
+			VolumeCapability: req.GetVolumeCapability(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// the striped logical volume only spans the size of the smallest member on every member
+	smallestGiB := int64(-1)
+	for _, member := range members {
+		disk, err := d.diskController.GetDiskByURI(ctx, member)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "GetDiskByURI(%s) failed with error(%v)", member, err)
+		}
+		if disk == nil || disk.Properties == nil || disk.Properties.DiskSizeGB == nil {
+			return nil, status.Errorf(codes.Internal, "could not get size of the disk(%s)", member)
+		}
+		sizeGiB := int64(*disk.Properties.DiskSizeGB)
+		if sizeGiB < memberGiB {
+			return nil, status.Errorf(codes.Internal, "member %s of striped volume %s has %d GiB after the resize, expected %d GiB", member, volumeID, sizeGiB, memberGiB)
+		}
+		if smallestGiB < 0 || sizeGiB < smallestGiB {
+			smallestGiB = sizeGiB
+		}
+	}
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         volumehelper.GiBToBytes(smallestGiB * int64(len(members))),
+		NodeExpansionRequired: true,
+	}, nil
+}
+
+// createStripedSnapshot snapshots all members of a striped volume one after the other. The snapshots are
+// not taken at the same point in time, the workload has to be quiesced for a consistent snapshot.
+func (d *Driver) createStripedSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest, members []string) (*csi.CreateSnapshotResponse, error) {
+	name := azureutils.CreateValidDiskName(req.GetName())
+	snapshot := &csi.Snapshot{
+		SourceVolumeId: req.GetSourceVolumeId(),
+		ReadyToUse:     true,
+	}
+	snapshotIDs := make([]string, len(members))
+	for i, member := range members {
+		resp, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+			SourceVolumeId: member,
+			Name:           getStripeMemberName(name, i),
+			Secrets:        req.GetSecrets(),
+			Parameters:     req.GetParameters(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		memberSnapshot := resp.GetSnapshot()
+		snapshotIDs[i] = memberSnapshot.GetSnapshotId()
+		snapshot.SizeBytes += memberSnapshot.GetSizeBytes()
+		snapshot.ReadyToUse = snapshot.ReadyToUse && memberSnapshot.GetReadyToUse()
+		if snapshot.CreationTime == nil || memberSnapshot.GetCreationTime().AsTime().After(snapshot.CreationTime.AsTime()) {
+			snapshot.CreationTime = memberSnapshot.GetCreationTime()
+		}
+	}
+	snapshot.SnapshotId = joinStripedID(snapshotIDs)
+	return &csi.CreateSnapshotResponse{Snapshot: snapshot}, nil
+}
+
+// deleteStripedSnapshot deletes the snapshots of all members of a striped volume
+func (d *Driver) deleteStripedSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest, members []string) (*csi.DeleteSnapshotResponse, error) {
+	for _, member := range members {
+		if _, err := d.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: member, Secrets: req.GetSecrets()}); err != nil {
+			return nil, err
+		}
+	}
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// validateStripeSource checks that the snapshot or volume a volume is created from has one member per stripe
+func validateStripeSource(sourceID string, stripeCount int) error {
+	if sourceID == "" {
+		return nil
+	}
+	if members := len(splitStripedID(sourceID)); members != stripeCount {
+		return status.Errorf(codes.InvalidArgument, "source %s has %d stripes, but %s is %d", sourceID, members, consts.StripeCountField, stripeCount)
+	}
+	return nil
+}
+
+// getStripeVGName returns the name of the LVM volume group of the striped volume volumeID, which is stable
+// across NodeStageVolume, NodeExpandVolume and NodeUnstageVolume
+func getStripeVGName(volumeID string) string {
+	return fmt.Sprintf("%s%x", stripeVGPrefix, sha256.Sum256([]byte(volumeID)))[:len(stripeVGPrefix)+32]
+}
+
+// getStripeMapperPath returns the device-mapper path of the striped logical volume in the volume group
+func getStripeMapperPath(vgName string) string {
+	return filepath.Join(devMapperDir, vgName+"-"+stripeLVName)
+}
+
+// parseStripeVGName returns the volume group if devicePath is a striped logical volume assembled by the driver
+func parseStripeVGName(devicePath string) (string, bool) {
+	name := filepath.Base(devicePath)
+	if filepath.Dir(devicePath) != devMapperDir || !strings.HasPrefix(name, stripeVGPrefix) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "-"+stripeLVName), true
+}
+
+// getStripeMemberPublishContexts returns the publish context of each member of a striped volume with its LUN,
+// size and unique ID, the identity is empty if the volume was published by a controller which does not list it
+func getStripeMemberPublishContexts(publishContext map[string]string, members int) ([]map[string]string, error) {
+	luns := strings.Split(publishContext[consts.StripeLUNs], ",")
+	if len(luns) != members {
+		return nil, fmt.Errorf("%s %q of the publish context does not list the %d members of the volume", consts.StripeLUNs, publishContext[consts.StripeLUNs], members)
+	}
+	memberContexts := make([]map[string]string, members)
+	for i, lun := range luns {
+		if _, err := strconv.Atoi(lun); err != nil {
+			return nil, fmt.Errorf("invalid lun %q in %s: %v", lun, consts.StripeLUNs, err)
+		}
+		memberContexts[i] = map[string]string{consts.LUN: lun}
+	}
+	for _, field := range []struct{ key, memberKey string }{
+		{consts.StripeDiskSizeBytes, consts.DiskSizeBytesField},
+		{consts.StripeDiskUniqueIDs, consts.DiskUniqueIDField},
+	} {
+		value, ok := publishContext[field.key]
+		if !ok {
+			continue
+		}
+		values := strings.Split(value, ",")
+		if len(values) != members {
+			return nil, fmt.Errorf("%s %q of the publish context does not list the %d members of the volume", field.key, value, members)
+		}
+		for i, v := range values {
+			if v != "" {
+				memberContexts[i][field.memberKey] = v
+			}
+		}
+	}
+	return memberContexts, nil
+}
+
+// assembleStripedVolume activates the striped logical volume of volumeID over its member devices, which were
+// verified and tuned by NodeStageVolume, and returns its device-mapper path. The volume group and the logical
+// volume are created if the members are empty, members carrying other data are refused like formatting them.
+func (d *Driver) assembleStripedVolume(ctx context.Context, volumeID string, devices []string, volumeContext map[string]string) (string, error) {
+	vgName := getStripeVGName(volumeID)
+	mapperPath := getStripeMapperPath(vgName)
+	logger := klog.FromContext(ctx).WithValues("volumeGroup", vgName)
+	if _, err := os.Stat(mapperPath); err == nil {
+		// activated by a previous NodeStageVolume
+		logger.V(2).Info("striped volume is already active", "mapperPath", mapperPath)
+		return mapperPath, nil
+	}
+
+	exists, err := d.volumeGroupExists(vgName)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		if output, err := d.mounter.Exec.Command("vgchange", "--activate", "y", vgName).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to activate volume group %s: output: %s, err: %v", vgName, string(output), err)
+		}
+		logger.V(2).Info("activated striped volume", "mapperPath", mapperPath)
+		return mapperPath, nil
+	}
+
+	for _, device := range devices {
+		if err := d.checkPhysicalVolumeSignatures(ctx, volumeID, device, vgName, volumeContext); err != nil {
+			return "", err
+		}
+	}
+	logger.V(2).Info("creating striped volume", "devices", devices)
+	if output, err := d.mounter.Exec.Command("pvcreate", devices...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to create physical volumes on %v: output: %s, err: %v", devices, string(output), err)
+	}
+	if output, err := d.mounter.Exec.Command("vgcreate", append([]string{vgName}, devices...)...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to create volume group %s: output: %s, err: %v", vgName, string(output), err)
+	}
+	if output, err := d.mounter.Exec.Command("lvcreate", "--yes", "--type", "striped", "--stripes", strconv.Itoa(len(devices)),
+		"--stripesize", stripeSize, "--extents", "100%FREE", "--name", stripeLVName, vgName).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to create striped logical volume in %s: output: %s, err: %v", vgName, string(output), err)
+	}
+	logger.V(2).Info("created striped volume", "mapperPath", mapperPath)
+	return mapperPath, nil
+}
+
+// volumeGroupExists returns whether the LVM volume group vgName exists, vgs fails with "not found" if it does not
+func (d *Driver) volumeGroupExists(vgName string) (bool, error) {
+	output, err := d.mounter.Exec.Command("vgs", "--noheadings", vgName).CombinedOutput()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == vgsExitNotFound && strings.Contains(string(output), "not found") {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to list volume group %s: output: %s, err: %v", vgName, string(output), err)
+}
+
+// checkPhysicalVolumeSignatures refuses like checkDiskSignatures to create the volume group vgName on a device
+// carrying data, an LVM physical volume is only accepted if it belongs to no volume group or to vgName,
+// e.g. after a previous attempt to create the volume group failed
+func (d *Driver) checkPhysicalVolumeSignatures(ctx context.Context, diskURI, device, vgName string, volumeContext map[string]string) error {
+	if allowFormatWithExistingData(volumeContext) {
+		return nil
+	}
+
+	signatures, err := getDiskSignatures(device, d.mounter)
+	if err != nil {
+		return err
+	}
+	foreign := getForeignSignatures(signatures, lvmSignature)
+	if len(foreign) < len(signatures) {
+		output, err := d.mounter.Exec.Command("pvs", "--noheadings", "--options", "vg_name", device).Output()
+		if err != nil {
+			return fmt.Errorf("failed to list the volume group of physical volume %s: output: %s, err: %v", device, string(output), err)
+		}
+		if owner := strings.TrimSpace(string(output)); owner != "" && owner != vgName {
+			foreign = append(foreign, fmt.Sprintf("%s of volume group %s", lvmSignature, owner))
+		}
+	}
+	return d.refuseForeignSignatures(ctx, diskURI, device, lvmSignature, foreign, volumeContext)
+}
+
+// deactivateStripedVolume deactivates the volume group of the striped volume volumeID if it is active,
+// so that its members can be detached
+func (d *Driver) deactivateStripedVolume(ctx context.Context, volumeID string) error {
+	vgName := getStripeVGName(volumeID)
+	if _, err := os.Stat(getStripeMapperPath(vgName)); err != nil {
+		return nil
+	}
+	if output, err := d.mounter.Exec.Command("vgchange", "--activate", "n", vgName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to deactivate volume group %s: output: %s, err: %v", vgName, string(output), err)
+	}
+	klog.FromContext(ctx).V(2).Info("deactivated striped volume", "volumeGroup", vgName)
+	return nil
+}
+
+// growStripedVolume grows the physical volumes of the volume group to the new size of the members
+// and the striped logical volume over all of them
+func (d *Driver) growStripedVolume(ctx context.Context, vgName string) error {
+	logger := klog.FromContext(ctx).WithValues("volumeGroup", vgName)
+	output, err := d.mounter.Exec.Command("pvs", "--noheadings", "--options", "pv_name", "--select", "vg_name="+vgName).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list physical volumes of %s: output: %s, err: %v", vgName, string(output), err)
+	}
+	devices := strings.Fields(string(output))
+	for _, device := range devices {
+		if d.enableDiskOnlineResize {
+			if err := rescanVolume(d.ioHandler, device); err != nil {
+				logger.Error(err, "rescanVolume failed", "device", device)
+			}
+		}
+		if output, err := d.mounter.Exec.Command("pvresize", device).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to resize physical volume %s: output: %s, err: %v", device, string(output), err)
+		}
+	}
+	logger.V(2).Info("growing striped volume", "devices", devices)
+	if output, err := d.mounter.Exec.Command("lvextend", "--extents", "100%VG", vgName+"/"+stripeLVName).CombinedOutput(); err != nil {
+		// lvextend fails if the logical volume already spans the volume group
+		if !strings.Contains(string(output), "matches existing size") {
+			return fmt.Errorf("failed to extend striped logical volume in %s: output: %s, err: %v", vgName, string(output), err)
+		}
+	}
+	return nil
+}
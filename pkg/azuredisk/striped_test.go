@@ -0,0 +1,416 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+	"k8s.io/utils/ptr"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+	volumehelper "sigs.k8s.io/azuredisk-csi-driver/pkg/util"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/diskclient/mock_diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	mockvmclient "sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachineclient/mock_virtualmachineclient"
+)
+
+func TestStripedID(t *testing.T) {
+	rg := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/"
+	members := []string{rg + "pvc-1", rg + "pvc-1-stripe1", rg + "pvc-1-stripe2"}
+	id := joinStripedID(members)
+	assert.Equal(t, rg+"pvc-1,pvc-1-stripe1,pvc-1-stripe2", id)
+	assert.Equal(t, members, splitStripedID(id))
+	assert.Equal(t, []string{rg + "pvc-1"}, splitStripedID(rg+"pvc-1"))
+
+	assert.Equal(t, "pvc-1", getStripeMemberName("pvc-1", 0))
+	assert.Equal(t, "pvc-1-stripe3", getStripeMemberName("pvc-1", 3))
+	long := strings.Repeat("a", 80)
+	assert.Equal(t, strings.Repeat("a", 72)+"-stripe1", getStripeMemberName(long, 1))
+
+	assert.Equal(t, int64(3), getStripeMemberGiB(10, 4))
+	assert.Equal(t, int64(4), getStripeMemberGiB(16, 4))
+
+	assert.NoError(t, validateStripeSource("", 2))
+	assert.NoError(t, validateStripeSource(id, 3))
+	assert.Error(t, validateStripeSource(rg+"pvc-1", 3))
+}
+
+func TestGetAttachVolumeHandle(t *testing.T) {
+	member := fmt.Sprintf(consts.ManagedDiskPath, "subs", "rg", "pvc-1-stripe1")
+	assert.Equal(t, member, getAttachVolumeHandle(context.Background(), member))
+	// the events of a member published for a striped volume go to the VolumeAttachment of the striped volume
+	ctx := withStripedVolumeID(context.Background(), "vol_1,pvc-1-stripe1")
+	assert.Equal(t, "vol_1,pvc-1-stripe1", getAttachVolumeHandle(ctx, member))
+}
+
+func TestGetStripeMemberPublishContexts(t *testing.T) {
+	memberContexts, err := getStripeMemberPublishContexts(map[string]string{
+		consts.StripeLUNs:          "1,2",
+		consts.StripeDiskSizeBytes: "1073741824,1073741824",
+		consts.StripeDiskUniqueIDs: "id1,",
+	}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{
+		{consts.LUN: "1", consts.DiskSizeBytesField: "1073741824", consts.DiskUniqueIDField: "id1"},
+		{consts.LUN: "2", consts.DiskSizeBytesField: "1073741824"},
+	}, memberContexts)
+
+	memberContexts, err = getStripeMemberPublishContexts(map[string]string{consts.StripeLUNs: "1,2"}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{consts.LUN: "1"}, {consts.LUN: "2"}}, memberContexts)
+
+	_, err = getStripeMemberPublishContexts(map[string]string{consts.StripeLUNs: "1,2"}, 3)
+	assert.EqualError(t, err, `stripeLUNs "1,2" of the publish context does not list the 3 members of the volume`)
+	_, err = getStripeMemberPublishContexts(map[string]string{consts.StripeLUNs: "1,2", consts.StripeDiskUniqueIDs: "id1"}, 2)
+	assert.EqualError(t, err, `stripeDiskUniqueIDs "id1" of the publish context does not list the 2 members of the volume`)
+	_, err = getStripeMemberPublishContexts(map[string]string{consts.StripeLUNs: "1,x"}, 2)
+	assert.ErrorContains(t, err, `invalid lun "x" in stripeLUNs`)
+}
+
+func TestStripedVolume(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	defer func(dir string) { devMapperDir = dir }(devMapperDir)
+	devMapperDir = t.TempDir()
+	vgName := getStripeVGName("vol_1")
+	mapperPath := getStripeMapperPath(vgName)
+	assert.Len(t, vgName, len(stripeVGPrefix)+32)
+
+	output := func(out string, exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte(out), []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte(out), []byte{}, nil
+		}
+	}
+	var cmds []string
+	setScripts := func(actions ...testingexec.FakeAction) {
+		cmds = nil
+		fakeMounter, err := mounter.NewFakeSafeMounter()
+		require.NoError(t, err)
+		d.setMounter(fakeMounter)
+		fakeExec := fakeMounter.Exec.(*mounter.FakeSafeMounter)
+		for _, action := range actions {
+			fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+				fakeCmd := &testingexec.FakeCmd{}
+				record := func() ([]byte, []byte, error) {
+					cmds = append(cmds, strings.Join(append([]string{cmd}, args...), " "))
+					return action()
+				}
+				fakeCmd.OutputScript = []testingexec.FakeAction{record}
+				fakeCmd.CombinedOutputScript = []testingexec.FakeAction{record}
+				return testingexec.InitFakeCmd(fakeCmd, cmd, args...)
+			})
+		}
+	}
+	devices := []string{"/dev/sdc", "/dev/sdd"}
+
+	vgNotFound := output(fmt.Sprintf("  Volume group \"%s\" not found\n  Cannot process volume group %s\n", vgName, vgName), 5)
+
+	t.Run("create on empty members", func(t *testing.T) {
+		setScripts(vgNotFound, output("", 2), output("", 2), output("", 0), output("", 0), output("", 0))
+		path, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		require.NoError(t, err)
+		assert.Equal(t, mapperPath, path)
+		assert.Equal(t, []string{
+			"vgs --noheadings " + vgName,
+			"blkid -p -o export /dev/sdc",
+			"blkid -p -o export /dev/sdd",
+			"pvcreate /dev/sdc /dev/sdd",
+			"vgcreate " + vgName + " /dev/sdc /dev/sdd",
+			"lvcreate --yes --type striped --stripes 2 --stripesize 64k --extents 100%FREE --name stripe " + vgName,
+		}, cmds)
+	})
+
+	t.Run("create on orphan physical volumes", func(t *testing.T) {
+		setScripts(vgNotFound, output("DEVNAME=/dev/sdc\nTYPE=LVM2_member\n", 0), output("  \n", 0),
+			output("DEVNAME=/dev/sdd\nTYPE=LVM2_member\n", 0), output("  "+vgName+"\n", 0), output("", 0), output("", 0), output("", 0))
+		_, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"vgs --noheadings " + vgName,
+			"blkid -p -o export /dev/sdc",
+			"pvs --noheadings --options vg_name /dev/sdc",
+			"blkid -p -o export /dev/sdd",
+			"pvs --noheadings --options vg_name /dev/sdd",
+			"pvcreate /dev/sdc /dev/sdd",
+			"vgcreate " + vgName + " /dev/sdc /dev/sdd",
+			"lvcreate --yes --type striped --stripes 2 --stripesize 64k --extents 100%FREE --name stripe " + vgName,
+		}, cmds)
+	})
+
+	t.Run("activate existing volume group", func(t *testing.T) {
+		setScripts(output("  "+vgName+"   2   1   0 wz--n- 9.99g 0\n", 0), output("", 0))
+		path, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		require.NoError(t, err)
+		assert.Equal(t, mapperPath, path)
+		assert.Equal(t, []string{"vgs --noheadings " + vgName, "vgchange --activate y " + vgName}, cmds)
+	})
+
+	t.Run("fail to activate existing volume group", func(t *testing.T) {
+		setScripts(output("", 0), output("  Couldn't find device with uuid", 5))
+		_, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		assert.ErrorContains(t, err, "failed to activate volume group "+vgName)
+		assert.Equal(t, []string{"vgs --noheadings " + vgName, "vgchange --activate y " + vgName}, cmds)
+	})
+
+	t.Run("fail to list volume group", func(t *testing.T) {
+		setScripts(output("  /run/lock/lvm/V_"+vgName+": open failed: Permission denied", 5))
+		_, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		assert.ErrorContains(t, err, "failed to list volume group "+vgName)
+		assert.Equal(t, []string{"vgs --noheadings " + vgName}, cmds)
+	})
+
+	t.Run("refuse member with data", func(t *testing.T) {
+		setScripts(vgNotFound, output("DEVNAME=/dev/sdc\nTYPE=ext4\n", 0))
+		_, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		assert.True(t, errors.Is(err, errForeignDataSignature))
+	})
+
+	t.Run("refuse member of another volume group", func(t *testing.T) {
+		setScripts(vgNotFound, output("DEVNAME=/dev/sdc\nTYPE=LVM2_member\n", 0), output("  datavg\n", 0))
+		_, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		assert.True(t, errors.Is(err, errForeignDataSignature))
+		assert.ErrorContains(t, err, "LVM2_member of volume group datavg found on /dev/sdc")
+	})
+
+	t.Run("deactivate inactive volume", func(t *testing.T) {
+		setScripts()
+		assert.NoError(t, d.deactivateStripedVolume(context.Background(), "vol_1"))
+	})
+
+	require.NoError(t, os.WriteFile(mapperPath, nil, 0600))
+
+	t.Run("already active", func(t *testing.T) {
+		setScripts()
+		path, err := d.assembleStripedVolume(context.Background(), "vol_1", devices, nil)
+		require.NoError(t, err)
+		assert.Equal(t, mapperPath, path)
+	})
+
+	t.Run("deactivate", func(t *testing.T) {
+		setScripts(output("", 0))
+		assert.NoError(t, d.deactivateStripedVolume(context.Background(), "vol_1"))
+		assert.Equal(t, []string{"vgchange --activate n " + vgName}, cmds)
+	})
+
+	t.Run("grow", func(t *testing.T) {
+		name, ok := parseStripeVGName(mapperPath)
+		require.True(t, ok)
+		assert.Equal(t, vgName, name)
+		_, ok = parseStripeVGName("/dev/sdc")
+		assert.False(t, ok)
+
+		setScripts(output("  /dev/sdc\n  /dev/sdd\n", 0), output("", 0), output("", 0),
+			output("  New size (2560 extents) matches existing size (2560 extents).", 5))
+		require.NoError(t, d.growStripedVolume(context.Background(), vgName))
+		assert.Equal(t, []string{
+			"pvs --noheadings --options pv_name --select vg_name=" + vgName,
+			"pvresize /dev/sdc",
+			"pvresize /dev/sdd",
+			"lvextend --extents 100%VG " + vgName + "/stripe",
+		}, cmds)
+	})
+}
+
+func TestPublishStripedVolume(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	d, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	nodeName := "node-1"
+	members := []string{
+		fmt.Sprintf(consts.ManagedDiskPath, "subs", "rg", "pvc-1"),
+		fmt.Sprintf(consts.ManagedDiskPath, "subs", "rg", "pvc-1-stripe1"),
+	}
+	req := &csi.ControllerPublishVolumeRequest{
+		VolumeId: joinStripedID(members),
+		NodeId:   nodeName,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		},
+	}
+
+	// the second member does not exist, so its attach fails
+	diskClient := mock_diskclient.NewMockInterface(cntl)
+	d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetDiskClientForSub(gomock.Any()).Return(diskClient, nil).AnyTimes()
+	diskClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, name string) (*armcompute.Disk, error) {
+			if name == "pvc-1-stripe1" {
+				return nil, errors.New(consts.NotFound)
+			}
+			return &armcompute.Disk{ID: &members[0], Name: &name}, nil
+		}).AnyTimes()
+
+	var mu sync.Mutex
+	var updates int
+	dataDisks := []*armcompute.DataDisk{{Lun: ptr.To(int32(0)), Name: ptr.To("other")}}
+	getVM := func() *armcompute.VirtualMachine {
+		return &armcompute.VirtualMachine{
+			Name:     &nodeName,
+			ID:       ptr.To("/subscriptions/subs/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/" + nodeName),
+			Location: &d.getCloud().Location,
+			Properties: &armcompute.VirtualMachineProperties{
+				ProvisioningState: ptr.To("Succeeded"),
+				HardwareProfile:   &armcompute.HardwareProfile{VMSize: ptr.To(armcompute.VirtualMachineSizeTypesStandardA0)},
+				StorageProfile:    &armcompute.StorageProfile{DataDisks: dataDisks},
+			},
+		}
+	}
+	mockVMClient := d.getCloud().ComputeClientFactory.GetVirtualMachineClient().(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, _ *string) (*armcompute.VirtualMachine, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return getVM(), nil
+		}).AnyTimes()
+	mockVMClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, vm armcompute.VirtualMachine) (*armcompute.VirtualMachine, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			updates++
+			dataDisks = nil
+			for _, disk := range vm.Properties.StorageProfile.DataDisks {
+				if !ptr.Deref(disk.ToBeDetached, false) {
+					dataDisks = append(dataDisks, disk)
+				}
+			}
+			return getVM(), nil
+		}).AnyTimes()
+
+	t.Run("detach the attached members on failure", func(t *testing.T) {
+		_, err := d.ControllerPublishVolume(context.Background(), req)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		mu.Lock()
+		defer mu.Unlock()
+		// the first member was attached and detached again
+		assert.Equal(t, 2, updates)
+		require.Len(t, dataDisks, 1)
+		assert.Equal(t, "other", *dataDisks[0].Name)
+	})
+
+	t.Run("not enough free data disk slots", func(t *testing.T) {
+		_, err := d.(*fakeDriver).kubeClient.StorageV1().CSINodes().Create(context.Background(), &storagev1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+			Spec: storagev1.CSINodeSpec{Drivers: []storagev1.CSINodeDriver{{
+				Name:        d.(*fakeDriver).Name,
+				Allocatable: &storagev1.VolumeNodeResources{Count: ptr.To(int32(2))},
+			}}},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = d.ControllerPublishVolume(context.Background(), req)
+		assert.Equal(t, status.Errorf(codes.ResourceExhausted, "node %s has 1 free data disk slots, but 2 members of striped volume %s are not attached yet", nodeName, req.VolumeId), err)
+	})
+}
+
+func TestExpandStripedVolume(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	d, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	members := []string{
+		fmt.Sprintf(consts.ManagedDiskPath, "subs", "rg", "pvc-1"),
+		fmt.Sprintf(consts.ManagedDiskPath, "subs", "rg", "pvc-1-stripe1"),
+	}
+	volumeID := joinStripedID(members)
+	req := &csi.ControllerExpandVolumeRequest{
+		VolumeId:      volumeID,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: volumehelper.GiBToBytes(20)},
+	}
+
+	var mu sync.Mutex
+	sizes := map[string]int32{"pvc-1": 5, "pvc-1-stripe1": 5}
+	patchErr := errors.New("patch failed")
+	diskClient := mock_diskclient.NewMockInterface(cntl)
+	d.getClientFactory().(*mock_azclient.MockClientFactory).EXPECT().GetDiskClientForSub(gomock.Any()).Return(diskClient, nil).AnyTimes()
+	diskClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, name string) (*armcompute.Disk, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return &armcompute.Disk{Name: &name, Properties: &armcompute.DiskProperties{
+				DiskSizeGB: ptr.To(sizes[name]),
+				DiskState:  ptr.To(armcompute.DiskStateUnattached),
+			}}, nil
+		}).AnyTimes()
+	var patched []string
+	diskClient.EXPECT().Patch(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, name string, update armcompute.DiskUpdate) (*armcompute.Disk, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			patched = append(patched, name)
+			if name == "pvc-1-stripe1" && patchErr != nil {
+				return nil, patchErr
+			}
+			sizes[name] = *update.Properties.DiskSizeGB
+			return &armcompute.Disk{}, nil
+		}).AnyTimes()
+
+	// a failed resize leaves the members at different sizes
+	_, err = d.ControllerExpandVolume(context.Background(), req)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, map[string]int32{"pvc-1": 10, "pvc-1-stripe1": 5}, sizes)
+
+	// the retry only resizes the remaining member
+	patched, patchErr = nil, nil
+	resp, err := d.ControllerExpandVolume(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pvc-1-stripe1"}, patched)
+	assert.Equal(t, volumehelper.GiBToBytes(20), resp.CapacityBytes)
+	assert.True(t, resp.NodeExpansionRequired)
+
+	// the capacity is the one of the smallest member on every member
+	sizes["pvc-1"] = 12
+	resp, err = d.ControllerExpandVolume(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, volumehelper.GiBToBytes(20), resp.CapacityBytes)
+
+	// an operation on the striped volume in progress
+	d.getVolumeLocks().TryAcquire(volumeID)
+	defer d.getVolumeLocks().Release(volumeID)
+	_, err = d.ControllerExpandVolume(context.Background(), req)
+	assert.Equal(t, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID), err)
+	_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: volumeID})
+	assert.Equal(t, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, volumeID), err)
+}
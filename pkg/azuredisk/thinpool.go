@@ -0,0 +1,691 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	volumehelper "sigs.k8s.io/azuredisk-csi-driver/pkg/util"
+)
+
+const (
+	// thinVolumeIDPrefix is the prefix of the ID of a thin volume, followed by the node and the volume name
+	thinVolumeIDPrefix = "lvmthin#"
+	// thinVolumeIDSeparator separates the node and the volume name in the ID of a thin volume
+	thinVolumeIDSeparator = "#"
+	// thinPoolVGName is the LVM volume group created by the driver on the pool disk of a node
+	thinPoolVGName = "azuredisk_thinpool"
+	// thinPoolLVName is the name of the thin pool logical volume in the volume group
+	thinPoolLVName = "pool"
+	// thinPoolTagPrefix is the prefix of the volume group tag recording the pool volume owning the volume group
+	thinPoolTagPrefix = "azuredisk_"
+	// thinVolumePVTagPrefix is the prefix of the logical volume tag recording the persistent volume of a thin volume
+	thinVolumePVTagPrefix = "azuredisk_pv="
+	// thinVolumeReclaimPolicyTagPrefix is the prefix of the logical volume tag recording the reclaim policy
+	// of the persistent volume of a thin volume
+	thinVolumeReclaimPolicyTagPrefix = "azuredisk_reclaimpolicy="
+	// thinPoolFullPercent is the usage of the data or the metadata of the thin pool from which
+	// the thin volumes are reported abnormal
+	thinPoolFullPercent = 90
+	// thinVolumeCollectInterval is the interval of the removal of the thin volumes whose persistent volume was deleted
+	// and were not removed on the update of their persistent volume
+	thinVolumeCollectInterval = 5 * time.Minute
+	// thinVolumeFinalizer keeps the persistent volume of a deleted thin volume until the node plugin
+	// has removed its logical volume
+	thinVolumeFinalizer = "disk.csi.azure.com/lvm-thin-volume"
+)
+
+// nodeTopologyKey is the topology key of the node hosting a thin volume
+var nodeTopologyKey = "N/A"
+
+// errThinPoolNotReady is returned when a thin volume is staged before the pool volume of the node
+var errThinPoolNotReady = errors.New("the LVM thin pool of the node is not staged")
+
+// errThinPoolInUse is returned when the pool volume is unstaged while thin volumes of the node are staged
+var errThinPoolInUse = errors.New("the LVM thin pool of the node has staged thin volumes")
+
+// getThinVolumeID returns the ID of the thin volume name in the thin pool of node
+func getThinVolumeID(node, name string) string {
+	return thinVolumeIDPrefix + node + thinVolumeIDSeparator + name
+}
+
+// parseThinVolumeID returns the node and the name of a thin volume, false if volumeID is not a thin volume
+func parseThinVolumeID(volumeID string) (string, string, bool) {
+	if !strings.HasPrefix(volumeID, thinVolumeIDPrefix) {
+		return "", "", false
+	}
+	node, name, ok := strings.Cut(strings.TrimPrefix(volumeID, thinVolumeIDPrefix), thinVolumeIDSeparator)
+	if !ok || node == "" || name == "" {
+		return "", "", false
+	}
+	return node, name, true
+}
+
+// getThinLVName returns the logical volume of the thin volume name, LVM doubles the dashes of
+// logical volume names in device-mapper names so they are replaced by underscores
+func getThinLVName(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// getThinMapperPath returns the device-mapper path of the logical volume lvName of the thin pool volume group
+func getThinMapperPath(lvName string) string {
+	return filepath.Join(devMapperDir, thinPoolVGName+"-"+lvName)
+}
+
+// parseThinLVName returns the logical volume if devicePath is a thin volume of the thin pool
+func parseThinLVName(devicePath string) (string, bool) {
+	name := filepath.Base(devicePath)
+	if filepath.Dir(devicePath) != devMapperDir || !strings.HasPrefix(name, thinPoolVGName+"-") {
+		return "", false
+	}
+	lvName := strings.TrimPrefix(name, thinPoolVGName+"-")
+	// the thin pool and its hidden data and metadata volumes are not thin volumes
+	switch lvName {
+	case "", thinPoolLVName, thinPoolLVName + "-tpool", thinPoolLVName + "_tdata", thinPoolLVName + "_tmeta":
+		return "", false
+	}
+	return lvName, true
+}
+
+// getThinPoolTag returns the volume group tag recording that the thin pool is on the pool volume volumeID
+func getThinPoolTag(volumeID string) string {
+	return fmt.Sprintf("%s%x", thinPoolTagPrefix, sha256.Sum256([]byte(volumeID)))[:len(thinPoolTagPrefix)+32]
+}
+
+// getThinVolumeNode returns the node of the nodeTopologyKey segment of the accessibility requirements,
+// the preferred topologies come first
+func getThinVolumeNode(requirement *csi.TopologyRequirement) string {
+	if requirement == nil {
+		return ""
+	}
+	for _, topology := range append(requirement.GetPreferred(), requirement.GetRequisite()...) {
+		if node := topology.GetSegments()[nodeTopologyKey]; node != "" {
+			return node
+		}
+	}
+	return ""
+}
+
+// createThinVolume creates a thin volume on the node selected by the scheduler, the logical volume itself
+// is created in the thin pool of the node by NodeStageVolume
+func (d *Driver) createThinVolume(_ context.Context, req *csi.CreateVolumeRequest, volumeContext map[string]string) (*csi.CreateVolumeResponse, error) {
+	for _, volCap := range req.GetVolumeCapabilities() {
+		if volCap.GetBlock() != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s %s is not supported with block volumes", consts.LVMThinPoolField, consts.LVMThinPoolVolume)
+		}
+	}
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s %s can not be created from a snapshot or a volume", consts.LVMThinPoolField, consts.LVMThinPoolVolume)
+	}
+	node := getThinVolumeNode(req.GetAccessibilityRequirements())
+	if node == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "%s %s requires the %s topology of the node, use the WaitForFirstConsumer volume binding mode",
+			consts.LVMThinPoolField, consts.LVMThinPoolVolume, nodeTopologyKey)
+	}
+
+	requestGiB := max(volumehelper.RoundUpGiB(req.GetCapacityRange().GetRequiredBytes()), consts.MinimumDiskSizeGiB)
+	maxVolSize := volumehelper.RoundUpGiB(req.GetCapacityRange().GetLimitBytes())
+	if maxVolSize > 0 && maxVolSize < requestGiB {
+		return nil, status.Error(codes.InvalidArgument, "After round-up, volume size exceeds the limit specified")
+	}
+	volumeContext[consts.RequestedSizeGib] = strconv.FormatInt(requestGiB, 10)
+
+	volumeID := getThinVolumeID(node, req.GetName())
+	klog.V(2).Infof("create thin volume %s of %dGiB on node %s", volumeID, requestGiB, node)
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: volumehelper.GiBToBytes(requestGiB),
+			VolumeContext: volumeContext,
+			AccessibleTopology: []*csi.Topology{
+				{Segments: map[string]string{nodeTopologyKey: node}},
+			},
+		},
+	}, nil
+}
+
+// deleteThinVolume adds thinVolumeFinalizer to the persistent volume pvName of the thin volume volumeID, the controller
+// can not reach the thin pool of the node so the node plugin removes the logical volume and then the finalizer
+func (d *Driver) deleteThinVolume(ctx context.Context, volumeID, pvName string) (*csi.DeleteVolumeResponse, error) {
+	if d.kubeClient == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "thin volume %s can not be deleted without a kube client", volumeID)
+	}
+	pv, err := d.kubeClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, status.Errorf(codes.Internal, "failed to get persistent volume %s: %v", pvName, err)
+	}
+	if err != nil || pv.Spec.CSI == nil || pv.Spec.CSI.VolumeHandle != volumeID {
+		// the logical volume of a persistent volume deleted without the finalizer is removed with its Delete reclaim policy tag
+		klog.V(2).Infof("persistent volume %s of thin volume %s is already deleted", pvName, volumeID)
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+	if !slices.Contains(pv.Finalizers, thinVolumeFinalizer) {
+		patch := fmt.Sprintf(`{"metadata":{"finalizers":[%q]}}`, thinVolumeFinalizer)
+		if _, err := d.kubeClient.CoreV1().PersistentVolumes().Patch(ctx, pvName, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to add finalizer %s to persistent volume %s: %v", thinVolumeFinalizer, pvName, err)
+		}
+	}
+	klog.V(2).Infof("persistent volume %s is kept until the node removes thin volume %s", pvName, volumeID)
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// expandThinVolume checks that the new size of the thin volume volumeID fits in the pool volume of its node,
+// the logical volume is extended by NodeExpandVolume
+func (d *Driver) expandThinVolume(ctx context.Context, volumeID, node string, capacityBytes int64) (*csi.ControllerExpandVolumeResponse, error) {
+	requestBytes := volumehelper.GiBToBytes(volumehelper.RoundUpGiB(capacityBytes))
+	poolBytes, err := d.getThinPoolCapacity(ctx, node)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get the capacity of the LVM thin pool of node %s: %v", node, err)
+	}
+	if poolBytes == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "the pool volume of node %s is not attached, thin volume %s can not be expanded", node, volumeID)
+	}
+	if requestBytes > poolBytes {
+		return nil, status.Errorf(codes.OutOfRange, "the requested size %dGiB of thin volume %s exceeds the %dGiB pool volume of node %s, expand the pool volume first",
+			volumehelper.RoundUpGiB(requestBytes), volumeID, volumehelper.RoundUpGiB(poolBytes), node)
+	}
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         requestBytes,
+		NodeExpansionRequired: true,
+	}, nil
+}
+
+// getThinPoolCapacity returns the capacity of the pool volume attached to node, 0 if there is none
+func (d *Driver) getThinPoolCapacity(ctx context.Context, node string) (int64, error) {
+	if d.kubeClient == nil {
+		return 0, errors.New("thin volumes require a kube client")
+	}
+	if d.pvLister == nil || !d.pvListerSynced() {
+		return 0, errors.New("persistent volumes are not synced yet")
+	}
+	volumeAttachments, err := d.kubeClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, va := range volumeAttachments.Items {
+		// the pool volume is a volume of the Azure disk driver, thin volumes are not attached
+		pvName := va.Spec.Source.PersistentVolumeName
+		if va.Spec.Attacher != consts.DefaultDriverName || !strings.EqualFold(va.Spec.NodeName, node) || pvName == nil {
+			continue
+		}
+		pv, err := d.pvLister.Get(*pvName)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if pv.Spec.CSI == nil {
+			continue
+		}
+		if role, _ := azureutils.GetLVMThinPool(pv.Spec.CSI.VolumeAttributes); role == consts.LVMThinPoolPool {
+			capacity := pv.Spec.Capacity[v1.ResourceStorage]
+			return capacity.Value(), nil
+		}
+	}
+	return 0, nil
+}
+
+// ensureThinPool creates the thin pool of the node on the pool volume volumeID attached on device, or activates
+// it if it already exists. The volume group is tagged with the pool volume, a node has a single thin pool.
+func (d *Driver) ensureThinPool(ctx context.Context, volumeID, device string, volumeContext map[string]string) error {
+	tag := getThinPoolTag(volumeID)
+	logger := klog.FromContext(ctx).WithValues("volumeGroup", thinPoolVGName, "device", device)
+	exists, err := d.volumeGroupExists(thinPoolVGName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		output, err := d.mounter.Exec.Command("vgs", "--noheadings", "--options", "vg_tags", thinPoolVGName).Output()
+		if err != nil {
+			return fmt.Errorf("failed to list volume group %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+		}
+		if !slices.Contains(strings.Split(strings.TrimSpace(string(output)), ","), tag) {
+			return fmt.Errorf("the LVM thin pool of the node is on another volume than %s", volumeID)
+		}
+		if _, err := os.Stat(getThinMapperPath(thinPoolLVName)); err == nil {
+			logger.V(2).Info("thin pool is already active")
+			return nil
+		}
+		if output, err := d.mounter.Exec.Command("vgchange", "--activate", "y", thinPoolVGName).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to activate volume group %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+		}
+		logger.V(2).Info("activated thin pool")
+		return nil
+	}
+
+	if err := d.checkPhysicalVolumeSignatures(ctx, volumeID, device, thinPoolVGName, volumeContext); err != nil {
+		return err
+	}
+	logger.V(2).Info("creating thin pool")
+	if output, err := d.mounter.Exec.Command("pvcreate", device).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create physical volume on %s: output: %s, err: %v", device, string(output), err)
+	}
+	if output, err := d.mounter.Exec.Command("vgcreate", "--addtag", tag, thinPoolVGName, device).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create volume group %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	if output, err := d.mounter.Exec.Command("lvcreate", "--yes", "--type", "thin-pool", "--extents", "100%FREE",
+		"--name", thinPoolLVName, thinPoolVGName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create thin pool in %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	logger.V(2).Info("created thin pool")
+	return nil
+}
+
+// ownsThinPool returns whether the thin pool of the node is active on the pool volume volumeID
+func (d *Driver) ownsThinPool(volumeID string) (bool, error) {
+	if _, err := os.Stat(getThinMapperPath(thinPoolLVName)); err != nil {
+		return false, nil
+	}
+	output, err := d.mounter.Exec.Command("vgs", "--noheadings", "--options", "vg_tags", thinPoolVGName).Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to list volume group %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	return slices.Contains(strings.Split(strings.TrimSpace(string(output)), ","), getThinPoolTag(volumeID)), nil
+}
+
+// deactivateThinPool deactivates the thin pool if it is on the pool volume volumeID so that the pool disk
+// can be detached, it fails with errThinPoolInUse while thin volumes are staged, their pods have to be
+// deleted first
+func (d *Driver) deactivateThinPool(ctx context.Context, volumeID string) error {
+	owned, err := d.ownsThinPool(volumeID)
+	if err != nil || !owned {
+		return err
+	}
+	thinVolumes, err := d.listThinVolumes()
+	if err != nil {
+		return err
+	}
+	var open []string
+	for _, thinVolume := range thinVolumes {
+		if thinVolume.open {
+			open = append(open, thinVolume.name())
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("%w, delete the pods using the thin volumes %s on node %s before the pool volume %s",
+			errThinPoolInUse, strings.Join(open, ", "), d.NodeID, volumeID)
+	}
+	if output, err := d.mounter.Exec.Command("vgchange", "--activate", "n", thinPoolVGName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to deactivate volume group %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	klog.FromContext(ctx).V(2).Info("deactivated thin pool", "volumeGroup", thinPoolVGName)
+	return nil
+}
+
+// growThinPool grows the physical volume of the pool volume volumeID to the new size of the disk
+// and extends the thin pool over the free extents
+func (d *Driver) growThinPool(ctx context.Context, volumeID string) error {
+	owned, err := d.ownsThinPool(volumeID)
+	if err != nil || !owned {
+		return err
+	}
+	logger := klog.FromContext(ctx).WithValues("volumeGroup", thinPoolVGName)
+	output, err := d.mounter.Exec.Command("pvs", "--noheadings", "--options", "pv_name", "--select", "vg_name="+thinPoolVGName).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list physical volumes of %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	for _, device := range strings.Fields(string(output)) {
+		if output, err := d.mounter.Exec.Command("pvresize", device).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to resize physical volume %s: output: %s, err: %v", device, string(output), err)
+		}
+	}
+	output, err = d.mounter.Exec.Command("vgs", "--noheadings", "--options", "vg_free_count", thinPoolVGName).Output()
+	if err != nil {
+		return fmt.Errorf("failed to get free extents of %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	if strings.TrimSpace(string(output)) == "0" {
+		return nil
+	}
+	logger.V(2).Info("growing thin pool")
+	if output, err := d.mounter.Exec.Command("lvextend", "--extents", "+100%FREE", thinPoolVGName+"/"+thinPoolLVName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to extend thin pool in %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	return nil
+}
+
+// ensureThinVolume activates the logical volume of the thin volume name in the thin pool of the node
+// and returns its device-mapper path, the logical volume is created with the requested size if it does not exist
+// and tagged with its persistent volume, whose name is the volume name, and the reclaim policy of the persistent volume
+func (d *Driver) ensureThinVolume(ctx context.Context, name string, volumeContext map[string]string) (string, error) {
+	lvName := getThinLVName(name)
+	mapperPath := getThinMapperPath(lvName)
+	logger := klog.FromContext(ctx).WithValues("logicalVolume", lvName)
+	if _, err := os.Stat(mapperPath); err == nil {
+		logger.V(2).Info("thin volume is already active", "mapperPath", mapperPath)
+		return mapperPath, nil
+	}
+	if _, err := os.Stat(getThinMapperPath(thinPoolLVName)); err != nil {
+		return "", errThinPoolNotReady
+	}
+
+	thinVolume, err := d.getThinVolume(lvName)
+	if err != nil {
+		return "", err
+	}
+	if thinVolume != nil {
+		if output, err := d.mounter.Exec.Command("lvchange", "--activate", "y", thinPoolVGName+"/"+lvName).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to activate thin volume %s: output: %s, err: %v", lvName, string(output), err)
+		}
+		logger.V(2).Info("activated thin volume", "mapperPath", mapperPath)
+		return mapperPath, nil
+	}
+
+	// the logical volume does not exist yet
+	sizeGiB := int64(consts.MinimumDiskSizeGiB)
+	if v, ok := volumeContext[consts.RequestedSizeGib]; ok {
+		if sizeGiB, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid %s %q: %v", consts.RequestedSizeGib, v, err)
+		}
+	}
+	reclaimPolicy, err := d.getThinVolumeReclaimPolicy(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if output, err := d.mounter.Exec.Command("lvcreate", "--yes", "--type", "thin", "--virtualsize", fmt.Sprintf("%dg", sizeGiB),
+		"--thinpool", thinPoolLVName, "--name", lvName, "--addtag", thinVolumePVTagPrefix+name,
+		"--addtag", thinVolumeReclaimPolicyTagPrefix+string(reclaimPolicy), thinPoolVGName).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to create thin volume %s: output: %s, err: %v", lvName, string(output), err)
+	}
+	logger.V(2).Info("created thin volume", "mapperPath", mapperPath, "sizeGiB", sizeGiB, "reclaimPolicy", reclaimPolicy)
+	return mapperPath, nil
+}
+
+// getThinVolumeReclaimPolicy returns the reclaim policy of the persistent volume pvName of a thin volume
+func (d *Driver) getThinVolumeReclaimPolicy(ctx context.Context, pvName string) (v1.PersistentVolumeReclaimPolicy, error) {
+	if d.kubeClient == nil {
+		return "", fmt.Errorf("failed to get persistent volume %s: thin volumes require a kube client", pvName)
+	}
+	pv, err := d.kubeClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get persistent volume %s: %v", pvName, err)
+	}
+	return pv.Spec.PersistentVolumeReclaimPolicy, nil
+}
+
+// deactivateThinVolume deactivates the logical volume of the thin volume name if it is active
+func (d *Driver) deactivateThinVolume(ctx context.Context, name string) error {
+	lvName := getThinLVName(name)
+	if _, err := os.Stat(getThinMapperPath(lvName)); err != nil {
+		return nil
+	}
+	if output, err := d.mounter.Exec.Command("lvchange", "--activate", "n", thinPoolVGName+"/"+lvName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to deactivate thin volume %s: output: %s, err: %v", lvName, string(output), err)
+	}
+	klog.FromContext(ctx).V(2).Info("deactivated thin volume", "logicalVolume", lvName)
+	return nil
+}
+
+// growThinVolume extends the logical volume of a thin volume to sizeGiB
+func (d *Driver) growThinVolume(ctx context.Context, lvName string, sizeGiB int64) error {
+	klog.FromContext(ctx).V(2).Info("growing thin volume", "logicalVolume", lvName, "sizeGiB", sizeGiB)
+	if output, err := d.mounter.Exec.Command("lvextend", "--size", fmt.Sprintf("%dg", sizeGiB), thinPoolVGName+"/"+lvName).CombinedOutput(); err != nil {
+		// lvextend fails if the logical volume already has the size
+		if !strings.Contains(string(output), "matches existing size") {
+			return fmt.Errorf("failed to extend thin volume %s: output: %s, err: %v", lvName, string(output), err)
+		}
+	}
+	return nil
+}
+
+// getThinPoolCondition returns the condition of the thin volumes of the node, abnormal when the data
+// or the metadata of the thin pool is almost full since writes fail once the pool is exhausted
+func (d *Driver) getThinPoolCondition() *csi.VolumeCondition {
+	output, err := d.mounter.Exec.Command("lvs", "--noheadings", "--separator", ",", "--options", "data_percent,metadata_percent",
+		thinPoolVGName+"/"+thinPoolLVName).Output()
+	if err != nil {
+		return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("failed to get the usage of the LVM thin pool: %v", err)}
+	}
+	fields := strings.Split(strings.TrimSpace(string(output)), ",")
+	if len(fields) != 2 {
+		return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("unexpected usage of the LVM thin pool: %q", string(output))}
+	}
+	for i, usage := range []string{"data", "metadata"} {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+		if err != nil {
+			return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("unexpected %s usage of the LVM thin pool: %q", usage, fields[i])}
+		}
+		if percent >= thinPoolFullPercent {
+			return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("the %s of the LVM thin pool is %.1f%% full, expand the pool volume", usage, percent)}
+		}
+	}
+	return &csi.VolumeCondition{Message: "volume is healthy"}
+}
+
+// thinVolumeEventHandler removes the logical volume of a thin volume of the node once its persistent volume
+// is deleted with thinVolumeFinalizer, the failed removals are retried by collectThinVolumes
+func (d *Driver) thinVolumeEventHandler(ctx context.Context) cache.ResourceEventHandler {
+	handle := func(obj interface{}) {
+		pv, ok := obj.(*v1.PersistentVolume)
+		if !ok {
+			return
+		}
+		if err := d.removeDeletedThinVolume(ctx, pv); err != nil {
+			klog.Warningf("failed to remove the thin volume of persistent volume %s, retrying in %v: %v", pv.Name, thinVolumeCollectInterval, err)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, obj interface{}) { handle(obj) },
+	}
+}
+
+// removeDeletedThinVolume removes the logical volume of the thin volume of pv if pv is deleted with thinVolumeFinalizer
+// and the thin volume is on the node, and then the finalizer so that the persistent volume is only gone once
+// the space of the logical volume is released
+func (d *Driver) removeDeletedThinVolume(ctx context.Context, pv *v1.PersistentVolume) error {
+	if pv.DeletionTimestamp == nil || !slices.Contains(pv.Finalizers, thinVolumeFinalizer) || pv.Spec.CSI == nil {
+		return nil
+	}
+	volumeID := pv.Spec.CSI.VolumeHandle
+	node, name, isThin := parseThinVolumeID(volumeID)
+	if !isThin || !strings.EqualFold(node, d.NodeID) {
+		return nil
+	}
+	if _, err := os.Stat(getThinMapperPath(thinPoolLVName)); err != nil {
+		return errThinPoolNotReady
+	}
+	if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
+		return fmt.Errorf(volumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer d.volumeLocks.Release(volumeID)
+
+	lvName := getThinLVName(name)
+	thinVolume, err := d.getThinVolume(lvName)
+	if err != nil {
+		return err
+	}
+	if thinVolume != nil {
+		if thinVolume.open {
+			return fmt.Errorf("thin volume %s is still in use", lvName)
+		}
+		if output, err := d.mounter.Exec.Command("lvremove", "--yes", thinPoolVGName+"/"+lvName).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to remove thin volume %s: output: %s, err: %v", lvName, string(output), err)
+		}
+		klog.V(2).Infof("removed thin volume %s of deleted persistent volume %s", lvName, pv.Name)
+	}
+	patch := fmt.Sprintf(`{"metadata":{"$deleteFromPrimitiveList/finalizers":[%q]}}`, thinVolumeFinalizer)
+	if _, err := d.kubeClient.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove finalizer %s from persistent volume %s: %v", thinVolumeFinalizer, pv.Name, err)
+	}
+	klog.V(2).Infof("removed finalizer %s from persistent volume %s", thinVolumeFinalizer, pv.Name)
+	return nil
+}
+
+// collectThinVolumes retries the removal of the thin volumes of the deleted persistent volumes, and removes the
+// logical volumes of the thin pool whose persistent volume is gone with the Delete reclaim policy
+func (d *Driver) collectThinVolumes(ctx context.Context) {
+	if d.pvLister == nil || !d.pvListerSynced() {
+		return
+	}
+	pvs, err := d.pvLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list persistent volumes: %v", err)
+		return
+	}
+	for _, pv := range pvs {
+		if err := d.removeDeletedThinVolume(ctx, pv); err != nil {
+			klog.Warningf("failed to remove the thin volume of persistent volume %s: %v", pv.Name, err)
+		}
+	}
+
+	if _, err := os.Stat(getThinMapperPath(thinPoolLVName)); err != nil {
+		return
+	}
+	thinVolumes, err := d.listThinVolumes()
+	if err != nil {
+		klog.Errorf("%v", err)
+		return
+	}
+	for _, thinVolume := range thinVolumes {
+		d.collectThinVolume(ctx, thinVolume)
+	}
+}
+
+// thinVolume is a logical volume of the thin pool of the node
+type thinVolume struct {
+	lvName string
+	// open is true if the logical volume is in use, e.g. mounted by NodeStageVolume
+	open bool
+	// pvName and reclaimPolicy are recorded in the tags of the logical volume when it is created
+	pvName        string
+	reclaimPolicy v1.PersistentVolumeReclaimPolicy
+}
+
+// name returns the persistent volume of the thin volume, or its logical volume if it is not tagged
+func (v thinVolume) name() string {
+	if v.pvName != "" {
+		return v.pvName
+	}
+	return v.lvName
+}
+
+// listThinVolumes returns the logical volumes of the thin pool of the node
+func (d *Driver) listThinVolumes() ([]thinVolume, error) {
+	return d.selectThinVolumes()
+}
+
+// getThinVolume returns the logical volume lvName of the thin pool of the node, nil if it does not exist
+func (d *Driver) getThinVolume(lvName string) (*thinVolume, error) {
+	thinVolumes, err := d.selectThinVolumes("--select", "lv_name="+lvName)
+	if err != nil || len(thinVolumes) == 0 {
+		return nil, err
+	}
+	return &thinVolumes[0], nil
+}
+
+// selectThinVolumes returns the logical volumes of the thin pool of the node matching the lvs options
+func (d *Driver) selectThinVolumes(options ...string) ([]thinVolume, error) {
+	args := append([]string{"--noheadings", "--separator", ",", "--options", "lv_name,pool_lv,lv_device_open,lv_tags"}, options...)
+	output, err := d.mounter.Exec.Command("lvs", append(args, thinPoolVGName)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list thin volumes of %s: output: %s, err: %v", thinPoolVGName, string(output), err)
+	}
+	var thinVolumes []thinVolume
+	for _, line := range strings.Split(string(output), "\n") {
+		// the tags are separated by commas too
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 4)
+		if len(fields) != 4 || fields[1] != thinPoolLVName {
+			continue
+		}
+		volume := thinVolume{lvName: fields[0], open: fields[2] == "open"}
+		for _, tag := range strings.Split(fields[3], ",") {
+			if pvName, ok := strings.CutPrefix(tag, thinVolumePVTagPrefix); ok {
+				volume.pvName = pvName
+			} else if reclaimPolicy, ok := strings.CutPrefix(tag, thinVolumeReclaimPolicyTagPrefix); ok {
+				volume.reclaimPolicy = v1.PersistentVolumeReclaimPolicy(reclaimPolicy)
+			}
+		}
+		thinVolumes = append(thinVolumes, volume)
+	}
+	return thinVolumes, nil
+}
+
+// collectThinVolume removes the logical volume of thinVolume if its persistent volume is gone with the Delete
+// reclaim policy, e.g. deleted before the finalizer was added, the recorded reclaim policy follows the changes
+// of the reclaim policy of the persistent volume. Logical volumes without tags were not created by the driver
+// and are never removed.
+func (d *Driver) collectThinVolume(_ context.Context, thinVolume thinVolume) {
+	lvName, pvName := thinVolume.lvName, thinVolume.pvName
+	if pvName == "" {
+		klog.V(4).Infof("skip thin volume %s without persistent volume tag", lvName)
+		return
+	}
+	pv, err := d.pvLister.Get(pvName)
+	if err == nil {
+		if pv.DeletionTimestamp != nil {
+			// the persistent volume is being deleted, its logical volume is removed by removeDeletedThinVolume
+			return
+		}
+		if reclaimPolicy := pv.Spec.PersistentVolumeReclaimPolicy; reclaimPolicy != thinVolume.reclaimPolicy {
+			if output, err := d.mounter.Exec.Command("lvchange", "--deltag", thinVolumeReclaimPolicyTagPrefix+string(thinVolume.reclaimPolicy),
+				"--addtag", thinVolumeReclaimPolicyTagPrefix+string(reclaimPolicy), thinPoolVGName+"/"+lvName).CombinedOutput(); err != nil {
+				klog.Errorf("failed to record reclaim policy %s of thin volume %s: output: %s, err: %v", reclaimPolicy, lvName, string(output), err)
+				return
+			}
+			klog.V(2).Infof("recorded reclaim policy %s of thin volume %s", reclaimPolicy, lvName)
+		}
+		return
+	}
+	if !apierrors.IsNotFound(err) {
+		klog.Warningf("failed to get persistent volume %s of thin volume %s: %v", pvName, lvName, err)
+		return
+	}
+	if thinVolume.reclaimPolicy != v1.PersistentVolumeReclaimDelete {
+		klog.V(4).Infof("keep thin volume %s of deleted persistent volume %s with reclaim policy %s", lvName, pvName, thinVolume.reclaimPolicy)
+		return
+	}
+	if thinVolume.open {
+		klog.Warningf("thin volume %s is still in use, persistent volume %s was deleted", lvName, pvName)
+		return
+	}
+	volumeID := getThinVolumeID(d.NodeID, pvName)
+	if acquired := d.volumeLocks.TryAcquire(volumeID); !acquired {
+		return
+	}
+	defer d.volumeLocks.Release(volumeID)
+	if output, err := d.mounter.Exec.Command("lvremove", "--yes", thinPoolVGName+"/"+lvName).CombinedOutput(); err != nil {
+		klog.Errorf("failed to remove thin volume %s: output: %s, err: %v", lvName, string(output), err)
+		return
+	}
+	klog.V(2).Infof("removed thin volume %s of deleted persistent volume %s", lvName, pvName)
+}
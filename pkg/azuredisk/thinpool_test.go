@@ -0,0 +1,511 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+	"k8s.io/utils/ptr"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/mounter"
+)
+
+func TestThinVolumeID(t *testing.T) {
+	id := getThinVolumeID("node-1", "pvc-1")
+	assert.Equal(t, "lvmthin#node-1#pvc-1", id)
+	node, name, ok := parseThinVolumeID(id)
+	assert.True(t, ok)
+	assert.Equal(t, "node-1", node)
+	assert.Equal(t, "pvc-1", name)
+	for _, id := range []string{"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/pvc-1", "lvmthin#node-1", "lvmthin##pvc-1"} {
+		_, _, ok = parseThinVolumeID(id)
+		assert.False(t, ok, id)
+	}
+
+	defer func(dir string) { devMapperDir = dir }(devMapperDir)
+	devMapperDir = "/dev/mapper"
+	assert.Equal(t, "pvc_1", getThinLVName("pvc-1"))
+	lvName, ok := parseThinLVName(getThinMapperPath("pvc_1"))
+	assert.True(t, ok)
+	assert.Equal(t, "pvc_1", lvName)
+	for _, path := range []string{getThinMapperPath(thinPoolLVName), getThinMapperPath("pool-tpool"), "/dev/mapper/azuredisk_stripe_0-stripe", "/dev/sdc"} {
+		_, ok = parseThinLVName(path)
+		assert.False(t, ok, path)
+	}
+	assert.Len(t, getThinPoolTag("vol_1"), len(thinPoolTagPrefix)+32)
+}
+
+func TestCreateThinVolume(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	d, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+
+	mountCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	topology := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{{Segments: map[string]string{topologyKey: "eastus-1", nodeTopologyKey: "node-1"}}},
+	}
+	params := map[string]string{consts.LVMThinPoolField: consts.LVMThinPoolVolume}
+
+	t.Run("disk driver name", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{Name: "pvc-1", Parameters: params,
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap}, AccessibilityRequirements: topology})
+		assert.Equal(t, status.Error(codes.InvalidArgument, "lvmthinpool volume is provisioned by the thin volumes driver name, not by disk.csi.azure.com"), err)
+	})
+
+	d.setName("lvmthin.disk.csi.azure.com")
+	t.Run("success", func(t *testing.T) {
+		resp, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:                      "pvc-1",
+			Parameters:                params,
+			VolumeCapabilities:        []*csi.VolumeCapability{mountCap},
+			CapacityRange:             &csi.CapacityRange{RequiredBytes: 3 << 30},
+			AccessibilityRequirements: topology,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "lvmthin#node-1#pvc-1", resp.Volume.VolumeId)
+		assert.Equal(t, int64(3<<30), resp.Volume.CapacityBytes)
+		assert.Equal(t, "3", resp.Volume.VolumeContext[consts.RequestedSizeGib])
+		assert.Equal(t, []*csi.Topology{{Segments: map[string]string{nodeTopologyKey: "node-1"}}}, resp.Volume.AccessibleTopology)
+	})
+
+	tests := []struct {
+		desc string
+		req  *csi.CreateVolumeRequest
+		msg  string
+	}{
+		{
+			desc: "no node topology",
+			req:  &csi.CreateVolumeRequest{Name: "pvc-1", Parameters: params, VolumeCapabilities: []*csi.VolumeCapability{mountCap}},
+			msg:  "lvmthinpool volume requires the " + nodeTopologyKey + " topology of the node, use the WaitForFirstConsumer volume binding mode",
+		},
+		{
+			desc: "block volume",
+			req: &csi.CreateVolumeRequest{Name: "pvc-1", Parameters: params, VolumeCapabilities: []*csi.VolumeCapability{blockCap},
+				AccessibilityRequirements: topology},
+			msg: "lvmthinpool volume is not supported with block volumes",
+		},
+		{
+			desc: "pool must be block",
+			req: &csi.CreateVolumeRequest{Name: "pool-1", Parameters: map[string]string{consts.LVMThinPoolField: consts.LVMThinPoolPool},
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap}},
+			msg: "lvmthinpool pool must be a block volume",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := d.CreateVolume(context.Background(), test.req)
+			assert.Equal(t, status.Error(codes.InvalidArgument, test.msg), err)
+		})
+	}
+
+	id := getThinVolumeID("node-1", "pvc-1")
+	_, err = d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{VolumeId: id, NodeId: "node-1", VolumeCapability: mountCap})
+	assert.NoError(t, err)
+	_, err = d.ControllerUnpublishVolume(context.Background(), &csi.ControllerUnpublishVolumeRequest{VolumeId: id, NodeId: "node-1"})
+	assert.NoError(t, err)
+	_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id})
+	assert.NoError(t, err, "persistent volume already deleted")
+	d.(*fakeDriver).kubeClient = nil
+	_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	kubeClient := fake.NewSimpleClientset(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: id}}}})
+	d.(*fakeDriver).kubeClient = kubeClient
+	_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id})
+	require.NoError(t, err)
+	pv, err := kubeClient.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{thinVolumeFinalizer}, pv.Finalizers)
+
+	expandReq := func(sizeGiB int64) *csi.ControllerExpandVolumeRequest {
+		return &csi.ControllerExpandVolumeRequest{VolumeId: id, CapacityRange: &csi.CapacityRange{RequiredBytes: sizeGiB << 30}}
+	}
+	_, err = d.ControllerExpandVolume(context.Background(), expandReq(5))
+	assert.Equal(t, codes.Internal, status.Code(err), "persistent volumes not synced")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startFakePVInformer(ctx, t, &d.(*fakeDriver).Driver, &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pool-1"},
+		Spec: v1.PersistentVolumeSpec{Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")},
+			PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: "pool_1",
+				VolumeAttributes: map[string]string{consts.LVMThinPoolField: consts.LVMThinPoolPool}}}}})
+	kubeClient = d.(*fakeDriver).kubeClient.(*fake.Clientset)
+	_, err = d.ControllerExpandVolume(context.Background(), expandReq(5))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "pool volume not attached")
+	for _, va := range []storagev1.VolumeAttachment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "va-other-node"},
+			Spec: storagev1.VolumeAttachmentSpec{Attacher: consts.DefaultDriverName, NodeName: "node-2", Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: ptr.To("pool-1")}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "va-other-driver"},
+			Spec: storagev1.VolumeAttachmentSpec{Attacher: "file.csi.azure.com", NodeName: "node-1", Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: ptr.To("pool-1")}}},
+	} {
+		_, err = kubeClient.StorageV1().VolumeAttachments().Create(context.Background(), &va, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	_, err = d.ControllerExpandVolume(context.Background(), expandReq(5))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "pool volume attached to another node or by another driver")
+	_, err = kubeClient.StorageV1().VolumeAttachments().Create(context.Background(), &storagev1.VolumeAttachment{ObjectMeta: metav1.ObjectMeta{Name: "va-1"},
+		Spec: storagev1.VolumeAttachmentSpec{Attacher: consts.DefaultDriverName, NodeName: "node-1", Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: ptr.To("pool-1")}}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	expand, err := d.ControllerExpandVolume(context.Background(), expandReq(5))
+	require.NoError(t, err)
+	assert.Equal(t, &csi.ControllerExpandVolumeResponse{CapacityBytes: 5 << 30, NodeExpansionRequired: true}, expand)
+	_, err = d.ControllerExpandVolume(context.Background(), expandReq(20))
+	assert.Equal(t, status.Error(codes.OutOfRange, "the requested size 20GiB of thin volume "+id+" exceeds the 10GiB pool volume of node node-1, expand the pool volume first"), err)
+	_, err = d.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{SourceVolumeId: id, Name: "snapshot"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestThinPool(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skip test on GOOS=%s", runtime.GOOS)
+	}
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	fd, err := NewFakeDriver(cntl)
+	require.NoError(t, err)
+	d := fd.(*fakeDriver)
+
+	defer func(dir string) { devMapperDir = dir }(devMapperDir)
+	devMapperDir = t.TempDir()
+	tag := getThinPoolTag("pool_1")
+	poolPath := getThinMapperPath(thinPoolLVName)
+	volumePath := getThinMapperPath("pvc_1")
+
+	output := func(out string, exitStatus int) testingexec.FakeAction {
+		return func() ([]byte, []byte, error) {
+			if exitStatus != 0 {
+				return []byte(out), []byte{}, testingexec.FakeExitError{Status: exitStatus}
+			}
+			return []byte(out), []byte{}, nil
+		}
+	}
+	var cmds []string
+	setScripts := func(actions ...testingexec.FakeAction) {
+		cmds = nil
+		fakeMounter, err := mounter.NewFakeSafeMounter()
+		require.NoError(t, err)
+		d.setMounter(fakeMounter)
+		fakeExec := fakeMounter.Exec.(*mounter.FakeSafeMounter)
+		for _, action := range actions {
+			fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+				fakeCmd := &testingexec.FakeCmd{}
+				record := func() ([]byte, []byte, error) {
+					cmds = append(cmds, strings.Join(append([]string{cmd}, args...), " "))
+					return action()
+				}
+				fakeCmd.OutputScript = []testingexec.FakeAction{record}
+				fakeCmd.CombinedOutputScript = []testingexec.FakeAction{record}
+				return testingexec.InitFakeCmd(fakeCmd, cmd, args...)
+			})
+		}
+	}
+
+	vgNotFound := output(fmt.Sprintf("  Volume group \"%s\" not found\n  Cannot process volume group %s\n", thinPoolVGName, thinPoolVGName), 5)
+
+	t.Run("create pool on empty disk", func(t *testing.T) {
+		setScripts(vgNotFound, output("", 2), output("", 0), output("", 0), output("", 0))
+		require.NoError(t, d.ensureThinPool(context.Background(), "pool_1", "/dev/sdd", nil))
+		assert.Equal(t, []string{
+			"vgs --noheadings " + thinPoolVGName,
+			"blkid -p -o export /dev/sdd",
+			"pvcreate /dev/sdd",
+			"vgcreate --addtag " + tag + " " + thinPoolVGName + " /dev/sdd",
+			"lvcreate --yes --type thin-pool --extents 100%FREE --name pool " + thinPoolVGName,
+		}, cmds)
+	})
+
+	t.Run("refuse disk with data", func(t *testing.T) {
+		setScripts(vgNotFound, output("DEVNAME=/dev/sdd\nTYPE=ext4\n", 0))
+		err := d.ensureThinPool(context.Background(), "pool_1", "/dev/sdd", nil)
+		assert.True(t, errors.Is(err, errForeignDataSignature))
+	})
+
+	t.Run("refuse physical volume of another volume group", func(t *testing.T) {
+		setScripts(vgNotFound, output("DEVNAME=/dev/sdd\nTYPE=LVM2_member\n", 0), output("  datavg\n", 0))
+		err := d.ensureThinPool(context.Background(), "pool_1", "/dev/sdd", nil)
+		assert.True(t, errors.Is(err, errForeignDataSignature))
+		assert.Equal(t, []string{
+			"vgs --noheadings " + thinPoolVGName,
+			"blkid -p -o export /dev/sdd",
+			"pvs --noheadings --options vg_name /dev/sdd",
+		}, cmds)
+	})
+
+	t.Run("fail to list volume group", func(t *testing.T) {
+		setScripts(output("  Reading VG "+thinPoolVGName+" failed.", 5))
+		assert.ErrorContains(t, d.ensureThinPool(context.Background(), "pool_1", "/dev/sdd", nil),
+			"failed to list volume group "+thinPoolVGName)
+		assert.Len(t, cmds, 1)
+	})
+
+	t.Run("activate existing pool", func(t *testing.T) {
+		setScripts(output("", 0), output("  "+tag+"\n", 0), output("", 0))
+		require.NoError(t, d.ensureThinPool(context.Background(), "pool_1", "/dev/sdd", nil))
+		assert.Equal(t, []string{
+			"vgs --noheadings " + thinPoolVGName,
+			"vgs --noheadings --options vg_tags " + thinPoolVGName,
+			"vgchange --activate y " + thinPoolVGName,
+		}, cmds)
+	})
+
+	t.Run("pool of another volume", func(t *testing.T) {
+		setScripts(output("", 0), output("  "+getThinPoolTag("pool_2")+"\n", 0))
+		assert.EqualError(t, d.ensureThinPool(context.Background(), "pool_1", "/dev/sdd", nil),
+			"the LVM thin pool of the node is on another volume than pool_1")
+	})
+
+	t.Run("thin volume before pool", func(t *testing.T) {
+		setScripts()
+		_, err := d.ensureThinVolume(context.Background(), "pvc-1", nil)
+		assert.Equal(t, errThinPoolNotReady, err)
+	})
+
+	require.NoError(t, os.WriteFile(poolPath, nil, 0600))
+
+	t.Run("create thin volume", func(t *testing.T) {
+		d.kubeClient = fake.NewSimpleClientset(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+			Spec: v1.PersistentVolumeSpec{PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete}})
+		defer func() { d.kubeClient = nil }()
+		setScripts(output("", 0), output("", 0))
+		path, err := d.ensureThinVolume(context.Background(), "pvc-1", map[string]string{consts.RequestedSizeGib: "3"})
+		require.NoError(t, err)
+		assert.Equal(t, volumePath, path)
+		assert.Equal(t, []string{
+			"lvs --noheadings --separator , --options lv_name,pool_lv,lv_device_open,lv_tags --select lv_name=pvc_1 " + thinPoolVGName,
+			"lvcreate --yes --type thin --virtualsize 3g --thinpool pool --name pvc_1 --addtag azuredisk_pv=pvc-1 " +
+				"--addtag azuredisk_reclaimpolicy=Delete " + thinPoolVGName,
+		}, cmds)
+	})
+
+	t.Run("create thin volume without persistent volume", func(t *testing.T) {
+		d.kubeClient = fake.NewSimpleClientset()
+		defer func() { d.kubeClient = nil }()
+		setScripts(output("", 0))
+		_, err := d.ensureThinVolume(context.Background(), "pvc-1", nil)
+		assert.ErrorContains(t, err, "failed to get persistent volume pvc-1")
+		assert.Len(t, cmds, 1)
+	})
+
+	t.Run("create thin volume without kubeClient", func(t *testing.T) {
+		setScripts(output("", 0))
+		_, err := d.ensureThinVolume(context.Background(), "pvc-1", nil)
+		assert.ErrorContains(t, err, "thin volumes require a kube client")
+		assert.Len(t, cmds, 1)
+	})
+
+	t.Run("activate existing thin volume", func(t *testing.T) {
+		setScripts(output("  pvc_1,pool,,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n", 0), output("", 0))
+		_, err := d.ensureThinVolume(context.Background(), "pvc-1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"lvs --noheadings --separator , --options lv_name,pool_lv,lv_device_open,lv_tags --select lv_name=pvc_1 " + thinPoolVGName, "lvchange --activate y " + thinPoolVGName + "/pvc_1"}, cmds)
+	})
+
+	t.Run("fail to activate existing thin volume", func(t *testing.T) {
+		setScripts(output("  pvc_1,pool,,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n", 0),
+			output("  Check of pool "+thinPoolVGName+"/pool failed (status:1). Manual repair required!", 5))
+		_, err := d.ensureThinVolume(context.Background(), "pvc-1", nil)
+		assert.ErrorContains(t, err, "failed to activate thin volume pvc_1")
+		assert.Len(t, cmds, 2)
+	})
+
+	t.Run("fail to list thin volume", func(t *testing.T) {
+		setScripts(output("  Unable to obtain global lock.", 5))
+		_, err := d.ensureThinVolume(context.Background(), "pvc-1", nil)
+		assert.ErrorContains(t, err, "failed to list thin volumes of "+thinPoolVGName)
+		assert.Len(t, cmds, 1)
+	})
+
+	require.NoError(t, os.WriteFile(volumePath, nil, 0600))
+
+	t.Run("grow thin volume", func(t *testing.T) {
+		setScripts(output("  New size (1280 extents) matches existing size (1280 extents).", 5))
+		require.NoError(t, d.growThinVolume(context.Background(), "pvc_1", 5))
+		assert.Equal(t, []string{"lvextend --size 5g " + thinPoolVGName + "/pvc_1"}, cmds)
+	})
+
+	t.Run("deactivate thin volume", func(t *testing.T) {
+		setScripts(output("", 0))
+		require.NoError(t, d.deactivateThinVolume(context.Background(), "pvc-1"))
+		assert.Equal(t, []string{"lvchange --activate n " + thinPoolVGName + "/pvc_1"}, cmds)
+	})
+
+	t.Run("grow pool", func(t *testing.T) {
+		setScripts(output("  "+tag+"\n", 0), output("  /dev/sdd\n", 0), output("", 0), output("  256\n", 0), output("", 0))
+		require.NoError(t, d.growThinPool(context.Background(), "pool_1"))
+		assert.Equal(t, []string{
+			"vgs --noheadings --options vg_tags " + thinPoolVGName,
+			"pvs --noheadings --options pv_name --select vg_name=" + thinPoolVGName,
+			"pvresize /dev/sdd",
+			"vgs --noheadings --options vg_free_count " + thinPoolVGName,
+			"lvextend --extents +100%FREE " + thinPoolVGName + "/pool",
+		}, cmds)
+	})
+
+	t.Run("deactivate pool of another volume", func(t *testing.T) {
+		setScripts(output("  "+tag+"\n", 0))
+		require.NoError(t, d.deactivateThinPool(context.Background(), "vol_1"))
+		assert.Len(t, cmds, 1)
+	})
+
+	t.Run("refuse deactivating pool with staged thin volumes", func(t *testing.T) {
+		setScripts(output("  "+tag+"\n", 0), output("  pool,,open,\n  pvc_1,pool,open,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n"+
+			"  pvc_2,pool,,azuredisk_pv=pvc-2,azuredisk_reclaimpolicy=Delete\n", 0))
+		err := d.deactivateThinPool(context.Background(), "pool_1")
+		assert.True(t, errors.Is(err, errThinPoolInUse))
+		assert.EqualError(t, err, "the LVM thin pool of the node has staged thin volumes, delete the pods using the thin volumes pvc-1 on node fakeNodeID before the pool volume pool_1")
+	})
+
+	t.Run("deactivate pool", func(t *testing.T) {
+		setScripts(output("  "+tag+"\n", 0), output("  pool,,open,\n  pvc_1,pool,,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n", 0), output("", 0))
+		require.NoError(t, d.deactivateThinPool(context.Background(), "pool_1"))
+		assert.Equal(t, []string{
+			"vgs --noheadings --options vg_tags " + thinPoolVGName,
+			"lvs --noheadings --separator , --options lv_name,pool_lv,lv_device_open,lv_tags " + thinPoolVGName,
+			"vgchange --activate n " + thinPoolVGName,
+		}, cmds)
+	})
+
+	t.Run("pool condition", func(t *testing.T) {
+		setScripts(output("  45.00,10.20\n", 0))
+		assert.Equal(t, &csi.VolumeCondition{Message: "volume is healthy"}, d.getThinPoolCondition())
+		setScripts(output("  93.50,10.20\n", 0))
+		assert.Equal(t, &csi.VolumeCondition{Abnormal: true, Message: "the data of the LVM thin pool is 93.5% full, expand the pool volume"},
+			d.getThinPoolCondition())
+	})
+
+	thinPV := func(name string, reclaimPolicy v1.PersistentVolumeReclaimPolicy, deleted bool) *v1.PersistentVolume {
+		pv := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{PersistentVolumeReclaimPolicy: reclaimPolicy,
+				PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: getThinVolumeID(d.NodeID, name)}}}}
+		if deleted {
+			pv.DeletionTimestamp = &metav1.Time{}
+			pv.Finalizers = []string{"kubernetes.io/pv-protection", thinVolumeFinalizer}
+		}
+		return pv
+	}
+	setPVs := func(pvs ...*v1.PersistentVolume) *fake.Clientset {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		objects := make([]k8sruntime.Object, 0, len(pvs))
+		for _, pv := range pvs {
+			require.NoError(t, indexer.Add(pv))
+			objects = append(objects, pv)
+		}
+		kubeClient := fake.NewSimpleClientset(objects...)
+		d.kubeClient = kubeClient
+		d.pvLister = corelisters.NewPersistentVolumeLister(indexer)
+		d.pvListerSynced = func() bool { return true }
+		return kubeClient
+	}
+	defer func() {
+		d.kubeClient, d.pvLister, d.pvListerSynced = nil, nil, nil
+	}()
+	lvsPVC1 := "lvs --noheadings --separator , --options lv_name,pool_lv,lv_device_open,lv_tags --select lv_name=pvc_1 " + thinPoolVGName
+
+	t.Run("remove deleted thin volume", func(t *testing.T) {
+		pv := thinPV("pvc-1", v1.PersistentVolumeReclaimDelete, true)
+		kubeClient := setPVs(pv)
+		setScripts(output("  pvc_1,pool,,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n", 0), output("", 0))
+		require.NoError(t, d.removeDeletedThinVolume(context.Background(), pv))
+		assert.Equal(t, []string{lvsPVC1, "lvremove --yes " + thinPoolVGName + "/pvc_1"}, cmds)
+		pv, err := kubeClient.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-1", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"kubernetes.io/pv-protection"}, pv.Finalizers)
+	})
+
+	t.Run("keep deleted thin volume in use", func(t *testing.T) {
+		pv := thinPV("pvc-1", v1.PersistentVolumeReclaimDelete, true)
+		kubeClient := setPVs(pv)
+		setScripts(output("  pvc_1,pool,open,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n", 0))
+		assert.EqualError(t, d.removeDeletedThinVolume(context.Background(), pv), "thin volume pvc_1 is still in use")
+		pv, err := kubeClient.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-1", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Contains(t, pv.Finalizers, thinVolumeFinalizer)
+	})
+
+	t.Run("remove finalizer of never staged thin volume", func(t *testing.T) {
+		pv := thinPV("pvc-1", v1.PersistentVolumeReclaimDelete, true)
+		kubeClient := setPVs(pv)
+		setScripts(output("", 0))
+		require.NoError(t, d.removeDeletedThinVolume(context.Background(), pv))
+		assert.Equal(t, []string{lvsPVC1}, cmds)
+		pv, err := kubeClient.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-1", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, pv.Finalizers, thinVolumeFinalizer)
+	})
+
+	t.Run("skip persistent volumes not deleted or on another node", func(t *testing.T) {
+		setScripts()
+		require.NoError(t, d.removeDeletedThinVolume(context.Background(), thinPV("pvc-1", v1.PersistentVolumeReclaimDelete, false)))
+		pv := thinPV("pvc-1", v1.PersistentVolumeReclaimDelete, true)
+		pv.Spec.CSI.VolumeHandle = getThinVolumeID("node-2", "pvc-1")
+		require.NoError(t, d.removeDeletedThinVolume(context.Background(), pv))
+		assert.Empty(t, cmds)
+	})
+
+	t.Run("collect deleted volumes", func(t *testing.T) {
+		setPVs(thinPV("pvc-2", v1.PersistentVolumeReclaimDelete, false), thinPV("pvc-5", v1.PersistentVolumeReclaimRetain, false),
+			thinPV("pvc-6", v1.PersistentVolumeReclaimDelete, true))
+		setScripts(output("", 0), output("  pool,,open,\n"+
+			"  pvc_1,pool,,azuredisk_pv=pvc-1,azuredisk_reclaimpolicy=Delete\n"+
+			"  pvc_2,pool,,azuredisk_pv=pvc-2,azuredisk_reclaimpolicy=Delete\n"+
+			"  pvc_3,pool,open,azuredisk_pv=pvc-3,azuredisk_reclaimpolicy=Delete\n"+
+			"  pvc_4,pool,,azuredisk_pv=pvc-4,azuredisk_reclaimpolicy=Retain\n"+
+			"  pvc_5,pool,,azuredisk_pv=pvc-5,azuredisk_reclaimpolicy=Delete\n"+
+			"  pvc_6,pool,,azuredisk_pv=pvc-6,azuredisk_reclaimpolicy=Delete\n"+
+			"  data,pool,,\n", 0), output("", 0), output("", 0))
+		d.collectThinVolumes(context.Background())
+		assert.Equal(t, []string{
+			"lvs --noheadings --separator , --options lv_name,pool_lv,lv_device_open,lv_tags --select lv_name=pvc_6 " + thinPoolVGName,
+			"lvs --noheadings --separator , --options lv_name,pool_lv,lv_device_open,lv_tags " + thinPoolVGName,
+			"lvremove --yes " + thinPoolVGName + "/pvc_1",
+			"lvchange --deltag azuredisk_reclaimpolicy=Delete --addtag azuredisk_reclaimpolicy=Retain " + thinPoolVGName + "/pvc_5",
+		}, cmds)
+	})
+
+	assert.Equal(t, filepath.Join(devMapperDir, "azuredisk_thinpool-pool"), poolPath)
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+const (
+	// throttlingStateAnnotation holds the JSON encoded throttlingState on the throttling state Lease
+	throttlingStateAnnotation = "disk.csi.azure.com/throttling-state"
+	// armRateLimiterWindowPrefix prefixes the windows of the ARM rate limiter in throttlingState
+	armRateLimiterWindowPrefix  = "arm_rate_limiter"
+	throttlingStateSyncInterval = 15 * time.Second
+)
+
+// throttlingState is the persisted form of the throttling windows of the controller
+type throttlingState struct {
+	// Windows maps <cacheName>/<key> and arm_rate_limiter/<subscription>/<class> to the window expiry
+	Windows map[string]time.Time `json:"windows"`
+}
+
+// throttlingCaches returns the timed caches whose entries are throttling windows
+func (d *Driver) throttlingCaches() map[string]azcache.Resource {
+	return map[string]azcache.Resource{
+		throttlingCacheName:        d.throttlingCache,
+		checkDiskLunThrottlingName: d.checkDiskLunThrottlingCache,
+	}
+}
+
+// localThrottlingWindows returns the live throttling windows of this controller
+func (d *Driver) localThrottlingWindows(now time.Time) map[string]time.Time {
+	windows := map[string]time.Time{}
+	for name, cache := range d.throttlingCaches() {
+		if cache == nil {
+			continue
+		}
+		for key, remaining := range liveCacheEntries(cache, now) {
+			windows[name+"/"+key] = now.Add(remaining).Truncate(time.Second)
+		}
+	}
+	for key, until := range d.armRateLimiter.Windows() {
+		windows[armRateLimiterWindowPrefix+"/"+key] = until.Truncate(time.Second)
+	}
+	return windows
+}
+
+// restoreThrottlingWindow applies a window read from the throttling state Lease
+func (d *Driver) restoreThrottlingWindow(name string, expiry, now time.Time) error {
+	prefix, key, found := strings.Cut(name, "/")
+	if !found || key == "" {
+		return fmt.Errorf("invalid throttling window %q", name)
+	}
+	if prefix == armRateLimiterWindowPrefix {
+		return d.armRateLimiter.Block(key, expiry)
+	}
+	cache, ok := d.throttlingCaches()[prefix]
+	if !ok {
+		return fmt.Errorf("unknown throttling cache %q", prefix)
+	}
+	if cache == nil {
+		return nil
+	}
+	return restoreCacheEntry(cache, key, expiry, now)
+}
+
+// restoreCacheEntry sets key in a timed cache so that it expires at expiry, or after TTL if that is earlier
+func restoreCacheEntry(cache azcache.Resource, key string, expiry, now time.Time) error {
+	timedCache, ok := cache.(*azcache.TimedCache)
+	if !ok {
+		return fmt.Errorf("unsupported cache type %T", cache)
+	}
+	if remaining, found := liveCacheEntries(cache, now)[key]; found && !now.Add(remaining).Before(expiry) {
+		return nil
+	}
+	timedCache.Set(key, "")
+	obj, exists, err := timedCache.Store.GetByKey(key)
+	if err != nil || !exists {
+		return fmt.Errorf("failed to restore cache entry %s: %v", key, err)
+	}
+	entry := obj.(*azcache.AzureCacheEntry)
+	createdOn := expiry.Add(-timedCache.TTL)
+	if createdOn.After(now) {
+		createdOn = now
+	}
+	entry.Lock.Lock()
+	entry.CreatedOn = createdOn
+	entry.Lock.Unlock()
+	return nil
+}
+
+// syncThrottlingState merges the throttling windows of this controller with the windows stored on the
+// throttling state Lease. Windows of the Lease are applied locally, so that a restarted controller
+// or a new leader honors the windows of its predecessor, and the Lease is updated when the merged
+// windows differ from the stored ones. Expired windows are dropped on both sides.
+func (d *Driver) syncThrottlingState(ctx context.Context) {
+	if d.kubeClient == nil || d.throttlingStateLeaseName == "" {
+		return
+	}
+	now := time.Now()
+	leases := d.kubeClient.CoordinationV1().Leases(d.throttlingStateLeaseNamespace)
+	lease, err := leases.Get(ctx, d.throttlingStateLeaseName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("failed to get throttling state lease %s/%s: %v", d.throttlingStateLeaseNamespace, d.throttlingStateLeaseName, err)
+		return
+	}
+	if apierrors.IsNotFound(err) {
+		lease = nil
+	}
+
+	stored := map[string]time.Time{}
+	if lease != nil {
+		if value, ok := lease.Annotations[throttlingStateAnnotation]; ok {
+			var state throttlingState
+			if err := json.Unmarshal([]byte(value), &state); err != nil {
+				klog.Warningf("ignore invalid throttling state on lease %s/%s: %v", d.throttlingStateLeaseNamespace, d.throttlingStateLeaseName, err)
+			} else if state.Windows != nil {
+				stored = state.Windows
+			}
+		}
+	}
+
+	merged := d.localThrottlingWindows(now)
+	for name, expiry := range stored {
+		if !expiry.After(now) {
+			continue
+		}
+		if current, ok := merged[name]; ok && !current.Before(expiry) {
+			continue
+		}
+		if err := d.restoreThrottlingWindow(name, expiry, now); err != nil {
+			klog.Warningf("ignore throttling window %s: %v", name, err)
+			continue
+		}
+		klog.V(2).Infof("restored throttling window %s until %v", name, expiry)
+		merged[name] = expiry
+	}
+	if sameThrottlingWindows(merged, stored) {
+		return
+	}
+
+	value, err := json.Marshal(throttlingState{Windows: merged})
+	if err != nil {
+		klog.Warningf("failed to marshal throttling state: %v", err)
+		return
+	}
+	if lease == nil {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        d.throttlingStateLeaseName,
+				Namespace:   d.throttlingStateLeaseNamespace,
+				Annotations: map[string]string{throttlingStateAnnotation: string(value)},
+			},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+	} else {
+		lease = lease.DeepCopy()
+		if lease.Annotations == nil {
+			lease.Annotations = map[string]string{}
+		}
+		lease.Annotations[throttlingStateAnnotation] = string(value)
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		klog.Warningf("failed to save throttling state to lease %s/%s: %v", d.throttlingStateLeaseNamespace, d.throttlingStateLeaseName, err)
+		return
+	}
+	klog.V(4).Infof("saved %d throttling windows to lease %s/%s", len(merged), d.throttlingStateLeaseNamespace, d.throttlingStateLeaseName)
+}
+
+// sameThrottlingWindows compares windows by instant since decoded times carry a different location
+func sameThrottlingWindows(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, expiry := range a {
+		if other, ok := b[name]; !ok || !other.Equal(expiry) {
+			return false
+		}
+	}
+	return true
+}
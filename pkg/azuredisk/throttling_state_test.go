@@ -0,0 +1,127 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/ratelimit"
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+func newThrottlingStateTestDriver(t *testing.T, cntl *gomock.Controller, kubeClient clientset.Interface) *fakeDriver {
+	fd, err := NewFakeDriver(cntl)
+	assert.NoError(t, err)
+	d := fd.(*fakeDriver)
+	getter := func(_ context.Context, _ string) (interface{}, error) { return nil, nil }
+	d.throttlingCache, _ = azcache.NewTimedCache(5*time.Minute, getter, false)
+	d.checkDiskLunThrottlingCache, _ = azcache.NewTimedCache(30*time.Minute, getter, false)
+	d.armRateLimiter = ratelimit.NewLimiter(ratelimit.DefaultConfig())
+	d.kubeClient = kubeClient
+	d.throttlingStateLeaseName = "csi-azuredisk-throttling-state"
+	d.throttlingStateLeaseNamespace = "kube-system"
+	return d
+}
+
+func getThrottlingState(t *testing.T, kubeClient clientset.Interface) map[string]time.Time {
+	lease, err := kubeClient.CoordinationV1().Leases("kube-system").Get(context.Background(), "csi-azuredisk-throttling-state", metav1.GetOptions{})
+	assert.NoError(t, err)
+	var state throttlingState
+	assert.NoError(t, json.Unmarshal([]byte(lease.Annotations[throttlingStateAnnotation]), &state))
+	return state.Windows
+}
+
+func TestSyncThrottlingState(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	kubeClient := fake.NewSimpleClientset()
+
+	d := newThrottlingStateTestDriver(t, cntl, kubeClient)
+	// nothing is written without throttling windows
+	d.syncThrottlingState(context.Background())
+	_, err := kubeClient.CoordinationV1().Leases("kube-system").Get(context.Background(), d.throttlingStateLeaseName, metav1.GetOptions{})
+	assert.Error(t, err)
+
+	d.setThrottlingCache(consts.GetDiskThrottlingKey, "")
+	d.armRateLimiter.Observe("sub", "disk_write", fmt.Errorf("Retriable: true, RetryAfter: 60s, HTTPStatusCode: 429, RawError: %s", consts.TooManyRequests))
+	d.syncThrottlingState(context.Background())
+	windows := getThrottlingState(t, kubeClient)
+	assert.Len(t, windows, 2)
+	getDiskWindow := windows[throttlingCacheName+"/"+consts.GetDiskThrottlingKey]
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), getDiskWindow, 2*time.Second)
+	assert.Contains(t, windows, armRateLimiterWindowPrefix+"/sub/disk_write")
+
+	// a restarted controller restores the windows
+	restarted := newThrottlingStateTestDriver(t, cntl, kubeClient)
+	assert.False(t, restarted.isGetDiskThrottled(context.Background()))
+	restarted.syncThrottlingState(context.Background())
+	assert.True(t, restarted.isGetDiskThrottled(context.Background()))
+	remaining := liveCacheEntries(restarted.throttlingCache, time.Now())[consts.GetDiskThrottlingKey]
+	assert.WithinDuration(t, getDiskWindow, time.Now().Add(remaining), 2*time.Second)
+	assert.True(t, restarted.armRateLimiter.IsThrottled("sub", "disk_write"))
+	assert.Equal(t, windows, getThrottlingState(t, kubeClient))
+}
+
+func TestSyncThrottlingStateIgnoresStaleWindows(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	now := time.Now().Truncate(time.Second)
+	value, _ := json.Marshal(throttlingState{Windows: map[string]time.Time{
+		throttlingCacheName + "/" + consts.GetDiskThrottlingKey:             now.Add(-time.Minute),
+		checkDiskLunThrottlingName + "/" + consts.CheckDiskLunThrottlingKey: now.Add(10 * time.Minute),
+		armRateLimiterWindowPrefix + "/sub/vm_write":                        now.Add(time.Minute),
+		"unknown/key": now.Add(time.Minute),
+	}})
+	kubeClient := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "csi-azuredisk-throttling-state",
+			Namespace:   "kube-system",
+			Annotations: map[string]string{throttlingStateAnnotation: string(value)},
+		},
+	})
+
+	d := newThrottlingStateTestDriver(t, cntl, kubeClient)
+	d.syncThrottlingState(context.Background())
+	assert.False(t, d.isGetDiskThrottled(context.Background()))
+	assert.True(t, d.isCheckDiskLunThrottled(context.Background()))
+	assert.True(t, d.armRateLimiter.IsThrottled("sub", "vm_write"))
+
+	windows := getThrottlingState(t, kubeClient)
+	assert.Len(t, windows, 2)
+	assert.True(t, windows[checkDiskLunThrottlingName+"/"+consts.CheckDiskLunThrottlingKey].Equal(now.Add(10*time.Minute)))
+	assert.True(t, windows[armRateLimiterWindowPrefix+"/sub/vm_write"].Equal(now.Add(time.Minute)))
+
+	// an invalid state is overwritten with the local windows
+	lease, _ := kubeClient.CoordinationV1().Leases("kube-system").Get(context.Background(), "csi-azuredisk-throttling-state", metav1.GetOptions{})
+	lease.Annotations[throttlingStateAnnotation] = "invalid"
+	_, err := kubeClient.CoordinationV1().Leases("kube-system").Update(context.Background(), lease, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	d.syncThrottlingState(context.Background())
+	assert.Len(t, getThrottlingState(t, kubeClient), 2)
+}
@@ -19,13 +19,44 @@ package azuredisk
 import (
 	"context"
 	"fmt"
+	"net/http"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/ratelimit"
+)
+
+const tracerName = "sigs.k8s.io/azuredisk-csi-driver/pkg/azuredisk"
+
+// span attributes of the driver
+const (
+	attrVolumeID     = attribute.Key("azuredisk.volume_id")
+	attrNode         = attribute.Key("azuredisk.node")
+	attrLun          = attribute.Key("azuredisk.lun")
+	attrSKU          = attribute.Key("azuredisk.sku")
+	attrBatchID      = attribute.Key("azuredisk.batch_id")
+	attrBatchSize    = attribute.Key("azuredisk.batch_size")
+	attrQueueLength  = attribute.Key("azuredisk.queue_length")
+	attrThrottled    = attribute.Key("azuredisk.throttled")
+	attrOperation    = attribute.Key("azuredisk.operation")
+	attrFsType       = attribute.Key("azuredisk.fs_type")
+	attrTargetPath   = attribute.Key("azuredisk.target_path")
+	attrResourceType = attribute.Key("azure.resource_type")
+	attrMethod       = attribute.Key("azure.method")
+	attrResourceName = attribute.Key("azure.resource_name")
+	attrRG           = attribute.Key("azure.resource_group")
+	attrSubscription = attribute.Key("azure.subscription_id")
 )
 
 func InitOtelTracing() (*otlptrace.Exporter, error) {
@@ -54,6 +85,48 @@ func InitOtelTracing() (*otlptrace.Exporter, error) {
 
 	// Register the trace provider as global.
 	otel.SetTracerProvider(traceProvider)
+	// Propagate the trace context to ARM in the traceparent header
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
 	return exporter, nil
 }
+
+// startSpan starts a child span of the span in ctx, it is a no-op span if tracing is disabled
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, oteltrace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span and ends it
+func endSpan(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// armTracingInterceptor returns an interceptor which wraps every ARM call in a client span and
+// passes the trace context to the Azure SDK HTTP pipeline, so that ARM requests carry the traceparent header
+func armTracingInterceptor(limiter *ratelimit.Limiter) interceptor.Interceptor {
+	return func(ctx context.Context, op *interceptor.Operation, invoke interceptor.Invoker) (interface{}, error) {
+		class := ratelimit.Class(op)
+		ctx, span := otel.Tracer(tracerName).Start(ctx, fmt.Sprintf("ARM %s.%s", op.ResourceType, op.Method),
+			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+			oteltrace.WithAttributes(
+				attrSubscription.String(op.SubscriptionID),
+				attrResourceType.String(string(op.ResourceType)),
+				attrMethod.String(op.Method),
+				attrRG.String(op.ResourceGroup),
+				attrResourceName.String(op.ResourceName),
+				attrThrottled.Bool(limiter.IsThrottled(op.SubscriptionID, class)),
+			))
+		header := http.Header{}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+		if len(header) > 0 {
+			ctx = policy.WithHTTPHeader(ctx, header)
+		}
+		result, err := invoke(ctx)
+		endSpan(span, err)
+		return result, err
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredisk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+)
+
+// spanRecorder keeps the ended spans
+type spanRecorder struct {
+	sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *spanRecorder) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+func (r *spanRecorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.Lock()
+	defer r.Unlock()
+	r.spans = append(r.spans, s)
+}
+func (r *spanRecorder) Shutdown(context.Context) error   { return nil }
+func (r *spanRecorder) ForceFlush(context.Context) error { return nil }
+
+func (r *spanRecorder) span(name string) sdktrace.ReadOnlySpan {
+	r.Lock()
+	defer r.Unlock()
+	for _, s := range r.spans {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// setupTracing installs a global tracer provider recording the spans and restores the previous one at cleanup
+func setupTracing(t *testing.T) *spanRecorder {
+	recorder := &spanRecorder{}
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+	return recorder
+}
+
+func TestStartSpan(t *testing.T) {
+	recorder := setupTracing(t)
+
+	ctx, parent := startSpan(context.Background(), "parent")
+	_, child := startSpan(ctx, "child", attrLun.Int(3), attrBatchSize.Int(2))
+	endSpan(child, errors.New("attach failed"))
+	endSpan(parent, nil)
+
+	parentSpan, childSpan := recorder.span("parent"), recorder.span("child")
+	assert.NotNil(t, parentSpan)
+	assert.NotNil(t, childSpan)
+	assert.Equal(t, parentSpan.SpanContext().SpanID(), childSpan.Parent().SpanID())
+	assert.Equal(t, codes.Error, childSpan.Status().Code)
+	assert.Equal(t, "attach failed", childSpan.Status().Description)
+	assert.Equal(t, codes.Unset, parentSpan.Status().Code)
+	assert.Contains(t, childSpan.Attributes(), attrLun.Int(3))
+	assert.Contains(t, childSpan.Attributes(), attrBatchSize.Int(2))
+}
+
+type transporterFunc func(*http.Request) (*http.Response, error)
+
+func (f transporterFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestARMTracingInterceptor(t *testing.T) {
+	recorder := setupTracing(t)
+
+	var traceparent string
+	pipeline := azruntime.NewPipeline("test", "v1", azruntime.PipelineOptions{}, &policy.ClientOptions{
+		Retry: policy.RetryOptions{MaxRetries: -1},
+		Transport: transporterFunc(func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("traceparent")
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+	})
+
+	op := &interceptor.Operation{
+		SubscriptionID: "sub",
+		ResourceType:   interceptor.ResourceTypeVirtualMachine,
+		Method:         "CreateOrUpdate",
+		ResourceGroup:  "rg",
+		ResourceName:   "vm",
+		Mutating:       true,
+	}
+	_, err := armTracingInterceptor(nil)(context.Background(), op, func(ctx context.Context) (interface{}, error) {
+		req, err := azruntime.NewRequest(ctx, http.MethodPut, "https://management.azure.com/vm")
+		if err != nil {
+			return nil, err
+		}
+		_, err = pipeline.Do(req)
+		return nil, err
+	})
+	assert.NoError(t, err)
+
+	span := recorder.span("ARM virtualMachine.CreateOrUpdate")
+	assert.NotNil(t, span)
+	assert.Contains(t, span.Attributes(), attrResourceName.String("vm"))
+	assert.Contains(t, span.Attributes(), attrThrottled.Bool(false))
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+	assert.Contains(t, traceparent, span.SpanContext().SpanID().String())
+}
+
+func TestLockNodeAndWaitForBatchSpans(t *testing.T) {
+	recorder := setupTracing(t)
+	c := &controllerCommon{lockMap: newLockMap(), AttachDetachInitialDelayInMs: 1}
+
+	c.lockNode(context.Background(), "node1", attachOperation)
+	c.waitForBatch(context.Background(), "node1", attachOperation)
+	c.lockMap.UnlockEntry("node1")
+
+	for _, name := range []string{"waitForNodeLock", "waitForBatch"} {
+		span := recorder.span(name)
+		if assert.NotNil(t, span, name) {
+			assert.Contains(t, span.Attributes(), attrNode.String("node1"))
+			assert.Contains(t, span.Attributes(), attrOperation.String(attachOperation))
+		}
+	}
+}
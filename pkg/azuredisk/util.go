@@ -16,7 +16,10 @@ limitations under the License.
 
 package azuredisk
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 // lockMap used to lock on entries
 type lockMap struct {
@@ -55,3 +58,21 @@ func (lm *lockMap) UnlockEntry(entry string) {
 	}
 	mutex.Unlock()
 }
+
+// HeldEntries returns the sorted entries whose locks are currently held.
+// It is only intended for debugging since an entry may be released right after the check.
+func (lm *lockMap) HeldEntries() []string {
+	lm.Lock()
+	defer lm.Unlock()
+
+	entries := []string{}
+	for entry, mutex := range lm.mutexMap {
+		if mutex.TryLock() {
+			mutex.Unlock()
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
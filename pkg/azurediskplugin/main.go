@@ -18,14 +18,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 
+	"github.com/go-logr/logr/funcr"
 	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/azuredisk-csi-driver/pkg/azuredisk"
@@ -44,7 +49,11 @@ var (
 	version        = flag.Bool("version", false, "Print the version and exit.")
 	metricsAddress = flag.String("metrics-address", "", "export the metrics")
 	preStopHook    = flag.Bool("pre-stop-hook", false, "enable pre-stop hook")
-	driverOptions  azuredisk.DriverOptions
+	// debug server exposes pprof and driver in-memory state, it is bound to localhost by default
+	enableDebugServer = flag.Bool("enable-debug-server", false, "enable the debug server serving pprof and driver in-memory state")
+	debugAddress      = flag.String("debug-address", "localhost:29606", "address of the debug server")
+	loggingFormat     = flag.String("logging-format", "text", "log output format, text or json")
+	driverOptions     azuredisk.DriverOptions
 )
 
 // exit is a separate function to handle program termination
@@ -54,6 +63,9 @@ var exit = func(code int) {
 
 func main() {
 	flag.Parse()
+	if err := setupLogging(*loggingFormat, os.Stderr); err != nil {
+		klog.Fatalln(err)
+	}
 	if *version {
 		info, err := azuredisk.GetVersionYAML(driverOptions.DriverName)
 		if err != nil {
@@ -69,6 +81,25 @@ func main() {
 	exit(0)
 }
 
+// setupLogging makes klog write JSON lines to out if format is json, the -v flag still sets the verbosity
+func setupLogging(format string, out io.Writer) error {
+	switch format {
+	case "text":
+		return nil
+	case "json":
+		verbosity := 0
+		if f := flag.Lookup("v"); f != nil {
+			verbosity, _ = strconv.Atoi(f.Value.String())
+		}
+		klog.SetLogger(funcr.NewJSON(func(obj string) {
+			fmt.Fprintln(out, obj)
+		}, funcr.Options{LogCaller: funcr.All, LogTimestamp: true, Verbosity: verbosity}))
+		return nil
+	default:
+		return fmt.Errorf("unsupported logging format %q, supported formats are text and json", format)
+	}
+}
+
 func handlePreStopHook(kubeconfig string) {
 	kubeClient, err := azureutils.GetKubeClient(kubeconfig)
 	if err != nil {
@@ -90,6 +121,7 @@ func handle() {
 	if driver == nil {
 		klog.Fatalln("Failed to initialize azuredisk CSI Driver")
 	}
+	exportDebugServer(driver.GetDebugState)
 	if err := driver.Run(context.Background()); err != nil {
 		klog.Fatalf("Failed to run azuredisk CSI Driver: %v", err)
 	}
@@ -124,6 +156,45 @@ func serveMetrics(l net.Listener) error {
 	return trapClosedConnErr(http.Serve(l, m))
 }
 
+func exportDebugServer(getState func() *azuredisk.DebugState) {
+	if !*enableDebugServer {
+		return
+	}
+	l, err := net.Listen("tcp", *debugAddress)
+	if err != nil {
+		klog.Warningf("failed to get listener for debug endpoint: %v", err)
+		return
+	}
+	if addr, ok := l.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		klog.Warningf("debug server is listening on non-loopback address %v, driver state and pprof are exposed", addr)
+	}
+	klog.V(2).Infof("set up debug server on %v", l.Addr().String())
+	go func() {
+		defer l.Close()
+		if err := serveDebug(l, getState); err != nil {
+			klog.Errorf("debug server failure(%v), address(%v)", err, l.Addr().String())
+		}
+	}()
+}
+
+func serveDebug(l net.Listener, getState func() *azuredisk.DebugState) error {
+	m := http.NewServeMux()
+	m.HandleFunc("/debug/pprof/", pprof.Index)
+	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	m.HandleFunc("/debug/state", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(getState()); err != nil {
+			klog.Errorf("failed to encode driver state: %v", err)
+		}
+	})
+	return trapClosedConnErr(http.Serve(l, m))
+}
+
 func trapClosedConnErr(err error) error {
 	if err == nil {
 		return nil
@@ -17,11 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azuredisk"
 )
 
 func TestMain(t *testing.T) {
@@ -80,3 +89,63 @@ func TestTrapClosedConnErr(t *testing.T) {
 		}
 	}
 }
+
+func TestServeDebug(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	expected := &azuredisk.DebugState{
+		VolumeLocks:    []string{"vol-1"},
+		LockMapEntries: []string{"node-1"},
+	}
+	go func() {
+		_ = serveDebug(l, func() *azuredisk.DebugState { return expected })
+	}()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/debug/state", l.Addr().String()))
+	if err != nil {
+		t.Fatalf("failed to get debug state: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read debug state: %v", err)
+	}
+	state := &azuredisk.DebugState{}
+	if err := json.Unmarshal(body, state); err != nil {
+		t.Fatalf("failed to unmarshal debug state(%s): %v", string(body), err)
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("Expected state %v, but got %v", expected, state)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("http://%s/debug/pprof/", l.Addr().String()))
+	if err != nil {
+		t.Fatalf("failed to get pprof index: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	defer klog.ClearLogger()
+
+	assert.NoError(t, setupLogging("text", io.Discard))
+	assert.Error(t, setupLogging("yaml", io.Discard))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, setupLogging("json", buf))
+	klog.FromContext(context.Background()).WithValues("requestID", "abc").Info("GRPC call", "method", "/csi.v1.Controller/ControllerPublishVolume")
+	klog.Flush()
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "GRPC call", line["msg"])
+	assert.Equal(t, "abc", line["requestID"])
+	assert.Equal(t, "/csi.v1.Controller/ControllerPublishVolume", line["method"])
+}
@@ -97,13 +97,16 @@ type ManagedDiskParameters struct {
 	DiskName                string
 	EnableBursting          *bool
 	PerformancePlus         *bool
+	FormatOptions           []string
 	FsType                  string
 	Location                string
 	LogicalSectorSize       int
+	LVMThinPool             string
 	MaxShares               int
 	NetworkAccessPolicy     string
 	PublicNetworkAccess     string
 	PerfProfile             string
+	StripeCount             int
 	SubscriptionID          string
 	ResourceGroup           string
 	Tags                    map[string]string
@@ -312,6 +315,70 @@ func GetFStype(attributes map[string]string) string {
 	return ""
 }
 
+// GetFsckPolicy returns the fsckPolicy attribute in lower case, none if it is not set
+func GetFsckPolicy(attributes map[string]string) (string, error) {
+	for k, v := range attributes {
+		if strings.EqualFold(k, consts.FsckPolicyField) {
+			policy := strings.ToLower(v)
+			switch policy {
+			case consts.FsckPolicyNone, consts.FsckPolicyCheck, consts.FsckPolicyRepair:
+				return policy, nil
+			}
+			return "", fmt.Errorf("%s %s is not supported, supported policies are %s, %s and %s", consts.FsckPolicyField, v,
+				consts.FsckPolicyNone, consts.FsckPolicyCheck, consts.FsckPolicyRepair)
+		}
+	}
+	return consts.FsckPolicyNone, nil
+}
+
+// GetHostEncryption returns the hostEncryption attribute in lower case, none if it is not set
+func GetHostEncryption(attributes map[string]string) (string, error) {
+	for k, v := range attributes {
+		if strings.EqualFold(k, consts.HostEncryptionField) {
+			encryption := strings.ToLower(v)
+			switch encryption {
+			case consts.HostEncryptionNone, consts.HostEncryptionLUKS:
+				return encryption, nil
+			}
+			return "", fmt.Errorf("%s %s is not supported, supported values are %s and %s", consts.HostEncryptionField, v,
+				consts.HostEncryptionNone, consts.HostEncryptionLUKS)
+		}
+	}
+	return consts.HostEncryptionNone, nil
+}
+
+// GetLVMThinPool returns the role of the volume in the LVM thin pool of a node: pool for the disk backing the
+// thin pool, volume for a thin logical volume carved out of it, empty if the volume does not use the thin pool
+func GetLVMThinPool(attributes map[string]string) (string, error) {
+	for k, v := range attributes {
+		if strings.EqualFold(k, consts.LVMThinPoolField) {
+			role := strings.ToLower(v)
+			switch role {
+			case consts.LVMThinPoolPool, consts.LVMThinPoolVolume:
+				return role, nil
+			}
+			return "", fmt.Errorf("%s %s is not supported, supported values are %s and %s", consts.LVMThinPoolField, v,
+				consts.LVMThinPoolPool, consts.LVMThinPoolVolume)
+		}
+	}
+	return "", nil
+}
+
+// GetReadOnlyRemountRecovery returns whether the readOnlyRemountRecovery attribute enables the recovery
+// of the volume after it was remounted read-only, false if it is not set
+func GetReadOnlyRemountRecovery(attributes map[string]string) (bool, error) {
+	for k, v := range attributes {
+		if strings.EqualFold(k, consts.ReadOnlyRemountRecoveryField) {
+			recovery, err := strconv.ParseBool(v)
+			if err != nil {
+				return false, fmt.Errorf("invalid %s: %s", consts.ReadOnlyRemountRecoveryField, v)
+			}
+			return recovery, nil
+		}
+	}
+	return false, nil
+}
+
 func GetMaxShares(attributes map[string]string) (int, error) {
 	for k, v := range attributes {
 		switch strings.ToLower(k) {
@@ -559,7 +626,7 @@ func ParseDiskParameters(parameters map[string]string) (ManagedDiskParameters, e
 		Tags:           make(map[string]string),
 		VolumeContext:  parameters,
 	}
-	var originTags, tagValueDelimiter string
+	var originTags, tagValueDelimiter, formatOptions string
 	for k, v := range parameters {
 		switch strings.ToLower(k) {
 		case consts.SkuNameField:
@@ -615,6 +682,36 @@ func ParseDiskParameters(parameters map[string]string) (ManagedDiskParameters, e
 			diskParams.Tags[consts.PvNameTag] = v
 		case consts.FsTypeField:
 			diskParams.FsType = strings.ToLower(v)
+		case consts.FormatOptionsField:
+			formatOptions = v
+		case consts.FsckPolicyField:
+			if _, err = GetFsckPolicy(map[string]string{k: v}); err != nil {
+				return diskParams, err
+			}
+		case consts.HostEncryptionField:
+			if _, err = GetHostEncryption(map[string]string{k: v}); err != nil {
+				return diskParams, err
+			}
+		case consts.VolumeAttributePartition:
+			if !strings.EqualFold(v, consts.VolumeAttributePartitionAuto) {
+				return diskParams, fmt.Errorf("%s %s is not supported in storage class, supported value is %s", consts.VolumeAttributePartition, v, consts.VolumeAttributePartitionAuto)
+			}
+		case consts.ReadOnlyRemountRecoveryField:
+			if _, err = GetReadOnlyRemountRecovery(map[string]string{k: v}); err != nil {
+				return diskParams, err
+			}
+		case consts.LVMThinPoolField:
+			if diskParams.LVMThinPool, err = GetLVMThinPool(map[string]string{k: v}); err != nil {
+				return diskParams, err
+			}
+		case consts.StripeCountField:
+			diskParams.StripeCount, err = strconv.Atoi(v)
+			if err != nil {
+				return diskParams, fmt.Errorf("parse %s failed with error: %v", v, err)
+			}
+			if diskParams.StripeCount < 1 || diskParams.StripeCount > consts.MaxStripeCount {
+				return diskParams, fmt.Errorf("%s %d is not supported, supported values are 1 to %d", consts.StripeCountField, diskParams.StripeCount, consts.MaxStripeCount)
+			}
 		case consts.KindField:
 			// fix csi migration issue: https://github.com/kubernetes/kubernetes/issues/103433
 			diskParams.VolumeContext[consts.KindField] = string(v1.AzureManagedDisk)
@@ -669,6 +766,10 @@ func ParseDiskParameters(parameters map[string]string) (ManagedDiskParameters, e
 		diskParams.Tags[k] = v
 	}
 
+	if diskParams.FormatOptions, err = ParseFormatOptions(diskParams.FsType, formatOptions); err != nil {
+		return diskParams, err
+	}
+
 	if strings.EqualFold(diskParams.AccountType, string(armcompute.DiskStorageAccountTypesPremiumV2LRS)) {
 		if diskParams.CachingMode != "" && !strings.EqualFold(string(diskParams.CachingMode), string(v1.AzureDataDiskCachingNone)) {
 			return diskParams, fmt.Errorf("cachingMode %s is not supported for %s", diskParams.CachingMode, armcompute.DiskStorageAccountTypesPremiumV2LRS)
@@ -756,9 +857,23 @@ func InsertDiskProperties(disk *armcompute.Disk, publishConext map[string]string
 	}
 }
 
+// InsertDiskIdentity inserts the size and unique ID of the disk, which the node verifies the device on the LUN against
+func InsertDiskIdentity(disk *armcompute.Disk, publishContext map[string]string) {
+	if disk == nil || disk.Properties == nil || publishContext == nil {
+		return
+	}
+
+	if disk.Properties.DiskSizeBytes != nil {
+		publishContext[consts.DiskSizeBytesField] = strconv.FormatInt(*disk.Properties.DiskSizeBytes, 10)
+	}
+	if disk.Properties.UniqueID != nil {
+		publishContext[consts.DiskUniqueIDField] = *disk.Properties.UniqueID
+	}
+}
+
 func SleepIfThrottled(err error, defaultSleepSec int) {
 	if err != nil && IsThrottlingError(err) {
-		retryAfter := getRetryAfterSeconds(err)
+		retryAfter := GetRetryAfterSeconds(err)
 		if retryAfter == 0 {
 			retryAfter = defaultSleepSec
 		}
@@ -775,8 +890,8 @@ func IsThrottlingError(err error) bool {
 	return false
 }
 
-// getRetryAfterSeconds returns the number of seconds to wait from the error message
-func getRetryAfterSeconds(err error) int {
+// GetRetryAfterSeconds returns the number of seconds to wait from the error message
+func GetRetryAfterSeconds(err error) int {
 	if err == nil {
 		return 0
 	}
@@ -477,6 +477,147 @@ func TestGetMaxShares(t *testing.T) {
 	}
 }
 
+func TestGetFsckPolicy(t *testing.T) {
+	tests := []struct {
+		options       map[string]string
+		expectedValue string
+		expectedError error
+	}{
+		{
+			nil,
+			consts.FsckPolicyNone,
+			nil,
+		},
+		{
+			map[string]string{"fsckPolicy": "Repair"},
+			consts.FsckPolicyRepair,
+			nil,
+		},
+		{
+			map[string]string{consts.FsckPolicyField: "force"},
+			"",
+			fmt.Errorf("fsckpolicy force is not supported, supported policies are none, check and repair"),
+		},
+	}
+
+	for _, test := range tests {
+		result, err := GetFsckPolicy(test.options)
+		if result != test.expectedValue {
+			t.Errorf("input: %q, GetFsckPolicy result: %v, expected: %v", test.options, result, test.expectedValue)
+		}
+		if !reflect.DeepEqual(err, test.expectedError) {
+			t.Errorf("input: %q, GetFsckPolicy error: %v, expected: %v", test.options, err, test.expectedError)
+		}
+	}
+}
+
+func TestGetHostEncryption(t *testing.T) {
+	tests := []struct {
+		options       map[string]string
+		expectedValue string
+		expectedError error
+	}{
+		{
+			nil,
+			consts.HostEncryptionNone,
+			nil,
+		},
+		{
+			map[string]string{"hostEncryption": "LUKS"},
+			consts.HostEncryptionLUKS,
+			nil,
+		},
+		{
+			map[string]string{consts.HostEncryptionField: "bitlocker"},
+			"",
+			fmt.Errorf("hostencryption bitlocker is not supported, supported values are none and luks"),
+		},
+	}
+
+	for _, test := range tests {
+		result, err := GetHostEncryption(test.options)
+		if result != test.expectedValue {
+			t.Errorf("input: %q, GetHostEncryption result: %v, expected: %v", test.options, result, test.expectedValue)
+		}
+		if !reflect.DeepEqual(err, test.expectedError) {
+			t.Errorf("input: %q, GetHostEncryption error: %v, expected: %v", test.options, err, test.expectedError)
+		}
+	}
+}
+
+func TestGetReadOnlyRemountRecovery(t *testing.T) {
+	tests := []struct {
+		options       map[string]string
+		expectedValue bool
+		expectedError error
+	}{
+		{
+			nil,
+			false,
+			nil,
+		},
+		{
+			map[string]string{"readOnlyRemountRecovery": "True"},
+			true,
+			nil,
+		},
+		{
+			map[string]string{consts.ReadOnlyRemountRecoveryField: "yes"},
+			false,
+			fmt.Errorf("invalid readonlyremountrecovery: yes"),
+		},
+	}
+
+	for _, test := range tests {
+		result, err := GetReadOnlyRemountRecovery(test.options)
+		if result != test.expectedValue {
+			t.Errorf("input: %q, GetReadOnlyRemountRecovery result: %v, expected: %v", test.options, result, test.expectedValue)
+		}
+		if !reflect.DeepEqual(err, test.expectedError) {
+			t.Errorf("input: %q, GetReadOnlyRemountRecovery error: %v, expected: %v", test.options, err, test.expectedError)
+		}
+	}
+}
+
+func TestGetLVMThinPool(t *testing.T) {
+	tests := []struct {
+		options       map[string]string
+		expectedValue string
+		expectedError error
+	}{
+		{
+			nil,
+			"",
+			nil,
+		},
+		{
+			map[string]string{"lvmThinPool": "Pool"},
+			consts.LVMThinPoolPool,
+			nil,
+		},
+		{
+			map[string]string{consts.LVMThinPoolField: "volume"},
+			consts.LVMThinPoolVolume,
+			nil,
+		},
+		{
+			map[string]string{consts.LVMThinPoolField: "true"},
+			"",
+			fmt.Errorf("lvmthinpool true is not supported, supported values are pool and volume"),
+		},
+	}
+
+	for _, test := range tests {
+		result, err := GetLVMThinPool(test.options)
+		if result != test.expectedValue {
+			t.Errorf("input: %q, GetLVMThinPool result: %v, expected: %v", test.options, result, test.expectedValue)
+		}
+		if !reflect.DeepEqual(err, test.expectedError) {
+			t.Errorf("input: %q, GetLVMThinPool error: %v, expected: %v", test.options, err, test.expectedError)
+		}
+	}
+}
+
 func TestGetSourceVolumeID(t *testing.T) {
 	SourceResourceID := "test"
 
@@ -1295,6 +1436,110 @@ func TestParseDiskParameters(t *testing.T) {
 			},
 			expectedError: fmt.Errorf("parse invalidValue failed with error: strconv.Atoi: parsing \"invalidValue\": invalid syntax"),
 		},
+		{
+			name:        "valid formatOptions in parameters",
+			inputParams: map[string]string{consts.FsTypeField: "xfs", consts.FormatOptionsField: "-i size=512 -K"},
+			expectedOutput: ManagedDiskParameters{
+				FsType:         "xfs",
+				FormatOptions:  []string{"-i", "size=512", "-K"},
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.FsTypeField: "xfs", consts.FormatOptionsField: "-i size=512 -K"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: nil,
+		},
+		{
+			name:        "invalid formatOptions in parameters",
+			inputParams: map[string]string{consts.FormatOptionsField: "-O ^resize_inode"},
+			expectedOutput: ManagedDiskParameters{
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.FormatOptionsField: "-O ^resize_inode"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: fmt.Errorf("mkfs option -O is not allowed in formatoptions with fsType ext4"),
+		},
+		{
+			name:        "invalid fsckPolicy in parameters",
+			inputParams: map[string]string{consts.FsckPolicyField: "force"},
+			expectedOutput: ManagedDiskParameters{
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.FsckPolicyField: "force"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: fmt.Errorf("fsckpolicy force is not supported, supported policies are none, check and repair"),
+		},
+		{
+			name:        "automatic partition in parameters",
+			inputParams: map[string]string{consts.VolumeAttributePartition: "Auto"},
+			expectedOutput: ManagedDiskParameters{
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.VolumeAttributePartition: "Auto"},
+				DeviceSettings: make(map[string]string),
+			},
+		},
+		{
+			name:        "partition number in parameters",
+			inputParams: map[string]string{consts.VolumeAttributePartition: "1"},
+			expectedOutput: ManagedDiskParameters{
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.VolumeAttributePartition: "1"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: fmt.Errorf("partition 1 is not supported in storage class, supported value is auto"),
+		},
+		{
+			name:        "invalid hostEncryption in parameters",
+			inputParams: map[string]string{consts.HostEncryptionField: "bitlocker"},
+			expectedOutput: ManagedDiskParameters{
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.HostEncryptionField: "bitlocker"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: fmt.Errorf("hostencryption bitlocker is not supported, supported values are none and luks"),
+		},
+		{
+			name:        "invalid readOnlyRemountRecovery in parameters",
+			inputParams: map[string]string{consts.ReadOnlyRemountRecoveryField: "yes"},
+			expectedOutput: ManagedDiskParameters{
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.ReadOnlyRemountRecoveryField: "yes"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: fmt.Errorf("invalid readonlyremountrecovery: yes"),
+		},
+		{
+			name:        "stripeCount in parameters",
+			inputParams: map[string]string{consts.StripeCountField: "4"},
+			expectedOutput: ManagedDiskParameters{
+				StripeCount:    4,
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.StripeCountField: "4"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: nil,
+		},
+		{
+			name:        "invalid stripeCount in parameters",
+			inputParams: map[string]string{consts.StripeCountField: "17"},
+			expectedOutput: ManagedDiskParameters{
+				StripeCount:    17,
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.StripeCountField: "17"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: fmt.Errorf("stripecount 17 is not supported, supported values are 1 to 16"),
+		},
+		{
+			name:        "lvmThinPool in parameters",
+			inputParams: map[string]string{consts.LVMThinPoolField: "Volume"},
+			expectedOutput: ManagedDiskParameters{
+				LVMThinPool:    consts.LVMThinPoolVolume,
+				Tags:           make(map[string]string),
+				VolumeContext:  map[string]string{consts.LVMThinPoolField: "Volume"},
+				DeviceSettings: make(map[string]string),
+			},
+			expectedError: nil,
+		},
 		{
 			name:        "disk parameters with PremiumV2_LRS",
 			inputParams: map[string]string{consts.SkuNameField: "PremiumV2_LRS"},
@@ -1648,6 +1893,43 @@ func TestInsertDiskProperties(t *testing.T) {
 	}
 }
 
+func TestInsertDiskIdentity(t *testing.T) {
+	tests := []struct {
+		desc        string
+		disk        *armcompute.Disk
+		expectedMap map[string]string
+	}{
+		{
+			desc:        "nil pointer",
+			expectedMap: map[string]string{},
+		},
+		{
+			desc:        "empty",
+			disk:        &armcompute.Disk{Properties: &armcompute.DiskProperties{}},
+			expectedMap: map[string]string{},
+		},
+		{
+			desc: "size and unique ID",
+			disk: &armcompute.Disk{
+				Properties: &armcompute.DiskProperties{
+					DiskSizeBytes: ptr.To(int64(10737418240)),
+					UniqueID:      ptr.To("4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b"),
+				},
+			},
+			expectedMap: map[string]string{
+				consts.DiskSizeBytesField: "10737418240",
+				consts.DiskUniqueIDField:  "4e2b1c3a-90f1-4c6b-9e4a-0c1d2e3f4a5b",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		publishContext := map[string]string{}
+		InsertDiskIdentity(test.disk, publishContext)
+		assert.Equal(t, test.expectedMap, publishContext, test.desc)
+	}
+}
+
 func TestSleepIfThrottled(t *testing.T) {
 	const sleepDuration = 1 * time.Second
 
@@ -1806,9 +2088,9 @@ func TestGetRetryAfterSeconds(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		result := getRetryAfterSeconds(test.err)
+		result := GetRetryAfterSeconds(test.err)
 		if result != test.expected {
-			t.Errorf("desc: (%s), input: err(%v), getRetryAfterSeconds returned with int(%d), not equal to expected(%d)",
+			t.Errorf("desc: (%s), input: err(%v), GetRetryAfterSeconds returned with int(%d), not equal to expected(%d)",
 				test.desc, test.err, result, test.expected)
 		}
 	}
@@ -80,6 +80,15 @@ var (
 	lunStr1   = "2"
 	diskPath1 = "3:0:0:" + lunStr1
 	devName1  = "sde"
+	// nvmeNamespace is the NVMe namespace of the data disk on lun 3
+	nvmeNamespace = "nvme0n5"
+	// nvmeNamespacePath is the path of a controller with native NVMe multipath to the namespace nvme2n7
+	// of the data disk on lun 5
+	nvmeNamespacePath = "nvme2c2n7"
+	// byLunLink is the udev link of the data disk on lun 4
+	byLunLink = "/dev/disk/azure/data/by-lun/4"
+	// partitionName is the first partition of the data disk on lun 1
+	partitionName = devName + "1"
 )
 
 type fakeIOHandler struct{}
@@ -122,6 +131,15 @@ func (handler *fakeIOHandler) ReadDir(dirname string) ([]os.DirEntry, error) {
 			name: "host0",
 		}
 		return []os.DirEntry{n}, nil
+	case "/sys/class/nvme/":
+		// nvme0 and nvme2 expose the remote disks and nvme1 a local disk
+		return []os.DirEntry{&fakeDirEntry{name: "nvme0"}, &fakeDirEntry{name: "nvme1"}, &fakeDirEntry{name: "nvme2"}}, nil
+	case "/sys/class/nvme/nvme0":
+		return []os.DirEntry{&fakeDirEntry{name: "device"}, &fakeDirEntry{name: "nvme0n1"}, &fakeDirEntry{name: nvmeNamespace}}, nil
+	case "/sys/class/nvme/nvme1":
+		return []os.DirEntry{&fakeDirEntry{name: "nvme1n1"}}, nil
+	case "/sys/class/nvme/nvme2":
+		return []os.DirEntry{&fakeDirEntry{name: nvmeNamespacePath}}, nil
 	}
 
 	return nil, fmt.Errorf("bad dir")
@@ -131,11 +149,34 @@ func (handler *fakeIOHandler) WriteFile(_ string, _ []byte, _ os.FileMode) error
 	return nil
 }
 
-func (handler *fakeIOHandler) Readlink(_ string) (string, error) {
+func (handler *fakeIOHandler) Readlink(name string) (string, error) {
+	if name == byLunLink {
+		return "../../../../nvme0n6", nil
+	}
+	if name == "/sys/class/block/"+partitionName {
+		return "../../devices/LNXSYSTM:00/VMBUS:00/host4/target4:0:0/" + diskPath + "/block/" + devName + "/" + partitionName, nil
+	}
+	if strings.HasPrefix(name, "/dev/disk/azure/scsi1/") || strings.HasPrefix(name, "/dev/disk/azure/data/by-lun/") {
+		return "", fmt.Errorf("bad link")
+	}
 	return "/dev/azure/disk/sda", nil
 }
 
 func (handler *fakeIOHandler) ReadFile(filename string) ([]byte, error) {
+	switch filename {
+	case "/sys/class/nvme/nvme0/model", "/sys/class/nvme/nvme2/model":
+		return []byte("MSFT NVMe Accelerator v1.0              \n"), nil
+	case "/sys/class/nvme/nvme1/model":
+		return []byte("Microsoft NVMe Direct Disk v2           \n"), nil
+	case "/sys/class/nvme/nvme0/nvme0n1/nsid", "/sys/class/nvme/nvme1/nvme1n1/nsid":
+		return []byte("1\n"), nil
+	case "/sys/class/nvme/nvme0/" + nvmeNamespace + "/nsid":
+		return []byte("5\n"), nil
+	case "/sys/class/nvme/nvme2/" + nvmeNamespacePath + "/nsid":
+		return []byte("7\n"), nil
+	case "/sys/class/block/" + partitionName + "/partition":
+		return []byte("1\n"), nil
+	}
 	if strings.HasSuffix(filename, "vendor") {
 		return []byte("Msft    \n"), nil
 	}
@@ -0,0 +1,144 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+var (
+	numberRegex = regexp.MustCompile(`^[0-9]+$`)
+	// sizeRegex matches a number with an optional unit, e.g. 512, 64k
+	sizeRegex = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+)
+
+// formatFlag is an allowed mkfs flag
+type formatFlag struct {
+	// noValue is true for a flag without argument
+	noValue bool
+	// subOptions are the allowed keys of a comma separated key[=value] argument, the argument is a number if empty.
+	// The value of a key matches its pattern, a key with a nil pattern takes no value.
+	subOptions map[string]*regexp.Regexp
+}
+
+var extFormatFlags = map[string]formatFlag{
+	// block size
+	"-b": {},
+	// bytes per inode
+	"-i": {},
+	// inode size
+	"-I": {},
+	// the reserved blocks percentage -m is left out since mount-utils appends -m0 after the options, which overrides it
+	// number of inodes
+	"-N": {},
+	// extended options, resize is left out since it caps the online expansion of the filesystem
+	"-E": {subOptions: map[string]*regexp.Regexp{
+		"lazy_itable_init":  numberRegex,
+		"lazy_journal_init": numberRegex,
+		"stride":            numberRegex,
+		"stripe_width":      numberRegex,
+		"stripe-width":      numberRegex,
+		"discard":           nil,
+		"nodiscard":         nil,
+	}},
+}
+
+// formatFlags are the mkfs flags which a StorageClass may set with formatOptions, by fstype
+var formatFlags = map[string]map[string]formatFlag{
+	"ext2": extFormatFlags,
+	"ext3": extFormatFlags,
+	"ext4": extFormatFlags,
+	"xfs": {
+		"-b": {subOptions: map[string]*regexp.Regexp{"size": sizeRegex}},
+		"-i": {subOptions: map[string]*regexp.Regexp{"size": sizeRegex, "maxpct": numberRegex}},
+		"-d": {subOptions: map[string]*regexp.Regexp{"agcount": numberRegex, "su": sizeRegex, "sw": numberRegex}},
+		"-l": {subOptions: map[string]*regexp.Regexp{"size": sizeRegex}},
+		// do not discard blocks at mkfs time
+		"-K": {noValue: true},
+	},
+}
+
+// GetFormatOptions returns the formatOptions attribute
+func GetFormatOptions(attributes map[string]string) string {
+	for k, v := range attributes {
+		if strings.EqualFold(k, consts.FormatOptionsField) {
+			return v
+		}
+	}
+	return ""
+}
+
+// ParseFormatOptions splits the space separated mkfs arguments of formatOptions and checks them against
+// the flags allowed for fsType, an empty fsType is the default ext4
+func ParseFormatOptions(fsType, formatOptions string) ([]string, error) {
+	args := strings.Fields(formatOptions)
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if fsType == "" {
+		fsType = "ext4"
+	}
+	flags, ok := formatFlags[strings.ToLower(fsType)]
+	if !ok {
+		return nil, fmt.Errorf("%s is not supported with fsType %s", consts.FormatOptionsField, fsType)
+	}
+
+	for i := 0; i < len(args); i++ {
+		flag, ok := flags[args[i]]
+		if !ok {
+			return nil, fmt.Errorf("mkfs option %s is not allowed in %s with fsType %s", args[i], consts.FormatOptionsField, fsType)
+		}
+		if flag.noValue {
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, fmt.Errorf("mkfs option %s in %s requires a value", args[i], consts.FormatOptionsField)
+		}
+		i++
+		if err := checkFormatFlagValue(flag, args[i]); err != nil {
+			return nil, fmt.Errorf("invalid value %q of mkfs option %s in %s: %v", args[i], args[i-1], consts.FormatOptionsField, err)
+		}
+	}
+	return args, nil
+}
+
+// checkFormatFlagValue checks the argument of a flag
+func checkFormatFlagValue(flag formatFlag, value string) error {
+	if len(flag.subOptions) == 0 {
+		if !numberRegex.MatchString(value) {
+			return fmt.Errorf("not a number")
+		}
+		return nil
+	}
+	for _, subOption := range strings.Split(value, ",") {
+		key, val, hasValue := strings.Cut(subOption, "=")
+		pattern, ok := flag.subOptions[key]
+		switch {
+		case !ok:
+			return fmt.Errorf("%s is not allowed", key)
+		case pattern == nil && hasValue:
+			return fmt.Errorf("%s takes no value", key)
+		case pattern != nil && !pattern.MatchString(val):
+			return fmt.Errorf("invalid value %q of %s", val, key)
+		}
+	}
+	return nil
+}
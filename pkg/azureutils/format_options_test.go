@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormatOptions(t *testing.T) {
+	tests := []struct {
+		desc          string
+		fsType        string
+		formatOptions string
+		expected      []string
+		expectedErr   string
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc:          "ext4 by default",
+			formatOptions: " -b 4096  -i 65536 -E lazy_itable_init=0,lazy_journal_init=0,nodiscard ",
+			expected:      []string{"-b", "4096", "-i", "65536", "-E", "lazy_itable_init=0,lazy_journal_init=0,nodiscard"},
+		},
+		{
+			desc:          "xfs",
+			fsType:        "XFS",
+			formatOptions: "-b size=4096 -i size=512,maxpct=5 -d su=64k,sw=4 -K",
+			expected:      []string{"-b", "size=4096", "-i", "size=512,maxpct=5", "-d", "su=64k,sw=4", "-K"},
+		},
+		{
+			desc:          "unsupported fsType",
+			fsType:        "btrfs",
+			formatOptions: "-n 16k",
+			expectedErr:   "formatoptions is not supported with fsType btrfs",
+		},
+		{
+			desc:          "flag not allowed",
+			fsType:        "ext4",
+			formatOptions: "-F",
+			expectedErr:   "mkfs option -F is not allowed in formatoptions with fsType ext4",
+		},
+		{
+			desc:          "reserved blocks percentage overridden by mount-utils",
+			formatOptions: "-m 5",
+			expectedErr:   "mkfs option -m is not allowed in formatoptions with fsType ext4",
+		},
+		{
+			desc:          "missing value",
+			formatOptions: "-b",
+			expectedErr:   "mkfs option -b in formatoptions requires a value",
+		},
+		{
+			desc:          "not a number",
+			formatOptions: "-i 64k",
+			expectedErr:   `invalid value "64k" of mkfs option -i in formatoptions: not a number`,
+		},
+		{
+			desc:          "extended option capping the online expansion",
+			formatOptions: "-E resize=4294967295",
+			expectedErr:   `invalid value "resize=4294967295" of mkfs option -E in formatoptions: resize is not allowed`,
+		},
+		{
+			desc:          "value of a key without value",
+			formatOptions: "-E discard=1",
+			expectedErr:   `invalid value "discard=1" of mkfs option -E in formatoptions: discard takes no value`,
+		},
+		{
+			desc:          "invalid size",
+			fsType:        "xfs",
+			formatOptions: "-i size=big",
+			expectedErr:   `invalid value "size=big" of mkfs option -i in formatoptions: invalid value "big" of size`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			args, err := ParseFormatOptions(test.fsType, test.formatOptions)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, args)
+		})
+	}
+}
+
+func TestGetFormatOptions(t *testing.T) {
+	assert.Equal(t, "", GetFormatOptions(nil))
+	assert.Equal(t, "-b 4096", GetFormatOptions(map[string]string{"formatOptions": "-b 4096"}))
+}
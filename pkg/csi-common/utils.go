@@ -17,6 +17,8 @@ limitations under the License.
 package csicommon
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
@@ -100,16 +102,40 @@ func getLogLevel(method string) int32 {
 	return 2
 }
 
+// newRequestID returns a random ID which correlates the log lines of one gRPC request
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewLogContext returns a context whose logger adds keysAndValues to every line, along with the logger
+func NewLogContext(ctx context.Context, keysAndValues ...interface{}) (context.Context, klog.Logger) {
+	logger := klog.FromContext(ctx).WithValues(keysAndValues...)
+	return klog.NewContext(ctx, logger), logger
+}
+
+// LogWarning logs msg through the logger of ctx with keysAndValues as structured fields.
+// klog.Logger has no warning severity, so the line is logged at info level with the caller's location
+func LogWarning(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	klog.FromContext(ctx).WithCallDepth(1).Info(msg, keysAndValues...)
+}
+
+// LogGRPC logs the gRPC request and response, and passes a logger with the request ID and method
+// to the handler through the context, so that klog.FromContext(ctx) in the driver logs them on every line
 func LogGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	level := klog.Level(getLogLevel(info.FullMethod))
-	klog.V(level).Infof("GRPC call: %s", info.FullMethod)
-	klog.V(level).Infof("GRPC request: %s", protosanitizer.StripSecrets(req))
+	level := int(getLogLevel(info.FullMethod))
+	ctx, logger := NewLogContext(ctx, "requestID", newRequestID(), "method", info.FullMethod)
+	logger.V(level).Info("GRPC call")
+	logger.V(level).Info("GRPC request", "request", protosanitizer.StripSecrets(req))
 
 	resp, err := handler(ctx, req)
 	if err != nil {
-		klog.Errorf("GRPC error: %v", err)
+		logger.Error(err, "GRPC error")
 	} else {
-		klog.V(level).Infof("GRPC response: %s", protosanitizer.StripSecrets(resp))
+		logger.V(level).Info("GRPC response", "response", protosanitizer.StripSecrets(resp))
 	}
 	return resp, err
 }
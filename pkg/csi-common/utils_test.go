@@ -25,6 +25,7 @@ import (
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/go-logr/logr/funcr"
 	"google.golang.org/grpc"
 	"k8s.io/klog/v2"
 
@@ -101,7 +102,11 @@ func TestLogGRPC(t *testing.T) {
 	buf := new(bytes.Buffer)
 	klog.SetOutput(buf)
 
-	handler := func(_ context.Context, _ interface{}) (interface{}, error) { return nil, nil }
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		klog.FromContext(ctx).Info("from handler")
+		LogWarning(ctx, "warning from handler", "node", "node1")
+		return nil, nil
+	}
 	info := grpc.UnaryServerInfo{
 		FullMethod: "fake",
 	}
@@ -120,14 +125,14 @@ func TestLogGRPC(t *testing.T) {
 					"account_key":  "testkey",
 				},
 			},
-			`GRPC request: {"secrets":"***stripped***","volume_id":"vol_1"}`,
+			`request="{\"secrets\":\"***stripped***\",\"volume_id\":\"vol_1\"}"`,
 		},
 		{
 			"without secrets",
 			&csi.ListSnapshotsRequest{
 				StartingToken: "testtoken",
 			},
-			`GRPC request: {"starting_token":"testtoken"}`,
+			`request="{\"starting_token\":\"testtoken\"}"`,
 		},
 	}
 
@@ -138,9 +143,14 @@ func TestLogGRPC(t *testing.T) {
 			klog.Flush()
 
 			// ASSERT
-			assert.Contains(t, buf.String(), "GRPC call: fake")
+			assert.Contains(t, buf.String(), `"GRPC call"`)
+			assert.Contains(t, buf.String(), `method="fake"`)
+			assert.Regexp(t, `requestID="[0-9a-f]{16}"`, buf.String())
 			assert.Contains(t, buf.String(), test.expStr)
-			assert.Contains(t, buf.String(), "GRPC response: null")
+			assert.Contains(t, buf.String(), `"GRPC response"`)
+			assert.Contains(t, buf.String(), `response="null"`)
+			assert.Regexp(t, `"from handler" requestID="[0-9a-f]{16}" method="fake"`, buf.String())
+			assert.Regexp(t, `(?m)^I.* utils_test.go:\d+\] "warning from handler" requestID="[0-9a-f]{16}" method="fake" node="node1"$`, buf.String())
 
 			// CLEANUP
 			buf.Reset()
@@ -148,6 +158,18 @@ func TestLogGRPC(t *testing.T) {
 	}
 }
 
+func TestLogWarning(t *testing.T) {
+	var lines []string
+	logger := funcr.NewJSON(func(obj string) { lines = append(lines, obj) }, funcr.Options{})
+	ctx, _ := NewLogContext(klog.NewContext(context.Background(), logger), "requestID", "0123456789abcdef")
+
+	LogWarning(ctx, "warning from handler", "node", "node1", "disk", "disk1")
+
+	assert.Equal(t, []string{
+		`{"logger":"","level":0,"msg":"warning from handler","requestID":"0123456789abcdef","node":"node1","disk":"disk1"}`,
+	}, lines)
+}
+
 func TestNewControllerServiceCapability(t *testing.T) {
 	tests := []struct {
 		cap csi.ControllerServiceCapability_RPC_Type
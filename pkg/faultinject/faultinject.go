@@ -0,0 +1,389 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package faultinject injects ARM errors and latencies into the disk, snapshot and VM calls
+// of the driver, so that its retry paths can be exercised in staging and in unit tests.
+// The injector is an interceptor, so it also applies to the calls made by the cloud provider
+// vmset implementations. Rules are read from a file or a ConfigMap.
+package faultinject
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+)
+
+// Fault is the error a rule injects
+type Fault string
+
+const (
+	// FaultThrottling fails the call with 429 TooManyRequests and a Retry-After header
+	FaultThrottling Fault = "Throttling"
+	// FaultOperationPreempted fails the call as preempted by a more recent operation on the VM
+	FaultOperationPreempted Fault = "OperationPreempted"
+	// FaultZonalAllocationFailed fails the call with a zonal allocation failure
+	FaultZonalAllocationFailed Fault = "ZonalAllocationFailed"
+	// FaultMaximumDataDiskExceeded fails the call as exceeding the data disk limit of the VM size
+	FaultMaximumDataDiskExceeded Fault = "MaximumDataDiskExceeded"
+	// FaultDanglingAttach makes disk Get calls report the disk as attached to another VM
+	FaultDanglingAttach Fault = "DanglingAttach"
+
+	// ConfigMapKey is the key of the rules in the ConfigMap
+	ConfigMapKey = "rules"
+
+	defaultRetryAfterSeconds = 10
+	defaultMaxDataDiskCount  = 8
+	defaultDanglingVM        = "fault-injection-vm"
+	armEndpoint              = "https://management.azure.com"
+)
+
+// Rule selects calls and the fault and latency injected into them
+type Rule struct {
+	// Name of the rule, used in logs
+	Name string `json:"name,omitempty"`
+	// ResourceType matches the resource type of the call, e.g. disk or virtualMachine, all types if empty
+	ResourceType string `json:"resourceType,omitempty"`
+	// Method matches the client method of the call, e.g. CreateOrUpdate, all methods if empty
+	Method string `json:"method,omitempty"`
+	// DiskName is a regular expression matching the name of the disk a call targets, or of a data
+	// disk in the VM update or attach/detach request of a call. All calls match if empty.
+	DiskName string `json:"diskName,omitempty"`
+	// Probability of injecting into a matching call, 1 if unset
+	Probability *float64 `json:"probability,omitempty"`
+	// Fault injected into the call, none if empty
+	Fault Fault `json:"fault,omitempty"`
+	// Latency added before the call is sent
+	Latency metav1.Duration `json:"latency,omitempty"`
+	// RetryAfterSeconds of the Throttling fault, 10 if unset
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+	// MaxDataDiskCount reported by the MaximumDataDiskExceeded fault, 8 if unset
+	MaxDataDiskCount int `json:"maxDataDiskCount,omitempty"`
+	// ManagedBy is the name of the VM the DanglingAttach fault reports the disk attached to
+	ManagedBy string `json:"managedBy,omitempty"`
+
+	diskName *regexp.Regexp
+}
+
+// Config is the content of the rules file or ConfigMap key
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Injector holds the rules and injects their faults into the intercepted calls
+type Injector struct {
+	mu    sync.RWMutex
+	rules []Rule
+	// data is the config the rules were parsed from, to skip unchanged reloads
+	data []byte
+	// random returns a number in [0, 1)
+	random func() float64
+	// sleep waits for d or until ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewInjector returns an injector without rules
+func NewInjector() *Injector {
+	return &Injector{
+		random: rand.Float64,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+				return nil
+			}
+		},
+	}
+}
+
+// ParseConfig parses and validates YAML or JSON rules
+func ParseConfig(data []byte) ([]Rule, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse fault injection rules: %w", err)
+	}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Name == "" {
+			rule.Name = strconv.Itoa(i)
+		}
+		switch rule.Fault {
+		case "", FaultThrottling, FaultOperationPreempted, FaultZonalAllocationFailed, FaultMaximumDataDiskExceeded:
+		case FaultDanglingAttach:
+			if rule.ResourceType != "" && rule.ResourceType != string(interceptor.ResourceTypeDisk) {
+				return nil, fmt.Errorf("rule %s: fault %s only applies to disks", rule.Name, rule.Fault)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: unknown fault %q", rule.Name, rule.Fault)
+		}
+		if rule.Probability != nil && (*rule.Probability < 0 || *rule.Probability > 1) {
+			return nil, fmt.Errorf("rule %s: probability %v is not in [0, 1]", rule.Name, *rule.Probability)
+		}
+		if rule.Latency.Duration < 0 {
+			return nil, fmt.Errorf("rule %s: negative latency %v", rule.Name, rule.Latency.Duration)
+		}
+		if rule.DiskName != "" {
+			re, err := regexp.Compile(rule.DiskName)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid diskName: %w", rule.Name, err)
+			}
+			rule.diskName = re
+		}
+	}
+	return config.Rules, nil
+}
+
+// SetConfig replaces the rules with the ones parsed from data, the rules are kept if data is invalid
+func (i *Injector) SetConfig(data []byte) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.data != nil && bytes.Equal(i.data, data) {
+		return nil
+	}
+	rules, err := ParseConfig(data)
+	if err != nil {
+		return err
+	}
+	klog.Warningf("fault injection: %d rules loaded", len(rules))
+	i.rules = rules
+	i.data = data
+	return nil
+}
+
+// LoadFile sets the rules from a YAML or JSON file
+func (i *Injector) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return i.SetConfig(data)
+}
+
+// LoadConfigMap sets the rules from the rules key of a ConfigMap, a missing ConfigMap removes all rules
+func (i *Injector) LoadConfigMap(ctx context.Context, kubeClient clientset.Interface, namespace, name string) error {
+	configMap, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return i.SetConfig([]byte{})
+	}
+	if err != nil {
+		return err
+	}
+	return i.SetConfig([]byte(configMap.Data[ConfigMapKey]))
+}
+
+// Interceptor returns an interceptor which injects the faults and latencies of the matching rules
+func (i *Injector) Interceptor() interceptor.Interceptor {
+	return func(ctx context.Context, op *interceptor.Operation, invoke interceptor.Invoker) (interface{}, error) {
+		var dangling *Rule
+		for _, rule := range i.match(op) {
+			if rule.Latency.Duration > 0 {
+				klog.V(2).Infof("fault injection: rule %s delays %s.%s(%s) by %v", rule.Name, op.ResourceType, op.Method, op.ResourceName, rule.Latency.Duration)
+				if err := i.sleep(ctx, rule.Latency.Duration); err != nil {
+					return nil, err
+				}
+			}
+			if rule.Fault == FaultDanglingAttach {
+				if op.ResourceType == interceptor.ResourceTypeDisk && op.Method == "Get" && dangling == nil {
+					dangling = rule
+				}
+				continue
+			}
+			if rule.Fault != "" {
+				klog.Warningf("fault injection: rule %s fails %s.%s(%s) with %s", rule.Name, op.ResourceType, op.Method, op.ResourceName, rule.Fault)
+				return nil, rule.err(op)
+			}
+		}
+		result, err := invoke(ctx)
+		if err != nil || dangling == nil {
+			return result, err
+		}
+		disk, ok := result.(*armcompute.Disk)
+		if !ok || disk == nil {
+			return result, err
+		}
+		vm := dangling.ManagedBy
+		if vm == "" {
+			vm = defaultDanglingVM
+		}
+		klog.Warningf("fault injection: rule %s reports disk %s attached to VM %s", dangling.Name, op.ResourceName, vm)
+		copied := *disk
+		copied.ManagedBy = ptr.To(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", op.SubscriptionID, op.ResourceGroup, vm))
+		return &copied, nil
+	}
+}
+
+// match returns the rules matching op which pass their probability
+func (i *Injector) match(op *interceptor.Operation) []*Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var matched []*Rule
+	for idx := range i.rules {
+		rule := &i.rules[idx]
+		if rule.ResourceType != "" && !strings.EqualFold(rule.ResourceType, string(op.ResourceType)) {
+			continue
+		}
+		if rule.Method != "" && !strings.EqualFold(rule.Method, op.Method) {
+			continue
+		}
+		if rule.diskName != nil && !matchesDiskName(rule.diskName, op) {
+			continue
+		}
+		if rule.Probability != nil && i.random() >= *rule.Probability {
+			continue
+		}
+		matched = append(matched, rule)
+	}
+	return matched
+}
+
+// matchesDiskName returns true if re matches the disk op targets or a data disk in its request
+func matchesDiskName(re *regexp.Regexp, op *interceptor.Operation) bool {
+	if op.ResourceType == interceptor.ResourceTypeDisk {
+		return re.MatchString(op.ResourceName)
+	}
+	var ids []*string
+	switch params := op.Parameters.(type) {
+	case armcompute.VirtualMachine:
+		if params.Properties != nil && params.Properties.StorageProfile != nil {
+			ids = dataDiskIDs(params.Properties.StorageProfile.DataDisks)
+		}
+	case armcompute.VirtualMachineUpdate:
+		if params.Properties != nil && params.Properties.StorageProfile != nil {
+			ids = dataDiskIDs(params.Properties.StorageProfile.DataDisks)
+		}
+	case armcompute.VirtualMachineScaleSetVM:
+		if params.Properties != nil && params.Properties.StorageProfile != nil {
+			ids = dataDiskIDs(params.Properties.StorageProfile.DataDisks)
+		}
+	case armcompute.AttachDetachDataDisksRequest:
+		for _, disk := range params.DataDisksToAttach {
+			ids = append(ids, disk.DiskID)
+		}
+		for _, disk := range params.DataDisksToDetach {
+			ids = append(ids, disk.DiskID)
+		}
+	}
+	for _, id := range ids {
+		if id != nil && re.MatchString((*id)[strings.LastIndex(*id, "/")+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func dataDiskIDs(dataDisks []*armcompute.DataDisk) []*string {
+	ids := make([]*string, 0, len(dataDisks))
+	for _, disk := range dataDisks {
+		if disk != nil && disk.ManagedDisk != nil {
+			ids = append(ids, disk.ManagedDisk.ID)
+		}
+	}
+	return ids
+}
+
+// err returns the ARM error of the fault of r
+func (r *Rule) err(op *interceptor.Operation) error {
+	header := http.Header{}
+	status, code, message := http.StatusConflict, string(r.Fault), ""
+	switch r.Fault {
+	case FaultThrottling:
+		retryAfter := r.RetryAfterSeconds
+		if retryAfter <= 0 {
+			retryAfter = defaultRetryAfterSeconds
+		}
+		header.Set("Retry-After", strconv.Itoa(retryAfter))
+		status, code = http.StatusTooManyRequests, consts.TooManyRequests
+		message = fmt.Sprintf("The request is being throttled as the limit has been reached for operation type - %s.%s.", op.ResourceType, op.Method)
+	case FaultOperationPreempted:
+		message = "Operation execution has been preempted by a more recent operation."
+	case FaultZonalAllocationFailed:
+		message = "Allocation failed. We do not have sufficient capacity for the requested VM size in this zone."
+	case FaultMaximumDataDiskExceeded:
+		count := r.MaxDataDiskCount
+		if count <= 0 {
+			count = defaultMaxDataDiskCount
+		}
+		code = "OperationNotAllowed"
+		message = fmt.Sprintf("The maximum number of data disks allowed to be attached to a VM of this size is %d.", count)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"error": map[string]string{"code": code, "message": message}})
+	header.Set("Content-Type", "application/json")
+	header.Set("x-ms-error-code", code)
+	req, _ := http.NewRequest(httpMethod(op), armEndpoint+resourcePath(op), nil)
+	return runtime.NewResponseError(&http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	})
+}
+
+func httpMethod(op *interceptor.Operation) string {
+	switch {
+	case op.Method == "Delete":
+		return http.MethodDelete
+	case strings.Contains(op.Method, "AttachDetach"):
+		return http.MethodPost
+	case op.Mutating:
+		return http.MethodPut
+	}
+	return http.MethodGet
+}
+
+func resourcePath(op *interceptor.Operation) string {
+	path := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute", op.SubscriptionID, op.ResourceGroup)
+	switch op.ResourceType {
+	case interceptor.ResourceTypeDisk:
+		path += "/disks"
+	case interceptor.ResourceTypeSnapshot:
+		path += "/snapshots"
+	case interceptor.ResourceTypeVirtualMachine:
+		path += "/virtualMachines"
+	case interceptor.ResourceTypeVirtualMachineScaleSet:
+		path += "/virtualMachineScaleSets"
+	case interceptor.ResourceTypeVirtualMachineScaleSetVM:
+		path += fmt.Sprintf("/virtualMachineScaleSets/%s/virtualMachines", op.ParentResourceName)
+	}
+	if op.ResourceName != "" {
+		path += "/" + op.ResourceName
+	}
+	return path
+}
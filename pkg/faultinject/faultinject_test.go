@@ -0,0 +1,226 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/util"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		desc        string
+		config      string
+		expectedErr string
+	}{
+		{
+			desc: "valid rules",
+			config: `
+rules:
+- name: throttle-disk-writes
+  resourceType: disk
+  method: CreateOrUpdate
+  diskName: ^pvc-
+  probability: 0.5
+  fault: Throttling
+  retryAfterSeconds: 5
+- latency: 30s
+`,
+		},
+		{
+			desc:   "empty config",
+			config: "",
+		},
+		{
+			desc:        "unknown fault",
+			config:      "rules:\n- fault: Boom\n",
+			expectedErr: `rule 0: unknown fault "Boom"`,
+		},
+		{
+			desc:        "dangling attach of a VM",
+			config:      "rules:\n- resourceType: virtualMachine\n  fault: DanglingAttach\n",
+			expectedErr: "rule 0: fault DanglingAttach only applies to disks",
+		},
+		{
+			desc:        "invalid probability",
+			config:      "rules:\n- name: r\n  probability: 2\n",
+			expectedErr: "rule r: probability 2 is not in [0, 1]",
+		},
+		{
+			desc:        "invalid diskName",
+			config:      "rules:\n- diskName: '('\n",
+			expectedErr: "rule 0: invalid diskName",
+		},
+		{
+			desc:        "unknown field",
+			config:      "rules:\n- disk: pvc\n",
+			expectedErr: "failed to parse fault injection rules",
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseConfig([]byte(test.config))
+		if test.expectedErr == "" {
+			assert.NoError(t, err, test.desc)
+		} else {
+			assert.ErrorContains(t, err, test.expectedErr, test.desc)
+		}
+	}
+}
+
+func diskOp(method, name string) *interceptor.Operation {
+	return &interceptor.Operation{SubscriptionID: "subs", ResourceType: interceptor.ResourceTypeDisk, Method: method, ResourceGroup: "rg", ResourceName: name, Mutating: method != "Get"}
+}
+
+func TestInterceptor(t *testing.T) {
+	ctx := context.Background()
+	injector := NewInjector()
+	var slept time.Duration
+	injector.sleep = func(_ context.Context, d time.Duration) error {
+		slept += d
+		return nil
+	}
+	assert.NoError(t, injector.SetConfig([]byte(`
+rules:
+- resourceType: disk
+  method: CreateOrUpdate
+  diskName: ^pvc-
+  fault: Throttling
+  retryAfterSeconds: 5
+- resourceType: virtualMachine
+  diskName: ^pvc-full
+  fault: MaximumDataDiskExceeded
+  maxDataDiskCount: 4
+- resourceType: virtualMachineScaleSetVM
+  method: AttachDetachDataDisks
+  latency: 2m
+  fault: OperationPreempted
+- resourceType: disk
+  method: Get
+  diskName: ^dangling
+  fault: DanglingAttach
+- resourceType: snapshot
+  probability: 0.5
+  fault: ZonalAllocationFailed
+`)))
+	intercept := injector.Interceptor()
+	called := 0
+	invoke := func(context.Context) (interface{}, error) {
+		called++
+		return &armcompute.Disk{Name: ptr.To("disk")}, nil
+	}
+
+	// injected throttling is recognized by the throttling handling of the driver
+	_, err := intercept(ctx, diskOp("CreateOrUpdate", "pvc-1"), invoke)
+	assert.True(t, azureutils.IsThrottlingError(err))
+	var respErr *azcore.ResponseError
+	assert.True(t, errors.As(err, &respErr))
+	assert.Equal(t, http.StatusTooManyRequests, respErr.StatusCode)
+	assert.Equal(t, "5", respErr.RawResponse.Header.Get("Retry-After"))
+	assert.Equal(t, 0, called)
+
+	// other disks and methods are not affected
+	_, err = intercept(ctx, diskOp("CreateOrUpdate", "other"), invoke)
+	assert.NoError(t, err)
+	_, err = intercept(ctx, diskOp("Delete", "pvc-1"), invoke)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, called)
+
+	// data disks of a VM update are matched by name
+	vmOp := &interceptor.Operation{SubscriptionID: "subs", ResourceType: interceptor.ResourceTypeVirtualMachine, Method: "CreateOrUpdate", ResourceGroup: "rg", ResourceName: "vm", Mutating: true,
+		Parameters: armcompute.VirtualMachine{Properties: &armcompute.VirtualMachineProperties{StorageProfile: &armcompute.StorageProfile{DataDisks: []*armcompute.DataDisk{
+			{ManagedDisk: &armcompute.ManagedDiskParameters{ID: ptr.To("/subscriptions/subs/resourceGroups/rg/providers/Microsoft.Compute/disks/pvc-full-1")}},
+		}}}}}
+	_, err = intercept(ctx, vmOp, invoke)
+	assert.ErrorContains(t, err, util.MaximumDataDiskExceededMsg)
+	assert.ErrorContains(t, err, "is 4.")
+
+	// latency is added before the fault
+	vmssOp := &interceptor.Operation{SubscriptionID: "subs", ResourceType: interceptor.ResourceTypeVirtualMachineScaleSetVM, Method: "AttachDetachDataDisks", ResourceGroup: "rg", ParentResourceName: "vmss", ResourceName: "0", Mutating: true}
+	_, err = intercept(ctx, vmssOp, invoke)
+	assert.ErrorContains(t, err, "OperationPreempted")
+	assert.ErrorContains(t, err, "/virtualMachineScaleSets/vmss/virtualMachines/0")
+	assert.Equal(t, 2*time.Minute, slept)
+
+	// dangling attach reports the disk attached to another VM
+	result, err := intercept(ctx, diskOp("Get", "dangling-1"), invoke)
+	assert.NoError(t, err)
+	assert.Equal(t, "/subscriptions/subs/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/fault-injection-vm", *result.(*armcompute.Disk).ManagedBy)
+
+	// probability
+	snapshotOp := &interceptor.Operation{SubscriptionID: "subs", ResourceType: interceptor.ResourceTypeSnapshot, Method: "Get", ResourceGroup: "rg", ResourceName: "snapshot"}
+	injector.random = func() float64 { return 0.7 }
+	_, err = intercept(ctx, snapshotOp, invoke)
+	assert.NoError(t, err)
+	injector.random = func() float64 { return 0.2 }
+	_, err = intercept(ctx, snapshotOp, invoke)
+	assert.ErrorContains(t, err, "ZonalAllocationFailed")
+
+	// invalid rules keep the previous ones
+	assert.Error(t, injector.SetConfig([]byte("rules:\n- fault: Boom\n")))
+	_, err = intercept(ctx, diskOp("CreateOrUpdate", "pvc-1"), invoke)
+	assert.Error(t, err)
+	// no rules
+	assert.NoError(t, injector.SetConfig([]byte("rules: []")))
+	_, err = intercept(ctx, diskOp("CreateOrUpdate", "pvc-1"), invoke)
+	assert.NoError(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	injector := NewInjector()
+	intercept := injector.Interceptor()
+	invoke := func(context.Context) (interface{}, error) { return nil, nil }
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("rules:\n- fault: OperationPreempted\n"), 0600))
+	assert.NoError(t, injector.LoadFile(path))
+	_, err := intercept(ctx, diskOp("Delete", "disk"), invoke)
+	assert.ErrorContains(t, err, "OperationPreempted")
+	assert.Error(t, injector.LoadFile(filepath.Join(t.TempDir(), "missing")))
+
+	kubeClient := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "fault-injection"},
+		Data:       map[string]string{ConfigMapKey: "rules:\n- fault: Throttling\n"},
+	})
+	assert.NoError(t, injector.LoadConfigMap(ctx, kubeClient, "kube-system", "fault-injection"))
+	_, err = intercept(ctx, diskOp("Delete", "disk"), invoke)
+	assert.True(t, strings.Contains(err.Error(), "TooManyRequests"))
+
+	// a deleted ConfigMap removes the rules
+	assert.NoError(t, kubeClient.CoreV1().ConfigMaps("kube-system").Delete(ctx, "fault-injection", metav1.DeleteOptions{}))
+	assert.NoError(t, injector.LoadConfigMap(ctx, kubeClient, "kube-system", "fault-injection"))
+	_, err = intercept(ctx, diskOp("Delete", "disk"), invoke)
+	assert.NoError(t, err)
+}
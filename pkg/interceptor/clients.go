@@ -0,0 +1,324 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package interceptor
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/snapshotclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachineclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient"
+)
+
+// invoke passes call through intercept and converts the result back to the type of the client method
+func invoke[T any](ctx context.Context, intercept Interceptor, op *Operation, call func(context.Context) (T, error)) (T, error) {
+	result, err := intercept(ctx, op, func(ctx context.Context) (interface{}, error) {
+		return call(ctx)
+	})
+	typed, _ := result.(T)
+	return typed, err
+}
+
+// invokeNoResult passes call through intercept for client methods which only return an error
+func invokeNoResult(ctx context.Context, intercept Interceptor, op *Operation, call func(context.Context) error) error {
+	_, err := intercept(ctx, op, func(ctx context.Context) (interface{}, error) {
+		return nil, call(ctx)
+	})
+	return err
+}
+
+type diskClient struct {
+	diskclient.Interface
+	subscriptionID string
+	intercept      Interceptor
+}
+
+func (c *diskClient) op(method, resourceGroupName, resourceName string, parameters interface{}, mutating bool) *Operation {
+	return &Operation{
+		SubscriptionID: c.subscriptionID,
+		ResourceType:   ResourceTypeDisk,
+		Method:         method,
+		ResourceGroup:  resourceGroupName,
+		ResourceName:   resourceName,
+		Parameters:     parameters,
+		Mutating:       mutating,
+	}
+}
+
+func (c *diskClient) Get(ctx context.Context, resourceGroupName string, resourceName string) (*armcompute.Disk, error) {
+	return invoke(ctx, c.intercept, c.op("Get", resourceGroupName, resourceName, nil, false), func(ctx context.Context) (*armcompute.Disk, error) {
+		return c.Interface.Get(ctx, resourceGroupName, resourceName)
+	})
+}
+
+func (c *diskClient) List(ctx context.Context, resourceGroupName string) ([]*armcompute.Disk, error) {
+	return invoke(ctx, c.intercept, c.op("List", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.Disk, error) {
+		return c.Interface.List(ctx, resourceGroupName)
+	})
+}
+
+func (c *diskClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, resourceName string, resourceParam armcompute.Disk) (*armcompute.Disk, error) {
+	return invoke(ctx, c.intercept, c.op("CreateOrUpdate", resourceGroupName, resourceName, resourceParam, true), func(ctx context.Context) (*armcompute.Disk, error) {
+		return c.Interface.CreateOrUpdate(ctx, resourceGroupName, resourceName, resourceParam)
+	})
+}
+
+func (c *diskClient) Patch(ctx context.Context, resourceGroupName string, resourceName string, parameters armcompute.DiskUpdate) (*armcompute.Disk, error) {
+	return invoke(ctx, c.intercept, c.op("Patch", resourceGroupName, resourceName, parameters, true), func(ctx context.Context) (*armcompute.Disk, error) {
+		return c.Interface.Patch(ctx, resourceGroupName, resourceName, parameters)
+	})
+}
+
+func (c *diskClient) Delete(ctx context.Context, resourceGroupName string, resourceName string) error {
+	return invokeNoResult(ctx, c.intercept, c.op("Delete", resourceGroupName, resourceName, nil, true), func(ctx context.Context) error {
+		return c.Interface.Delete(ctx, resourceGroupName, resourceName)
+	})
+}
+
+type snapshotClient struct {
+	snapshotclient.Interface
+	subscriptionID string
+	intercept      Interceptor
+}
+
+func (c *snapshotClient) op(method, resourceGroupName, resourceName string, parameters interface{}, mutating bool) *Operation {
+	return &Operation{
+		SubscriptionID: c.subscriptionID,
+		ResourceType:   ResourceTypeSnapshot,
+		Method:         method,
+		ResourceGroup:  resourceGroupName,
+		ResourceName:   resourceName,
+		Parameters:     parameters,
+		Mutating:       mutating,
+	}
+}
+
+func (c *snapshotClient) Get(ctx context.Context, resourceGroupName string, resourceName string) (*armcompute.Snapshot, error) {
+	return invoke(ctx, c.intercept, c.op("Get", resourceGroupName, resourceName, nil, false), func(ctx context.Context) (*armcompute.Snapshot, error) {
+		return c.Interface.Get(ctx, resourceGroupName, resourceName)
+	})
+}
+
+func (c *snapshotClient) List(ctx context.Context, resourceGroupName string) ([]*armcompute.Snapshot, error) {
+	return invoke(ctx, c.intercept, c.op("List", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.Snapshot, error) {
+		return c.Interface.List(ctx, resourceGroupName)
+	})
+}
+
+func (c *snapshotClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, resourceName string, resourceParam armcompute.Snapshot) (*armcompute.Snapshot, error) {
+	return invoke(ctx, c.intercept, c.op("CreateOrUpdate", resourceGroupName, resourceName, resourceParam, true), func(ctx context.Context) (*armcompute.Snapshot, error) {
+		return c.Interface.CreateOrUpdate(ctx, resourceGroupName, resourceName, resourceParam)
+	})
+}
+
+func (c *snapshotClient) Delete(ctx context.Context, resourceGroupName string, resourceName string) error {
+	return invokeNoResult(ctx, c.intercept, c.op("Delete", resourceGroupName, resourceName, nil, true), func(ctx context.Context) error {
+		return c.Interface.Delete(ctx, resourceGroupName, resourceName)
+	})
+}
+
+type virtualMachineClient struct {
+	virtualmachineclient.Interface
+	subscriptionID string
+	intercept      Interceptor
+}
+
+func (c *virtualMachineClient) op(method, resourceGroupName, resourceName string, parameters interface{}, mutating bool) *Operation {
+	return &Operation{
+		SubscriptionID: c.subscriptionID,
+		ResourceType:   ResourceTypeVirtualMachine,
+		Method:         method,
+		ResourceGroup:  resourceGroupName,
+		ResourceName:   resourceName,
+		Parameters:     parameters,
+		Mutating:       mutating,
+	}
+}
+
+func (c *virtualMachineClient) Get(ctx context.Context, resourceGroupName string, resourceName string, expand *string) (*armcompute.VirtualMachine, error) {
+	return invoke(ctx, c.intercept, c.op("Get", resourceGroupName, resourceName, nil, false), func(ctx context.Context) (*armcompute.VirtualMachine, error) {
+		return c.Interface.Get(ctx, resourceGroupName, resourceName, expand)
+	})
+}
+
+func (c *virtualMachineClient) List(ctx context.Context, resourceGroupName string) ([]*armcompute.VirtualMachine, error) {
+	return invoke(ctx, c.intercept, c.op("List", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
+		return c.Interface.List(ctx, resourceGroupName)
+	})
+}
+
+func (c *virtualMachineClient) InstanceView(ctx context.Context, resourceGroupName string, vmName string) (*armcompute.VirtualMachineInstanceView, error) {
+	return invoke(ctx, c.intercept, c.op("InstanceView", resourceGroupName, vmName, nil, false), func(ctx context.Context) (*armcompute.VirtualMachineInstanceView, error) {
+		return c.Interface.InstanceView(ctx, resourceGroupName, vmName)
+	})
+}
+
+func (c *virtualMachineClient) ListVMInstanceView(ctx context.Context, resourceGroupName string) ([]*armcompute.VirtualMachine, error) {
+	return invoke(ctx, c.intercept, c.op("ListVMInstanceView", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
+		return c.Interface.ListVMInstanceView(ctx, resourceGroupName)
+	})
+}
+
+func (c *virtualMachineClient) ListVmssFlexVMsWithOnlyInstanceView(ctx context.Context, resourceGroupName string, virtualMachineScaleSetID string) ([]*armcompute.VirtualMachine, error) {
+	return invoke(ctx, c.intercept, c.op("ListVmssFlexVMsWithOnlyInstanceView", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
+		return c.Interface.ListVmssFlexVMsWithOnlyInstanceView(ctx, resourceGroupName, virtualMachineScaleSetID)
+	})
+}
+
+func (c *virtualMachineClient) ListVmssFlexVMsWithOutInstanceView(ctx context.Context, resourceGroupName string, virtualMachineScaleSetID string) ([]*armcompute.VirtualMachine, error) {
+	return invoke(ctx, c.intercept, c.op("ListVmssFlexVMsWithOutInstanceView", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachine, error) {
+		return c.Interface.ListVmssFlexVMsWithOutInstanceView(ctx, resourceGroupName, virtualMachineScaleSetID)
+	})
+}
+
+func (c *virtualMachineClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, resourceName string, resourceParam armcompute.VirtualMachine) (*armcompute.VirtualMachine, error) {
+	return invoke(ctx, c.intercept, c.op("CreateOrUpdate", resourceGroupName, resourceName, resourceParam, true), func(ctx context.Context) (*armcompute.VirtualMachine, error) {
+		return c.Interface.CreateOrUpdate(ctx, resourceGroupName, resourceName, resourceParam)
+	})
+}
+
+func (c *virtualMachineClient) Delete(ctx context.Context, resourceGroupName string, resourceName string) error {
+	return invokeNoResult(ctx, c.intercept, c.op("Delete", resourceGroupName, resourceName, nil, true), func(ctx context.Context) error {
+		return c.Interface.Delete(ctx, resourceGroupName, resourceName)
+	})
+}
+
+func (c *virtualMachineClient) BeginAttachDetachDataDisks(ctx context.Context, resourceGroupName string, vmName string, parameters armcompute.AttachDetachDataDisksRequest, options *armcompute.VirtualMachinesClientBeginAttachDetachDataDisksOptions) (*runtime.Poller[armcompute.VirtualMachinesClientAttachDetachDataDisksResponse], error) {
+	return invoke(ctx, c.intercept, c.op("BeginAttachDetachDataDisks", resourceGroupName, vmName, parameters, true), func(ctx context.Context) (*runtime.Poller[armcompute.VirtualMachinesClientAttachDetachDataDisksResponse], error) {
+		return c.Interface.BeginAttachDetachDataDisks(ctx, resourceGroupName, vmName, parameters, options)
+	})
+}
+
+func (c *virtualMachineClient) BeginUpdate(ctx context.Context, resourceGroupName string, vmName string, parameters armcompute.VirtualMachineUpdate, options *armcompute.VirtualMachinesClientBeginUpdateOptions) (*runtime.Poller[armcompute.VirtualMachinesClientUpdateResponse], error) {
+	return invoke(ctx, c.intercept, c.op("BeginUpdate", resourceGroupName, vmName, parameters, true), func(ctx context.Context) (*runtime.Poller[armcompute.VirtualMachinesClientUpdateResponse], error) {
+		return c.Interface.BeginUpdate(ctx, resourceGroupName, vmName, parameters, options)
+	})
+}
+
+type virtualMachineScaleSetClient struct {
+	virtualmachinescalesetclient.Interface
+	subscriptionID string
+	intercept      Interceptor
+}
+
+func (c *virtualMachineScaleSetClient) op(method, resourceGroupName, resourceName string, parameters interface{}, mutating bool) *Operation {
+	return &Operation{
+		SubscriptionID: c.subscriptionID,
+		ResourceType:   ResourceTypeVirtualMachineScaleSet,
+		Method:         method,
+		ResourceGroup:  resourceGroupName,
+		ResourceName:   resourceName,
+		Parameters:     parameters,
+		Mutating:       mutating,
+	}
+}
+
+func (c *virtualMachineScaleSetClient) Get(ctx context.Context, resourceGroupName string, resourceName string, expand *armcompute.ExpandTypesForGetVMScaleSets) (*armcompute.VirtualMachineScaleSet, error) {
+	return invoke(ctx, c.intercept, c.op("Get", resourceGroupName, resourceName, nil, false), func(ctx context.Context) (*armcompute.VirtualMachineScaleSet, error) {
+		return c.Interface.Get(ctx, resourceGroupName, resourceName, expand)
+	})
+}
+
+func (c *virtualMachineScaleSetClient) List(ctx context.Context, resourceGroupName string) ([]*armcompute.VirtualMachineScaleSet, error) {
+	return invoke(ctx, c.intercept, c.op("List", resourceGroupName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachineScaleSet, error) {
+		return c.Interface.List(ctx, resourceGroupName)
+	})
+}
+
+func (c *virtualMachineScaleSetClient) CreateOrUpdate(ctx context.Context, resourceGroupName string, resourceName string, resourceParam armcompute.VirtualMachineScaleSet) (*armcompute.VirtualMachineScaleSet, error) {
+	return invoke(ctx, c.intercept, c.op("CreateOrUpdate", resourceGroupName, resourceName, resourceParam, true), func(ctx context.Context) (*armcompute.VirtualMachineScaleSet, error) {
+		return c.Interface.CreateOrUpdate(ctx, resourceGroupName, resourceName, resourceParam)
+	})
+}
+
+func (c *virtualMachineScaleSetClient) Delete(ctx context.Context, resourceGroupName string, resourceName string) error {
+	return invokeNoResult(ctx, c.intercept, c.op("Delete", resourceGroupName, resourceName, nil, true), func(ctx context.Context) error {
+		return c.Interface.Delete(ctx, resourceGroupName, resourceName)
+	})
+}
+
+type virtualMachineScaleSetVMClient struct {
+	virtualmachinescalesetvmclient.Interface
+	subscriptionID string
+	intercept      Interceptor
+}
+
+func (c *virtualMachineScaleSetVMClient) op(method, resourceGroupName, parentResourceName, resourceName string, parameters interface{}, mutating bool) *Operation {
+	return &Operation{
+		SubscriptionID:     c.subscriptionID,
+		ResourceType:       ResourceTypeVirtualMachineScaleSetVM,
+		Method:             method,
+		ResourceGroup:      resourceGroupName,
+		ParentResourceName: parentResourceName,
+		ResourceName:       resourceName,
+		Parameters:         parameters,
+		Mutating:           mutating,
+	}
+}
+
+func (c *virtualMachineScaleSetVMClient) Get(ctx context.Context, resourceGroupName string, parentResourceName string, resourceName string) (*armcompute.VirtualMachineScaleSetVM, error) {
+	return invoke(ctx, c.intercept, c.op("Get", resourceGroupName, parentResourceName, resourceName, nil, false), func(ctx context.Context) (*armcompute.VirtualMachineScaleSetVM, error) {
+		return c.Interface.Get(ctx, resourceGroupName, parentResourceName, resourceName)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) GetInstanceView(ctx context.Context, resourceGroupName string, vmScaleSetName string, instanceID string) (*armcompute.VirtualMachineScaleSetVMInstanceView, error) {
+	return invoke(ctx, c.intercept, c.op("GetInstanceView", resourceGroupName, vmScaleSetName, instanceID, nil, false), func(ctx context.Context) (*armcompute.VirtualMachineScaleSetVMInstanceView, error) {
+		return c.Interface.GetInstanceView(ctx, resourceGroupName, vmScaleSetName, instanceID)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) List(ctx context.Context, resourceGroupName string, parentResourceName string) ([]*armcompute.VirtualMachineScaleSetVM, error) {
+	return invoke(ctx, c.intercept, c.op("List", resourceGroupName, parentResourceName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachineScaleSetVM, error) {
+		return c.Interface.List(ctx, resourceGroupName, parentResourceName)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) ListVMInstanceView(ctx context.Context, resourceGroupName string, parentResourceName string) ([]*armcompute.VirtualMachineScaleSetVM, error) {
+	return invoke(ctx, c.intercept, c.op("ListVMInstanceView", resourceGroupName, parentResourceName, "", nil, false), func(ctx context.Context) ([]*armcompute.VirtualMachineScaleSetVM, error) {
+		return c.Interface.ListVMInstanceView(ctx, resourceGroupName, parentResourceName)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) Delete(ctx context.Context, resourceGroupName string, parentResourceName string, resourceName string) error {
+	return invokeNoResult(ctx, c.intercept, c.op("Delete", resourceGroupName, parentResourceName, resourceName, nil, true), func(ctx context.Context) error {
+		return c.Interface.Delete(ctx, resourceGroupName, parentResourceName, resourceName)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) Update(ctx context.Context, resourceGroupName string, vmScaleSetName string, instanceID string, parameters armcompute.VirtualMachineScaleSetVM) (*armcompute.VirtualMachineScaleSetVM, error) {
+	return invoke(ctx, c.intercept, c.op("Update", resourceGroupName, vmScaleSetName, instanceID, parameters, true), func(ctx context.Context) (*armcompute.VirtualMachineScaleSetVM, error) {
+		return c.Interface.Update(ctx, resourceGroupName, vmScaleSetName, instanceID, parameters)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) BeginUpdate(ctx context.Context, resourceGroupName string, vmScaleSetName string, instanceID string, parameters armcompute.VirtualMachineScaleSetVM, options *armcompute.VirtualMachineScaleSetVMsClientBeginUpdateOptions) (*runtime.Poller[armcompute.VirtualMachineScaleSetVMsClientUpdateResponse], error) {
+	return invoke(ctx, c.intercept, c.op("BeginUpdate", resourceGroupName, vmScaleSetName, instanceID, parameters, true), func(ctx context.Context) (*runtime.Poller[armcompute.VirtualMachineScaleSetVMsClientUpdateResponse], error) {
+		return c.Interface.BeginUpdate(ctx, resourceGroupName, vmScaleSetName, instanceID, parameters, options)
+	})
+}
+
+func (c *virtualMachineScaleSetVMClient) AttachDetachDataDisks(ctx context.Context, resourceGroupName string, vmScaleSetName string, instanceID string, parameters armcompute.AttachDetachDataDisksRequest) (*armcompute.VirtualMachineScaleSetVMsClientAttachDetachDataDisksResponse, error) {
+	return invoke(ctx, c.intercept, c.op("AttachDetachDataDisks", resourceGroupName, vmScaleSetName, instanceID, parameters, true), func(ctx context.Context) (*armcompute.VirtualMachineScaleSetVMsClientAttachDetachDataDisksResponse, error) {
+		return c.Interface.AttachDetachDataDisks(ctx, resourceGroupName, vmScaleSetName, instanceID, parameters)
+	})
+}
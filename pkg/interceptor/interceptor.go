@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package interceptor decorates the azclient.ClientFactory so that every disk, snapshot
+// and VM call made by the driver, including the calls made by the cloud provider vmset
+// implementations, passes through a chain of interceptors.
+package interceptor
+
+import (
+	"context"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/snapshotclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachineclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient"
+)
+
+// ResourceType is the type of the ARM resource an operation targets
+type ResourceType string
+
+const (
+	ResourceTypeDisk                     ResourceType = "disk"
+	ResourceTypeSnapshot                 ResourceType = "snapshot"
+	ResourceTypeVirtualMachine           ResourceType = "virtualMachine"
+	ResourceTypeVirtualMachineScaleSet   ResourceType = "virtualMachineScaleSet"
+	ResourceTypeVirtualMachineScaleSetVM ResourceType = "virtualMachineScaleSetVM"
+)
+
+// Operation describes a single intercepted ARM call
+type Operation struct {
+	// SubscriptionID of the client making the call
+	SubscriptionID string
+	// ResourceType of the target resource
+	ResourceType ResourceType
+	// Method is the client method name, e.g. Get, CreateOrUpdate, Delete
+	Method string
+	// ResourceGroup of the target resource
+	ResourceGroup string
+	// ParentResourceName is the scale set name for VMSS VM calls, empty otherwise
+	ParentResourceName string
+	// ResourceName of the target resource, empty for list calls
+	ResourceName string
+	// Parameters is the request payload of mutating calls
+	Parameters interface{}
+	// Mutating is true if the call changes the state of the resource
+	Mutating bool
+}
+
+// Invoker performs the intercepted call and returns its result
+type Invoker func(ctx context.Context) (interface{}, error)
+
+// Interceptor is called for every operation. It must call invoke to perform the call,
+// or return its own result; the result must have the type the client method returns.
+type Interceptor func(ctx context.Context, op *Operation, invoke Invoker) (interface{}, error)
+
+// chain composes interceptors, the first interceptor is the outermost one
+func chain(interceptors []Interceptor) Interceptor {
+	return func(ctx context.Context, op *Operation, invoke Invoker) (interface{}, error) {
+		next := invoke
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context) (interface{}, error) {
+				return interceptor(ctx, op, inner)
+			}
+		}
+		return next(ctx)
+	}
+}
+
+// clientFactory wraps the disk, snapshot, VM and VMSS clients of an azclient.ClientFactory.
+// All other clients are returned unchanged.
+type clientFactory struct {
+	azclient.ClientFactory
+	subscriptionID string
+	intercept      Interceptor
+}
+
+// NewClientFactory returns a ClientFactory whose disk, snapshot, VM and VMSS clients pass every call
+// through interceptors. subscriptionID is the default subscription of factory.
+func NewClientFactory(factory azclient.ClientFactory, subscriptionID string, interceptors ...Interceptor) azclient.ClientFactory {
+	if factory == nil || len(interceptors) == 0 {
+		return factory
+	}
+	return &clientFactory{
+		ClientFactory:  factory,
+		subscriptionID: subscriptionID,
+		intercept:      chain(interceptors),
+	}
+}
+
+func (f *clientFactory) GetDiskClient() diskclient.Interface {
+	return &diskClient{Interface: f.ClientFactory.GetDiskClient(), subscriptionID: f.subscriptionID, intercept: f.intercept}
+}
+
+func (f *clientFactory) GetDiskClientForSub(subscriptionID string) (diskclient.Interface, error) {
+	client, err := f.ClientFactory.GetDiskClientForSub(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	return &diskClient{Interface: client, subscriptionID: f.subscriptionFor(subscriptionID), intercept: f.intercept}, nil
+}
+
+func (f *clientFactory) GetSnapshotClient() snapshotclient.Interface {
+	return &snapshotClient{Interface: f.ClientFactory.GetSnapshotClient(), subscriptionID: f.subscriptionID, intercept: f.intercept}
+}
+
+func (f *clientFactory) GetSnapshotClientForSub(subscriptionID string) (snapshotclient.Interface, error) {
+	client, err := f.ClientFactory.GetSnapshotClientForSub(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotClient{Interface: client, subscriptionID: f.subscriptionFor(subscriptionID), intercept: f.intercept}, nil
+}
+
+func (f *clientFactory) GetVirtualMachineClient() virtualmachineclient.Interface {
+	return &virtualMachineClient{Interface: f.ClientFactory.GetVirtualMachineClient(), subscriptionID: f.subscriptionID, intercept: f.intercept}
+}
+
+func (f *clientFactory) GetVirtualMachineScaleSetClient() virtualmachinescalesetclient.Interface {
+	return &virtualMachineScaleSetClient{Interface: f.ClientFactory.GetVirtualMachineScaleSetClient(), subscriptionID: f.subscriptionID, intercept: f.intercept}
+}
+
+func (f *clientFactory) GetVirtualMachineScaleSetVMClient() virtualmachinescalesetvmclient.Interface {
+	return &virtualMachineScaleSetVMClient{Interface: f.ClientFactory.GetVirtualMachineScaleSetVMClient(), subscriptionID: f.subscriptionID, intercept: f.intercept}
+}
+
+// subscriptionFor returns the subscription the ForSub clients use, an empty subscription means the default one
+func (f *clientFactory) subscriptionFor(subscriptionID string) string {
+	if subscriptionID == "" {
+		return f.subscriptionID
+	}
+	return subscriptionID
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/diskclient/mock_diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/mock_azclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetclient/mock_virtualmachinescalesetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azclient/virtualmachinescalesetvmclient/mock_virtualmachinescalesetvmclient"
+)
+
+func TestNewClientFactoryWithoutInterceptors(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	factory := mock_azclient.NewMockClientFactory(cntl)
+
+	assert.Equal(t, factory, NewClientFactory(factory, "sub"))
+	assert.Nil(t, NewClientFactory(nil, "sub", func(ctx context.Context, _ *Operation, invoke Invoker) (interface{}, error) {
+		return invoke(ctx)
+	}))
+}
+
+func TestInterceptorChain(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	factory := mock_azclient.NewMockClientFactory(cntl)
+	disks := mock_diskclient.NewMockInterface(cntl)
+	factory.EXPECT().GetDiskClient().Return(disks).AnyTimes()
+	factory.EXPECT().GetDiskClientForSub("other").Return(disks, nil).AnyTimes()
+
+	var calls []string
+	var ops []*Operation
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, op *Operation, invoke Invoker) (interface{}, error) {
+			calls = append(calls, name)
+			ops = append(ops, op)
+			return invoke(ctx)
+		}
+	}
+	wrapped := NewClientFactory(factory, "sub", record("outer"), record("inner"))
+
+	disk := &armcompute.Disk{Name: to.Ptr("disk")}
+	disks.EXPECT().Get(gomock.Any(), "rg", "disk").Return(disk, nil)
+	result, err := wrapped.GetDiskClient().Get(context.Background(), "rg", "disk")
+	assert.NoError(t, err)
+	assert.Equal(t, disk, result)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.Equal(t, &Operation{SubscriptionID: "sub", ResourceType: ResourceTypeDisk, Method: "Get", ResourceGroup: "rg", ResourceName: "disk"}, ops[0])
+
+	calls, ops = nil, nil
+	client, err := wrapped.GetDiskClientForSub("other")
+	assert.NoError(t, err)
+	disks.EXPECT().Delete(gomock.Any(), "rg", "disk").Return(fmt.Errorf("delete failed"))
+	assert.EqualError(t, client.Delete(context.Background(), "rg", "disk"), "delete failed")
+	assert.Equal(t, "other", ops[0].SubscriptionID)
+	assert.True(t, ops[0].Mutating)
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	factory := mock_azclient.NewMockClientFactory(cntl)
+	vms := mock_virtualmachinescalesetvmclient.NewMockInterface(cntl)
+	factory.EXPECT().GetVirtualMachineScaleSetVMClient().Return(vms).AnyTimes()
+
+	var op *Operation
+	wrapped := NewClientFactory(factory, "sub", func(_ context.Context, o *Operation, _ Invoker) (interface{}, error) {
+		op = o
+		return &armcompute.VirtualMachineScaleSetVM{Name: to.Ptr("vmss_0")}, nil
+	})
+
+	params := armcompute.VirtualMachineScaleSetVM{}
+	result, err := wrapped.GetVirtualMachineScaleSetVMClient().Update(context.Background(), "rg", "vmss", "0", params)
+	assert.NoError(t, err)
+	assert.Equal(t, "vmss_0", *result.Name)
+	assert.Equal(t, ResourceTypeVirtualMachineScaleSetVM, op.ResourceType)
+	assert.Equal(t, "vmss", op.ParentResourceName)
+	assert.Equal(t, "0", op.ResourceName)
+	assert.Equal(t, params, op.Parameters)
+	assert.True(t, op.Mutating)
+
+	// a nil result is converted to the zero value of the client method result
+	wrapped = NewClientFactory(factory, "sub", func(_ context.Context, _ *Operation, _ Invoker) (interface{}, error) {
+		return nil, fmt.Errorf("rejected")
+	})
+	result, err = wrapped.GetVirtualMachineScaleSetVMClient().Get(context.Background(), "rg", "vmss", "0")
+	assert.EqualError(t, err, "rejected")
+	assert.Nil(t, result)
+}
+
+func TestVirtualMachineScaleSetClient(t *testing.T) {
+	cntl := gomock.NewController(t)
+	defer cntl.Finish()
+	factory := mock_azclient.NewMockClientFactory(cntl)
+	vmss := mock_virtualmachinescalesetclient.NewMockInterface(cntl)
+	factory.EXPECT().GetVirtualMachineScaleSetClient().Return(vmss).AnyTimes()
+	vmss.EXPECT().Get(gomock.Any(), "rg", "vmss", nil).Return(&armcompute.VirtualMachineScaleSet{Name: to.Ptr("vmss")}, nil)
+
+	var op *Operation
+	wrapped := NewClientFactory(factory, "sub", func(ctx context.Context, o *Operation, invoke Invoker) (interface{}, error) {
+		op = o
+		return invoke(ctx)
+	})
+	result, err := wrapped.GetVirtualMachineScaleSetClient().Get(context.Background(), "rg", "vmss", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "vmss", *result.Name)
+	assert.Equal(t, &Operation{SubscriptionID: "sub", ResourceType: ResourceTypeVirtualMachineScaleSet, Method: "Get", ResourceGroup: "rg", ResourceName: "vmss"}, op)
+}
@@ -23,6 +23,13 @@ type Interface interface {
 	DiskSupportsPerfOptimization(diskPerfProfile, diskAccountType string) bool
 	OptimizeDiskPerformance(nodeInfo *NodeInfo,
 		devicePath, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) error
+	// GetDeviceSettings returns the device settings of the perf profile relative to the block device directory in sysfs
+	GetDeviceSettings(nodeInfo *NodeInfo,
+		perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) (map[string]string, error)
+	// ApplyDeviceSettings writes the device settings of the device at devicePath
+	ApplyDeviceSettings(devicePath string, deviceSettings map[string]string) error
+	// ReadDeviceSettings reads the current values of the settings of the device at devicePath
+	ReadDeviceSettings(devicePath string, settings []string) (map[string]string, error)
 }
 
 // Compile-time check to ensure all Mounter DeviceHelper satisfy
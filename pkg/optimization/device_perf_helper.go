@@ -25,8 +25,7 @@ import (
 )
 
 // IsValidPerfProfile Checks to see if perf profile passed is correct
-// Right now we are only supporting basic profile
-// Other advanced profiles to come later
+// Besides none, basic and advanced, the named perf profiles loaded with SetPerfProfiles are supported
 func IsValidPerfProfile(profile string) bool {
 	return isPerfTuningEnabled(profile) || strings.EqualFold(profile, consts.PerfProfileNone)
 }
@@ -79,7 +78,7 @@ func isPerfTuningEnabled(profile string) bool {
 	case consts.PerfProfileAdvanced:
 		return true
 	default:
-		return false
+		return IsPerfProfileDefined(profile)
 	}
 }
 
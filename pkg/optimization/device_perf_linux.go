@@ -25,6 +25,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -48,39 +50,113 @@ func (deviceHelper *DeviceHelper) DiskSupportsPerfOptimization(diskPerfProfile,
 // OptimizeDiskPerformance optimizes device performance by setting tuning block device settings
 func (deviceHelper *DeviceHelper) OptimizeDiskPerformance(nodeInfo *NodeInfo, devicePath,
 	perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) (err error) {
-
-	if nodeInfo == nil {
-		return fmt.Errorf("OptimizeDiskPerformance: Node info is not provided. Error: invalid parameter")
+	deviceSettings, err := deviceHelper.GetDeviceSettings(nodeInfo, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettingsFromCtx)
+	if err != nil {
+		return fmt.Errorf("OptimizeDiskPerformance: %v", err)
 	}
+	return deviceHelper.ApplyDeviceSettings(devicePath, deviceSettings)
+}
 
-	deviceName, err := getDeviceName(devicePath)
-	if err != nil {
-		return fmt.Errorf("OptimizeDiskPerformance: Could not get deviceName for %s. Error: %v", devicePath, err)
+// GetDeviceSettings gets the device settings of the perf profile, relative to the block device directory in sysfs
+func (deviceHelper *DeviceHelper) GetDeviceSettings(nodeInfo *NodeInfo,
+	perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) (deviceSettings map[string]string, err error) {
+	if nodeInfo == nil {
+		return nil, fmt.Errorf("GetDeviceSettings: Node info is not provided. Error: invalid parameter")
 	}
 
-	var deviceSettings map[string]string
-	deviceRoot := filepath.Join(deviceHelper.blockDeviceRootPath, deviceName)
+	// an empty deviceRoot keeps the settings relative
 	switch strings.ToLower(perfProfile) {
 	case consts.PerfProfileBasic:
 		deviceSettings, err = getDeviceSettingsForBasicProfile(nodeInfo,
-			deviceRoot, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr)
+			"", perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr)
 	case consts.PerfProfileAdvanced:
-		deviceSettings, err = getDeviceSettingsForAdvancedProfile(deviceRoot, deviceSettingsFromCtx)
+		deviceSettings, err = getDeviceSettingsForAdvancedProfile("", deviceSettingsFromCtx)
 	default:
-		return fmt.Errorf("OptimizeDiskPerformance: Invalid perfProfile %s", perfProfile)
+		profile, ok := getPerfProfile(perfProfile)
+		if !ok {
+			return nil, fmt.Errorf("GetDeviceSettings: Invalid perfProfile %s", perfProfile)
+		}
+		deviceSettings, err = getDeviceSettingsForCustomProfile(nodeInfo, profile,
+			"", accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr)
 	}
 
 	if err != nil {
-		return fmt.Errorf("OptimizeDiskPerformance: Failed to optimize disk for deviceName %s perfProfile %s. Error: %v",
-			deviceName, perfProfile, err)
+		return nil, fmt.Errorf("GetDeviceSettings: Failed to get device settings for perfProfile %s. Error: %v", perfProfile, err)
 	}
 
-	klog.V(2).Infof("OptimizeDiskPerformance: Tuning settings for deviceRoot %s perfProfile %s accountType %s deviceSettings %v",
-		deviceRoot,
+	klog.V(2).Infof("GetDeviceSettings: Tuning settings for perfProfile %s accountType %s deviceSettings %v",
 		perfProfile,
 		accountType,
 		deviceSettings)
-	return applyDeviceSettings(deviceRoot, deviceSettings)
+	return deviceSettings, nil
+}
+
+// ApplyDeviceSettings writes the device settings relative to the block device directory in sysfs
+func (deviceHelper *DeviceHelper) ApplyDeviceSettings(devicePath string, deviceSettings map[string]string) error {
+	deviceRoot, err := deviceHelper.getDeviceRoot(devicePath)
+	if err != nil {
+		return err
+	}
+	absSettings := make(map[string]string, len(deviceSettings))
+	for setting, value := range deviceSettings {
+		if !isDeviceSettingSupported(deviceRoot, setting) {
+			klog.V(2).Infof("ApplyDeviceSettings: Skipping setting %s which deviceRoot %s does not have", setting, deviceRoot)
+			continue
+		}
+		absSettings[filepath.Join(deviceRoot, setting)] = value
+	}
+	klog.V(2).Infof("ApplyDeviceSettings: Tuning settings for deviceRoot %s deviceSettings %v", deviceRoot, deviceSettings)
+	return applyDeviceSettings(deviceRoot, absSettings)
+}
+
+// ReadDeviceSettings reads the current values of the settings relative to the block device directory in sysfs,
+// the selected value of a list like "[mq-deadline] none" is returned as is written.
+// The settings the device does not have are not returned, as ApplyDeviceSettings skips them
+func (deviceHelper *DeviceHelper) ReadDeviceSettings(devicePath string, settings []string) (map[string]string, error) {
+	deviceRoot, err := deviceHelper.getDeviceRoot(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	settings = slices.DeleteFunc(slices.Clone(settings), func(setting string) bool {
+		return !isDeviceSettingSupported(deviceRoot, setting)
+	})
+	absSettings := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		absSettings[filepath.Join(deviceRoot, setting)] = ""
+	}
+	if err := AreDeviceSettingsValid(deviceRoot, absSettings); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		content, err := os.ReadFile(filepath.Join(deviceRoot, setting))
+		if err != nil {
+			return nil, fmt.Errorf("ReadDeviceSettings: Could not read %s. Error: %v", filepath.Join(deviceRoot, setting), err)
+		}
+		values[setting] = selectedValue(string(content))
+	}
+	return values, nil
+}
+
+// getDeviceRoot gets the block device directory in sysfs of the device lun path
+func (deviceHelper *DeviceHelper) getDeviceRoot(devicePath string) (string, error) {
+	deviceName, err := getDeviceName(devicePath)
+	if err != nil {
+		return "", fmt.Errorf("Could not get deviceName for %s. Error: %v", devicePath, err)
+	}
+	return filepath.Join(deviceHelper.blockDeviceRootPath, deviceName), nil
+}
+
+// selectedValue returns the value in brackets of a sysfs list, or the trimmed content otherwise
+func selectedValue(content string) string {
+	content = strings.TrimSpace(content)
+	if start := strings.Index(content, "["); start >= 0 {
+		if end := strings.Index(content[start:], "]"); end > 0 {
+			return content[start+1 : start+end]
+		}
+	}
+	return content
 }
 
 func getDeviceSettingsForBasicProfile(nodeInfo *NodeInfo,
@@ -114,6 +190,26 @@ func getDeviceSettingsForAdvancedProfile(deviceRoot string, deviceSettingsFromCt
 	return deviceSettings, nil
 }
 
+func getDeviceSettingsForCustomProfile(nodeInfo *NodeInfo, profile *perfProfile,
+	deviceRoot, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string) (deviceSettings map[string]string, err error) {
+	klog.V(2).Infof("getDeviceSettingsForCustomProfile: Getting settings for deviceRoot %s", deviceRoot)
+	var diskSku *DiskSkuInfo
+	if profile.usesDisk {
+		diskSku, err = getMatchingDiskSku(DiskSkuMap, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr)
+		if err != nil || diskSku == nil {
+			return nil, fmt.Errorf("could not find sku for account %s size %s. Error: sku not found", accountType, diskSizeGibStr)
+		}
+	}
+
+	// the requested IOPS and bandwidth are optional, they are zero if not set
+	volume := &volumeInfo{}
+	volume.SizeGiB, _ = strconv.Atoi(diskSizeGibStr)
+	volume.Iops, _ = strconv.Atoi(diskIopsStr)
+	volume.BwMbps, _ = strconv.Atoi(diskBwMbpsStr)
+
+	return profile.deviceSettings(deviceRoot, nodeInfo, diskSku, volume)
+}
+
 func applyDeviceSettings(deviceRoot string, deviceSettings map[string]string) (err error) {
 	if err = AreDeviceSettingsValid(deviceRoot, deviceSettings); err != nil {
 		return err
@@ -140,9 +236,32 @@ func getDeviceName(lunPath string) (deviceName string, err error) {
 		return "", fmt.Errorf("path %s is not a symlink. Error: %v", lunPath, err)
 	}
 
-	return filepath.Base(devicePath), nil
+	deviceName = filepath.Base(devicePath)
+	// the settings of a partition are the ones of its disk
+	if match := diskPartitionRegex.FindStringSubmatch(deviceName); match != nil {
+		return match[1] + match[2], nil
+	}
+	return deviceName, nil
+}
+
+// nvmeNamespaceNameRegex matches the NVMe namespaces, e.g. nvme0n3 and nvme0c1n3
+var nvmeNamespaceNameRegex = regexp.MustCompile(`^nvme[0-9]+(?:c[0-9]+)?n[0-9]+$`)
+
+// scsiDeviceSettings are the settings of the SCSI device of a disk, an NVMe namespace has no SCSI device
+// and its queue depth is bounded by queue/nr_requests which is tuned as well
+var scsiDeviceSettings = []string{"device/queue_depth"}
+
+// isDeviceSettingSupported returns false for a setting relative to deviceRoot that the kind of device does not have
+func isDeviceSettingSupported(deviceRoot, setting string) bool {
+	if nvmeNamespaceNameRegex.MatchString(filepath.Base(deviceRoot)) {
+		return !slices.Contains(scsiDeviceSettings, filepath.Clean(setting))
+	}
+	return true
 }
 
+// diskPartitionRegex matches the partitions of SCSI and NVMe disks, e.g. sdc1 and nvme0n3p1, capturing the disk name
+var diskPartitionRegex = regexp.MustCompile(`^(?:(sd[a-z]+)[0-9]+|(nvme[0-9]+n[0-9]+)p[0-9]+)$`)
+
 // echoToFile echos setting value to the file
 func echoToFile(content, filePath string) (err error) {
 	outfile, err := os.Create(filePath)
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -54,7 +55,7 @@ func Test_OptimizeDiskPerformance(t *testing.T) {
 		{
 			name:                "could not have queue dir for device should return error",
 			nodeInfo:            &NodeInfo{SkuName: "Standard_DS14", MaxBurstIops: 51200, MaxIops: 51200, MaxBwMbps: 512, MaxBurstBwMbps: 512},
-			devicePath:          "sda1",
+			devicePath:          "sdw",
 			perfProfile:         "basic",
 			accountType:         "Premium_LRS",
 			diskSizeGibStr:      "512",
@@ -67,7 +68,7 @@ func Test_OptimizeDiskPerformance(t *testing.T) {
 		{
 			name:                "could not have queue/iosched dir for device should return error",
 			nodeInfo:            &NodeInfo{SkuName: "Standard_DS14", MaxBurstIops: 51200, MaxIops: 51200, MaxBwMbps: 512, MaxBurstBwMbps: 512},
-			devicePath:          "sda2",
+			devicePath:          "sdx",
 			perfProfile:         "basic",
 			accountType:         "Premium_LRS",
 			diskSizeGibStr:      "512",
@@ -80,7 +81,7 @@ func Test_OptimizeDiskPerformance(t *testing.T) {
 		{
 			name:                "could not have device dir for device should return error",
 			nodeInfo:            &NodeInfo{SkuName: "Standard_DS14", MaxBurstIops: 51200, MaxIops: 51200, MaxBwMbps: 512, MaxBurstBwMbps: 512},
-			devicePath:          "sda3",
+			devicePath:          "sdy",
 			perfProfile:         "basic",
 			accountType:         "Premium_LRS",
 			diskSizeGibStr:      "512",
@@ -93,7 +94,7 @@ func Test_OptimizeDiskPerformance(t *testing.T) {
 		{
 			name:                "valid device",
 			nodeInfo:            &NodeInfo{SkuName: "Standard_DS14", MaxBurstIops: 51200, MaxIops: 51200, MaxBwMbps: 512, MaxBurstBwMbps: 512},
-			devicePath:          "sda4",
+			devicePath:          "sdz",
 			perfProfile:         "basic",
 			accountType:         "Premium_LRS",
 			diskSizeGibStr:      "512",
@@ -299,6 +300,26 @@ func Test_getDeviceSettingsForAdvancedProfile(t *testing.T) {
 	}
 }
 
+func Test_getDeviceSettingsForCustomProfile(t *testing.T) {
+	profile, err := newPerfProfile(PerfProfile{
+		Settings: map[string]string{"queue/scheduler": "none"},
+		Formulas: map[string]string{"device/queue_depth": "ceil(min(disk.MaxBurstIops, node.MaxBurstIops) * 0.0022)"},
+	})
+	require.NoError(t, err)
+	nodeInfo := &NodeInfo{SkuName: "Standard_DS14", MaxBurstIops: 51200, MaxIops: 51200, MaxBwMbps: 512, MaxBurstBwMbps: 512}
+
+	// a 512 GiB Premium_LRS disk matches P20 with 3500 burst IOPS
+	deviceSettings, err := getDeviceSettingsForCustomProfile(nodeInfo, profile, "/sys/block/sdc", "Premium_LRS", "512", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/sys/block/sdc/queue/scheduler":    "none",
+		"/sys/block/sdc/device/queue_depth": "8",
+	}, deviceSettings)
+
+	_, err = getDeviceSettingsForCustomProfile(nodeInfo, profile, "/sys/block/sdc", "Premium_LRS", "100000", "", "")
+	assert.ErrorContains(t, err, "could not find sku for account Premium_LRS size 100000")
+}
+
 func Test_applyDeviceSettings(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -491,24 +512,56 @@ func Test_meetsRequest(t *testing.T) {
 }
 
 func Test_getDeviceName(t *testing.T) {
+	dir := t.TempDir()
+	for _, device := range []string{"sdc", "sdc1", "nvme0n3", "nvme0n3p1", "nvme0n12"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, device), nil, 0600))
+		require.NoError(t, os.Symlink(device, filepath.Join(dir, "link-"+device)))
+	}
 	tests := []struct {
-		name    string
-		lunPath string
-		wantErr bool
+		name       string
+		lunPath    string
+		deviceName string
+		wantErr    bool
 	}{
 		{
 			name:    "return error for invalid file",
 			lunPath: "blah",
 			wantErr: true,
 		},
+		{
+			name:       "scsi disk",
+			lunPath:    filepath.Join(dir, "link-sdc"),
+			deviceName: "sdc",
+		},
+		{
+			name:       "scsi partition",
+			lunPath:    filepath.Join(dir, "link-sdc1"),
+			deviceName: "sdc",
+		},
+		{
+			name:       "nvme namespace",
+			lunPath:    filepath.Join(dir, "link-nvme0n3"),
+			deviceName: "nvme0n3",
+		},
+		{
+			name:       "nvme partition",
+			lunPath:    filepath.Join(dir, "link-nvme0n3p1"),
+			deviceName: "nvme0n3",
+		},
+		{
+			name:       "nvme namespace with two digits",
+			lunPath:    filepath.Join(dir, "nvme0n12"),
+			deviceName: "nvme0n12",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := getDeviceName(tt.lunPath)
+			deviceName, err := getDeviceName(tt.lunPath)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getDeviceName() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			assert.Equal(t, tt.deviceName, deviceName)
 		})
 	}
 }
@@ -537,3 +590,63 @@ func Test_echoToFile(t *testing.T) {
 		})
 	}
 }
+
+func Test_ApplyAndReadDeviceSettings(t *testing.T) {
+	root := t.TempDir()
+	devicePath := filepath.Join(root, "sdx")
+	require.NoError(t, os.MkdirAll(filepath.Join(devicePath, "queue"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(devicePath, "queue/scheduler"), []byte("[mq-deadline] kyber none\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(devicePath, "queue/nr_requests"), []byte("256\n"), 0600))
+	deviceHelper := &DeviceHelper{blockDeviceRootPath: root}
+
+	settings, err := deviceHelper.ReadDeviceSettings(devicePath, []string{"queue/scheduler", "queue/nr_requests"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"queue/scheduler": "mq-deadline", "queue/nr_requests": "256"}, settings)
+
+	require.NoError(t, deviceHelper.ApplyDeviceSettings(devicePath, map[string]string{"queue/nr_requests": "64"}))
+	settings, err = deviceHelper.ReadDeviceSettings(devicePath, []string{"queue/nr_requests"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"queue/nr_requests": "64"}, settings)
+
+	_, err = deviceHelper.ReadDeviceSettings(devicePath, []string{"../sda/queue/scheduler"})
+	assert.Error(t, err)
+	_, err = deviceHelper.ReadDeviceSettings(devicePath, []string{"queue/missing"})
+	assert.Error(t, err)
+}
+
+func Test_ApplyAndReadDeviceSettingsOfNVMeNamespace(t *testing.T) {
+	root := t.TempDir()
+	deviceHelper := &DeviceHelper{blockDeviceRootPath: root}
+	deviceSettings := map[string]string{"queue/nr_requests": "64", "device/queue_depth": "32"}
+
+	for _, device := range []string{"nvme0n3", "nvme0c1n3"} {
+		// an NVMe namespace has no SCSI device, so it has no device/queue_depth
+		devicePath := filepath.Join(root, device)
+		require.NoError(t, os.MkdirAll(filepath.Join(devicePath, "queue"), 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(devicePath, "queue/nr_requests"), []byte("1023\n"), 0600))
+
+		settings, err := deviceHelper.ReadDeviceSettings(devicePath, []string{"queue/nr_requests", "device/queue_depth"})
+		require.NoError(t, err, device)
+		assert.Equal(t, map[string]string{"queue/nr_requests": "1023"}, settings, device)
+
+		require.NoError(t, deviceHelper.ApplyDeviceSettings(devicePath, deviceSettings), device)
+		settings, err = deviceHelper.ReadDeviceSettings(devicePath, []string{"queue/nr_requests"})
+		require.NoError(t, err, device)
+		assert.Equal(t, map[string]string{"queue/nr_requests": "64"}, settings, device)
+		assert.NoFileExists(t, filepath.Join(devicePath, "device/queue_depth"), device)
+	}
+
+	// the settings of a SCSI disk are not skipped
+	devicePath := filepath.Join(root, "sdx")
+	require.NoError(t, os.MkdirAll(filepath.Join(devicePath, "queue"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(devicePath, "queue/nr_requests"), []byte("256\n"), 0600))
+	_, err := deviceHelper.ReadDeviceSettings(devicePath, []string{"device/queue_depth"})
+	assert.Error(t, err)
+	assert.Error(t, deviceHelper.ApplyDeviceSettings(devicePath, deviceSettings))
+}
+
+func Test_selectedValue(t *testing.T) {
+	assert.Equal(t, "none", selectedValue("mq-deadline kyber [none]\n"))
+	assert.Equal(t, "128", selectedValue("128\n"))
+	assert.Equal(t, "[broken", selectedValue("[broken"))
+}
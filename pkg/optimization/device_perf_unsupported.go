@@ -34,3 +34,16 @@ func (deviceHelper *DeviceHelper) OptimizeDiskPerformance(nodeInfo *NodeInfo,
 	devicePath, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) (err error) {
 	return fmt.Errorf("OptimizeDiskPerformance not implemented")
 }
+
+func (deviceHelper *DeviceHelper) GetDeviceSettings(nodeInfo *NodeInfo,
+	perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) (map[string]string, error) {
+	return nil, fmt.Errorf("GetDeviceSettings not implemented")
+}
+
+func (deviceHelper *DeviceHelper) ApplyDeviceSettings(devicePath string, deviceSettings map[string]string) error {
+	return fmt.Errorf("ApplyDeviceSettings not implemented")
+}
+
+func (deviceHelper *DeviceHelper) ReadDeviceSettings(devicePath string, settings []string) (map[string]string, error) {
+	return nil, fmt.Errorf("ReadDeviceSettings not implemented")
+}
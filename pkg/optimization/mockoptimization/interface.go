@@ -77,3 +77,47 @@ func (mr *MockInterfaceMockRecorder) OptimizeDiskPerformance(nodeInfo, devicePat
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OptimizeDiskPerformance", reflect.TypeOf((*MockInterface)(nil).OptimizeDiskPerformance), nodeInfo, devicePath, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettingsFromCtx)
 }
+
+// GetDeviceSettings mocks base method.
+func (m *MockInterface) GetDeviceSettings(nodeInfo *optimization.NodeInfo, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr string, deviceSettingsFromCtx map[string]string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeviceSettings", nodeInfo, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettingsFromCtx)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeviceSettings indicates an expected call of GetDeviceSettings.
+func (mr *MockInterfaceMockRecorder) GetDeviceSettings(nodeInfo, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettingsFromCtx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceSettings", reflect.TypeOf((*MockInterface)(nil).GetDeviceSettings), nodeInfo, perfProfile, accountType, diskSizeGibStr, diskIopsStr, diskBwMbpsStr, deviceSettingsFromCtx)
+}
+
+// ApplyDeviceSettings mocks base method.
+func (m *MockInterface) ApplyDeviceSettings(devicePath string, deviceSettings map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyDeviceSettings", devicePath, deviceSettings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ApplyDeviceSettings indicates an expected call of ApplyDeviceSettings.
+func (mr *MockInterfaceMockRecorder) ApplyDeviceSettings(devicePath, deviceSettings interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyDeviceSettings", reflect.TypeOf((*MockInterface)(nil).ApplyDeviceSettings), devicePath, deviceSettings)
+}
+
+// ReadDeviceSettings mocks base method.
+func (m *MockInterface) ReadDeviceSettings(devicePath string, settings []string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadDeviceSettings", devicePath, settings)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadDeviceSettings indicates an expected call of ReadDeviceSettings.
+func (mr *MockInterfaceMockRecorder) ReadDeviceSettings(devicePath, settings interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDeviceSettings", reflect.TypeOf((*MockInterface)(nil).ReadDeviceSettings), devicePath, settings)
+}
@@ -0,0 +1,342 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package optimization
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+// PerfProfileConfig is the configuration of the named perf profiles, e.g.
+//
+//	profiles:
+//	  database:
+//	    settings:
+//	      queue/scheduler: mq-deadline
+//	    formulas:
+//	      device/queue_depth: ceil(min(disk.MaxBurstIops, node.MaxBurstIops) * 0.0022)
+type PerfProfileConfig struct {
+	Profiles map[string]PerfProfile `json:"profiles"`
+}
+
+// PerfProfile is a named set of device settings relative to the block device directory in sysfs
+type PerfProfile struct {
+	// Settings are written as is
+	Settings map[string]string `json:"settings,omitempty"`
+	// Formulas are Go arithmetic expressions over the fields of the matched disk SKU (disk.MaxIops),
+	// the node SKU (node.MaxBurstBwMbps) and the requested volume (volume.SizeGiB, volume.Iops, volume.BwMbps),
+	// with the functions min, max, ceil and floor. Results are rounded down to integers.
+	Formulas map[string]string `json:"formulas,omitempty"`
+}
+
+// perfProfile is a validated PerfProfile
+type perfProfile struct {
+	settings map[string]string
+	formulas map[string]ast.Expr
+	// usesDisk is true if a formula refers to the disk SKU
+	usesDisk bool
+}
+
+// volumeInfo is the requested size and performance of a volume
+type volumeInfo struct {
+	SizeGiB int
+	Iops    int
+	BwMbps  int
+}
+
+// formulaFuncs are the functions of the formulas with their number of arguments
+var formulaFuncs = map[string]int{"min": 2, "max": 2, "ceil": 1, "floor": 1}
+
+// formulaVars are the variables of the formulas with their types
+var formulaVars = map[string]reflect.Type{
+	"disk":   reflect.TypeOf(DiskSkuInfo{}),
+	"node":   reflect.TypeOf(NodeInfo{}),
+	"volume": reflect.TypeOf(volumeInfo{}),
+}
+
+// perfProfiles are the named perf profiles loaded at runtime
+var perfProfiles = struct {
+	mu       sync.RWMutex
+	profiles map[string]*perfProfile
+	data     []byte
+}{}
+
+// SetPerfProfiles replaces the named perf profiles with the ones parsed from data,
+// the profiles are kept if data is invalid
+func SetPerfProfiles(data []byte) error {
+	perfProfiles.mu.Lock()
+	defer perfProfiles.mu.Unlock()
+	if perfProfiles.data != nil && bytes.Equal(perfProfiles.data, data) {
+		return nil
+	}
+	profiles, err := parsePerfProfiles(data)
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("loaded %d perf profiles", len(profiles))
+	perfProfiles.profiles = profiles
+	perfProfiles.data = data
+	return nil
+}
+
+// IsPerfProfileDefined checks whether a named perf profile is loaded
+func IsPerfProfileDefined(name string) bool {
+	_, ok := getPerfProfile(name)
+	return ok
+}
+
+func getPerfProfile(name string) (*perfProfile, bool) {
+	perfProfiles.mu.RLock()
+	defer perfProfiles.mu.RUnlock()
+	profile, ok := perfProfiles.profiles[strings.ToLower(name)]
+	return profile, ok
+}
+
+// isBuiltInPerfProfile checks whether the profile is one of none, basic and advanced
+func isBuiltInPerfProfile(profile string) bool {
+	switch strings.ToLower(profile) {
+	case consts.PerfProfileNone, consts.PerfProfileBasic, consts.PerfProfileAdvanced:
+		return true
+	default:
+		return false
+	}
+}
+
+// isValidPerfProfileName checks whether the profile can name a custom perf profile
+func isValidPerfProfileName(profile string) bool {
+	return !isBuiltInPerfProfile(profile) && len(validation.IsDNS1123Label(strings.ToLower(profile))) == 0
+}
+
+func parsePerfProfiles(data []byte) (map[string]*perfProfile, error) {
+	var config PerfProfileConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse perf profiles: %w", err)
+	}
+	profiles := make(map[string]*perfProfile, len(config.Profiles))
+	for name, profile := range config.Profiles {
+		if !isValidPerfProfileName(name) {
+			return nil, fmt.Errorf("invalid perf profile name %q, it must be a DNS label other than none, basic and advanced", name)
+		}
+		if _, ok := profiles[strings.ToLower(name)]; ok {
+			return nil, fmt.Errorf("duplicate perf profile %s", name)
+		}
+		p, err := newPerfProfile(profile)
+		if err != nil {
+			return nil, fmt.Errorf("perf profile %s: %w", name, err)
+		}
+		profiles[strings.ToLower(name)] = p
+	}
+	return profiles, nil
+}
+
+func newPerfProfile(profile PerfProfile) (*perfProfile, error) {
+	p := &perfProfile{settings: profile.Settings, formulas: make(map[string]ast.Expr, len(profile.Formulas))}
+	deviceSettings := map[string]string{}
+	for setting, value := range profile.Settings {
+		deviceSettings[filepath.Join(consts.DummyBlockDevicePathLinux, setting)] = value
+	}
+	for setting, formula := range profile.Formulas {
+		if _, ok := profile.Settings[setting]; ok {
+			return nil, fmt.Errorf("setting %s has both a value and a formula", setting)
+		}
+		expr, usesDisk, err := parseFormula(formula)
+		if err != nil {
+			return nil, fmt.Errorf("invalid formula %q of setting %s: %w", formula, setting, err)
+		}
+		p.formulas[setting] = expr
+		p.usesDisk = p.usesDisk || usesDisk
+		deviceSettings[filepath.Join(consts.DummyBlockDevicePathLinux, setting)] = formula
+	}
+	if err := AreDeviceSettingsValid(consts.DummyBlockDevicePathLinux, deviceSettings); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseFormula parses and checks a formula, it returns whether the formula refers to the disk SKU
+func parseFormula(formula string) (ast.Expr, bool, error) {
+	expr, err := parser.ParseExpr(formula)
+	if err != nil {
+		return nil, false, err
+	}
+	usesDisk := false
+	var check func(expr ast.Expr) error
+	check = func(expr ast.Expr) error {
+		switch e := expr.(type) {
+		case *ast.BasicLit:
+			if e.Kind != token.INT && e.Kind != token.FLOAT {
+				return fmt.Errorf("unsupported literal %s", e.Value)
+			}
+		case *ast.ParenExpr:
+			return check(e.X)
+		case *ast.UnaryExpr:
+			if e.Op != token.SUB && e.Op != token.ADD {
+				return fmt.Errorf("unsupported operator %s", e.Op)
+			}
+			return check(e.X)
+		case *ast.BinaryExpr:
+			switch e.Op {
+			case token.ADD, token.SUB, token.MUL, token.QUO:
+			default:
+				return fmt.Errorf("unsupported operator %s", e.Op)
+			}
+			if err := check(e.X); err != nil {
+				return err
+			}
+			return check(e.Y)
+		case *ast.SelectorExpr:
+			variable, ok := e.X.(*ast.Ident)
+			if !ok {
+				return fmt.Errorf("unsupported expression")
+			}
+			varType, ok := formulaVars[variable.Name]
+			if !ok {
+				return fmt.Errorf("unknown variable %s", variable.Name)
+			}
+			if field, ok := varType.FieldByName(e.Sel.Name); !ok || field.Type.Kind() != reflect.Int {
+				return fmt.Errorf("unknown field %s.%s", variable.Name, e.Sel.Name)
+			}
+			usesDisk = usesDisk || variable.Name == "disk"
+		case *ast.CallExpr:
+			fun, ok := e.Fun.(*ast.Ident)
+			if !ok {
+				return fmt.Errorf("unsupported function call")
+			}
+			args, ok := formulaFuncs[fun.Name]
+			if !ok {
+				return fmt.Errorf("unknown function %s", fun.Name)
+			}
+			if len(e.Args) != args || e.Ellipsis.IsValid() {
+				return fmt.Errorf("function %s takes %d arguments", fun.Name, args)
+			}
+			for _, arg := range e.Args {
+				if err := check(arg); err != nil {
+					return err
+				}
+			}
+		case *ast.Ident:
+			return fmt.Errorf("unknown identifier %s, expected one of disk.<field>, node.<field> and volume.<field>", e.Name)
+		default:
+			return fmt.Errorf("unsupported expression")
+		}
+		return nil
+	}
+	if err := check(expr); err != nil {
+		return nil, false, err
+	}
+	return expr, usesDisk, nil
+}
+
+// evalFormula evaluates a formula checked by parseFormula, vars are the structs of formulaVars
+func evalFormula(expr ast.Expr, vars map[string]interface{}) (float64, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return strconv.ParseFloat(e.Value, 64)
+	case *ast.ParenExpr:
+		return evalFormula(e.X, vars)
+	case *ast.UnaryExpr:
+		x, err := evalFormula(e.X, vars)
+		if e.Op == token.SUB {
+			x = -x
+		}
+		return x, err
+	case *ast.BinaryExpr:
+		x, err := evalFormula(e.X, vars)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalFormula(e.Y, vars)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		default:
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return x / y, nil
+		}
+	case *ast.SelectorExpr:
+		name := e.X.(*ast.Ident).Name
+		value := vars[name]
+		if value == nil || reflect.ValueOf(value).IsNil() {
+			return 0, fmt.Errorf("%s is not available", name)
+		}
+		return float64(reflect.ValueOf(value).Elem().FieldByName(e.Sel.Name).Int()), nil
+	case *ast.CallExpr:
+		args := make([]float64, len(e.Args))
+		for i, arg := range e.Args {
+			value, err := evalFormula(arg, vars)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = value
+		}
+		switch e.Fun.(*ast.Ident).Name {
+		case "min":
+			return math.Min(args[0], args[1]), nil
+		case "max":
+			return math.Max(args[0], args[1]), nil
+		case "ceil":
+			return math.Ceil(args[0]), nil
+		default:
+			return math.Floor(args[0]), nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported expression")
+}
+
+// deviceSettings returns the settings of the profile under deviceRoot, diskSku is nil if no disk SKU matches the volume
+func (p *perfProfile) deviceSettings(deviceRoot string, nodeInfo *NodeInfo, diskSku *DiskSkuInfo, volume *volumeInfo) (map[string]string, error) {
+	deviceSettings := make(map[string]string, len(p.settings)+len(p.formulas))
+	for setting, value := range p.settings {
+		deviceSettings[filepath.Join(deviceRoot, setting)] = value
+	}
+	vars := map[string]interface{}{"disk": diskSku, "node": nodeInfo, "volume": volume}
+	for setting, formula := range p.formulas {
+		value, err := evalFormula(formula, vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate setting %s: %w", setting, err)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+			return nil, fmt.Errorf("setting %s evaluates to %g", setting, value)
+		}
+		deviceSettings[filepath.Join(deviceRoot, setting)] = strconv.FormatFloat(math.Floor(value), 'f', -1, 64)
+	}
+	return deviceSettings, nil
+}
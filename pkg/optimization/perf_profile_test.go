@@ -0,0 +1,192 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package optimization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPerfProfiles = `
+profiles:
+  database:
+    settings:
+      queue/scheduler: mq-deadline
+      queue/read_ahead_kb: "8"
+    formulas:
+      device/queue_depth: ceil(min(disk.MaxBurstIops, node.MaxBurstIops) * 0.0022)
+      queue/nr_requests: max(volume.Iops / 100, 16)
+  Streaming:
+    formulas:
+      queue/max_sectors_kb: min(node.MaxBwMbps * 1000 / (node.MaxIops * 0.75), 512)
+`
+
+func TestParsePerfProfiles(t *testing.T) {
+	tests := []struct {
+		desc        string
+		config      string
+		expectedErr string
+	}{
+		{
+			desc:   "valid profiles",
+			config: testPerfProfiles,
+		},
+		{
+			desc:   "empty config",
+			config: "",
+		},
+		{
+			desc:        "built-in profile name",
+			config:      "profiles:\n  Basic:\n    settings:\n      queue/scheduler: none\n",
+			expectedErr: `invalid perf profile name "Basic"`,
+		},
+		{
+			desc:        "invalid profile name",
+			config:      "profiles:\n  fast_io:\n    settings:\n      queue/scheduler: none\n",
+			expectedErr: `invalid perf profile name "fast_io"`,
+		},
+		{
+			desc:        "duplicate profile",
+			config:      "profiles:\n  fast:\n    settings:\n      queue/scheduler: none\n  FAST:\n    settings:\n      queue/scheduler: none\n",
+			expectedErr: "duplicate perf profile",
+		},
+		{
+			desc:        "no settings",
+			config:      "profiles:\n  fast: {}\n",
+			expectedErr: "perf profile fast: AreDeviceSettingsValid: No deviceSettings passed",
+		},
+		{
+			desc:        "setting outside of the device",
+			config:      "profiles:\n  fast:\n    settings:\n      ../sdb/queue/scheduler: none\n",
+			expectedErr: "is not a valid file path under /sys/block/sda",
+		},
+		{
+			desc:        "setting with value and formula",
+			config:      "profiles:\n  fast:\n    settings:\n      queue/nr_requests: \"8\"\n    formulas:\n      queue/nr_requests: \"16\"\n",
+			expectedErr: "setting queue/nr_requests has both a value and a formula",
+		},
+		{
+			desc:        "unknown field",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: disk.Iops\n",
+			expectedErr: "unknown field disk.Iops",
+		},
+		{
+			desc:        "unknown variable",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: vm.VCpus\n",
+			expectedErr: "unknown variable vm",
+		},
+		{
+			desc:        "string field",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: node.SkuName\n",
+			expectedErr: "unknown field node.SkuName",
+		},
+		{
+			desc:        "unknown function",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: sqrt(node.VCpus)\n",
+			expectedErr: "unknown function sqrt",
+		},
+		{
+			desc:        "wrong number of arguments",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: min(node.VCpus)\n",
+			expectedErr: "function min takes 2 arguments",
+		},
+		{
+			desc:        "unsupported operator",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: node.VCpus % 2\n",
+			expectedErr: "unsupported operator %",
+		},
+		{
+			desc:        "bare identifier",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/scheduler: none\n",
+			expectedErr: "unknown identifier none",
+		},
+		{
+			desc:        "invalid syntax",
+			config:      "profiles:\n  fast:\n    formulas:\n      queue/nr_requests: (node.VCpus\n",
+			expectedErr: `invalid formula "(node.VCpus" of setting queue/nr_requests`,
+		},
+		{
+			desc:        "unknown config field",
+			config:      "profile:\n  fast: {}\n",
+			expectedErr: "failed to parse perf profiles",
+		},
+	}
+	for _, test := range tests {
+		_, err := parsePerfProfiles([]byte(test.config))
+		if test.expectedErr == "" {
+			assert.NoError(t, err, test.desc)
+		} else {
+			assert.ErrorContains(t, err, test.expectedErr, test.desc)
+		}
+	}
+}
+
+func TestPerfProfileDeviceSettings(t *testing.T) {
+	profiles, err := parsePerfProfiles([]byte(testPerfProfiles))
+	assert.NoError(t, err)
+	nodeInfo := &NodeInfo{SkuName: "Standard_DS14", MaxBurstIops: 51200, MaxIops: 51200, MaxBwMbps: 512, MaxBurstBwMbps: 512}
+	diskSku := &DiskSkuInfo{MaxIops: 2300, MaxBurstIops: 3500, MaxBwMbps: 150, MaxBurstBwMbps: 170, MaxSizeGiB: 512}
+
+	assert.True(t, profiles["database"].usesDisk)
+	settings, err := profiles["database"].deviceSettings("/sys/block/sdc", nodeInfo, diskSku, &volumeInfo{SizeGiB: 512, Iops: 5000})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/sys/block/sdc/queue/scheduler":     "mq-deadline",
+		"/sys/block/sdc/queue/read_ahead_kb": "8",
+		"/sys/block/sdc/device/queue_depth":  "8",
+		"/sys/block/sdc/queue/nr_requests":   "50",
+	}, settings)
+
+	_, err = profiles["database"].deviceSettings("/sys/block/sdc", nodeInfo, nil, &volumeInfo{})
+	assert.ErrorContains(t, err, "failed to evaluate setting device/queue_depth: disk is not available")
+
+	assert.False(t, profiles["streaming"].usesDisk)
+	settings, err = profiles["streaming"].deviceSettings("/sys/block/sdc", nodeInfo, nil, &volumeInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"/sys/block/sdc/queue/max_sectors_kb": "13"}, settings)
+
+	_, err = profiles["streaming"].deviceSettings("/sys/block/sdc", &NodeInfo{}, nil, &volumeInfo{})
+	assert.ErrorContains(t, err, "failed to evaluate setting queue/max_sectors_kb: division by zero")
+
+	negative, err := newPerfProfile(PerfProfile{Formulas: map[string]string{"queue/nr_requests": "-node.VCpus"}})
+	assert.NoError(t, err)
+	_, err = negative.deviceSettings("/sys/block/sdc", &NodeInfo{VCpus: 4}, nil, &volumeInfo{})
+	assert.ErrorContains(t, err, "setting queue/nr_requests evaluates to -4")
+}
+
+func TestSetPerfProfiles(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, SetPerfProfiles([]byte{}))
+	})
+
+	assert.False(t, IsValidPerfProfile("database"))
+	assert.NoError(t, SetPerfProfiles([]byte(testPerfProfiles)))
+	assert.True(t, IsValidPerfProfile("Database"))
+	assert.True(t, isPerfTuningEnabled("streaming"))
+	assert.True(t, IsValidPerfProfile("basic"))
+	assert.False(t, IsValidPerfProfile("latency"))
+
+	// invalid profiles keep the previous ones
+	assert.Error(t, SetPerfProfiles([]byte("profiles:\n  latency: {}\n")))
+	assert.True(t, IsPerfProfileDefined("database"))
+	assert.False(t, IsPerfProfileDefined("latency"))
+
+	assert.NoError(t, SetPerfProfiles([]byte("profiles:\n  latency:\n    settings:\n      queue/scheduler: none\n")))
+	assert.False(t, IsPerfProfileDefined("database"))
+	assert.True(t, IsPerfProfileDefined("latency"))
+}
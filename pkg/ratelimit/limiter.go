@@ -0,0 +1,560 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ratelimit provides a shared token-bucket limiter for ARM calls. Every subscription
+// and operation class gets its own bucket whose rate adapts to 429 responses and Retry-After
+// headers, and waiting calls are served by priority.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+)
+
+// Priority of a call, a lower value is served first
+type Priority int
+
+const (
+	PriorityDetach Priority = iota
+	PriorityAttach
+	PriorityDefault
+	PriorityCreate
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityDetach:
+		return "detach"
+	case PriorityAttach:
+		return "attach"
+	case PriorityCreate:
+		return "create"
+	default:
+		return "default"
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose ARM calls are queued with priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by WithPriority, PriorityDefault if none
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityDefault
+}
+
+// Class returns the operation class of op, e.g. disk_read or vm_write.
+// VMSS VM calls share the class of VM calls since both update the VM model.
+func Class(op *interceptor.Operation) string {
+	resource := string(op.ResourceType)
+	switch op.ResourceType {
+	case interceptor.ResourceTypeVirtualMachine, interceptor.ResourceTypeVirtualMachineScaleSetVM:
+		resource = "vm"
+	case interceptor.ResourceTypeVirtualMachineScaleSet:
+		resource = "vmss"
+	}
+	if op.Mutating {
+		return resource + "_write"
+	}
+	return resource + "_read"
+}
+
+const (
+	// defaultRetryAfter is used for 429 responses without a Retry-After
+	defaultRetryAfter = 30 * time.Second
+	// defaultMaxRetryAfter is the longest a 429 response blocks a bucket
+	defaultMaxRetryAfter = 5 * time.Minute
+)
+
+// Config of the limiter
+type Config struct {
+	// ReadQPS and ReadBurst apply to each subscription and read operation class
+	ReadQPS   float64
+	ReadBurst int
+	// WriteQPS and WriteBurst apply to each subscription and write operation class
+	WriteQPS   float64
+	WriteBurst int
+	// MinQPS is the lowest rate the limiter backs off to after 429 responses
+	MinQPS float64
+	// MaxWait is the longest a call with the given priority may queue, a call whose
+	// estimated wait is longer is shed with a ThrottledError. Zero means no limit.
+	MaxWait map[Priority]time.Duration
+	// DefaultRetryAfter is used for 429 responses without a Retry-After header
+	DefaultRetryAfter time.Duration
+	// MaxRetryAfter caps the Retry-After of a 429 response so that a bad header can not stall the client
+	MaxRetryAfter time.Duration
+}
+
+// DefaultConfig returns the default limiter configuration
+func DefaultConfig() Config {
+	return Config{
+		ReadQPS:    20,
+		ReadBurst:  100,
+		WriteQPS:   5,
+		WriteBurst: 50,
+		MinQPS:     0.1,
+		MaxWait: map[Priority]time.Duration{
+			PriorityCreate: 60 * time.Second,
+		},
+		DefaultRetryAfter: defaultRetryAfter,
+		MaxRetryAfter:     defaultMaxRetryAfter,
+	}
+}
+
+// Validate returns an error if the rates of the configuration can not refill a bucket
+func (c Config) Validate() error {
+	if c.ReadQPS <= 0 {
+		return fmt.Errorf("read QPS %v must be greater than 0", c.ReadQPS)
+	}
+	if c.WriteQPS <= 0 {
+		return fmt.Errorf("write QPS %v must be greater than 0", c.WriteQPS)
+	}
+	if c.MinQPS < 0 {
+		return fmt.Errorf("min QPS %v must not be negative", c.MinQPS)
+	}
+	if c.MaxRetryAfter <= 0 {
+		return fmt.Errorf("max Retry-After %v must be greater than 0", c.MaxRetryAfter)
+	}
+	return nil
+}
+
+// ThrottledError is returned for calls shed by the limiter
+type ThrottledError struct {
+	SubscriptionID string
+	Class          string
+	RetryAfter     time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	// keep TooManyRequests in the message so that azureutils.IsThrottlingError recognizes it
+	return fmt.Sprintf("%s: %s calls of subscription %s are throttled by the driver, RetryAfter: %ds",
+		consts.TooManyRequests, e.Class, e.SubscriptionID, int(e.RetryAfter.Seconds()))
+}
+
+// Limiter holds one bucket per subscription and operation class
+type Limiter struct {
+	config Config
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter returns a limiter using the real clock
+func NewLimiter(config Config) *Limiter {
+	return NewLimiterWithClock(config, clock.RealClock{})
+}
+
+// NewLimiterWithClock returns a limiter using c, for tests
+func NewLimiterWithClock(config Config, c clock.Clock) *Limiter {
+	registerMetrics()
+	return &Limiter{
+		config:  config,
+		clock:   c,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Interceptor returns an interceptor which waits for a token before every call and
+// adapts the rate of the bucket to the result of the call
+func (l *Limiter) Interceptor() interceptor.Interceptor {
+	return func(ctx context.Context, op *interceptor.Operation, invoke interceptor.Invoker) (interface{}, error) {
+		class := Class(op)
+		if err := l.Wait(ctx, op.SubscriptionID, class, PriorityFromContext(ctx)); err != nil {
+			return nil, err
+		}
+		result, err := invoke(ctx)
+		l.Observe(op.SubscriptionID, class, err)
+		return result, err
+	}
+}
+
+// Wait blocks until a token of the bucket of subscriptionID and class is available
+func (l *Limiter) Wait(ctx context.Context, subscriptionID, class string, priority Priority) error {
+	if l == nil {
+		return nil
+	}
+	start := l.clock.Now()
+	err := l.bucket(subscriptionID, class).wait(ctx, priority)
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		shedCount.WithLabelValues(class, priority.String()).Inc()
+		klog.Warningf("shed %s %s call of subscription %s, retry after %v", priority, class, subscriptionID, throttled.RetryAfter)
+		return err
+	}
+	waitDuration.WithLabelValues(class, priority.String()).Observe(l.clock.Since(start).Seconds())
+	return err
+}
+
+// Observe adapts the bucket of subscriptionID and class to the result of a call: a throttling
+// error blocks the bucket until Retry-After and halves its rate, a success raises the rate again.
+func (l *Limiter) Observe(subscriptionID, class string, err error) {
+	if l == nil {
+		return
+	}
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		// shed by this limiter, not a response from ARM
+		return
+	}
+	b := l.bucket(subscriptionID, class)
+	if err != nil && azureutils.IsThrottlingError(err) {
+		retryAfter := l.retryAfter(err)
+		throttledCount.WithLabelValues(class).Inc()
+		qps := b.throttle(retryAfter)
+		klog.Warningf("ARM throttled %s calls of subscription %s, blocking for %v and reducing rate to %.2f qps", class, subscriptionID, retryAfter, qps)
+		return
+	}
+	if err == nil {
+		b.succeed()
+	}
+}
+
+// IsThrottled returns true if calls of subscriptionID and class are blocked by a Retry-After
+func (l *Limiter) IsThrottled(subscriptionID, class string) bool {
+	if l == nil {
+		return false
+	}
+	return l.bucket(subscriptionID, class).blocked() > 0
+}
+
+// Windows returns the expiry of the Retry-After blocks in effect, keyed by subscription and class
+func (l *Limiter) Windows() map[string]time.Time {
+	windows := map[string]time.Time{}
+	if l == nil {
+		return windows
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	for key, b := range l.buckets {
+		b.mu.Lock()
+		if b.blockedUntil.After(now) {
+			windows[key] = b.blockedUntil
+		}
+		b.mu.Unlock()
+	}
+	return windows
+}
+
+// Block blocks the bucket of the key returned by Windows until the given time, e.g. to restore
+// a window recorded before a restart. An earlier time than the current block is ignored.
+func (l *Limiter) Block(key string, until time.Time) error {
+	if l == nil {
+		return nil
+	}
+	subscriptionID, class, found := strings.Cut(key, "/")
+	if !found || class == "" {
+		return fmt.Errorf("invalid rate limiter key %q", key)
+	}
+	b := l.bucket(subscriptionID, class)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+		b.notify()
+	}
+	return nil
+}
+
+// retryAfter returns the Retry-After of a throttling error, DefaultRetryAfter if there is none,
+// capped to MaxRetryAfter
+func (l *Limiter) retryAfter(err error) time.Duration {
+	var d time.Duration
+	var ok bool
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.RawResponse != nil {
+		d, ok = parseRetryAfter(respErr.RawResponse.Header.Get("Retry-After"), l.clock.Now())
+	}
+	if !ok {
+		d = l.config.DefaultRetryAfter
+		if sec := azureutils.GetRetryAfterSeconds(err); sec > 0 {
+			d = time.Duration(sec) * time.Second
+		}
+	}
+	if d > l.config.MaxRetryAfter {
+		return l.config.MaxRetryAfter
+	}
+	return d
+}
+
+// parseRetryAfter parses the delay-seconds or HTTP-date form of a Retry-After header
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(value); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (l *Limiter) bucket(subscriptionID, class string) *bucket {
+	key := subscriptionID + "/" + class
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+	qps, burst := l.config.ReadQPS, l.config.ReadBurst
+	if isWriteClass(class) {
+		qps, burst = l.config.WriteQPS, l.config.WriteBurst
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	minQPS := l.config.MinQPS
+	if minQPS <= 0 || minQPS > qps {
+		minQPS = qps
+	}
+	b := &bucket{
+		subscriptionID: subscriptionID,
+		class:          class,
+		clock:          l.clock,
+		maxWait:        l.config.MaxWait,
+		maxQPS:         qps,
+		minQPS:         minQPS,
+		qps:            qps,
+		burst:          float64(burst),
+		tokens:         float64(burst),
+		last:           l.clock.Now(),
+		wake:           make(chan struct{}),
+		qpsSet:         currentQPS.WithLabelValues(subscriptionID, class).Set,
+		qlenSet:        queueLength.WithLabelValues(subscriptionID, class).Set,
+	}
+	b.qpsSet(qps)
+	l.buckets[key] = b
+	return b
+}
+
+func isWriteClass(class string) bool {
+	return strings.HasSuffix(class, "_write")
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+}
+
+// bucket is a token bucket whose waiters are served in priority order
+type bucket struct {
+	subscriptionID string
+	class          string
+	clock          clock.Clock
+	maxWait        map[Priority]time.Duration
+	maxQPS         float64
+	minQPS         float64
+	qpsSet         func(float64)
+	qlenSet        func(float64)
+
+	mu           sync.Mutex
+	qps          float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	lastIncrease time.Time
+	seq          uint64
+	waiters      []*waiter
+	// wake is closed and replaced whenever the state waiters depend on changes
+	wake chan struct{}
+}
+
+func (b *bucket) wait(ctx context.Context, priority Priority) error {
+	b.mu.Lock()
+	b.refill()
+	if len(b.waiters) == 0 && b.blockedLocked() <= 0 && b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.seq++
+	w := &waiter{priority: priority, seq: b.seq}
+	b.enqueue(w)
+	if max := b.maxWait[priority]; max > 0 {
+		if estimate := b.estimate(w); estimate > max {
+			b.remove(w)
+			b.mu.Unlock()
+			return &ThrottledError{SubscriptionID: b.subscriptionID, Class: b.class, RetryAfter: estimate}
+		}
+	}
+
+	for {
+		b.refill()
+		if b.waiters[0] == w && b.blockedLocked() <= 0 && b.tokens >= 1 {
+			b.tokens--
+			b.remove(w)
+			b.mu.Unlock()
+			return nil
+		}
+		delay := b.estimate(w)
+		wake := b.wake
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.remove(w)
+			b.mu.Unlock()
+			return ctx.Err()
+		case <-wake:
+		case <-b.clock.After(delay):
+		}
+		b.mu.Lock()
+	}
+}
+
+// refill adds the tokens generated since the last refill, b.mu must be held
+func (b *bucket) refill() {
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.qps
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// estimate returns how long w has to wait for its token, b.mu must be held
+func (b *bucket) estimate(w *waiter) time.Duration {
+	position := 0
+	for i, queued := range b.waiters {
+		if queued == w {
+			position = i
+			break
+		}
+	}
+	var delay time.Duration
+	if needed := float64(position+1) - b.tokens; needed > 0 {
+		delay = time.Duration(needed / b.qps * float64(time.Second))
+	}
+	if blocked := b.blockedLocked(); blocked > 0 {
+		delay += blocked
+	}
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
+
+// enqueue inserts w after all waiters of the same or a higher priority, b.mu must be held
+func (b *bucket) enqueue(w *waiter) {
+	i := sort.Search(len(b.waiters), func(i int) bool {
+		return b.waiters[i].priority > w.priority
+	})
+	b.waiters = append(b.waiters, nil)
+	copy(b.waiters[i+1:], b.waiters[i:])
+	b.waiters[i] = w
+	b.qlenSet(float64(len(b.waiters)))
+	b.notify()
+}
+
+func (b *bucket) remove(w *waiter) {
+	for i, queued := range b.waiters {
+		if queued == w {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			break
+		}
+	}
+	b.qlenSet(float64(len(b.waiters)))
+	b.notify()
+}
+
+// notify wakes all waiters to recompute their wait, b.mu must be held
+func (b *bucket) notify() {
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+func (b *bucket) blockedLocked() time.Duration {
+	return b.blockedUntil.Sub(b.clock.Now())
+}
+
+func (b *bucket) blocked() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.blockedLocked()
+}
+
+// throttle blocks the bucket for retryAfter and halves its rate, it returns the new rate
+func (b *bucket) throttle(retryAfter time.Duration) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if until := b.clock.Now().Add(retryAfter); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	b.qps /= 2
+	if b.qps < b.minQPS {
+		b.qps = b.minQPS
+	}
+	// drop the burst so that the calls queued during the block do not hit ARM at once
+	b.tokens = 0
+	b.lastIncrease = b.clock.Now()
+	b.qpsSet(b.qps)
+	b.notify()
+	return b.qps
+}
+
+// succeed raises the rate by a tenth of the configured rate at most once per second
+func (b *bucket) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.qps >= b.maxQPS {
+		return
+	}
+	now := b.clock.Now()
+	if now.Sub(b.lastIncrease) < time.Second {
+		return
+	}
+	b.refill()
+	b.lastIncrease = now
+	b.qps += b.maxQPS / 10
+	if b.qps > b.maxQPS {
+		b.qps = b.maxQPS
+	}
+	b.qpsSet(b.qps)
+	b.notify()
+}
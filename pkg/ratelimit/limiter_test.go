@@ -0,0 +1,304 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azureutils"
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/interceptor"
+)
+
+func testConfig() Config {
+	return Config{
+		ReadQPS:    10,
+		ReadBurst:  2,
+		WriteQPS:   1,
+		WriteBurst: 1,
+		MinQPS:     0.1,
+		MaxWait: map[Priority]time.Duration{
+			PriorityCreate: 5 * time.Second,
+		},
+		DefaultRetryAfter: 10 * time.Second,
+		MaxRetryAfter:     2 * time.Minute,
+	}
+}
+
+func throttlingError(retryAfter string) error {
+	header := http.Header{}
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &azcore.ResponseError{
+		ErrorCode:  "TooManyRequests",
+		StatusCode: http.StatusTooManyRequests,
+		RawResponse: &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     header,
+		},
+	}
+}
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		op       interceptor.Operation
+		expected string
+	}{
+		{op: interceptor.Operation{ResourceType: interceptor.ResourceTypeDisk}, expected: "disk_read"},
+		{op: interceptor.Operation{ResourceType: interceptor.ResourceTypeSnapshot, Mutating: true}, expected: "snapshot_write"},
+		{op: interceptor.Operation{ResourceType: interceptor.ResourceTypeVirtualMachine, Mutating: true}, expected: "vm_write"},
+		{op: interceptor.Operation{ResourceType: interceptor.ResourceTypeVirtualMachineScaleSetVM}, expected: "vm_read"},
+		{op: interceptor.Operation{ResourceType: interceptor.ResourceTypeVirtualMachineScaleSet}, expected: "vmss_read"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Class(&test.op))
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultConfig().Validate())
+	config := DefaultConfig()
+	config.ReadQPS = 0
+	assert.EqualError(t, config.Validate(), "read QPS 0 must be greater than 0")
+	config = DefaultConfig()
+	config.WriteQPS = -1
+	assert.EqualError(t, config.Validate(), "write QPS -1 must be greater than 0")
+	config = DefaultConfig()
+	config.MinQPS = -0.5
+	assert.EqualError(t, config.Validate(), "min QPS -0.5 must not be negative")
+	config = DefaultConfig()
+	config.MaxRetryAfter = 0
+	assert.EqualError(t, config.Validate(), "max Retry-After 0s must be greater than 0")
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	assert.Equal(t, PriorityDefault, PriorityFromContext(context.Background()))
+	assert.Equal(t, PriorityDetach, PriorityFromContext(WithPriority(context.Background(), PriorityDetach)))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, ok := parseRetryAfter("30", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+
+	_, ok = parseRetryAfter("", now)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
+
+func TestWaitConsumesBurst(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	l := NewLimiterWithClock(testConfig(), fakeClock)
+	ctx := context.Background()
+
+	assert.NoError(t, l.Wait(ctx, "sub", "disk_read", PriorityDefault))
+	assert.NoError(t, l.Wait(ctx, "sub", "disk_read", PriorityDefault))
+	// buckets are per subscription and class
+	assert.NoError(t, l.Wait(ctx, "sub", "disk_write", PriorityDefault))
+	assert.NoError(t, l.Wait(ctx, "other", "disk_read", PriorityDefault))
+
+	// the burst is used up, the next call waits 100ms for a new token
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx, "sub", "disk_read", PriorityDefault) }()
+	waitForWaiters(t, fakeClock)
+	fakeClock.Step(100 * time.Millisecond)
+	assert.NoError(t, <-done)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	go func() { done <- l.Wait(cancelled, "sub", "disk_read", PriorityDefault) }()
+	waitForWaiters(t, fakeClock)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestWaitPriority(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	l := NewLimiterWithClock(testConfig(), fakeClock)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx, "sub", "vm_write", PriorityDefault))
+
+	order := make(chan Priority, 2)
+	wait := func(p Priority) {
+		assert.NoError(t, l.Wait(ctx, "sub", "vm_write", p))
+		order <- p
+	}
+	go wait(PriorityAttach)
+	waitForQueue(t, l, "sub", "vm_write", 1)
+	go wait(PriorityDetach)
+	waitForQueue(t, l, "sub", "vm_write", 2)
+
+	for i := 0; i < 2; i++ {
+		fakeClock.Step(time.Second)
+		assert.Equal(t, []Priority{PriorityDetach, PriorityAttach}[i], <-order)
+		waitForQueue(t, l, "sub", "vm_write", 1-i)
+	}
+}
+
+func TestShed(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	l := NewLimiterWithClock(testConfig(), fakeClock)
+	ctx := context.Background()
+
+	l.Observe("sub", "disk_write", throttlingError("60"))
+	assert.True(t, l.IsThrottled("sub", "disk_write"))
+	assert.False(t, l.IsThrottled("sub", "disk_read"))
+
+	// create calls are shed since their wait would exceed 5s
+	err := l.Wait(ctx, "sub", "disk_write", PriorityCreate)
+	var throttled *ThrottledError
+	assert.True(t, errors.As(err, &throttled))
+	assert.Equal(t, "sub", throttled.SubscriptionID)
+	assert.GreaterOrEqual(t, throttled.RetryAfter, 60*time.Second)
+	assert.True(t, azureutils.IsThrottlingError(err))
+	// a shed call does not throttle the bucket again
+	l.Observe("sub", "disk_write", err)
+	assert.Equal(t, 0.5, l.bucket("sub", "disk_write").qps)
+
+	fakeClock.Step(61 * time.Second)
+	assert.False(t, l.IsThrottled("sub", "disk_write"))
+}
+
+func TestObserveAdaptsRate(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	l := NewLimiterWithClock(testConfig(), fakeClock)
+	b := l.bucket("sub", "disk_read")
+
+	l.Observe("sub", "disk_read", throttlingError(""))
+	assert.Equal(t, 5.0, b.qps)
+	assert.Equal(t, 10*time.Second, b.blocked())
+
+	// Retry-After in the error message is used when there is no header
+	l.Observe("sub", "disk_read", fmt.Errorf("Retriable: true, RetryAfter: 30s, HTTPStatusCode: 429, RawError: TooManyRequests"))
+	assert.Equal(t, 2.5, b.qps)
+	assert.Equal(t, 30*time.Second, b.blocked())
+
+	// a Retry-After longer than MaxRetryAfter is capped
+	fakeClock.Step(30 * time.Second)
+	l.Observe("sub", "disk_read", throttlingError("86400"))
+	assert.Equal(t, 2*time.Minute, b.blocked())
+	fakeClock.Step(2 * time.Minute)
+	l.Observe("sub", "disk_read", fmt.Errorf("Retriable: true, RetryAfter: 1000s, HTTPStatusCode: 429, RawError: TooManyRequests"))
+	assert.Equal(t, 2*time.Minute, b.blocked())
+	fakeClock.Step(2 * time.Minute)
+
+	for i := 0; i < 10; i++ {
+		l.Observe("sub", "disk_read", throttlingError("1"))
+	}
+	assert.Equal(t, 0.1, b.qps)
+
+	// other errors do not change the rate
+	l.Observe("sub", "disk_read", fmt.Errorf("not found"))
+	assert.Equal(t, 0.1, b.qps)
+
+	// successes raise the rate by a tenth of the configured rate at most once per second
+	l.Observe("sub", "disk_read", nil)
+	assert.Equal(t, 0.1, b.qps)
+	fakeClock.Step(time.Second)
+	l.Observe("sub", "disk_read", nil)
+	l.Observe("sub", "disk_read", nil)
+	assert.InDelta(t, 1.1, b.qps, 1e-9)
+	for i := 0; i < 20; i++ {
+		fakeClock.Step(time.Second)
+		l.Observe("sub", "disk_read", nil)
+	}
+	assert.Equal(t, 10.0, b.qps)
+}
+
+func TestInterceptor(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	l := NewLimiterWithClock(testConfig(), fakeClock)
+	intercept := l.Interceptor()
+	op := &interceptor.Operation{SubscriptionID: "sub", ResourceType: interceptor.ResourceTypeDisk, Method: "Get"}
+
+	result, err := intercept(context.Background(), op, func(_ context.Context) (interface{}, error) {
+		return "disk", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "disk", result)
+
+	_, err = intercept(context.Background(), op, func(_ context.Context) (interface{}, error) {
+		return nil, throttlingError("120")
+	})
+	assert.Error(t, err)
+	assert.True(t, l.IsThrottled("sub", "disk_read"))
+
+	// create calls are shed without reaching ARM while the bucket is blocked
+	ctx := WithPriority(context.Background(), PriorityCreate)
+	_, err = intercept(ctx, op, func(_ context.Context) (interface{}, error) {
+		t.Fatalf("unexpected call")
+		return nil, nil
+	})
+	assert.Error(t, err)
+
+	var nilLimiter *Limiter
+	assert.NoError(t, nilLimiter.Wait(context.Background(), "sub", "disk_read", PriorityCreate))
+	assert.False(t, nilLimiter.IsThrottled("sub", "disk_read"))
+	nilLimiter.Observe("sub", "disk_read", throttlingError(""))
+}
+
+func waitForWaiters(t *testing.T, fakeClock *clocktesting.FakeClock) {
+	t.Helper()
+	assert.Eventually(t, fakeClock.HasWaiters, 5*time.Second, time.Millisecond)
+}
+
+func waitForQueue(t *testing.T, l *Limiter, subscriptionID, class string, length int) {
+	t.Helper()
+	b := l.bucket(subscriptionID, class)
+	assert.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.waiters) == length
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestWindowsAndBlock(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	l := NewLimiterWithClock(testConfig(), fakeClock)
+	assert.Empty(t, l.Windows())
+
+	until := fakeClock.Now().Add(time.Minute)
+	assert.NoError(t, l.Block("sub/disk_write", until))
+	assert.True(t, l.IsThrottled("sub", "disk_write"))
+	assert.Equal(t, map[string]time.Time{"sub/disk_write": until}, l.Windows())
+
+	// an earlier block does not shorten the window
+	assert.NoError(t, l.Block("sub/disk_write", fakeClock.Now().Add(time.Second)))
+	assert.Equal(t, until, l.Windows()["sub/disk_write"])
+	assert.Error(t, l.Block("invalid", until))
+
+	fakeClock.Step(time.Minute)
+	assert.Empty(t, l.Windows())
+
+	var nilLimiter *Limiter
+	assert.Empty(t, nilLimiter.Windows())
+	assert.NoError(t, nilLimiter.Block("sub/disk_write", until))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	consts "sigs.k8s.io/azuredisk-csi-driver/pkg/azureconstants"
+)
+
+var (
+	registerMetricsOnce sync.Once
+
+	// currentQPS is the adapted rate of a bucket
+	currentQPS = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "arm_rate_limit_qps",
+			Help:           "Current rate of the ARM rate limiter per subscription and operation class",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"subscription", "class"},
+	)
+
+	// queueLength is the number of calls waiting for a token
+	queueLength = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "arm_rate_limit_queue_length",
+			Help:           "Number of ARM calls waiting in the rate limiter per subscription and operation class",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"subscription", "class"},
+	)
+
+	// waitDuration is the time a call waited for its token
+	waitDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "arm_rate_limit_wait_duration_seconds",
+			Help:           "Time ARM calls waited in the rate limiter",
+			Buckets:        []float64{0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"class", "priority"},
+	)
+
+	// throttledCount is the number of throttling responses received from ARM
+	throttledCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "arm_throttled_total",
+			Help:           "Number of throttling responses received from ARM",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"class"},
+	)
+
+	// shedCount is the number of calls rejected by the rate limiter
+	shedCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      consts.AzureDiskCSIDriverName,
+			Name:           "arm_rate_limit_shed_total",
+			Help:           "Number of ARM calls rejected by the rate limiter because their wait would exceed the maximum",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"class", "priority"},
+	)
+)
+
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(currentQPS)
+		legacyregistry.MustRegister(queueLength)
+		legacyregistry.MustRegister(waitDuration)
+		legacyregistry.MustRegister(throttledCount)
+		legacyregistry.MustRegister(shedCount)
+	})
+}
@@ -19,10 +19,16 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -46,81 +52,143 @@ var (
 	SkusFullfilePath                     = "skus-full.json"
 )
 
-func init() {
-	klog.InitFlags(nil)
-}
-
-// exit is a separate function to handle program termination
-var exit = func(code int) {
-	os.Exit(code)
-}
+var (
+	input                = flag.String("input", "", "path of the resource SKU list in the `az vm list-skus` JSON format, the SKUs are fetched with az if empty")
+	skusMapPath          = flag.String("skus-map", "pkg/optimization/azure_skus_map.go", "path of the generated disk and node SKU map")
+	maxDataDiskCountPath = flag.String("max-data-disk-count-map", "pkg/azuredisk/azure_dd_max_disk_count.go", "path of the generated max data disk count map")
+	check                = flag.Bool("check", false, "report the additions and removals against the existing maps instead of writing them")
+)
 
-func main() {
+const boilerPlate = `/*
+Copyright %s The Kubernetes Authors.
 
-	boilerPlate := `/*
-Copyright 2021 The Kubernetes Authors.
-	
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
 You may obtain a copy of the License at
 
     http://www.apache.org/licenses/LICENSE-2.0
-	
+
 Unless required by applicable law or agreed to in writing, software
 distributed under the License is distributed on an "AS IS" BASIS,
 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 See the License for the specific language governing permissions and
 limitations under the License.
 */
-	
-package optimization
-	
-import (
-)`
-	var sb strings.Builder
-	diskMapStart := "	DiskSkuMap = map[string]map[string]DiskSkuInfo{"
-	diskMapEnd := "	}"
-	accStart := `	"%s": map[string]DiskSkuInfo {`
-	accEnd := "		},"
-	diskSku := `		"%s": DiskSkuInfo{StorageAccountType: "%s", StorageTier: "%s", DiskSize: "%s", MaxAllowedShares: %s, MaxBurstIops: %s, MaxIops: %s, MaxBwMbps: %s, MaxBurstBwMbps: %s, MaxSizeGiB: %s},`
 
-	nodeMapStart := "	NodeInfoMap = map[string]NodeInfo{"
-	nodeInfo := `	"%s": NodeInfo{SkuName: "%s", MaxDataDiskCount: %s, VCpus: %s, MaxBurstIops: %s, MaxIops: %s, MaxBwMbps: %s, MaxBurstBwMbps: %s},`
-	nodeMapEnd := "	}"
+package %s
+`
 
-	defer os.Remove(SkusFullfilePath)
-	skusFilePath := "pkg/azuredisk/azure_skus_map.go"
+func init() {
+	klog.InitFlags(nil)
+}
 
-	skuMap := map[string]bool{}
+// exit is a separate function to handle program termination
+var exit = func(code int) {
+	os.Exit(code)
+}
 
-	var resources []*armcompute.ResourceSKU
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		klog.Errorf("%v", err)
+		exit(1)
+	}
+}
 
-	if err := getAllSkus(); err != nil {
-		klog.Errorf("Could not get skus. Error: %v", err)
+func run() error {
+	skusPath := *input
+	if skusPath == "" {
+		defer os.Remove(SkusFullfilePath)
+		if err := getAllSkus(); err != nil {
+			return fmt.Errorf("could not get skus: %w", err)
+		}
+		skusPath = SkusFullfilePath
+	}
+	resources, err := loadSkus(skusPath)
+	if err != nil {
+		return err
+	}
+	diskSkuInfoMap, vmSkuInfoMap, maxDataDiskCounts, err := buildTables(resources)
+	if err != nil {
+		return err
 	}
 
-	diskSkusFullJSON, err := os.Open(SkusFullfilePath)
+	skusMap, err := generateSkusMap(diskSkuInfoMap, vmSkuInfoMap)
+	if err != nil {
+		return err
+	}
+	maxDataDiskCountMap, err := generateMaxDataDiskCountMap(maxDataDiskCounts)
 	if err != nil {
-		klog.Errorf("Could not read file. Error: %v, FilePath: %s", err, SkusFullfilePath)
-		return
+		return err
+	}
+	files := []struct {
+		path    string
+		content []byte
+	}{
+		{*skusMapPath, skusMap},
+		{*maxDataDiskCountPath, maxDataDiskCountMap},
+	}
+
+	if *check {
+		outdated := 0
+		for _, file := range files {
+			changes, err := diffTables(file.path, file.content)
+			if err != nil {
+				return err
+			}
+			if len(changes) == 0 {
+				klog.Infof("%s is up to date", file.path)
+				continue
+			}
+			outdated++
+			fmt.Printf("%s:\n%s\n", file.path, strings.Join(changes, "\n"))
+		}
+		if outdated > 0 {
+			return fmt.Errorf("%d generated files are out of date, run without --check to update them", outdated)
+		}
+		return nil
 	}
-	defer diskSkusFullJSON.Close()
 
-	byteValue, _ := io.ReadAll(diskSkusFullJSON)
+	for _, file := range files {
+		if err := os.WriteFile(file.path, file.content, 0644); err != nil {
+			return fmt.Errorf("could not write file %s: %w", file.path, err)
+		}
+		klog.Info("Wrote to file ", file.path)
+	}
+	return nil
+}
 
-	err = json.Unmarshal([]byte(byteValue), &resources)
+// loadSkus reads a resource SKU list in the `az vm list-skus` JSON format
+func loadSkus(path string) ([]*armcompute.ResourceSKU, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		klog.Errorf("Could not parse json file file. Error: %v, FilePath: %s", err, SkusFullfilePath)
-		return
+		return nil, fmt.Errorf("could not read file %s: %w", path, err)
+	}
+	var resources []*armcompute.ResourceSKU
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return nil, fmt.Errorf("could not parse json file %s: %w", path, err)
 	}
+	return resources, nil
+}
 
+// buildTables returns the disk SKUs by lower case account type and size, the VM SKUs by lower case name
+// and the max data disk count by upper case VM size, the first SKU of the same name wins
+func buildTables(resources []*armcompute.ResourceSKU) (map[string]map[string]optimization.DiskSkuInfo, map[string]optimization.NodeInfo, map[string]int64, error) {
+	skuMap := map[string]bool{}
 	diskSkuInfoMap := map[string]map[string]optimization.DiskSkuInfo{}
 	vmSkuInfoMap := map[string]optimization.NodeInfo{}
+	maxDataDiskCounts := map[string]int64{}
 
 	for _, sku := range resources {
+		if sku == nil || sku.ResourceType == nil || sku.Name == nil {
+			continue
+		}
 		resType := strings.ToLower(*sku.ResourceType)
 		skuKey := ""
 		if resType == "disks" {
+			if sku.Tier == nil || sku.Size == nil {
+				continue
+			}
 			skuKey = fmt.Sprintf("%s-%s-%s", *sku.Name, *sku.Tier, *sku.Size)
 		} else if resType == "virtualmachines" {
 			skuKey = *sku.Name
@@ -139,72 +207,219 @@ import (
 			if _, ok := diskSkuInfoMap[account]; !ok {
 				diskSkuInfoMap[account] = map[string]optimization.DiskSkuInfo{}
 			}
-			diskSkuInfoMap[account][diskSize], err = getDiskCapabilities(sku)
+			diskSku, err := getDiskCapabilities(sku)
 			if err != nil {
-				klog.Errorf("populateSkuMap: Failed to get disk capabilities for disk %s %s %s. Error: %v", *sku.Name, *sku.Size, *sku.Tier, err)
-				exit(1)
+				return nil, nil, nil, fmt.Errorf("failed to get disk capabilities for disk %s %s %s: %w", *sku.Name, *sku.Size, *sku.Tier, err)
 			}
-		} else if resType == "virtualmachines" {
+			diskSkuInfoMap[account][diskSize] = diskSku
+		} else {
 			nodeInfo := optimization.NodeInfo{}
 			nodeInfo.SkuName = *sku.Name
-			err = populateNodeCapabilities(sku, &nodeInfo)
-			if err != nil {
-				klog.Errorf("populateSkuMap: Failed to populate node capabilities. Error: %v", err)
-				exit(1)
+			if err := populateNodeCapabilities(sku, &nodeInfo); err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to populate node capabilities of %s: %w", *sku.Name, err)
 			}
 			vmSkuInfoMap[strings.ToLower(*sku.Name)] = nodeInfo
+			if hasCapability(sku, MaxDataDiskCountCapability) {
+				maxDataDiskCounts[strings.ToUpper(*sku.Name)] = int64(nodeInfo.MaxDataDiskCount)
+			}
+		}
+	}
+	return diskSkuInfoMap, vmSkuInfoMap, maxDataDiskCounts, nil
+}
+
+// hasCapability returns whether the SKU reports the capability
+func hasCapability(sku *armcompute.ResourceSKU, name string) bool {
+	for _, capability := range sku.Capabilities {
+		if capability != nil && capability.Name != nil && strings.EqualFold(*capability.Name, name) {
+			return true
 		}
 	}
+	return false
+}
 
-	// Write the boiler plate stuff
-	appendWithErrCheck(&sb, boilerPlate)
-	appendWithErrCheck(&sb, "\n")
-	appendWithErrCheck(&sb, "\n")
-	appendWithErrCheck(&sb, "var (")
-	appendWithErrCheck(&sb, "\n")
+// generateSkusMap returns the formatted source of DiskSkuMap and NodeInfoMap
+func generateSkusMap(diskSkuInfoMap map[string]map[string]optimization.DiskSkuInfo, vmSkuInfoMap map[string]optimization.NodeInfo) ([]byte, error) {
+	diskSku := `"%s": {StorageAccountType: "%s", StorageTier: "%s", DiskSize: "%s", MaxAllowedShares: %s, MaxBurstIops: %s, MaxIops: %s, MaxBwMbps: %s, MaxBurstBwMbps: %s, MaxSizeGiB: %s},`
+	nodeInfo := `"%s": {SkuName: "%s", MaxDataDiskCount: %s, VCpus: %s, MaxBurstIops: %s, MaxIops: %s, MaxBwMbps: %s, MaxBurstBwMbps: %s},`
 
-	// Write the disk map
-	appendWithErrCheck(&sb, diskMapStart)
-	for account, sizes := range diskSkuInfoMap {
-		appendWithErrCheck(&sb, "\n")
-		appendWithErrCheck(&sb, fmt.Sprintf(accStart, account))
+	var sb strings.Builder
+	appendWithErrCheck(&sb, fmt.Sprintf(boilerPlate, "2021", "optimization"))
+	appendWithErrCheck(&sb, "\nvar (\n")
 
-		for size, sku := range sizes {
-			//diskSku := `"%s": DiskSkuInfo{storageAccountType: "%s", storageTier: "%s", diskSize: "%s",
-			//maxAllowedShares: %s, maxBurstIops: %s, maxIops: %s, maxBwMbps: %s, maxBurstBwMbps: %s, maxSizeGiB: %s},`
-			appendWithErrCheck(&sb, "\n")
+	// Write the disk map
+	appendWithErrCheck(&sb, "DiskSkuMap = map[string]map[string]DiskSkuInfo{\n")
+	for _, account := range sortedKeys(diskSkuInfoMap) {
+		appendWithErrCheck(&sb, fmt.Sprintf("%q: {\n", account))
+		sizes := diskSkuInfoMap[account]
+		for _, size := range sortedKeys(sizes) {
+			sku := sizes[size]
 			appendWithErrCheck(&sb, fmt.Sprintf(diskSku, size, sku.StorageAccountType, sku.StorageTier, sku.DiskSize, strconv.Itoa(sku.MaxAllowedShares),
 				strconv.Itoa(sku.MaxBurstIops), strconv.Itoa(sku.MaxIops), strconv.Itoa(sku.MaxBwMbps), strconv.Itoa(sku.MaxBurstBwMbps), strconv.Itoa(sku.MaxSizeGiB)))
+			appendWithErrCheck(&sb, "\n")
 		}
-		appendWithErrCheck(&sb, "\n")
-		appendWithErrCheck(&sb, accEnd)
+		appendWithErrCheck(&sb, "},\n")
 	}
-
-	appendWithErrCheck(&sb, "\n")
-	appendWithErrCheck(&sb, diskMapEnd)
-	appendWithErrCheck(&sb, "\n")
-	appendWithErrCheck(&sb, "\n")
+	appendWithErrCheck(&sb, "}\n\n")
 
 	// Write the VM Sku map
-	appendWithErrCheck(&sb, nodeMapStart)
-
-	//nodeInfo := `	"%s": NodeInfo{skuName: "%s", maxDataDiskCount: %s, vcpus: %s, maxBurstIops: %s, maxIops: %s, maxBwMbps: %s, maxBurstBwMbps: %s},`
-	for vm, sku := range vmSkuInfoMap {
-		appendWithErrCheck(&sb, "\n")
+	appendWithErrCheck(&sb, "NodeInfoMap = map[string]NodeInfo{\n")
+	for _, vm := range sortedKeys(vmSkuInfoMap) {
+		sku := vmSkuInfoMap[vm]
 		appendWithErrCheck(&sb, fmt.Sprintf(nodeInfo, vm, sku.SkuName, strconv.Itoa(sku.MaxDataDiskCount), strconv.Itoa(sku.VCpus),
 			strconv.Itoa(sku.MaxBurstIops), strconv.Itoa(sku.MaxIops), formatInt(sku.MaxBwMbps), formatInt(sku.MaxBurstBwMbps)))
+		appendWithErrCheck(&sb, "\n")
+	}
+	appendWithErrCheck(&sb, "}\n)\n")
+
+	return formatSource(sb.String())
+}
+
+// generateMaxDataDiskCountMap returns the formatted source of maxDataDiskCountMap
+func generateMaxDataDiskCountMap(maxDataDiskCounts map[string]int64) ([]byte, error) {
+	var sb strings.Builder
+	appendWithErrCheck(&sb, fmt.Sprintf(boilerPlate, "2020", "azuredisk"))
+	appendWithErrCheck(&sb, "\n// about how to get all VM size list,\n")
+	appendWithErrCheck(&sb, "// refer to https://github.com/kubernetes/kubernetes/issues/77461#issuecomment-492488756\n")
+	appendWithErrCheck(&sb, "var maxDataDiskCountMap = map[string]int64{\n")
+	for _, vmsize := range sortedKeys(maxDataDiskCounts) {
+		appendWithErrCheck(&sb, fmt.Sprintf("%q: %d,\n", vmsize, maxDataDiskCounts[vmsize]))
+	}
+	appendWithErrCheck(&sb, "}\n")
+
+	return formatSource(sb.String())
+}
+
+func formatSource(src string) ([]byte, error) {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated source: %w", err)
+	}
+	return formatted, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffTables returns the added, removed and changed map entries of the generated source against the existing file,
+// a missing file has no entries
+func diffTables(path string, generated []byte) ([]string, error) {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read file %s: %w", path, err)
+	}
+	oldEntries, err := tableEntries(path, existing)
+	if err != nil {
+		return nil, err
+	}
+	newEntries, err := tableEntries(path, generated)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, key := range sortedKeys(oldEntries) {
+		if _, ok := newEntries[key]; !ok {
+			changes = append(changes, fmt.Sprintf("- %s: %s", key, oldEntries[key]))
+		}
 	}
-	appendWithErrCheck(&sb, "\n")
-	appendWithErrCheck(&sb, nodeMapEnd)
-	appendWithErrCheck(&sb, "\n")
-	appendWithErrCheck(&sb, ")")
-	appendWithErrCheck(&sb, "\n")
+	for _, key := range sortedKeys(newEntries) {
+		oldValue, ok := oldEntries[key]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ %s: %s", key, newEntries[key]))
+		} else if oldValue != newEntries[key] {
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", key, oldValue, newEntries[key]))
+		}
+	}
+	return changes, nil
+}
 
-	err = os.WriteFile(skusFilePath, []byte(sb.String()), 0644)
+// tableEntries returns the entries of the map literals assigned to the variables of a Go source file,
+// keyed by the variable name and the string keys of the nested maps, e.g. DiskSkuMap["premium_lrs"]["p1"]
+func tableEntries(path string, src []byte) (map[string]string, error) {
+	entries := map[string]string{}
+	if len(src) == 0 {
+		return entries, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, 0)
 	if err != nil {
-		klog.Errorf("Could write file. Error: %v, FilePath: %s", err, skusFilePath)
+		return nil, fmt.Errorf("could not parse file %s: %w", path, err)
+	}
+
+	var collect func(prefix string, lit *ast.CompositeLit) error
+	collect = func(prefix string, lit *ast.CompositeLit) error {
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			keyLit, ok := kv.Key.(*ast.BasicLit)
+			if !ok || keyLit.Kind != token.STRING {
+				continue
+			}
+			key := fmt.Sprintf("%s[%s]", prefix, keyLit.Value)
+			if value, ok := kv.Value.(*ast.CompositeLit); ok && isMapLiteral(value) {
+				if err := collect(key, value); err != nil {
+					return err
+				}
+				continue
+			}
+			if value, ok := kv.Value.(*ast.CompositeLit); ok {
+				// compare the elided and the explicit element type alike
+				value.Type = nil
+			}
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, fset, kv.Value); err != nil {
+				return err
+			}
+			entries[key] = buf.String()
+		}
+		return nil
+	}
+
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, value := range valueSpec.Values {
+				lit, ok := value.(*ast.CompositeLit)
+				if !ok || i >= len(valueSpec.Names) {
+					continue
+				}
+				if err := collect(valueSpec.Names[i].Name, lit); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+// isMapLiteral returns whether all elements of the composite literal have string keys
+func isMapLiteral(lit *ast.CompositeLit) bool {
+	if len(lit.Elts) == 0 {
+		_, ok := lit.Type.(*ast.MapType)
+		return ok
+	}
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return false
+		}
+		if keyLit, ok := kv.Key.(*ast.BasicLit); !ok || keyLit.Kind != token.STRING {
+			return false
+		}
 	}
-	klog.Info("Wrote to file ", skusFilePath)
+	return true
 }
 
 func formatInt(value int) string {
@@ -18,13 +18,17 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMain(t *testing.T) {
 	// Set environment variable for test scenario
 	os.Setenv("TEST_SCENARIO", "true")
 	defer os.Unsetenv("TEST_SCENARIO")
+	setOutputPaths(t)
 
 	// Capture stdout
 	old := os.Stdout
@@ -51,3 +55,81 @@ func TestMain(t *testing.T) {
 		t.Errorf("Expected exit code 0, but got %d", exitCode)
 	}
 }
+
+func setOutputPaths(t *testing.T) {
+	dir := t.TempDir()
+	oldSkusMapPath, oldMaxDataDiskCountPath := *skusMapPath, *maxDataDiskCountPath
+	*skusMapPath = filepath.Join(dir, "azure_skus_map.go")
+	*maxDataDiskCountPath = filepath.Join(dir, "azure_dd_max_disk_count.go")
+	t.Cleanup(func() {
+		*skusMapPath, *maxDataDiskCountPath = oldSkusMapPath, oldMaxDataDiskCountPath
+		*input, *check = "", false
+	})
+}
+
+func TestRun(t *testing.T) {
+	setOutputPaths(t)
+	*input = "skus-sample.json"
+	assert.NoError(t, run())
+
+	skusMap, err := os.ReadFile(*skusMapPath)
+	assert.NoError(t, err)
+	entries, err := tableEntries(*skusMapPath, skusMap)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		`DiskSkuMap["premiumv2_lrs"]["p"]`: `{StorageAccountType: "PremiumV2_LRS", StorageTier: "Premium", DiskSize: "P", MaxAllowedShares: 15, MaxBurstIops: 0, MaxIops: 0, MaxBwMbps: 0, MaxBurstBwMbps: 0, MaxSizeGiB: 65536}`,
+		`NodeInfoMap["standard_a1_v2"]`:    `{SkuName: "Standard_A1_v2", MaxDataDiskCount: 2, VCpus: 1, MaxBurstIops: 1600, MaxIops: 1600, MaxBwMbps: 22, MaxBurstBwMbps: 22}`,
+	}, entries)
+	maxDataDiskCountMap, err := os.ReadFile(*maxDataDiskCountPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(maxDataDiskCountMap), "var maxDataDiskCountMap = map[string]int64{\n\t\"STANDARD_A1_V2\": 2,\n}\n")
+
+	// the generated files are up to date
+	*check = true
+	assert.NoError(t, run())
+
+	// additions, removals and changes are reported
+	assert.NoError(t, os.WriteFile(*maxDataDiskCountPath, []byte(`package azuredisk
+
+var maxDataDiskCountMap = map[string]int64{
+	"STANDARD_A1_V2":  4,
+	"STANDARD_OLD_V1": 8,
+}
+`), 0644))
+	changes, err := diffTables(*maxDataDiskCountPath, maxDataDiskCountMap)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`- maxDataDiskCountMap["STANDARD_OLD_V1"]: 8`,
+		`~ maxDataDiskCountMap["STANDARD_A1_V2"]: 4 -> 2`,
+	}, changes)
+	assert.ErrorContains(t, run(), "1 generated files are out of date")
+
+	// a missing file has no entries
+	assert.NoError(t, os.Remove(*skusMapPath))
+	changes, err = diffTables(*skusMapPath, skusMap)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	*input = "missing.json"
+	assert.ErrorContains(t, run(), "could not read file missing.json")
+}
+
+func TestTableEntries(t *testing.T) {
+	entries, err := tableEntries("skus.go", []byte(`package optimization
+
+var (
+	DiskSkuMap = map[string]map[string]DiskSkuInfo{
+		"premium_lrs": map[string]DiskSkuInfo{
+			"p1": DiskSkuInfo{MaxIops: 120},
+		},
+		"empty": map[string]DiskSkuInfo{},
+	}
+	count = 1
+)
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{`DiskSkuMap["premium_lrs"]["p1"]`: "{MaxIops: 120}"}, entries)
+
+	_, err = tableEntries("invalid.go", []byte("package"))
+	assert.ErrorContains(t, err, "could not parse file invalid.go")
+}
@@ -158,6 +158,13 @@ func (vl *VolumeLocks) Release(volumeID string) {
 	vl.locks.Delete(volumeID)
 }
 
+// List returns the sorted volume IDs whose locks are currently held
+func (vl *VolumeLocks) List() []string {
+	vl.mux.Lock()
+	defer vl.mux.Unlock()
+	return vl.locks.List()
+}
+
 func GetElementsInArray1NotInArray2(arr1 []int, arr2 []int) []int {
 	sort.Ints(arr1)
 	sort.Ints(arr2)
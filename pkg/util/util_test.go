@@ -306,6 +306,18 @@ func TestVolumeLock(t *testing.T) {
 	}
 }
 
+func TestVolumeLockList(t *testing.T) {
+	volumeLocks := NewVolumeLocks()
+	assert.Empty(t, volumeLocks.List())
+
+	assert.True(t, volumeLocks.TryAcquire("vol-b"))
+	assert.True(t, volumeLocks.TryAcquire("vol-a"))
+	assert.Equal(t, []string{"vol-a", "vol-b"}, volumeLocks.List())
+
+	volumeLocks.Release("vol-a")
+	assert.Equal(t, []string{"vol-b"}, volumeLocks.List())
+}
+
 func TestGetElementsInArray1NotInArray2(t *testing.T) {
 	testCases := []struct {
 		desc           string
@@ -27,8 +27,12 @@ trap cleanup EXIT
 
 readonly endpoint='unix:///tmp/csi.sock'
 nodeid='CSINode'
-if [[ "$#" -gt 0 ]] && [[ -n "$1" ]]; then
-  nodeid="$1"
+if [[ "$#" -gt 0 ]]; then
+  if [[ -n "$1" ]]; then
+    nodeid="$1"
+  fi
+  # the remaining arguments are passed to azurediskplugin
+  shift
 fi
 
 ARCH=$(uname -p)
@@ -36,7 +40,7 @@ if [[ "${ARCH}" == "x86_64" || ${ARCH} == "unknown" ]]; then
   ARCH="amd64"
 fi
 
-_output/${ARCH}/azurediskplugin --endpoint "$endpoint" --nodeid "$nodeid" -v=5 -support-zone=false -enable-disk-capacity-check=true &
+_output/${ARCH}/azurediskplugin --endpoint "$endpoint" --nodeid "$nodeid" -v=5 -support-zone=false -enable-disk-capacity-check=true "$@" &
 
 # sleep a while waiting for azurediskplugin start up
 sleep 1
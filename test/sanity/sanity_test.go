@@ -18,14 +18,19 @@ package sanity
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"sigs.k8s.io/azuredisk-csi-driver/test/utils/azure"
 	"sigs.k8s.io/azuredisk-csi-driver/test/utils/credentials"
+	"sigs.k8s.io/azuredisk-csi-driver/test/utils/fakearm"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -33,9 +38,19 @@ import (
 const (
 	nodeid = "sanity-test-node"
 	vmType = "standard"
+
+	// fakeARMEnv set to true runs the sanity tests against the fake ARM server instead of Azure
+	fakeARMEnv = "SANITY_FAKE_ARM"
+	// subscription, resource group and location of the fake ARM server
+	fakeSubscriptionID = "00000000-0000-0000-0000-000000000000"
+	fakeResourceGroup  = "sanity-test"
+	fakeLocation       = "eastus2"
 )
 
 func TestSanity(t *testing.T) {
+	if os.Getenv(fakeARMEnv) == "true" {
+		t.Skipf("%s is set, the sanity tests run against the fake ARM server", fakeARMEnv)
+	}
 	// Set necessary env vars for creating azure credential file
 	t.Setenv("AZURE_VM_TYPE", vmType)
 
@@ -72,8 +87,43 @@ func TestSanity(t *testing.T) {
 	_, err = azureClient.EnsureVirtualMachine(ctx, creds.ResourceGroup, creds.Location, nodeid)
 	assert.NoError(t, err)
 
+	runSanity(t)
+}
+
+// TestSanityFakeARM runs the sanity tests against the in-memory fake ARM server when SANITY_FAKE_ARM
+// is true, so that they need neither an Azure subscription nor network access
+func TestSanityFakeARM(t *testing.T) {
+	if os.Getenv(fakeARMEnv) != "true" {
+		t.Skipf("set %s=true to run the sanity tests against the fake ARM server", fakeARMEnv)
+	}
+	arm := fakearm.NewServer(fakeLocation)
+	arm.AddVirtualMachine(fakeSubscriptionID, fakeResourceGroup, nodeid, "")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := httptest.NewUnstartedServer(arm)
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	cloudConfig := filepath.Join(t.TempDir(), "azure.json")
+	err = os.WriteFile(cloudConfig, []byte(fakearm.CloudConfig(fakeSubscriptionID, fakeResourceGroup, fakeLocation, vmType)), 0600)
+	assert.NoError(t, err)
+
+	// Set necessary env vars for sanity test
+	t.Setenv("AZURE_CREDENTIAL_FILE", cloudConfig)
+	for k, v := range fakearm.IdentityEnv(server.URL) {
+		t.Setenv(k, v)
+	}
+	t.Setenv("nodeid", nodeid)
+
+	// point the driver at the fake ARM server
+	runSanity(t, "--enable-traffic-manager=true", fmt.Sprintf("--traffic-manager-port=%d", listener.Addr().(*net.TCPAddr).Port))
+}
+
+// runSanity runs csi-sanity against the driver started with args
+func runSanity(t *testing.T, args ...string) {
 	// Execute the script from project root
-	err = os.Chdir("../..")
+	err := os.Chdir("../..")
 	assert.NoError(t, err)
 	// Change directory back to test/sanity
 	defer func() {
@@ -85,7 +135,6 @@ func TestSanity(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, strings.HasSuffix(projectRoot, "azuredisk-csi-driver"))
 
-	args := make([]string, 0)
 	cmd := exec.Command("./test/sanity/run-tests-all-clouds.sh", args...)
 	cmd.Dir = projectRoot
 	cmd.Stdout = os.Stdout
@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/azuredisk-csi-driver/test/utils/fakearm"
+)
+
+var (
+	port           = flag.Int("port", 7788, "port of the server, pass it to the driver with --traffic-manager-port")
+	location       = flag.String("location", "eastus", "location of the resources")
+	subscriptionID = flag.String("subscription-id", "00000000-0000-0000-0000-000000000000", "subscription of the VMs")
+	resourceGroup  = flag.String("resource-group", "fakearm", "resource group of the VMs")
+	vmType         = flag.String("vm-type", "standard", "vmType of the printed cloud config")
+	vms            = flag.String("vms", "", "comma separated names of the VMs to add")
+	vmssVMs        = flag.String("vmss-vms", "", "comma separated <scaleSet>/<instanceID>/<computerName> of the VMSS VMs to add")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	server := fakearm.NewServer(*location)
+	for _, name := range strings.Split(*vms, ",") {
+		if name != "" {
+			server.AddVirtualMachine(*subscriptionID, *resourceGroup, name, "")
+		}
+	}
+	for _, vm := range strings.Split(*vmssVMs, ",") {
+		if vm == "" {
+			continue
+		}
+		parts := strings.Split(vm, "/")
+		if len(parts) != 3 {
+			klog.Fatalf("invalid VMSS VM %q, expected <scaleSet>/<instanceID>/<computerName>", vm)
+		}
+		server.AddVirtualMachineScaleSetVM(*subscriptionID, *resourceGroup, parts[0], parts[1], parts[2], "")
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	if err != nil {
+		klog.Fatalf("failed to listen on port %d: %v", *port, err)
+	}
+	url := fmt.Sprintf("http://%s", listener.Addr().String())
+	fmt.Fprintf(os.Stderr, "cloud config:\n%s\n", fakearm.CloudConfig(*subscriptionID, *resourceGroup, *location, *vmType))
+	for k, v := range fakearm.IdentityEnv(url) {
+		fmt.Fprintf(os.Stderr, "export %s=%s\n", k, v)
+	}
+	klog.Infof("serving fake ARM on %s", url)
+	if err := http.Serve(listener, server); err != nil {
+		klog.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,590 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakearm
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"k8s.io/utils/ptr"
+)
+
+const provisioningStateSucceeded = "Succeeded"
+
+// list is the body of list responses
+type list[T any] struct {
+	Value []T `json:"value"`
+}
+
+// sortedValues returns the values of resources under prefix, sorted by ID
+func sortedValues[T any](resources map[string]*T, prefix string) list[*T] {
+	keys := make([]string, 0, len(resources))
+	for key := range resources {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := list[*T]{Value: []*T{}}
+	for _, key := range keys {
+		result.Value = append(result.Value, resources[key])
+	}
+	return result
+}
+
+func (s *Server) serveDisk(req *request) (interface{}, *armError) {
+	if len(req.segments) == 1 {
+		if req.method != http.MethodGet {
+			return nil, methodNotAllowed(req)
+		}
+		return sortedValues(s.disks, strings.ToLower(req.resourceID(1))+"/"), nil
+	}
+	id := req.resourceID(2)
+	key := strings.ToLower(id)
+	disk := s.disks[key]
+	switch req.method {
+	case http.MethodGet:
+		if disk == nil {
+			return nil, notFound("Microsoft.Compute/disks", req.segments[1])
+		}
+		return disk, nil
+	case http.MethodPut:
+		var model armcompute.Disk
+		if err := req.unmarshal(&model); err != nil {
+			return nil, err
+		}
+		return s.putDisk(id, req.segments[1], disk, &model)
+	case http.MethodPatch:
+		if disk == nil {
+			return nil, notFound("Microsoft.Compute/disks", req.segments[1])
+		}
+		var update armcompute.DiskUpdate
+		if err := req.unmarshal(&update); err != nil {
+			return nil, err
+		}
+		return patchDisk(disk, &update)
+	case http.MethodDelete:
+		if disk == nil {
+			return nil, nil
+		}
+		if ptr.Deref(disk.ManagedBy, "") != "" {
+			return nil, newError(http.StatusConflict, "OperationNotAllowed", "Disk %s is attached to VM %s.", req.segments[1], *disk.ManagedBy)
+		}
+		delete(s.disks, key)
+		return nil, nil
+	}
+	return nil, methodNotAllowed(req)
+}
+
+// sourceSizeGB returns the size of the disk or snapshot a disk or snapshot is created from
+func (s *Server) sourceSizeGB(creationData *armcompute.CreationData) (*int32, *armError) {
+	if creationData == nil || ptr.Deref(creationData.SourceResourceID, "") == "" {
+		return nil, nil
+	}
+	sourceID := *creationData.SourceResourceID
+	if disk := s.disks[strings.ToLower(sourceID)]; disk != nil {
+		return disk.Properties.DiskSizeGB, nil
+	}
+	if snapshot := s.snapshots[strings.ToLower(sourceID)]; snapshot != nil {
+		return snapshot.Properties.DiskSizeGB, nil
+	}
+	return nil, notFound("Microsoft.Compute/disks", sourceID)
+}
+
+func (s *Server) putDisk(id, name string, existing, model *armcompute.Disk) (interface{}, *armError) {
+	if model.Properties == nil {
+		return nil, newError(http.StatusBadRequest, "InvalidParameter", "properties of disk %s are missing", name)
+	}
+	if existing != nil {
+		// an update keeps the state of the disk
+		model.ManagedBy = existing.ManagedBy
+		model.ManagedByExtended = existing.ManagedByExtended
+		model.Properties.TimeCreated = existing.Properties.TimeCreated
+		model.Properties.DiskState = existing.Properties.DiskState
+		model.Properties.UniqueID = existing.Properties.UniqueID
+	} else {
+		sourceSize, err := s.sourceSizeGB(model.Properties.CreationData)
+		if err != nil {
+			return nil, err
+		}
+		if model.Properties.DiskSizeGB == nil {
+			model.Properties.DiskSizeGB = sourceSize
+		}
+		if model.Properties.DiskSizeGB == nil {
+			return nil, newError(http.StatusBadRequest, "InvalidParameter", "diskSizeGB of disk %s is missing", name)
+		}
+		if sourceSize != nil && *model.Properties.DiskSizeGB < *sourceSize {
+			return nil, newError(http.StatusBadRequest, "InvalidParameter", "diskSizeGB %d of disk %s is smaller than its source %d", *model.Properties.DiskSizeGB, name, *sourceSize)
+		}
+		model.Properties.TimeCreated = ptr.To(time.Now().UTC())
+		model.Properties.DiskState = ptr.To(armcompute.DiskStateUnattached)
+		model.Properties.UniqueID = ptr.To(strconv.FormatInt(time.Now().UnixNano(), 16))
+	}
+	model.ID = ptr.To(id)
+	model.Name = ptr.To(name)
+	model.Type = ptr.To("Microsoft.Compute/disks")
+	if model.Location == nil {
+		model.Location = ptr.To(s.location)
+	}
+	if model.SKU == nil {
+		model.SKU = &armcompute.DiskSKU{Name: ptr.To(armcompute.DiskStorageAccountTypesStandardLRS)}
+	}
+	if model.Properties.NetworkAccessPolicy == nil {
+		model.Properties.NetworkAccessPolicy = ptr.To(armcompute.NetworkAccessPolicyAllowAll)
+	}
+	model.Properties.ProvisioningState = ptr.To(provisioningStateSucceeded)
+	model.Properties.DiskSizeBytes = ptr.To(int64(*model.Properties.DiskSizeGB) << 30)
+	s.disks[strings.ToLower(id)] = model
+	return model, nil
+}
+
+func patchDisk(disk *armcompute.Disk, update *armcompute.DiskUpdate) (interface{}, *armError) {
+	if update.SKU != nil {
+		disk.SKU = &armcompute.DiskSKU{Name: update.SKU.Name}
+	}
+	for k, v := range update.Tags {
+		if disk.Tags == nil {
+			disk.Tags = map[string]*string{}
+		}
+		disk.Tags[k] = v
+	}
+	if p := update.Properties; p != nil {
+		if p.DiskSizeGB != nil {
+			if *p.DiskSizeGB < *disk.Properties.DiskSizeGB {
+				return nil, newError(http.StatusBadRequest, "InvalidParameter", "disk %s can not be shrunk from %d to %d GB", *disk.Name, *disk.Properties.DiskSizeGB, *p.DiskSizeGB)
+			}
+			disk.Properties.DiskSizeGB = p.DiskSizeGB
+			disk.Properties.DiskSizeBytes = ptr.To(int64(*p.DiskSizeGB) << 30)
+		}
+		if p.DiskIOPSReadWrite != nil {
+			disk.Properties.DiskIOPSReadWrite = p.DiskIOPSReadWrite
+		}
+		if p.DiskMBpsReadWrite != nil {
+			disk.Properties.DiskMBpsReadWrite = p.DiskMBpsReadWrite
+		}
+		if p.BurstingEnabled != nil {
+			disk.Properties.BurstingEnabled = p.BurstingEnabled
+		}
+		if p.NetworkAccessPolicy != nil {
+			disk.Properties.NetworkAccessPolicy = p.NetworkAccessPolicy
+		}
+		if p.PublicNetworkAccess != nil {
+			disk.Properties.PublicNetworkAccess = p.PublicNetworkAccess
+		}
+		if p.MaxShares != nil {
+			disk.Properties.MaxShares = p.MaxShares
+		}
+	}
+	return disk, nil
+}
+
+func (s *Server) serveSnapshot(req *request) (interface{}, *armError) {
+	if len(req.segments) == 1 {
+		if req.method != http.MethodGet {
+			return nil, methodNotAllowed(req)
+		}
+		return sortedValues(s.snapshots, strings.ToLower(req.resourceID(1))+"/"), nil
+	}
+	id := req.resourceID(2)
+	key := strings.ToLower(id)
+	snapshot := s.snapshots[key]
+	switch req.method {
+	case http.MethodGet:
+		if snapshot == nil {
+			return nil, notFound("Microsoft.Compute/snapshots", req.segments[1])
+		}
+		return snapshot, nil
+	case http.MethodPut:
+		var model armcompute.Snapshot
+		if err := req.unmarshal(&model); err != nil {
+			return nil, err
+		}
+		if model.Properties == nil || model.Properties.CreationData == nil {
+			return nil, newError(http.StatusBadRequest, "InvalidParameter", "creationData of snapshot %s is missing", req.segments[1])
+		}
+		sourceSize, err := s.sourceSizeGB(model.Properties.CreationData)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot != nil && !strings.EqualFold(ptr.Deref(snapshot.Properties.CreationData.SourceResourceID, ""), ptr.Deref(model.Properties.CreationData.SourceResourceID, "")) {
+			return nil, newError(http.StatusConflict, "OperationNotAllowed", "Snapshot %s already exists with a different source, it can not be created from another existing disk or snapshot.", req.segments[1])
+		}
+		model.ID = ptr.To(id)
+		model.Name = ptr.To(req.segments[1])
+		model.Type = ptr.To("Microsoft.Compute/snapshots")
+		if model.Location == nil {
+			model.Location = ptr.To(s.location)
+		}
+		model.Properties.DiskSizeGB = sourceSize
+		model.Properties.ProvisioningState = ptr.To(provisioningStateSucceeded)
+		model.Properties.TimeCreated = ptr.To(time.Now().UTC())
+		model.Properties.CompletionPercent = ptr.To(float32(100))
+		s.snapshots[key] = &model
+		return &model, nil
+	case http.MethodDelete:
+		delete(s.snapshots, key)
+		return nil, nil
+	}
+	return nil, methodNotAllowed(req)
+}
+
+func (s *Server) serveVM(req *request) (interface{}, *armError) {
+	if len(req.segments) == 1 {
+		if req.method != http.MethodGet {
+			return nil, methodNotAllowed(req)
+		}
+		return sortedValues(s.vms, strings.ToLower(req.resourceID(1))+"/"), nil
+	}
+	id := req.resourceID(2)
+	vm := s.vms[strings.ToLower(id)]
+	if vm == nil {
+		return nil, notFound("Microsoft.Compute/virtualMachines", req.segments[1])
+	}
+	if len(req.segments) == 3 {
+		switch {
+		case req.method == http.MethodGet && strings.EqualFold(req.segments[2], "instanceView"):
+			return vm.Properties.InstanceView, nil
+		case req.method == http.MethodPost && strings.EqualFold(req.segments[2], "attachDetachDataDisks"):
+			var request armcompute.AttachDetachDataDisksRequest
+			if err := req.unmarshal(&request); err != nil {
+				return nil, err
+			}
+			dataDisks, err := s.attachDetach(id, vm.Properties.StorageProfile.DataDisks, &request, maxDataDiskCount(s.skus, vm.Properties.HardwareProfile.VMSize))
+			if err != nil {
+				return nil, err
+			}
+			vm.Properties.StorageProfile.DataDisks = dataDisks
+			return vm.Properties.StorageProfile, nil
+		}
+		return nil, methodNotAllowed(req)
+	}
+	switch req.method {
+	case http.MethodGet:
+		return vm, nil
+	case http.MethodPut, http.MethodPatch:
+		var update armcompute.VirtualMachine
+		if err := req.unmarshal(&update); err != nil {
+			return nil, err
+		}
+		if update.Properties != nil && update.Properties.StorageProfile != nil && update.Properties.StorageProfile.DataDisks != nil {
+			dataDisks, err := s.updateDataDisks(id, vm.Properties.StorageProfile.DataDisks, update.Properties.StorageProfile.DataDisks, maxDataDiskCount(s.skus, vm.Properties.HardwareProfile.VMSize))
+			if err != nil {
+				return nil, err
+			}
+			vm.Properties.StorageProfile.DataDisks = dataDisks
+		}
+		return vm, nil
+	}
+	return nil, methodNotAllowed(req)
+}
+
+func (s *Server) serveScaleSet(req *request) (interface{}, *armError) {
+	if len(req.segments) == 1 {
+		if req.method != http.MethodGet {
+			return nil, methodNotAllowed(req)
+		}
+		return sortedValues(s.scaleSets, strings.ToLower(req.resourceID(1))+"/"), nil
+	}
+	scaleSetID := req.resourceID(2)
+	scaleSet := s.scaleSets[strings.ToLower(scaleSetID)]
+	if scaleSet == nil {
+		return nil, notFound("Microsoft.Compute/virtualMachineScaleSets", req.segments[1])
+	}
+	if len(req.segments) == 2 {
+		if req.method != http.MethodGet {
+			return nil, methodNotAllowed(req)
+		}
+		return scaleSet, nil
+	}
+	if !strings.EqualFold(req.segments[2], "virtualMachines") {
+		return nil, methodNotAllowed(req)
+	}
+	if len(req.segments) == 3 {
+		if req.method != http.MethodGet {
+			return nil, methodNotAllowed(req)
+		}
+		return sortedValues(s.scaleSetVM, strings.ToLower(req.resourceID(3))+"/"), nil
+	}
+	id := req.resourceID(4)
+	vm := s.scaleSetVM[strings.ToLower(id)]
+	if vm == nil {
+		return nil, notFound("Microsoft.Compute/virtualMachineScaleSets/virtualMachines", req.segments[3])
+	}
+	maxDataDisks := maxDataDiskCount(s.skus, ptr.To(armcompute.VirtualMachineSizeTypes(ptr.Deref(vm.SKU.Name, ""))))
+	if len(req.segments) == 5 {
+		switch {
+		case req.method == http.MethodGet && strings.EqualFold(req.segments[4], "instanceView"):
+			return vm.Properties.InstanceView, nil
+		case req.method == http.MethodPost && strings.EqualFold(req.segments[4], "attachDetachDataDisks"):
+			var request armcompute.AttachDetachDataDisksRequest
+			if err := req.unmarshal(&request); err != nil {
+				return nil, err
+			}
+			dataDisks, err := s.attachDetach(id, vm.Properties.StorageProfile.DataDisks, &request, maxDataDisks)
+			if err != nil {
+				return nil, err
+			}
+			vm.Properties.StorageProfile.DataDisks = dataDisks
+			return vm.Properties.StorageProfile, nil
+		}
+		return nil, methodNotAllowed(req)
+	}
+	switch req.method {
+	case http.MethodGet:
+		return vm, nil
+	case http.MethodPut, http.MethodPatch:
+		var update armcompute.VirtualMachineScaleSetVM
+		if err := req.unmarshal(&update); err != nil {
+			return nil, err
+		}
+		if update.Properties != nil && update.Properties.StorageProfile != nil && update.Properties.StorageProfile.DataDisks != nil {
+			dataDisks, err := s.updateDataDisks(id, vm.Properties.StorageProfile.DataDisks, update.Properties.StorageProfile.DataDisks, maxDataDisks)
+			if err != nil {
+				return nil, err
+			}
+			vm.Properties.StorageProfile.DataDisks = dataDisks
+		}
+		return vm, nil
+	}
+	return nil, methodNotAllowed(req)
+}
+
+// attachDetach applies an attachDetachDataDisks request to the data disks of a VM
+func (s *Server) attachDetach(vmID string, current []*armcompute.DataDisk, request *armcompute.AttachDetachDataDisksRequest, maxDataDisks int) ([]*armcompute.DataDisk, *armError) {
+	requested := make([]*armcompute.DataDisk, 0, len(current)+len(request.DataDisksToAttach))
+	for _, disk := range current {
+		copied := *disk
+		for _, detach := range request.DataDisksToDetach {
+			if disk.ManagedDisk != nil && strings.EqualFold(ptr.Deref(disk.ManagedDisk.ID, ""), ptr.Deref(detach.DiskID, "")) {
+				copied.ToBeDetached = ptr.To(true)
+			}
+		}
+		requested = append(requested, &copied)
+	}
+	for _, attach := range request.DataDisksToAttach {
+		requested = append(requested, &armcompute.DataDisk{
+			Lun:                     attach.Lun,
+			Caching:                 attach.Caching,
+			CreateOption:            ptr.To(armcompute.DiskCreateOptionTypesAttach),
+			ManagedDisk:             &armcompute.ManagedDiskParameters{ID: attach.DiskID, DiskEncryptionSet: attach.DiskEncryptionSet},
+			WriteAcceleratorEnabled: attach.WriteAcceleratorEnabled,
+			DeleteOption:            attach.DeleteOption,
+		})
+	}
+	return s.updateDataDisks(vmID, current, requested, maxDataDisks)
+}
+
+// updateDataDisks validates the requested data disks of a VM and updates the state of the disks:
+// disks which are marked ToBeDetached or left out are detached, the others are attached.
+func (s *Server) updateDataDisks(vmID string, current, requested []*armcompute.DataDisk, maxDataDisks int) ([]*armcompute.DataDisk, *armError) {
+	result := make([]*armcompute.DataDisk, 0, len(requested))
+	attached := map[string]*armcompute.Disk{}
+	luns := map[int32]bool{}
+	for _, dataDisk := range requested {
+		if ptr.Deref(dataDisk.ToBeDetached, false) {
+			continue
+		}
+		if dataDisk.ManagedDisk == nil || ptr.Deref(dataDisk.ManagedDisk.ID, "") == "" {
+			return nil, newError(http.StatusBadRequest, "InvalidParameter", "only managed data disks are supported")
+		}
+		if dataDisk.Lun == nil {
+			return nil, newError(http.StatusBadRequest, "InvalidParameter", "lun of data disk %s is missing", *dataDisk.ManagedDisk.ID)
+		}
+		if luns[*dataDisk.Lun] {
+			return nil, newError(http.StatusConflict, "InvalidParameter", "Two disks are specified with the same LUN: %d.", *dataDisk.Lun)
+		}
+		luns[*dataDisk.Lun] = true
+		diskKey := strings.ToLower(*dataDisk.ManagedDisk.ID)
+		disk := s.disks[diskKey]
+		if disk == nil {
+			return nil, newError(http.StatusNotFound, "NotFound", "Disk %s is not found.", *dataDisk.ManagedDisk.ID)
+		}
+		if !isManagedBy(disk, vmID) && ptr.Deref(disk.ManagedBy, "") != "" && ptr.Deref(disk.Properties.MaxShares, 1) <= 1 {
+			return nil, newError(http.StatusConflict, "OperationNotAllowed", "Cannot attach data disk '%s' to VM '%s' because the disk is currently being attached to VM '%s'.",
+				*disk.Name, vmID, *disk.ManagedBy)
+		}
+		copied := *dataDisk
+		copied.Name = disk.Name
+		copied.DiskSizeGB = disk.Properties.DiskSizeGB
+		copied.CreateOption = ptr.To(armcompute.DiskCreateOptionTypesAttach)
+		copied.ManagedDisk = &armcompute.ManagedDiskParameters{ID: disk.ID, DiskEncryptionSet: dataDisk.ManagedDisk.DiskEncryptionSet}
+		if disk.SKU != nil && disk.SKU.Name != nil {
+			copied.ManagedDisk.StorageAccountType = ptr.To(armcompute.StorageAccountTypes(*disk.SKU.Name))
+		}
+		copied.ToBeDetached = nil
+		copied.DetachOption = nil
+		result = append(result, &copied)
+		attached[diskKey] = disk
+	}
+	if len(result) > maxDataDisks {
+		return nil, newError(http.StatusConflict, "OperationNotAllowed", "The maximum number of data disks allowed to be attached to a VM of this size is %d.", maxDataDisks)
+	}
+
+	for _, dataDisk := range current {
+		if dataDisk.ManagedDisk == nil || dataDisk.ManagedDisk.ID == nil {
+			continue
+		}
+		diskKey := strings.ToLower(*dataDisk.ManagedDisk.ID)
+		if disk := s.disks[diskKey]; disk != nil && attached[diskKey] == nil {
+			setDetached(disk, vmID)
+		}
+	}
+	for _, disk := range attached {
+		setAttached(disk, vmID)
+	}
+	return result, nil
+}
+
+func isManagedBy(disk *armcompute.Disk, vmID string) bool {
+	if strings.EqualFold(ptr.Deref(disk.ManagedBy, ""), vmID) {
+		return true
+	}
+	for _, id := range disk.ManagedByExtended {
+		if strings.EqualFold(ptr.Deref(id, ""), vmID) {
+			return true
+		}
+	}
+	return false
+}
+
+func setAttached(disk *armcompute.Disk, vmID string) {
+	if isManagedBy(disk, vmID) {
+		return
+	}
+	if ptr.Deref(disk.ManagedBy, "") == "" {
+		disk.ManagedBy = ptr.To(vmID)
+	} else {
+		disk.ManagedByExtended = append(disk.ManagedByExtended, ptr.To(vmID))
+	}
+	disk.Properties.DiskState = ptr.To(armcompute.DiskStateAttached)
+}
+
+func setDetached(disk *armcompute.Disk, vmID string) {
+	extended := make([]*string, 0, len(disk.ManagedByExtended))
+	for _, id := range disk.ManagedByExtended {
+		if !strings.EqualFold(ptr.Deref(id, ""), vmID) {
+			extended = append(extended, id)
+		}
+	}
+	disk.ManagedByExtended = extended
+	if strings.EqualFold(ptr.Deref(disk.ManagedBy, ""), vmID) {
+		disk.ManagedBy = nil
+		if len(extended) > 0 {
+			disk.ManagedBy, disk.ManagedByExtended = extended[0], extended[1:]
+		}
+	}
+	if disk.ManagedBy == nil {
+		disk.Properties.DiskState = ptr.To(armcompute.DiskStateUnattached)
+	}
+}
+
+// AddVirtualMachine adds a running VM without data disks, an empty vmSize means DefaultVMSize
+func (s *Server) AddVirtualMachine(subscriptionID, resourceGroup, name, vmSize string) {
+	if vmSize == "" {
+		vmSize = DefaultVMSize
+	}
+	id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", subscriptionID, resourceGroup, name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vms[strings.ToLower(id)] = &armcompute.VirtualMachine{
+		ID:       ptr.To(id),
+		Name:     ptr.To(name),
+		Type:     ptr.To("Microsoft.Compute/virtualMachines"),
+		Location: ptr.To(s.location),
+		Properties: &armcompute.VirtualMachineProperties{
+			HardwareProfile:   &armcompute.HardwareProfile{VMSize: ptr.To(armcompute.VirtualMachineSizeTypes(vmSize))},
+			OSProfile:         &armcompute.OSProfile{ComputerName: ptr.To(name)},
+			StorageProfile:    newStorageProfile(name),
+			ProvisioningState: ptr.To(provisioningStateSucceeded),
+			InstanceView:      &armcompute.VirtualMachineInstanceView{Statuses: runningStatuses()},
+		},
+	}
+}
+
+// AddVirtualMachineScaleSetVM adds a running VMSS VM whose computer name is nodeName, the scale set is
+// created if it does not exist. An empty vmSize means DefaultVMSize.
+func (s *Server) AddVirtualMachineScaleSetVM(subscriptionID, resourceGroup, scaleSetName, instanceID, nodeName, vmSize string) {
+	if vmSize == "" {
+		vmSize = DefaultVMSize
+	}
+	scaleSetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s", subscriptionID, resourceGroup, scaleSetName)
+	id := fmt.Sprintf("%s/virtualMachines/%s", scaleSetID, instanceID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scaleSets[strings.ToLower(scaleSetID)] == nil {
+		s.scaleSets[strings.ToLower(scaleSetID)] = &armcompute.VirtualMachineScaleSet{
+			ID:       ptr.To(scaleSetID),
+			Name:     ptr.To(scaleSetName),
+			Type:     ptr.To("Microsoft.Compute/virtualMachineScaleSets"),
+			Location: ptr.To(s.location),
+			SKU:      &armcompute.SKU{Name: ptr.To(vmSize)},
+			Properties: &armcompute.VirtualMachineScaleSetProperties{
+				OrchestrationMode: ptr.To(armcompute.OrchestrationModeUniform),
+				ProvisioningState: ptr.To(provisioningStateSucceeded),
+			},
+		}
+	}
+	s.scaleSetVM[strings.ToLower(id)] = &armcompute.VirtualMachineScaleSetVM{
+		ID:         ptr.To(id),
+		Name:       ptr.To(fmt.Sprintf("%s_%s", scaleSetName, instanceID)),
+		Type:       ptr.To("Microsoft.Compute/virtualMachineScaleSets/virtualMachines"),
+		Location:   ptr.To(s.location),
+		InstanceID: ptr.To(instanceID),
+		SKU:        &armcompute.SKU{Name: ptr.To(vmSize)},
+		Properties: &armcompute.VirtualMachineScaleSetVMProperties{
+			OSProfile:         &armcompute.OSProfile{ComputerName: ptr.To(nodeName)},
+			StorageProfile:    newStorageProfile(nodeName),
+			ProvisioningState: ptr.To(provisioningStateSucceeded),
+			InstanceView:      &armcompute.VirtualMachineScaleSetVMInstanceView{Statuses: runningStatuses()},
+		},
+	}
+}
+
+// Disk returns a copy of a disk, nil if it does not exist
+func (s *Server) Disk(diskURI string) *armcompute.Disk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	disk := s.disks[strings.ToLower(diskURI)]
+	if disk == nil {
+		return nil
+	}
+	copied := *disk
+	return &copied
+}
+
+func newStorageProfile(name string) *armcompute.StorageProfile {
+	return &armcompute.StorageProfile{
+		OSDisk: &armcompute.OSDisk{
+			Name:         ptr.To(name + "_OsDisk"),
+			OSType:       ptr.To(armcompute.OperatingSystemTypesLinux),
+			CreateOption: ptr.To(armcompute.DiskCreateOptionTypesFromImage),
+		},
+		DataDisks: []*armcompute.DataDisk{},
+	}
+}
+
+func runningStatuses() []*armcompute.InstanceViewStatus {
+	return []*armcompute.InstanceViewStatus{
+		{Code: ptr.To("ProvisioningState/succeeded")},
+		{Code: ptr.To("PowerState/running")},
+	}
+}
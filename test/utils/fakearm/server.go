@@ -0,0 +1,259 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakearm is an in-memory stand-in for the Azure Resource Manager endpoints the driver uses:
+// disks, snapshots, the data disks of VMs and VMSS VMs, and resource SKUs. Point the driver at it
+// with --enable-traffic-manager and --traffic-manager-port, the cloud config of CloudConfig and the
+// managed identity environment of IdentityEnv, which makes the driver take its token from the server.
+package fakearm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultVMSize is the size of the VMs added without a size
+	DefaultVMSize = "Standard_D4s_v3"
+
+	// IdentityHeader is the secret of the managed identity endpoint
+	IdentityHeader = "fakearm"
+
+	providerPath  = "providers/microsoft.compute"
+	tokenEndpoint = "msi/token"
+)
+
+// Server serves the ARM endpoints of disks, snapshots, VMs, VMSS VMs and resource SKUs from memory
+type Server struct {
+	mu       sync.Mutex
+	location string
+	// resources by lower case resource ID
+	disks      map[string]*armcompute.Disk
+	snapshots  map[string]*armcompute.Snapshot
+	vms        map[string]*armcompute.VirtualMachine
+	scaleSets  map[string]*armcompute.VirtualMachineScaleSet
+	scaleSetVM map[string]*armcompute.VirtualMachineScaleSetVM
+	skus       []*armcompute.ResourceSKU
+}
+
+// NewServer returns an empty Server whose resources are in location
+func NewServer(location string) *Server {
+	return &Server{
+		location:   location,
+		disks:      map[string]*armcompute.Disk{},
+		snapshots:  map[string]*armcompute.Snapshot{},
+		vms:        map[string]*armcompute.VirtualMachine{},
+		scaleSets:  map[string]*armcompute.VirtualMachineScaleSet{},
+		scaleSetVM: map[string]*armcompute.VirtualMachineScaleSetVM{},
+		skus:       defaultSKUs(location),
+	}
+}
+
+// armError is the error body of ARM
+type armError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newError(status int, code, format string, args ...interface{}) *armError {
+	return &armError{status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(resourceType, id string) *armError {
+	return newError(http.StatusNotFound, "ResourceNotFound", "The Resource '%s' under resource type '%s' was not found.", id, resourceType)
+}
+
+// request is a parsed ARM request path
+type request struct {
+	method         string
+	subscriptionID string
+	resourceGroup  string
+	// segments after /providers/Microsoft.Compute/, in their original case
+	segments []string
+	body     []byte
+}
+
+// resourceID returns the ID of the resource named by the first n segments
+func (r *request) resourceID(n int) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/%s", r.subscriptionID, r.resourceGroup, strings.Join(r.segments[:n], "/"))
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, newError(http.StatusBadRequest, "InvalidRequestContent", "%v", err))
+		return
+	}
+	klog.V(4).Infof("fakearm: %s %s %s", r.Method, r.URL.Path, string(body))
+
+	path := strings.Trim(r.URL.Path, "/")
+	if strings.EqualFold(path, "metadata/endpoints") {
+		s.serveMetadata(w, r)
+		return
+	}
+	if path == tokenEndpoint {
+		s.serveToken(w, r)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	lower := strings.ToLower(path)
+	req := &request{method: r.Method, body: body}
+	switch {
+	case len(parts) >= 2 && strings.EqualFold(parts[0], "subscriptions"):
+		req.subscriptionID = parts[1]
+	default:
+		writeError(w, newError(http.StatusNotFound, "NotFound", "path %s is not supported", r.URL.Path))
+		return
+	}
+
+	var result interface{}
+	var armErr *armError
+	switch {
+	case strings.HasPrefix(lower, fmt.Sprintf("subscriptions/%s/%s/skus", strings.ToLower(req.subscriptionID), providerPath)):
+		result, armErr = s.listSKUs()
+	case len(parts) >= 6 && strings.EqualFold(parts[2], "resourceGroups") && strings.EqualFold(parts[4], "providers") && strings.EqualFold(parts[5], "Microsoft.Compute"):
+		req.resourceGroup = parts[3]
+		req.segments = parts[6:]
+		result, armErr = s.serveCompute(req)
+	default:
+		armErr = newError(http.StatusNotFound, "NotFound", "path %s is not supported", r.URL.Path)
+	}
+	if armErr != nil {
+		writeError(w, armErr)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// serveCompute dispatches a request under /resourceGroups/{rg}/providers/Microsoft.Compute
+func (s *Server) serveCompute(req *request) (interface{}, *armError) {
+	if len(req.segments) == 0 {
+		return nil, newError(http.StatusNotFound, "NotFound", "resource type missing")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToLower(req.segments[0]) {
+	case "disks":
+		return s.serveDisk(req)
+	case "snapshots":
+		return s.serveSnapshot(req)
+	case "virtualmachines":
+		return s.serveVM(req)
+	case "virtualmachinescalesets":
+		return s.serveScaleSet(req)
+	}
+	return nil, newError(http.StatusNotFound, "NotFound", "resource type %s is not supported", req.segments[0])
+}
+
+// serveMetadata answers the endpoint discovery of the SDK, so that ARM requests come back to this server
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request) {
+	endpoint := fmt.Sprintf("http://%s/", r.Host)
+	writeJSON(w, http.StatusOK, []map[string]interface{}{
+		{
+			"name":            "AzurePublicCloud",
+			"resourceManager": endpoint,
+			"authentication": map[string]interface{}{
+				"audiences": []string{endpoint},
+			},
+		},
+	})
+}
+
+// serveToken answers the token requests of an App Service managed identity
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-IDENTITY-HEADER") != IdentityHeader {
+		writeError(w, newError(http.StatusUnauthorized, "Unauthorized", "X-IDENTITY-HEADER is missing or invalid"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "fakearm",
+		"expires_on":   strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10),
+		"resource":     r.URL.Query().Get("resource"),
+		"token_type":   "Bearer",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, newError(http.StatusInternalServerError, "InternalServerError", "%v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, err *armError) {
+	data, _ := json.Marshal(map[string]*armError{"error": err})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("x-ms-error-code", err.Code)
+	w.WriteHeader(err.status)
+	_, _ = w.Write(data)
+}
+
+// unmarshal decodes the request body into v
+func (r *request) unmarshal(v interface{}) *armError {
+	if err := json.Unmarshal(r.body, v); err != nil {
+		return newError(http.StatusBadRequest, "InvalidRequestContent", "%v", err)
+	}
+	return nil
+}
+
+func methodNotAllowed(req *request) *armError {
+	return newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "%s %s is not supported", req.method, strings.Join(req.segments, "/"))
+}
+
+// CloudConfig returns a cloud config for the server, the driver has to be started with --enable-traffic-manager
+// and --traffic-manager-port set to the port of the server
+func CloudConfig(subscriptionID, resourceGroup, location, vmType string) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"cloud":                       "AzurePublicCloud",
+		"subscriptionId":              subscriptionID,
+		"resourceGroup":               resourceGroup,
+		"location":                    location,
+		"vmType":                      vmType,
+		"useInstanceMetadata":         false,
+		"useManagedIdentityExtension": true,
+	})
+	return string(data)
+}
+
+// IdentityEnv returns the environment variables which make the managed identity of the driver take its
+// token from the server at url
+func IdentityEnv(url string) map[string]string {
+	return map[string]string{
+		"IDENTITY_ENDPOINT": strings.TrimSuffix(url, "/") + "/" + tokenEndpoint,
+		"IDENTITY_HEADER":   IdentityHeader,
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakearm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/azuredisk-csi-driver/pkg/azuredisk"
+)
+
+const (
+	subscriptionID = "subs"
+	resourceGroup  = "rg"
+	location       = "eastus"
+)
+
+func do(t *testing.T, url, method, path string, body interface{}) (int, map[string]interface{}) {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req, err := http.NewRequest(method, url+path, bytes.NewReader(data))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	result := map[string]interface{}{}
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(location)
+	s.AddVirtualMachine(subscriptionID, resourceGroup, "vm", "Standard_D2s_v3")
+	server := httptest.NewServer(s)
+	defer server.Close()
+	base := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute", subscriptionID, resourceGroup)
+	diskID := func(name string) string { return fmt.Sprintf("%s/disks/%s", base, name) }
+
+	status, _ := do(t, server.URL, http.MethodGet, base+"/disks/missing", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	for i := 0; i < 5; i++ {
+		status, disk := do(t, server.URL, http.MethodPut, fmt.Sprintf("%s/disks/disk%d", base, i), armcompute.Disk{
+			Properties: &armcompute.DiskProperties{DiskSizeGB: ptr.To(int32(10)), CreationData: &armcompute.CreationData{CreateOption: ptr.To(armcompute.DiskCreateOptionEmpty)}},
+		})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, diskID(fmt.Sprintf("disk%d", i)), disk["id"])
+	}
+
+	// a copy of a missing disk fails
+	status, _ = do(t, server.URL, http.MethodPut, base+"/disks/copy", armcompute.Disk{
+		Properties: &armcompute.DiskProperties{CreationData: &armcompute.CreationData{CreateOption: ptr.To(armcompute.DiskCreateOptionCopy), SourceResourceID: ptr.To(diskID("missing"))}},
+	})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	dataDisk := func(lun int32, name string) *armcompute.DataDisk {
+		return &armcompute.DataDisk{Lun: ptr.To(lun), ManagedDisk: &armcompute.ManagedDiskParameters{ID: ptr.To(diskID(name))}}
+	}
+	vm := func(dataDisks ...*armcompute.DataDisk) armcompute.VirtualMachine {
+		return armcompute.VirtualMachine{Properties: &armcompute.VirtualMachineProperties{StorageProfile: &armcompute.StorageProfile{DataDisks: dataDisks}}}
+	}
+	status, _ = do(t, server.URL, http.MethodPut, base+"/virtualMachines/vm", vm(dataDisk(0, "disk0"), dataDisk(0, "disk1")))
+	assert.Equal(t, http.StatusConflict, status, "duplicate LUN")
+	status, body := do(t, server.URL, http.MethodPut, base+"/virtualMachines/vm", vm(dataDisk(0, "disk0"), dataDisk(1, "disk1"), dataDisk(2, "disk2"), dataDisk(3, "disk3"), dataDisk(4, "disk4")))
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Contains(t, fmt.Sprint(body["error"]), "The maximum number of data disks allowed to be attached to a VM of this size is 4.")
+
+	status, _ = do(t, server.URL, http.MethodPut, base+"/virtualMachines/vm", vm(dataDisk(0, "disk0")))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, armcompute.DiskStateAttached, *s.Disk(diskID("disk0")).Properties.DiskState)
+	status, _ = do(t, server.URL, http.MethodDelete, base+"/disks/disk0", nil)
+	assert.Equal(t, http.StatusConflict, status, "attached disks can not be deleted")
+
+	detached := dataDisk(0, "disk0")
+	detached.ToBeDetached = ptr.To(true)
+	status, _ = do(t, server.URL, http.MethodPut, base+"/virtualMachines/vm", vm(detached))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, s.Disk(diskID("disk0")).ManagedBy)
+	status, _ = do(t, server.URL, http.MethodDelete, base+"/disks/disk0", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, s.Disk(diskID("disk0")))
+
+	s.AddVirtualMachineScaleSetVM(subscriptionID, resourceGroup, "vmss", "0", "node", "")
+	status, _ = do(t, server.URL, http.MethodPost, base+"/virtualMachineScaleSets/vmss/virtualMachines/0/attachDetachDataDisks", armcompute.AttachDetachDataDisksRequest{
+		DataDisksToAttach: []*armcompute.DataDisksToAttach{{DiskID: ptr.To(diskID("disk1")), Lun: ptr.To(int32(3))}},
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, armcompute.DiskStateAttached, *s.Disk(diskID("disk1")).Properties.DiskState)
+	status, _ = do(t, server.URL, http.MethodPut, base+"/virtualMachines/vm", vm(dataDisk(0, "disk1")))
+	assert.Equal(t, http.StatusConflict, status, "disk attached to another VM")
+	status, body = do(t, server.URL, http.MethodGet, base+"/virtualMachineScaleSets/vmss/virtualMachines", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, body["value"], 1)
+
+	status, body = do(t, server.URL, http.MethodGet, fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Compute/skus", subscriptionID), nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, body["value"], len(vmSizes)+len(diskSKUs))
+}
+
+// TestDriver runs the controller of the driver against the server
+func TestDriver(t *testing.T) {
+	s := NewServer(location)
+	s.AddVirtualMachine(subscriptionID, resourceGroup, "node", "")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(s)
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	dir := t.TempDir()
+	cloudConfig := filepath.Join(dir, "azure.json")
+	require.NoError(t, os.WriteFile(cloudConfig, []byte(CloudConfig(subscriptionID, resourceGroup, location, "standard")), 0600))
+	t.Setenv("AZURE_CREDENTIAL_FILE", cloudConfig)
+	for k, v := range IdentityEnv(server.URL) {
+		t.Setenv(k, v)
+	}
+
+	options := azuredisk.DriverOptions{}
+	options.AddFlags()
+	options.DriverName = "test.disk.csi.azure.com"
+	options.Kubeconfig = filepath.Join(dir, "missing-kubeconfig")
+	options.EnableTrafficManager = true
+	options.TrafficManagerPort = int64(listener.Addr().(*net.TCPAddr).Port)
+	d := azuredisk.NewDriver(&options)
+
+	ctx := context.Background()
+	capabilities := []*csi.VolumeCapability{{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}}
+	created, err := d.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               "pvc-disk",
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: 10 << 30},
+		VolumeCapabilities: capabilities,
+		Parameters:         map[string]string{"skuName": "Premium_LRS", "resourceGroup": resourceGroup},
+	})
+	require.NoError(t, err)
+	volumeID := created.Volume.VolumeId
+	assert.Equal(t, fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/disks/pvc-disk", subscriptionID, resourceGroup), volumeID)
+
+	published, err := d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{VolumeId: volumeID, NodeId: "node", VolumeCapability: capabilities[0]})
+	require.NoError(t, err)
+	assert.Equal(t, "0", published.PublishContext["LUN"])
+	assert.Equal(t, armcompute.DiskStateAttached, *s.Disk(volumeID).Properties.DiskState)
+
+	snapshot, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{SourceVolumeId: volumeID, Name: "snapshot", Parameters: map[string]string{"resourceGroup": resourceGroup}})
+	require.NoError(t, err)
+	assert.True(t, snapshot.Snapshot.ReadyToUse)
+	assert.Equal(t, int64(10<<30), snapshot.Snapshot.SizeBytes)
+
+	expanded, err := d.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{VolumeId: volumeID, CapacityRange: &csi.CapacityRange{RequiredBytes: 20 << 30}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(20<<30), expanded.CapacityBytes)
+
+	_, err = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: volumeID, NodeId: "node"})
+	require.NoError(t, err)
+	assert.Equal(t, armcompute.DiskStateUnattached, *s.Disk(volumeID).Properties.DiskState)
+
+	_, err = d.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snapshot.Snapshot.SnapshotId})
+	require.NoError(t, err)
+	_, err = d.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volumeID})
+	require.NoError(t, err)
+	assert.Nil(t, s.Disk(volumeID))
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakearm
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v6"
+	"k8s.io/utils/ptr"
+)
+
+// defaultMaxDataDiskCount is the data disk limit of VM sizes without SKU
+const defaultMaxDataDiskCount = 8
+
+// vmSizes are the VM sizes served as resource SKUs with their MaxDataDiskCount
+var vmSizes = map[string]int{
+	"Standard_D2s_v3":  4,
+	"Standard_D4s_v3":  8,
+	"Standard_D8s_v3":  16,
+	"Standard_DS2_v2":  8,
+	"Standard_DS3_v2":  16,
+	"Standard_E16s_v3": 32,
+}
+
+// diskSKUs are the disk SKUs served as resource SKUs with their MaxSizeGiB
+var diskSKUs = map[string]int{
+	"Standard_LRS":    32767,
+	"Premium_LRS":     32767,
+	"StandardSSD_LRS": 32767,
+	"UltraSSD_LRS":    65536,
+	"PremiumV2_LRS":   65536,
+	"Premium_ZRS":     32767,
+	"StandardSSD_ZRS": 32767,
+}
+
+func defaultSKUs(location string) []*armcompute.ResourceSKU {
+	skus := make([]*armcompute.ResourceSKU, 0, len(vmSizes)+len(diskSKUs))
+	for name, count := range vmSizes {
+		skus = append(skus, &armcompute.ResourceSKU{
+			Name:         ptr.To(name),
+			ResourceType: ptr.To("virtualMachines"),
+			Locations:    []*string{ptr.To(location)},
+			Capabilities: []*armcompute.ResourceSKUCapabilities{
+				{Name: ptr.To("MaxDataDiskCount"), Value: ptr.To(strconv.Itoa(count))},
+			},
+		})
+	}
+	for name, size := range diskSKUs {
+		skus = append(skus, &armcompute.ResourceSKU{
+			Name:         ptr.To(name),
+			ResourceType: ptr.To("disks"),
+			Locations:    []*string{ptr.To(location)},
+			Capabilities: []*armcompute.ResourceSKUCapabilities{
+				{Name: ptr.To("MaxSizeGiB"), Value: ptr.To(strconv.Itoa(size))},
+			},
+		})
+	}
+	sort.Slice(skus, func(i, j int) bool { return *skus[i].Name < *skus[j].Name })
+	return skus
+}
+
+func (s *Server) listSKUs() (interface{}, *armError) {
+	return list[*armcompute.ResourceSKU]{Value: s.skus}, nil
+}
+
+// maxDataDiskCount returns the MaxDataDiskCount capability of a VM size
+func maxDataDiskCount(skus []*armcompute.ResourceSKU, vmSize *armcompute.VirtualMachineSizeTypes) int {
+	if vmSize == nil {
+		return defaultMaxDataDiskCount
+	}
+	for _, sku := range skus {
+		if ptr.Deref(sku.ResourceType, "") != "virtualMachines" || !strings.EqualFold(ptr.Deref(sku.Name, ""), string(*vmSize)) {
+			continue
+		}
+		for _, capability := range sku.Capabilities {
+			if strings.EqualFold(ptr.Deref(capability.Name, ""), "MaxDataDiskCount") {
+				if count, err := strconv.Atoi(ptr.Deref(capability.Value, "")); err == nil {
+					return count
+				}
+			}
+		}
+	}
+	return defaultMaxDataDiskCount
+}